@@ -0,0 +1,83 @@
+// Command emails reports users whose emails collide once normalized and,
+// with --apply, fills the email_normalized column users are looked up by
+//
+// Run it before migration 16 to find collisions that would fail the unique
+// index, resolve them by hand, then run it with --apply after the migration.
+// The service refuses to start until every stored form is up to date, so run
+// it with --apply after changing email.fold_local_part as well
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nhassl3/sso/internal/config"
+	"github.com/nhassl3/sso/internal/lib/emailaddr"
+	"github.com/nhassl3/sso/internal/storage"
+	"github.com/nhassl3/sso/internal/storage/sqlite"
+)
+
+func main() {
+	var apply bool
+
+	flag.BoolVar(&apply, "apply", false, "write normalized emails, otherwise only report collisions")
+
+	// parses the flags as well
+	cfg := config.MustLoad()
+
+	st, err := sqlite.New(cfg.StoragePath)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx := context.Background()
+
+	emails, err := st.UserEmails(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	normalizer := emailaddr.Normalizer{FoldLocalPart: cfg.Email.FoldLocalPart}
+
+	collisions, invalid := normalizer.Collisions(emails)
+
+	for _, id := range invalid {
+		fmt.Printf("invalid email of user %d: %q\n", id, emails[id])
+	}
+
+	for _, c := range collisions {
+		fmt.Printf("%s is shared by:\n", c.Normalized)
+
+		for _, id := range c.IDs {
+			fmt.Printf("\tuser %d: %q\n", id, emails[id])
+		}
+	}
+
+	fmt.Printf("%d users, %d collisions, %d invalid emails\n", len(emails), len(collisions), len(invalid))
+
+	if !apply {
+		return
+	}
+
+	if len(collisions) > 0 || len(invalid) > 0 {
+		fmt.Println("resolve collisions and invalid emails first, nothing written")
+		os.Exit(1)
+	}
+
+	// emails are read again along with the write, so users registered
+	// or changed since the report get the right form as well
+	updated, err := st.NormalizeEmails(ctx, normalizer.Normalize)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserExists) || errors.Is(err, emailaddr.ErrInvalid) {
+			fmt.Println("emails changed concurrently, run again")
+			os.Exit(1)
+		}
+
+		panic(err)
+	}
+
+	fmt.Printf("normalized emails of %d users written\n", updated)
+}
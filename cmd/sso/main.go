@@ -25,9 +25,11 @@ func main() {
 
 	log.Info("starting application", slog.String("InformationLevel", cfg.Env))
 
-	application := app.New(log, cfg.GRPC.Port, cfg.StoragePath, cfg.TokenTTL)
+	application := app.New(log, cfg)
 
 	go application.GRPCServer.MustRun() // panic when errors occurs
+	go application.HTTPServer.MustRun()
+	go application.Scheduler.Run()
 
 	// Graceful shutdown
 	stop := make(chan os.Signal, 1)
@@ -37,6 +39,8 @@ func main() {
 	log.Info("stopping application", slog.String("signal", sign.String()))
 
 	application.GRPCServer.Stop()
+	application.HTTPServer.Stop()
+	application.Scheduler.Stop()
 	log.Info("application stopped")
 }
 
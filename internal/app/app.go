@@ -1,10 +1,27 @@
 package app
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
 	"log/slog"
-	"time"
 
+	"github.com/nhassl3/sso/internal/app/httpapp"
+	"github.com/nhassl3/sso/internal/app/scheduler"
+	"github.com/nhassl3/sso/internal/config"
+	"github.com/nhassl3/sso/internal/lib/crypt"
+	"github.com/nhassl3/sso/internal/lib/emailaddr"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	"github.com/nhassl3/sso/internal/lib/mailer"
+	"github.com/nhassl3/sso/internal/lib/password"
+	"github.com/nhassl3/sso/internal/lib/ratelimit"
+	"github.com/nhassl3/sso/internal/lib/webauthn"
+	"github.com/nhassl3/sso/internal/services/authorization"
+	"github.com/nhassl3/sso/internal/services/keys"
+	"github.com/nhassl3/sso/internal/services/oauth"
+	"github.com/nhassl3/sso/internal/services/permissions"
 	"github.com/nhassl3/sso/internal/storage/sqlite"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/nhassl3/sso/internal/app/grpcapp"
 	"github.com/nhassl3/sso/internal/services/auth"
@@ -12,19 +29,355 @@ import (
 
 type App struct {
 	GRPCServer *grpcapp.App
+	HTTPServer *httpapp.App
+	Scheduler  *scheduler.App
 }
 
-func New(log *slog.Logger, grpcPort int, storagePath string, tokenTTL time.Duration) *App {
-	storage, err := sqlite.New(storagePath)
+func New(log *slog.Logger, cfg *config.Config) *App {
+	storage, err := sqlite.New(cfg.StoragePath)
 	if err != nil {
 		panic(err)
 	}
 
-	authService := auth.New(log, storage, storage, storage, tokenTTL)
+	emails := emailaddr.Normalizer{FoldLocalPart: cfg.Email.FoldLocalPart}
+	mustNormalizedEmails(storage, emails)
 
-	grpcApp := grpcapp.New(log, grpcPort, authService)
+	keysService, err := keys.New(
+		log,
+		storage,
+		storage,
+		mustCipher(cfg.Signing.EncryptionKey),
+		keys.Rotation{
+			Algorithm:    cfg.Signing.Rotation.Algorithm,
+			Period:       cfg.Signing.Rotation.Period,
+			PublishDelay: cfg.Signing.Rotation.PublishDelay,
+			Overlap:      cfg.TokenTTL,
+		},
+		mustLoadKeys(cfg.Signing.Keys),
+		cfg.Signing.ActiveKey,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	authService := auth.New(
+		log,
+		storage,
+		storage,
+		storage,
+		storage,
+		keysService,
+		storage,
+		storage,
+		storage,
+		mustHasher(cfg.PasswordHash),
+		cfg.Issuer,
+		cfg.TokenTTL,
+		cfg.RefreshTokenTTL,
+		auth.MFA{
+			Cipher:          mustCipher(cfg.MFA.EncryptionKey),
+			RecoveryCodeKey: mustHMACKey(cfg.MFA.RecoveryCodeKey),
+			TOTPIssuer:      cfg.MFA.TOTPIssuer,
+			ChallengeTTL:    cfg.MFA.ChallengeTTL,
+			MaxAttempts:     cfg.MFA.MaxAttempts,
+			RelyingParty: webauthn.RelyingParty{
+				ID:      cfg.MFA.WebAuthn.RPID,
+				Name:    cfg.MFA.WebAuthn.RPName,
+				Origins: cfg.MFA.WebAuthn.Origins,
+			},
+		},
+		auth.Mail{
+			Mailer: mustMailer(cfg.Mail),
+			PasswordReset: auth.Link{
+				URL:      cfg.PasswordReset.URL,
+				TokenTTL: cfg.PasswordReset.TokenTTL,
+			},
+			EmailVerification: auth.Link{
+				URL:      cfg.EmailVerification.URL,
+				TokenTTL: cfg.EmailVerification.TokenTTL,
+			},
+			Passwordless: auth.Passwordless{
+				Link: auth.Link{
+					URL:      cfg.Passwordless.URL,
+					TokenTTL: cfg.Passwordless.TokenTTL,
+				},
+				MaxAttempts: cfg.Passwordless.MaxAttempts,
+			},
+		},
+		auth.Lockout{
+			MaxFailures:   cfg.Lockout.MaxFailures,
+			MaxIPFailures: cfg.Lockout.MaxIPFailures,
+			BaseDelay:     cfg.Lockout.BaseDelay,
+			MaxDelay:      cfg.Lockout.MaxDelay,
+			LockDuration:  cfg.Lockout.LockDuration,
+			Window:        cfg.Lockout.Window,
+		},
+		mustPasswordPolicy(cfg.PasswordPolicy),
+		emails,
+	)
+
+	oauthService := oauth.New(
+		log,
+		authService,
+		storage,
+		storage,
+		cfg.OAuth.CodeTTL,
+		cfg.OAuth.ClientCredentials.TokenTTL,
+		cfg.OAuth.ClientCredentials.Scopes,
+		oauth.DeviceFlow{
+			CodeTTL:         cfg.OAuth.Device.CodeTTL,
+			Interval:        cfg.OAuth.Device.Interval,
+			VerificationURI: cfg.OAuth.Device.VerificationURI,
+		},
+	)
+
+	permissionsService := permissions.New(log, storage, storage, storage)
+
+	authorizationService, err := authorization.New(log, storage, namespaces(cfg.Authorization))
+	if err != nil {
+		panic(err)
+	}
+
+	grpcApp := grpcapp.New(
+		log,
+		cfg.GRPC.Port,
+		ratelimit.NewRoutes(rateLimits(cfg.GRPC.RateLimit), emails.Key),
+		authService,
+		keysService,
+		oauthService,
+		permissionsService,
+		authorizationService,
+	)
+
+	httpApp := httpapp.New(
+		log,
+		cfg.HTTP.Port,
+		cfg.HTTP.Timeout,
+		ratelimit.NewRoutes(rateLimits(cfg.HTTP.RateLimit), emails.Key),
+		cfg.Issuer,
+		cfg.TokenTTL,
+		keysService,
+		authService,
+		oauthService,
+	)
+
+	schedulerApp := scheduler.New(log,
+		scheduler.Job{
+			Name:     "prune expired tokens",
+			Interval: cfg.CleanupInterval,
+			Run:      authService.PruneExpiredTokens,
+		},
+		scheduler.Job{
+			Name:     "rotate signing keys",
+			Interval: cfg.Signing.Rotation.Interval,
+			Run:      keysService.Rotate,
+		},
+		scheduler.Job{
+			Name:     "prune expired authorization codes",
+			Interval: cfg.CleanupInterval,
+			Run:      oauthService.PruneExpiredCodes,
+		},
+	)
 
 	return &App{
 		GRPCServer: grpcApp,
+		HTTPServer: httpApp,
+		Scheduler:  schedulerApp,
+	}
+}
+
+// mustNormalizedEmails panics if canonical forms of some emails are missing or don't
+// match the normalizer, e.g. after migration 16 or a change of fold_local_part.
+// Users of such emails couldn't log in until "go run ./cmd/emails --apply" writes the forms
+func mustNormalizedEmails(storage *sqlite.Storage, emails emailaddr.Normalizer) {
+	count, err := storage.UnnormalizedEmails(context.Background(), emails.Normalize)
+	if err != nil {
+		panic(err)
+	}
+
+	if count > 0 {
+		panic(fmt.Sprintf("emails of %d users aren't normalized, run \"go run ./cmd/emails --apply\" first", count))
+	}
+}
+
+// mustLoadKeys loads signing keys from disk and panics if any of them can't be loaded
+func mustLoadKeys(cfg []config.KeyConfig) []jwt.Key {
+	keys := make([]jwt.Key, 0, len(cfg))
+	for _, keyCfg := range cfg {
+		key, err := jwt.LoadKey(keyCfg.ID, keyCfg.Path)
+		if err != nil {
+			panic(err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// mustCipher creates cipher for secrets at rest from base64-encoded key and panics if the key is invalid
+func mustCipher(key string) *crypt.Cipher {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		panic("invalid encryption key: " + err.Error())
+	}
+
+	cipher, err := crypt.New(raw)
+	if err != nil {
+		panic(err)
+	}
+
+	return cipher
+}
+
+// mustHMACKey decodes base64-encoded key of at least 32 bytes and panics if the key is invalid
+func mustHMACKey(key string) []byte {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		panic("invalid hmac key: " + err.Error())
+	}
+
+	if len(raw) < 32 {
+		panic(fmt.Sprintf("invalid hmac key size %d, expected at least 32", len(raw)))
+	}
+
+	return raw
+}
+
+// mustHasher returns hasher of new passwords with the configured algorithm
+// and panics if the algorithm is unknown or its parameters are out of range
+func mustHasher(cfg config.PasswordHashConfig) auth.PasswordHasher {
+	switch cfg.Algorithm {
+	case "argon2id":
+		if cfg.Argon2id.Memory == 0 || cfg.Argon2id.Time == 0 || cfg.Argon2id.Parallelism == 0 {
+			panic("argon2id memory, time and parallelism must be positive")
+		}
+
+		return password.Argon2id{
+			Memory:      cfg.Argon2id.Memory,
+			Time:        cfg.Argon2id.Time,
+			Parallelism: cfg.Argon2id.Parallelism,
+		}
+	case "bcrypt":
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			panic(fmt.Sprintf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+		}
+
+		return password.Bcrypt{Cost: cfg.BcryptCost}
+	default:
+		panic("unknown password hash algorithm: " + cfg.Algorithm)
+	}
+}
+
+func mustPasswordPolicy(cfg config.PasswordPolicyConfig) auth.PasswordPolicy {
+	policy := auth.PasswordPolicy{
+		Default: passwordRules(cfg.Default),
+		Apps:    make(map[int]password.Policy, len(cfg.Apps)),
+	}
+
+	for appID, rules := range cfg.Apps {
+		policy.Apps[appID] = passwordRules(rules)
+	}
+
+	if cfg.BreachedList != "" {
+		list, err := password.OpenBreachedList(cfg.BreachedList)
+		if err != nil {
+			panic("failed to open breached password list: " + err.Error())
+		}
+
+		policy.Breached = list
+	}
+
+	return policy
+}
+
+func passwordRules(cfg config.PasswordRulesConfig) password.Policy {
+	return password.Policy{
+		MinLength:     cfg.MinLength,
+		MaxLength:     cfg.MaxLength,
+		RequireUpper:  cfg.RequireUpper,
+		RequireLower:  cfg.RequireLower,
+		RequireDigit:  cfg.RequireDigit,
+		RequireSymbol: cfg.RequireSymbol,
+		ForbidEmail:   cfg.ForbidEmail,
+	}
+}
+
+// mustMailer returns SMTP mailer if SMTP server is configured, else outbox
+// in a local directory, and panics if the outbox can't be created
+func mustMailer(cfg config.MailConfig) mailer.Mailer {
+	if cfg.SMTP.Host != "" {
+		return mailer.NewSMTP(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.From)
+	}
+
+	outbox, err := mailer.NewOutbox(cfg.OutboxDir, cfg.From)
+	if err != nil {
+		panic(err)
+	}
+
+	return outbox
+}
+
+// namespaces converts namespaces of relation tuples from config
+func namespaces(cfg config.AuthorizationConfig) map[string]authorization.Namespace {
+	namespaces := make(map[string]authorization.Namespace, len(cfg.Namespaces))
+	for name, namespace := range cfg.Namespaces {
+		relations := make(map[string]authorization.Rewrite, len(namespace.Relations))
+		for relation, rewrite := range namespace.Relations {
+			relations[relation] = rewriteRule(rewrite)
+		}
+
+		namespaces[name] = authorization.Namespace{Relations: relations}
+	}
+
+	return namespaces
+}
+
+func rewriteRule(cfg config.RewriteConfig) authorization.Rewrite {
+	rewrite := authorization.Rewrite{
+		This:            cfg.This,
+		ComputedUserset: cfg.ComputedUserset,
+	}
+
+	if cfg.TupleToUserset != nil {
+		rewrite.TupleToUserset = &authorization.TupleToUserset{
+			Tupleset:        cfg.TupleToUserset.Tupleset,
+			ComputedUserset: cfg.TupleToUserset.ComputedUserset,
+		}
+	}
+
+	if len(cfg.Union) > 0 {
+		rewrite.Union = make([]authorization.Rewrite, 0, len(cfg.Union))
+		for _, child := range cfg.Union {
+			rewrite.Union = append(rewrite.Union, rewriteRule(child))
+		}
+	}
+
+	if len(cfg.Intersection) > 0 {
+		rewrite.Intersection = make([]authorization.Rewrite, 0, len(cfg.Intersection))
+		for _, child := range cfg.Intersection {
+			rewrite.Intersection = append(rewrite.Intersection, rewriteRule(child))
+		}
+	}
+
+	return rewrite
+}
+
+func rateLimits(cfg config.RateLimitConfig) ratelimit.Rules {
+	routes := make(map[string]ratelimit.Rule, len(cfg.Methods))
+	for route, rule := range cfg.Methods {
+		routes[route] = rateLimit(rule)
+	}
+
+	return ratelimit.Rules{
+		Default: rateLimit(cfg.Default),
+		Routes:  routes,
+	}
+}
+
+func rateLimit(rule config.RateLimitRule) ratelimit.Rule {
+	return ratelimit.Rule{
+		Requests: rule.Requests,
+		Per:      rule.Per,
+		ByEmail:  rule.ByEmail,
 	}
 }
@@ -1,12 +1,20 @@
 package grpcapp
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net"
 
 	authgRPC "github.com/nhassl3/sso/internal/grpc/auth"
+	authorizationgRPC "github.com/nhassl3/sso/internal/grpc/authorization"
+	keysgRPC "github.com/nhassl3/sso/internal/grpc/keys"
+	oauthgRPC "github.com/nhassl3/sso/internal/grpc/oauth"
+	permissionsgRPC "github.com/nhassl3/sso/internal/grpc/permissions"
+	"github.com/nhassl3/sso/internal/lib/clientip"
+	"github.com/nhassl3/sso/internal/lib/ratelimit"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
 )
 
 const (
@@ -20,11 +28,30 @@ type App struct {
 	port       int
 }
 
-func New(log *slog.Logger, port int, auth authgRPC.Auth) *App {
-	gRPCServer := grpc.NewServer()
+func New(
+	log *slog.Logger,
+	port int,
+	rateLimits *ratelimit.Routes,
+	auth authgRPC.Auth,
+	keys keysgRPC.Keys,
+	oauth oauthgRPC.OAuth,
+	permissions permissionsgRPC.Permissions,
+	authorization authorizationgRPC.Authorization,
+) *App {
+	limiter := newRateLimiter(log, rateLimits)
+	authn := newAuthenticator(log, auth)
+
+	gRPCServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		clientIPInterceptor,
+		limiter.unaryInterceptor,
+		authn.unaryInterceptor,
+	))
 
-	// TODO: добавить auth интерфейс с реализованными методами Login, RegisterNewUser, IsAdmin
 	authgRPC.Register(gRPCServer, auth)
+	keysgRPC.Register(gRPCServer, keys)
+	oauthgRPC.Register(gRPCServer, oauth)
+	permissionsgRPC.Register(gRPCServer, permissions)
+	authorizationgRPC.Register(gRPCServer, authorization)
 
 	return &App{
 		log:        log,
@@ -33,6 +60,20 @@ func New(log *slog.Logger, port int, auth authgRPC.Auth) *App {
 	}
 }
 
+// clientIPInterceptor puts IP address of the gRPC peer into the request context
+func clientIPInterceptor(
+	ctx context.Context,
+	req any,
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ctx = clientip.NewContext(ctx, clientip.FromAddr(p.Addr.String()))
+	}
+
+	return handler(ctx, req)
+}
+
 // MustRun runs gRPC server and panics if any error occurs
 func (a *App) MustRun() {
 	if err := a.Run(); err != nil {
@@ -0,0 +1,161 @@
+package grpcapp
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	ssov1 "github.com/nhassl3/gRPC-sso-service/gen/go/sso"
+	"github.com/nhassl3/sso/internal/lib/caller"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authorizationKey is the request metadata key with "Bearer <access token>"
+const authorizationKey = "authorization"
+
+// access is the level of access a gRPC method requires
+type access int
+
+const (
+	// accessPublic methods may be called by anyone
+	accessPublic access = iota
+	// accessClient methods require an active access token of a user or of a client
+	accessClient
+	// accessUser methods require an active access token of a user
+	accessUser
+	// accessAdmin methods require an active access token of an admin
+	accessAdmin
+)
+
+// methodAccess lists methods that aren't public, keyed by full gRPC method name
+var methodAccess = map[string]access{
+	ssov1.Auth_RevokeAllSessions_FullMethodName: accessUser,
+	ssov1.Auth_UnlockUser_FullMethodName:        accessAdmin,
+
+	ssov1.Keys_CreateSigningKey_FullMethodName:   accessAdmin,
+	ssov1.Keys_ActivateSigningKey_FullMethodName: accessAdmin,
+	ssov1.Keys_ListSigningKeys_FullMethodName:    accessAdmin,
+	ssov1.Keys_DeleteSigningKey_FullMethodName:   accessAdmin,
+
+	ssov1.Permissions_CreateRole_FullMethodName:       accessAdmin,
+	ssov1.Permissions_DeleteRole_FullMethodName:       accessAdmin,
+	ssov1.Permissions_CreatePermission_FullMethodName: accessAdmin,
+	ssov1.Permissions_DeletePermission_FullMethodName: accessAdmin,
+	ssov1.Permissions_GrantPermission_FullMethodName:  accessAdmin,
+	ssov1.Permissions_RevokePermission_FullMethodName: accessAdmin,
+	ssov1.Permissions_AssignRole_FullMethodName:       accessAdmin,
+	ssov1.Permissions_UnassignRole_FullMethodName:     accessAdmin,
+
+	ssov1.Authorization_WriteTuples_FullMethodName: accessAdmin,
+	ssov1.Authorization_Check_FullMethodName:       accessClient,
+	ssov1.Authorization_Expand_FullMethodName:      accessClient,
+	ssov1.Authorization_ListObjects_FullMethodName: accessClient,
+}
+
+// Authenticator verifies access tokens of callers
+type Authenticator interface {
+	Introspect(ctx context.Context, token string) (claims jwt.Claims, active bool, err error)
+	IsAdmin(ctx context.Context, userID int64) (isAdmin bool, err error)
+}
+
+type authenticator struct {
+	log  *slog.Logger
+	auth Authenticator
+}
+
+func newAuthenticator(log *slog.Logger, auth Authenticator) *authenticator {
+	return &authenticator{log: log, auth: auth}
+}
+
+// unaryInterceptor rejects calls of non-public methods without an active access
+// token of a user, or of a client for client methods, with codes.Unauthenticated
+// and calls of admin methods by other users with codes.PermissionDenied
+//
+// The caller is put into the context of allowed calls
+func (a *authenticator) unaryInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	required := methodAccess[info.FullMethod]
+	if required == accessPublic {
+		return handler(ctx, req)
+	}
+
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "access token is required")
+	}
+
+	claims, active, err := a.auth.Introspect(ctx, token)
+	if err != nil {
+		a.log.Error("failed to introspect access token", slog.String("method", info.FullMethod), sl.ErrLog(err))
+
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	if !active {
+		return nil, status.Error(codes.Unauthenticated, "invalid access token")
+	}
+
+	// tokens of clients aren't issued to users
+	if claims.UserID <= 0 {
+		if required != accessClient {
+			return nil, status.Error(codes.Unauthenticated, "invalid access token")
+		}
+
+		return handler(caller.NewContext(ctx, caller.Caller{AppID: claims.AppID}), req)
+	}
+
+	isAdmin, err := a.auth.IsAdmin(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid access token")
+		}
+
+		a.log.Error("failed to check if caller is admin", slog.String("method", info.FullMethod), sl.ErrLog(err))
+
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	if required == accessAdmin && !isAdmin {
+		a.log.Warn(
+			"admin method called by non-admin",
+			slog.String("method", info.FullMethod),
+			slog.Int64("user_id", claims.UserID),
+		)
+
+		return nil, status.Error(codes.PermissionDenied, "admin access is required")
+	}
+
+	ctx = caller.NewContext(ctx, caller.Caller{
+		UserID: claims.UserID,
+		AppID:  claims.AppID,
+		Admin:  isAdmin,
+	})
+
+	return handler(ctx, req)
+}
+
+// bearerToken extracts token from "authorization: Bearer <token>" metadata
+func bearerToken(ctx context.Context) (string, bool) {
+	values := metadata.ValueFromIncomingContext(ctx, authorizationKey)
+	if len(values) != 1 {
+		return "", false
+	}
+
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
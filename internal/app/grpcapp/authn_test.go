@@ -0,0 +1,112 @@
+package grpcapp
+
+import (
+	"context"
+	"testing"
+
+	ssov1 "github.com/nhassl3/gRPC-sso-service/gen/go/sso"
+	"github.com/nhassl3/sso/internal/lib/caller"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	"github.com/nhassl3/sso/internal/lib/logger/handlers/slogdiscard"
+	"github.com/nhassl3/sso/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAuthenticator knows tokens "user", "admin", "client" and "deleted"
+type fakeAuthenticator struct{}
+
+func (fakeAuthenticator) Introspect(_ context.Context, token string) (jwt.Claims, bool, error) {
+	switch token {
+	case "user":
+		return jwt.Claims{UserID: 1, AppID: 1}, true, nil
+	case "admin":
+		return jwt.Claims{UserID: 2, AppID: 1}, true, nil
+	case "client":
+		return jwt.Claims{AppID: 1}, true, nil
+	case "deleted":
+		return jwt.Claims{UserID: 3, AppID: 1}, true, nil
+	default:
+		return jwt.Claims{}, false, nil
+	}
+}
+
+func (fakeAuthenticator) IsAdmin(_ context.Context, userID int64) (bool, error) {
+	if userID == 3 {
+		return false, storage.ErrUserNotFound
+	}
+
+	return userID == 2, nil
+}
+
+func TestAuthenticator(t *testing.T) {
+	a := newAuthenticator(slogdiscard.NewDiscardLogger(), fakeAuthenticator{})
+
+	tests := []struct {
+		name   string
+		method string
+		auth   string
+		code   codes.Code
+		caller caller.Caller
+	}{
+		{name: "public method", method: ssov1.Auth_Login_FullMethodName, code: codes.OK},
+		{name: "no token", method: ssov1.Auth_UnlockUser_FullMethodName, code: codes.Unauthenticated},
+		{name: "not bearer", method: ssov1.Auth_UnlockUser_FullMethodName, auth: "Basic admin", code: codes.Unauthenticated},
+		{name: "inactive token", method: ssov1.Auth_UnlockUser_FullMethodName, auth: "Bearer bad", code: codes.Unauthenticated},
+		{name: "client token", method: ssov1.Auth_UnlockUser_FullMethodName, auth: "Bearer client", code: codes.Unauthenticated},
+		{name: "deleted user", method: ssov1.Auth_UnlockUser_FullMethodName, auth: "Bearer deleted", code: codes.Unauthenticated},
+		{name: "not admin", method: ssov1.Auth_UnlockUser_FullMethodName, auth: "Bearer user", code: codes.PermissionDenied},
+		{
+			name:   "user method",
+			method: ssov1.Auth_RevokeAllSessions_FullMethodName,
+			auth:   "Bearer user",
+			code:   codes.OK,
+			caller: caller.Caller{UserID: 1, AppID: 1},
+		},
+		{name: "client method without token", method: ssov1.Authorization_Check_FullMethodName, code: codes.Unauthenticated},
+		{
+			name:   "client method",
+			method: ssov1.Authorization_ListObjects_FullMethodName,
+			auth:   "Bearer client",
+			code:   codes.OK,
+			caller: caller.Caller{AppID: 1},
+		},
+		{
+			name:   "client method by user",
+			method: ssov1.Authorization_Check_FullMethodName,
+			auth:   "Bearer user",
+			code:   codes.OK,
+			caller: caller.Caller{UserID: 1, AppID: 1},
+		},
+		{
+			name:   "admin",
+			method: ssov1.Auth_UnlockUser_FullMethodName,
+			auth:   "bearer admin",
+			code:   codes.OK,
+			caller: caller.Caller{UserID: 2, AppID: 1, Admin: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.auth != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(authorizationKey, tt.auth))
+			}
+
+			var got caller.Caller
+			handler := func(ctx context.Context, _ any) (any, error) {
+				got, _ = caller.FromContext(ctx)
+				return nil, nil
+			}
+
+			_, err := a.unaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			require.Equal(t, tt.code, status.Code(err))
+			assert.Equal(t, tt.caller, got)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package grpcapp
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/nhassl3/sso/internal/lib/clientip"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// retryAfterKey is the response metadata key with seconds the client has to wait
+const retryAfterKey = "retry-after"
+
+// rateLimiter limits calls of gRPC methods, keyed by full method name
+type rateLimiter struct {
+	log    *slog.Logger
+	routes *ratelimit.Routes
+	clock  func() time.Time
+}
+
+// emailRequest is a request that has an email, e.g. of Login or Register
+type emailRequest interface {
+	GetEmail() string
+}
+
+func newRateLimiter(log *slog.Logger, routes *ratelimit.Routes) *rateLimiter {
+	return &rateLimiter{
+		log:    log,
+		routes: routes,
+		clock:  time.Now,
+	}
+}
+
+// unaryInterceptor rejects calls over the limit with codes.ResourceExhausted
+// and "retry-after" metadata
+//
+// Client IP has to be put into the context by clientIPInterceptor beforehand
+func (l *rateLimiter) unaryInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	email := func() string {
+		if r, ok := req.(emailRequest); ok {
+			return r.GetEmail()
+		}
+
+		return ""
+	}
+
+	allowed, retryAfter := l.routes.Allow(info.FullMethod, clientip.FromContext(ctx), email, l.clock())
+	if !allowed {
+		l.log.Warn(
+			"rate limit exceeded",
+			slog.String("method", info.FullMethod),
+			slog.String("ip", clientip.FromContext(ctx)),
+			slog.Duration("retry_after", retryAfter),
+		)
+
+		seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+		if err := grpc.SetHeader(ctx, metadata.Pairs(retryAfterKey, seconds)); err != nil {
+			l.log.Error("failed to set retry-after header", sl.ErrLog(err))
+		}
+
+		return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded, retry after "+seconds+"s")
+	}
+
+	return handler(ctx, req)
+}
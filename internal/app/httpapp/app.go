@@ -0,0 +1,107 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	oauthhttp "github.com/nhassl3/sso/internal/http/oauth"
+	"github.com/nhassl3/sso/internal/http/oidc"
+	"github.com/nhassl3/sso/internal/http/wellknown"
+	"github.com/nhassl3/sso/internal/lib/clientip"
+	"github.com/nhassl3/sso/internal/lib/ratelimit"
+)
+
+const (
+	opRun  = "httpapp.Run"
+	opStop = "httpapp.Stop"
+)
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       int
+	timeout    time.Duration
+}
+
+func New(
+	log *slog.Logger,
+	port int,
+	timeout time.Duration,
+	rateLimits *ratelimit.Routes,
+	issuer string,
+	tokenTTL time.Duration,
+	keys wellknown.Keys,
+	auth oidc.UserInfoProvider,
+	oauth oauthhttp.OAuth,
+) *App {
+	mux := http.NewServeMux()
+
+	wellknown.Register(mux, log, keys, issuer)
+	oidc.Register(mux, log, auth)
+	oauthhttp.Register(mux, log, oauth, tokenTTL)
+
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Addr:         fmt.Sprintf(":%d", port),
+			Handler:      withClientIP(newRateLimiter(log, rateLimits).middleware(mux)),
+			ReadTimeout:  timeout,
+			WriteTimeout: timeout,
+		},
+		port:    port,
+		timeout: timeout,
+	}
+}
+
+// withClientIP puts IP address of the client into the request context
+//
+// The server is expected to face clients directly, forwarding headers aren't trusted
+func withClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := clientip.NewContext(r.Context(), clientip.FromAddr(r.RemoteAddr))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// MustRun runs HTTP server and panics if any error occurs
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+// Run HTTP server
+func (a *App) Run() error {
+	log := a.log.With(slog.String("op", opRun), slog.Int("port", a.port))
+
+	log.Info("starting HTTP server")
+
+	l, err := net.Listen("tcp", a.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opRun, err)
+	}
+
+	log.Info("http server is running", slog.String("address", l.Addr().String()))
+
+	if err := a.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", opRun, err)
+	}
+
+	return nil
+}
+
+// Stop stops HTTP server
+func (a *App) Stop() {
+	a.log.With(slog.String("op", opStop)).Info("stopping HTTP server", slog.Int("port", a.port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	_ = a.httpServer.Shutdown(ctx) // Graceful shutdown
+}
@@ -0,0 +1,64 @@
+package httpapp
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nhassl3/sso/internal/lib/clientip"
+	"github.com/nhassl3/sso/internal/lib/ratelimit"
+)
+
+// rateLimiter limits HTTP requests, keyed by method and path, e.g. "POST /token"
+type rateLimiter struct {
+	log    *slog.Logger
+	routes *ratelimit.Routes
+	clock  func() time.Time
+}
+
+func newRateLimiter(log *slog.Logger, routes *ratelimit.Routes) *rateLimiter {
+	return &rateLimiter{
+		log:    log,
+		routes: routes,
+		clock:  time.Now,
+	}
+}
+
+// middleware rejects requests over the limit with 429 Too Many Requests
+// and Retry-After header. Emails are taken from the "email" form field
+//
+// Client IP has to be put into the context by withClientIP beforehand
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.Method + " " + r.URL.Path
+
+		email := func() string {
+			if r.Method != http.MethodPost {
+				return ""
+			}
+
+			// parsed form is kept in the request for the handler
+			return r.PostFormValue("email")
+		}
+
+		allowed, retryAfter := l.routes.Allow(route, clientip.FromContext(r.Context()), email, l.clock())
+		if !allowed {
+			l.log.Warn(
+				"rate limit exceeded",
+				slog.String("route", route),
+				slog.String("ip", clientip.FromContext(r.Context())),
+				slog.Duration("retry_after", retryAfter),
+			)
+
+			seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+			w.Header().Set("Retry-After", seconds)
+			http.Error(w, "rate limit exceeded, retry after "+seconds+"s", http.StatusTooManyRequests)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+)
+
+const (
+	opRun  = "scheduler.Run"
+	opStop = "scheduler.Stop"
+)
+
+// Job is a background task that runs periodically
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+type App struct {
+	log    *slog.Logger
+	jobs   []Job
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(log *slog.Logger, jobs ...Job) *App {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &App{
+		log:    log,
+		jobs:   jobs,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Run runs all jobs and blocks until Stop is called
+func (a *App) Run() {
+	log := a.log.With(slog.String("op", opRun))
+
+	for _, job := range a.jobs {
+		if job.Interval <= 0 {
+			log.Warn("job is disabled", slog.String("job", job.Name))
+			continue
+		}
+
+		a.wg.Add(1)
+		go func(job Job) {
+			defer a.wg.Done()
+			a.loop(log.With(slog.String("job", job.Name)), job)
+		}(job)
+
+		log.Info("job scheduled", slog.String("job", job.Name), slog.Duration("interval", job.Interval))
+	}
+
+	<-a.ctx.Done()
+}
+
+// Stop stops all jobs and waits for running ones to finish
+func (a *App) Stop() {
+	a.log.With(slog.String("op", opStop)).Info("stopping scheduler")
+
+	a.cancel()
+	a.wg.Wait()
+}
+
+func (a *App) loop(log *slog.Logger, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job.Run(a.ctx); err != nil {
+				log.Error("job failed", sl.ErrLog(err))
+			}
+		}
+	}
+}
@@ -9,15 +9,253 @@ import (
 )
 
 type Config struct {
-	Env         string        `yaml:"env" env-default:"local"`
-	StoragePath string        `yaml:"storage_path" env-required:"true"`
-	TokenTTL    time.Duration `yaml:"token_ttl" env-default:"1h"`
-	GRPC        GRPCConfig    `yaml:"grpc"`
+	Env               string                  `yaml:"env" env-default:"local"`
+	StoragePath       string                  `yaml:"storage_path" env-required:"true"`
+	Issuer            string                  `yaml:"issuer" env-default:"http://localhost:8080"`
+	TokenTTL          time.Duration           `yaml:"token_ttl" env-default:"1h"`
+	RefreshTokenTTL   time.Duration           `yaml:"refresh_token_ttl" env-default:"720h"`
+	CleanupInterval   time.Duration           `yaml:"cleanup_interval" env-default:"1h"`
+	GRPC              GRPCConfig              `yaml:"grpc"`
+	HTTP              HTTPConfig              `yaml:"http"`
+	Signing           SigningConfig           `yaml:"signing"`
+	OAuth             OAuthConfig             `yaml:"oauth"`
+	MFA               MFAConfig               `yaml:"mfa"`
+	Mail              MailConfig              `yaml:"mail"`
+	PasswordReset     PasswordResetConfig     `yaml:"password_reset"`
+	EmailVerification EmailVerificationConfig `yaml:"email_verification"`
+	Passwordless      PasswordlessConfig      `yaml:"passwordless"`
+	Lockout           LockoutConfig           `yaml:"lockout"`
+	PasswordHash      PasswordHashConfig      `yaml:"password_hash"`
+	PasswordPolicy    PasswordPolicyConfig    `yaml:"password_policy"`
+	Email             EmailConfig             `yaml:"email"`
+	Authorization     AuthorizationConfig     `yaml:"authorization"`
 }
 
 type GRPCConfig struct {
-	Port    int           `yaml:"port" env-default:"44044"`
-	Timeout time.Duration `yaml:"timeout" env-default:"5s"`
+	Port      int             `yaml:"port" env-default:"44044"`
+	Timeout   time.Duration   `yaml:"timeout" env-default:"5s"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+}
+
+// RateLimitConfig describes token bucket limits of requests per client IP
+//
+// Methods are keyed by full gRPC method name, e.g. "/auth.Auth/Login", or by
+// HTTP method and path, e.g. "POST /token". Default applies to every other method
+type RateLimitConfig struct {
+	Default RateLimitRule            `yaml:"default"`
+	Methods map[string]RateLimitRule `yaml:"methods"`
+}
+
+// RateLimitRule allows Requests per Per with bursts of up to Requests.
+// ByEmail limits requests with the same email as well, whatever the client IP.
+// Zero Requests disables the limit
+type RateLimitRule struct {
+	Requests int           `yaml:"requests" env-default:"50"`
+	Per      time.Duration `yaml:"per" env-default:"1s"`
+	ByEmail  bool          `yaml:"by_email"`
+}
+
+type HTTPConfig struct {
+	Port      int             `yaml:"port" env-default:"8080"`
+	Timeout   time.Duration   `yaml:"timeout" env-default:"5s"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+}
+
+// SigningConfig describes asymmetric keys tokens are signed with
+//
+// If ActiveKey is empty, tokens are signed with HS256 using app secret.
+// EncryptionKey is base64-encoded 32-byte key private keys kept in storage are encrypted with
+type SigningConfig struct {
+	ActiveKey     string            `yaml:"active_key"`
+	Keys          []KeyConfig       `yaml:"keys"`
+	Rotation      KeyRotationConfig `yaml:"rotation"`
+	EncryptionKey string            `yaml:"encryption_key" env:"SIGNING_ENCRYPTION_KEY" env-required:"true"`
+}
+
+// KeyRotationConfig describes rotation of per-app keys kept in storage
+type KeyRotationConfig struct {
+	Interval     time.Duration `yaml:"interval" env-default:"1h"`
+	Algorithm    string        `yaml:"algorithm" env-default:"ES256"`
+	Period       time.Duration `yaml:"period" env-default:"720h"`
+	PublishDelay time.Duration `yaml:"publish_delay" env-default:"24h"`
+}
+
+type KeyConfig struct {
+	ID   string `yaml:"id"`
+	Path string `yaml:"path"`
+}
+
+type OAuthConfig struct {
+	CodeTTL           time.Duration           `yaml:"code_ttl" env-default:"1m"`
+	ClientCredentials ClientCredentialsConfig `yaml:"client_credentials"`
+	Device            DeviceFlowConfig        `yaml:"device"`
+}
+
+// ClientCredentialsConfig describes tokens issued to apps themselves
+//
+// Scopes maps app id to the scopes the app may request
+type ClientCredentialsConfig struct {
+	TokenTTL time.Duration    `yaml:"token_ttl" env-default:"5m"`
+	Scopes   map[int][]string `yaml:"scopes"`
+}
+
+// DeviceFlowConfig describes device authorization grant used by CLI tools
+//
+// VerificationURI is the page where logged-in user approves the device
+type DeviceFlowConfig struct {
+	CodeTTL         time.Duration `yaml:"code_ttl" env-default:"10m"`
+	Interval        time.Duration `yaml:"interval" env-default:"5s"`
+	VerificationURI string        `yaml:"verification_uri" env-default:"http://localhost:3000/device"`
+}
+
+// MFAConfig describes multi-factor authentication
+//
+// EncryptionKey is base64-encoded 32-byte key TOTP secrets are encrypted with at rest.
+// RecoveryCodeKey is base64-encoded key of at least 32 bytes recovery codes are hashed with
+type MFAConfig struct {
+	EncryptionKey   string         `yaml:"encryption_key" env:"MFA_ENCRYPTION_KEY" env-required:"true"`
+	RecoveryCodeKey string         `yaml:"recovery_code_key" env:"MFA_RECOVERY_CODE_KEY" env-required:"true"`
+	TOTPIssuer      string         `yaml:"totp_issuer" env-default:"sso"`
+	ChallengeTTL    time.Duration  `yaml:"challenge_ttl" env-default:"5m"`
+	MaxAttempts     int            `yaml:"max_attempts" env-default:"5"`
+	WebAuthn        WebAuthnConfig `yaml:"webauthn"`
+}
+
+// WebAuthnConfig describes relying party passkeys are registered for
+//
+// RPID is the domain of the service, passkeys can't be used on other domains.
+// Origins are origins of the pages running WebAuthn ceremonies
+type WebAuthnConfig struct {
+	RPID    string   `yaml:"rp_id" env-default:"localhost"`
+	RPName  string   `yaml:"rp_name" env-default:"sso"`
+	Origins []string `yaml:"origins" env-default:"http://localhost:3000"`
+}
+
+// MailConfig describes delivery of emails to users
+//
+// If SMTP host is empty, messages are written to OutboxDir instead of being sent
+type MailConfig struct {
+	From      string     `yaml:"from" env-default:"sso <noreply@localhost>"`
+	OutboxDir string     `yaml:"outbox_dir" env-default:"./storage/outbox"`
+	SMTP      SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+}
+
+// PasswordResetConfig describes reset of forgotten passwords
+//
+// URL is the page of the reset link, it gets the token in "token" query parameter
+type PasswordResetConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"30m"`
+	URL      string        `yaml:"url" env-default:"http://localhost:3000/reset-password"`
+}
+
+// EmailVerificationConfig describes verification of user emails
+//
+// URL is the page of the verification link, it gets the token in "token" query parameter
+type EmailVerificationConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"24h"`
+	URL      string        `yaml:"url" env-default:"http://localhost:3000/verify-email"`
+}
+
+// PasswordlessConfig describes login with one-time code or link sent by email
+//
+// URL is the page of the login link, it gets login id in "login_id" and the token
+// in "token" query parameters. Login is rejected after TokenTTL or MaxAttempts wrong codes
+type PasswordlessConfig struct {
+	TokenTTL    time.Duration `yaml:"token_ttl" env-default:"10m"`
+	MaxAttempts int           `yaml:"max_attempts" env-default:"5"`
+	URL         string        `yaml:"url" env-default:"http://localhost:3000/passwordless"`
+}
+
+// LockoutConfig describes brute-force protection of password login
+//
+// Every failed login delays the next one from the same email or client IP, the delay
+// starts at BaseDelay and doubles up to MaxDelay. After MaxFailures failures of the email
+// or MaxIPFailures of the IP it's locked for LockDuration. Counters start over
+// after Window without failures
+type LockoutConfig struct {
+	MaxFailures   int           `yaml:"max_failures" env-default:"5"`
+	MaxIPFailures int           `yaml:"max_ip_failures" env-default:"50"`
+	BaseDelay     time.Duration `yaml:"base_delay" env-default:"1s"`
+	MaxDelay      time.Duration `yaml:"max_delay" env-default:"30s"`
+	LockDuration  time.Duration `yaml:"lock_duration" env-default:"15m"`
+	Window        time.Duration `yaml:"window" env-default:"1h"`
+}
+
+// PasswordHashConfig selects algorithm of new password hashes, "argon2id" or "bcrypt".
+// Hashes of other algorithms or parameters are upgraded on successful login
+type PasswordHashConfig struct {
+	Algorithm  string         `yaml:"algorithm" env-default:"argon2id"`
+	BcryptCost int            `yaml:"bcrypt_cost" env-default:"10"`
+	Argon2id   Argon2idConfig `yaml:"argon2id"`
+}
+
+// Argon2idConfig holds argon2id parameters, Memory is in KiB
+type Argon2idConfig struct {
+	Memory      uint32 `yaml:"memory" env-default:"19456"`
+	Time        uint32 `yaml:"time" env-default:"2"`
+	Parallelism uint8  `yaml:"parallelism" env-default:"1"`
+}
+
+// PasswordPolicyConfig describes passwords users may choose
+//
+// Apps replace Default entirely for the app with the ID. BreachedList is an
+// optional path to a file of sorted SHA-1 hashes of breached passwords
+type PasswordPolicyConfig struct {
+	Default      PasswordRulesConfig         `yaml:"default"`
+	Apps         map[int]PasswordRulesConfig `yaml:"apps"`
+	BreachedList string                      `yaml:"breached_list"`
+}
+
+// PasswordRulesConfig holds rules of a password policy, MaxLength is in bytes
+type PasswordRulesConfig struct {
+	MinLength     int  `yaml:"min_length" env-default:"8"`
+	MaxLength     int  `yaml:"max_length" env-default:"72"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+	ForbidEmail   bool `yaml:"forbid_email" env-default:"true"`
+}
+
+// EmailConfig describes canonical form of emails users are looked up by.
+// FoldLocalPart makes the part before "@" case-insensitive, the domain always is.
+// The service doesn't start until stored forms match it, see cmd/emails
+type EmailConfig struct {
+	FoldLocalPart bool `yaml:"fold_local_part" env-default:"true"`
+}
+
+// AuthorizationConfig holds namespaces of relation tuples keyed by name
+type AuthorizationConfig struct {
+	Namespaces map[string]NamespaceConfig `yaml:"namespaces"`
+}
+
+// NamespaceConfig holds rewrites of relations keyed by name,
+// a relation without rewrite holds subjects of its tuples only
+type NamespaceConfig struct {
+	Relations map[string]RewriteConfig `yaml:"relations"`
+}
+
+// RewriteConfig defines userset of a relation, at most one field is set
+type RewriteConfig struct {
+	This            bool                  `yaml:"this"`
+	ComputedUserset string                `yaml:"computed_userset"`
+	TupleToUserset  *TupleToUsersetConfig `yaml:"tuple_to_userset"`
+	Union           []RewriteConfig       `yaml:"union"`
+	Intersection    []RewriteConfig       `yaml:"intersection"`
+}
+
+// TupleToUsersetConfig stands for ComputedUserset relation of objects
+// having Tupleset relation to the object
+type TupleToUsersetConfig struct {
+	Tupleset        string `yaml:"tupleset"`
+	ComputedUserset string `yaml:"computed_userset"`
 }
 
 func MustLoad() *Config {
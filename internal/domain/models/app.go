@@ -1,7 +1,12 @@
 package models
 
+// App is a client application users log in to
+//
+// If RequireVerifiedEmail is set, users can't log in to the app
+// until they verify their email
 type App struct {
-	ID     int
-	Name   string
-	Secret string
+	ID                   int
+	Name                 string
+	Secret               string
+	RequireVerifiedEmail bool
 }
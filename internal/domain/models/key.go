@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	KeyStatePending  = "pending"
+	KeyStateActive   = "active"
+	KeyStateRetiring = "retiring"
+)
+
+// SigningKey is a stored asymmetric key tokens of the app are signed with
+//
+// Pending key is already published, but not used for signing yet. Active
+// key signs new tokens. Retiring key only verifies tokens until ExpiresAt
+type SigningKey struct {
+	ID          string
+	AppID       int
+	Algorithm   string
+	PrivateKey  []byte
+	State       string
+	CreatedAt   time.Time
+	ActivatedAt time.Time
+	ExpiresAt   time.Time
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginFailures counts failed password logins of the subject,
+// e.g. an email or a client IP address
+type LoginFailures struct {
+	Subject       string
+	Failures      int
+	LastFailureAt time.Time
+}
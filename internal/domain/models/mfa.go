@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// TOTP is a TOTP authenticator enrolled by the user
+//
+// Secret is encrypted at rest. Authenticator isn't used until user confirms
+// it with the first code. LastStep is the time step of the last accepted code,
+// codes of this and earlier steps are rejected
+type TOTP struct {
+	UserID   int64
+	Secret   []byte
+	Enabled  bool
+	LastStep int64
+}
+
+// MFAChallenge is a stored (hashed) second step of the login started with password
+type MFAChallenge struct {
+	IDHash    string
+	UserID    int64
+	AppID     int
+	Nonce     string
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+// WebAuthn ceremonies
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login"
+)
+
+// Passkey is a WebAuthn credential of the user
+//
+// PublicKey is COSE-encoded. SignCount is the last signature counter reported
+// by the authenticator, authenticators that don't count report zero
+type Passkey struct {
+	ID         []byte
+	UserID     int64
+	PublicKey  []byte
+	SignCount  uint32
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// WebAuthnSession is a pending WebAuthn ceremony stored by hash of its challenge
+//
+// UserID is zero for passwordless login, the user is known from the passkey.
+// MFAChallengeHash is set for login completing MFA challenge with a passkey
+type WebAuthnSession struct {
+	ChallengeHash    string
+	Ceremony         string
+	UserID           int64
+	AppID            int
+	Nonce            string
+	MFAChallengeHash string
+	ExpiresAt        time.Time
+}
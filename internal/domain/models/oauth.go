@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// AuthorizationCode is a stored (hashed) one-time OAuth 2.0 authorization code
+type AuthorizationCode struct {
+	CodeHash      string
+	AppID         int
+	UserID        int64
+	RedirectURI   string
+	CodeChallenge string
+	Scope         string
+	Nonce         string
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+	Used          bool
+}
+
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+	DeviceCodeRedeemed = "redeemed"
+)
+
+// DeviceCode is a stored (hashed) OAuth 2.0 device code with its user code (RFC 8628)
+//
+// UserID and AuthTime are set once user approves the code
+type DeviceCode struct {
+	DeviceCodeHash string
+	UserCode       string
+	AppID          int
+	Scope          string
+	Status         string
+	UserID         int64
+	AuthTime       time.Time
+	PollInterval   time.Duration
+	LastPolledAt   time.Time
+	ExpiresAt      time.Time
+}
@@ -0,0 +1,36 @@
+package models
+
+// Role is a named set of permissions users of an app are assigned
+type Role struct {
+	ID          int64
+	AppID       int
+	Name        string
+	Permissions []string
+}
+
+// Permission is a named action in an app, granted to users through roles
+type Permission struct {
+	ID    int64
+	AppID int
+	Name  string
+}
+
+// AppUser is a user within an app, roles of users are scoped per app
+type AppUser struct {
+	UserID int64
+	AppID  int
+}
+
+// PermissionCheck asks whether the user may perform action on resource in the app
+type PermissionCheck struct {
+	UserID   int64
+	AppID    int
+	Resource string
+	Action   string
+}
+
+// PermissionDecision answers PermissionCheck, Reason explains it to humans
+type PermissionDecision struct {
+	Allowed bool
+	Reason  string
+}
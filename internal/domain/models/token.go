@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// Tokens is a set of tokens issued to user after successful authentication
+//
+// IDToken is only issued when user authenticates, not on refresh.
+// If MFAChallengeID is set, no tokens are issued until user completes the challenge
+type Tokens struct {
+	AccessToken    string
+	RefreshToken   string
+	IDToken        string
+	MFAChallengeID string
+}
+
+// RefreshToken is a stored (hashed) opaque refresh token.
+//
+// Tokens issued from the same Login share FamilyID, so the whole chain
+// can be revoked at once when reuse of a rotated token is detected
+type RefreshToken struct {
+	ID        int64
+	TokenHash string
+	FamilyID  string
+	UserID    int64
+	AppID     int
+	ExpiresAt time.Time
+	Used      bool
+	Revoked   bool
+}
+
+// PasswordResetToken is a stored (hashed) single-use token sent to the user
+// who has forgotten their password
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    int64
+	ExpiresAt time.Time
+}
+
+// EmailVerificationToken is a stored (hashed) single-use token sent to
+// the email of the user to prove they own it
+//
+// Email is the address the token was sent to, token doesn't verify
+// the address the user has changed to since
+type EmailVerificationToken struct {
+	TokenHash string
+	UserID    int64
+	Email     string
+	ExpiresAt time.Time
+}
+
+// PasswordlessLogin is a stored (hashed) login started without password
+//
+// It's completed with either the one-time code or the link token mailed
+// to the user. Like MFA challenge, it's rejected after too many wrong codes
+type PasswordlessLogin struct {
+	IDHash    string
+	UserID    int64
+	AppID     int
+	Nonce     string
+	CodeHash  string
+	TokenHash string
+	Attempts  int
+	ExpiresAt time.Time
+}
@@ -0,0 +1,38 @@
+package models
+
+// Object is an object of a namespace, e.g. "document:readme"
+type Object struct {
+	Namespace string
+	ID        string
+}
+
+func (o Object) String() string {
+	return o.Namespace + ":" + o.ID
+}
+
+// Subject is either an object itself, e.g. "user:42", or a userset of objects
+// having the relation to it, e.g. "group:eng#member"
+type Subject struct {
+	Object   Object
+	Relation string
+}
+
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Object.String()
+	}
+
+	return s.Object.String() + "#" + s.Relation
+}
+
+// RelationTuple says that subject has relation to object,
+// e.g. "document:readme#viewer@group:eng#member"
+type RelationTuple struct {
+	Object   Object
+	Relation string
+	Subject  Subject
+}
+
+func (t RelationTuple) String() string {
+	return t.Object.String() + "#" + t.Relation + "@" + t.Subject.String()
+}
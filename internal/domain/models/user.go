@@ -1,7 +1,12 @@
 package models
 
+// User is a registered user
+//
+// MFAEnabled is set if the user has either TOTP enabled or a passkey registered
 type User struct {
-	ID           int64
-	Email        string
-	PasswordHash []byte
+	ID            int64
+	Email         string
+	PasswordHash  []byte
+	MFAEnabled    bool
+	EmailVerified bool
 }
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	ssov1 "github.com/nhassl3/gRPC-sso-service/gen/go/sso"
+	"github.com/nhassl3/sso/internal/services/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) EnrollTOTP(ctx context.Context, req *ssov1.EnrollTOTPRequest) (*ssov1.EnrollTOTPResponse, error) {
+	if err := validateEnrollTOTP(req); err != nil {
+		return nil, err
+	}
+
+	uri, err := s.auth.EnrollTOTP(ctx, req.GetToken())
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	return &ssov1.EnrollTOTPResponse{ProvisioningUri: uri}, nil
+}
+
+func (s *serverAPI) ConfirmTOTP(ctx context.Context, req *ssov1.ConfirmTOTPRequest) (*ssov1.ConfirmTOTPResponse, error) {
+	if err := validateConfirmTOTP(req); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := s.auth.ConfirmTOTP(ctx, req.GetToken(), req.GetCode())
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	return &ssov1.ConfirmTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *serverAPI) VerifyMFA(ctx context.Context, req *ssov1.VerifyMFARequest) (*ssov1.VerifyMFAResponse, error) {
+	if err := validateVerifyMFA(req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.VerifyMFA(ctx, req.GetChallengeId(), req.GetCode())
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	return &ssov1.VerifyMFAResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IdToken:      tokens.IDToken,
+	}, nil
+}
+
+func (s *serverAPI) RegenerateRecoveryCodes(
+	ctx context.Context,
+	req *ssov1.RegenerateRecoveryCodesRequest,
+) (*ssov1.RegenerateRecoveryCodesResponse, error) {
+	if err := validateRegenerateRecoveryCodes(req); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := s.auth.RegenerateRecoveryCodes(ctx, req.GetToken())
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	return &ssov1.RegenerateRecoveryCodesResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *serverAPI) GetRecoveryCodesCount(
+	ctx context.Context,
+	req *ssov1.GetRecoveryCodesCountRequest,
+) (*ssov1.GetRecoveryCodesCountResponse, error) {
+	if err := validateGetRecoveryCodesCount(req); err != nil {
+		return nil, err
+	}
+
+	remaining, err := s.auth.RecoveryCodesRemaining(ctx, req.GetToken())
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	return &ssov1.GetRecoveryCodesCountResponse{Remaining: int32(remaining)}, nil
+}
+
+// mfaError converts error of MFA methods of the Auth service to gRPC status
+func mfaError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, "invalid token")
+	case errors.Is(err, auth.ErrInvalidMFAChallenge):
+		return status.Error(codes.Unauthenticated, "invalid or expired mfa challenge")
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		return status.Error(codes.InvalidArgument, "invalid code")
+	case errors.Is(err, auth.ErrMFAAlreadyEnabled):
+		return status.Error(codes.AlreadyExists, "mfa already enabled")
+	case errors.Is(err, auth.ErrMFANotEnrolled):
+		return status.Error(codes.FailedPrecondition, "mfa not enrolled")
+	case errors.Is(err, auth.ErrEmailNotVerified):
+		return status.Error(codes.FailedPrecondition, "email not verified")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func validateEnrollTOTP(req *ssov1.EnrollTOTPRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	return nil
+}
+
+func validateConfirmTOTP(req *ssov1.ConfirmTOTPRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if req.GetCode() == "" {
+		return status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	return nil
+}
+
+func validateVerifyMFA(req *ssov1.VerifyMFARequest) error {
+	if req.GetChallengeId() == "" {
+		return status.Error(codes.InvalidArgument, "challenge_id is required")
+	}
+
+	if req.GetCode() == "" {
+		return status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	return nil
+}
+
+func validateRegenerateRecoveryCodes(req *ssov1.RegenerateRecoveryCodesRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	return nil
+}
+
+func validateGetRecoveryCodesCount(req *ssov1.GetRecoveryCodesCountRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	ssov1 "github.com/nhassl3/gRPC-sso-service/gen/go/sso"
+	"github.com/nhassl3/sso/internal/lib/webauthn"
+	"github.com/nhassl3/sso/internal/services/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Passkey ceremonies exchange WebAuthn JSON: public_key of responses is passed to
+// PublicKeyCredential.parseCreationOptionsFromJSON() or parseRequestOptionsFromJSON(),
+// credential of requests is the result of PublicKeyCredential.toJSON()
+
+func (s *serverAPI) BeginPasskeyRegistration(
+	ctx context.Context,
+	req *ssov1.BeginPasskeyRegistrationRequest,
+) (*ssov1.BeginPasskeyRegistrationResponse, error) {
+	if err := validateBeginPasskeyRegistration(req); err != nil {
+		return nil, err
+	}
+
+	opts, err := s.auth.BeginPasskeyRegistration(ctx, req.GetToken())
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	publicKey, err := json.Marshal(opts)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.BeginPasskeyRegistrationResponse{PublicKey: string(publicKey)}, nil
+}
+
+func (s *serverAPI) FinishPasskeyRegistration(
+	ctx context.Context,
+	req *ssov1.FinishPasskeyRegistrationRequest,
+) (*ssov1.FinishPasskeyRegistrationResponse, error) {
+	if err := validateFinishPasskeyRegistration(req); err != nil {
+		return nil, err
+	}
+
+	registration, err := webauthn.ParseRegistration([]byte(req.GetCredential()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "malformed credential")
+	}
+
+	id, err := s.auth.FinishPasskeyRegistration(ctx, req.GetToken(), registration)
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	return &ssov1.FinishPasskeyRegistrationResponse{
+		CredentialId: base64.RawURLEncoding.EncodeToString(id),
+	}, nil
+}
+
+func (s *serverAPI) BeginPasskeyLogin(
+	ctx context.Context,
+	req *ssov1.BeginPasskeyLoginRequest,
+) (*ssov1.BeginPasskeyLoginResponse, error) {
+	if err := validateBeginPasskeyLogin(req); err != nil {
+		return nil, err
+	}
+
+	opts, err := s.auth.BeginPasskeyLogin(ctx, int(req.GetAppId()), req.GetNonce(), req.GetMfaChallengeId())
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	publicKey, err := json.Marshal(opts)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.BeginPasskeyLoginResponse{PublicKey: string(publicKey)}, nil
+}
+
+func (s *serverAPI) FinishPasskeyLogin(
+	ctx context.Context,
+	req *ssov1.FinishPasskeyLoginRequest,
+) (*ssov1.FinishPasskeyLoginResponse, error) {
+	if err := validateFinishPasskeyLogin(req); err != nil {
+		return nil, err
+	}
+
+	assertion, err := webauthn.ParseAssertion([]byte(req.GetCredential()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "malformed credential")
+	}
+
+	tokens, err := s.auth.FinishPasskeyLogin(ctx, assertion)
+	if err != nil {
+		return nil, passkeyError(err)
+	}
+
+	return &ssov1.FinishPasskeyLoginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IdToken:      tokens.IDToken,
+	}, nil
+}
+
+// passkeyError converts error of passkey methods of the Auth service to gRPC status
+func passkeyError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidPasskey):
+		return status.Error(codes.Unauthenticated, "invalid passkey")
+	case errors.Is(err, auth.ErrPasskeyExists):
+		return status.Error(codes.AlreadyExists, "passkey already registered")
+	case errors.Is(err, auth.ErrInvalidAppID):
+		return status.Error(codes.NotFound, "app not found")
+	default:
+		return mfaError(err)
+	}
+}
+
+func validateBeginPasskeyRegistration(req *ssov1.BeginPasskeyRegistrationRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	return nil
+}
+
+func validateFinishPasskeyRegistration(req *ssov1.FinishPasskeyRegistrationRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if req.GetCredential() == "" {
+		return status.Error(codes.InvalidArgument, "credential is required")
+	}
+
+	return nil
+}
+
+func validateBeginPasskeyLogin(req *ssov1.BeginPasskeyLoginRequest) error {
+	if req.GetMfaChallengeId() == "" && req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "app_id or mfa_challenge_id is required")
+	}
+
+	return nil
+}
+
+func validateFinishPasskeyLogin(req *ssov1.FinishPasskeyLoginRequest) error {
+	if req.GetCredential() == "" {
+		return status.Error(codes.InvalidArgument, "credential is required")
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	ssov1 "github.com/nhassl3/gRPC-sso-service/gen/go/sso"
+	"github.com/nhassl3/sso/internal/services/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) StartPasswordlessLogin(
+	ctx context.Context,
+	req *ssov1.StartPasswordlessLoginRequest,
+) (*ssov1.StartPasswordlessLoginResponse, error) {
+	if err := validateStartPasswordlessLogin(req); err != nil {
+		return nil, err
+	}
+
+	loginID, err := s.auth.StartPasswordlessLogin(ctx, req.GetEmail(), int(req.GetAppId()), req.GetNonce())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAppID) {
+			return nil, status.Error(codes.InvalidArgument, "invalid app_id")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.StartPasswordlessLoginResponse{LoginId: loginID}, nil
+}
+
+func (s *serverAPI) CompletePasswordlessLogin(
+	ctx context.Context,
+	req *ssov1.CompletePasswordlessLoginRequest,
+) (*ssov1.CompletePasswordlessLoginResponse, error) {
+	if err := validateCompletePasswordlessLogin(req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.CompletePasswordlessLogin(ctx, req.GetLoginId(), req.GetCode())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidPasswordless):
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired login")
+		case errors.Is(err, auth.ErrInvalidLoginCode):
+			return nil, status.Error(codes.InvalidArgument, "invalid code")
+		case errors.Is(err, auth.ErrEmailNotVerified):
+			return nil, status.Error(codes.FailedPrecondition, "email not verified")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.CompletePasswordlessLoginResponse{
+		Token:          tokens.AccessToken,
+		RefreshToken:   tokens.RefreshToken,
+		IdToken:        tokens.IDToken,
+		MfaChallengeId: tokens.MFAChallengeID,
+	}, nil
+}
+
+func validateStartPasswordlessLogin(req *ssov1.StartPasswordlessLoginRequest) error {
+	if req.GetEmail() == "" {
+		return status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	return nil
+}
+
+func validateCompletePasswordlessLogin(req *ssov1.CompletePasswordlessLoginRequest) error {
+	if req.GetLoginId() == "" {
+		return status.Error(codes.InvalidArgument, "login_id is required")
+	}
+
+	if req.GetCode() == "" {
+		return status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	return nil
+}
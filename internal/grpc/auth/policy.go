@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nhassl3/sso/internal/services/auth"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// passwordPolicyError converts *auth.PasswordPolicyError to InvalidArgument status
+// with a BadRequest detail, one field violation per violated rule, described
+// as "<rule>: <message>". ok is false for other errors
+func passwordPolicyError(err error) (error, bool) {
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return nil, false
+	}
+
+	violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(policyErr.Violations))
+	for _, v := range policyErr.Violations {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       "password",
+			Description: fmt.Sprintf("%s: %s", v.Rule, v.Message),
+		})
+	}
+
+	st, detailErr := status.New(codes.InvalidArgument, "password violates policy").
+		WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if detailErr != nil {
+		return status.Error(codes.InvalidArgument, "password violates policy"), true
+	}
+
+	return st.Err(), true
+}
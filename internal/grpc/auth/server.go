@@ -3,8 +3,15 @@ package auth
 import (
 	"context"
 	"errors"
+	"strconv"
+	"strings"
 
 	ssov1 "github.com/nhassl3/gRPC-sso-service/gen/go/sso"
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/caller"
+	"github.com/nhassl3/sso/internal/lib/emailaddr"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	"github.com/nhassl3/sso/internal/lib/webauthn"
 	"github.com/nhassl3/sso/internal/services/auth"
 	"github.com/nhassl3/sso/internal/storage"
 	"google.golang.org/grpc"
@@ -18,9 +25,41 @@ const (
 )
 
 type Auth interface {
-	Login(ctx context.Context, email string, password string, appID int) (token string, err error)
-	RegisterNewUser(ctx context.Context, email string, password string) (userID int64, err error)
+	Login(ctx context.Context, email string, password string, appID int, nonce string) (tokens models.Tokens, err error)
+	RegisterNewUser(ctx context.Context, email string, password string, appID int) (userID int64, err error)
 	IsAdmin(ctx context.Context, userID int64) (isAdmin bool, err error)
+	Refresh(ctx context.Context, refreshToken string) (tokens models.Tokens, err error)
+	Logout(ctx context.Context, token string, refreshToken string) error
+	RevokeToken(ctx context.Context, token string) error
+	RevokeAllSessions(ctx context.Context, userID int64) error
+	UnlockUser(ctx context.Context, userID int64) error
+	Introspect(ctx context.Context, token string) (claims jwt.Claims, active bool, err error)
+	UserInfo(ctx context.Context, accessToken string) (user models.User, err error)
+	ChangePassword(ctx context.Context, accessToken string, currentPassword string, newPassword string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, newPassword string) error
+	RequestEmailVerification(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+	StartPasswordlessLogin(ctx context.Context, email string, appID int, nonce string) (loginID string, err error)
+	CompletePasswordlessLogin(ctx context.Context, loginID string, code string) (tokens models.Tokens, err error)
+	EnrollTOTP(ctx context.Context, accessToken string) (provisioningURI string, err error)
+	ConfirmTOTP(ctx context.Context, accessToken string, code string) (recoveryCodes []string, err error)
+	VerifyMFA(ctx context.Context, challengeID string, code string) (tokens models.Tokens, err error)
+	RegenerateRecoveryCodes(ctx context.Context, accessToken string) (recoveryCodes []string, err error)
+	RecoveryCodesRemaining(ctx context.Context, accessToken string) (remaining int, err error)
+	BeginPasskeyRegistration(ctx context.Context, accessToken string) (opts webauthn.CreationOptions, err error)
+	FinishPasskeyRegistration(
+		ctx context.Context,
+		accessToken string,
+		registration webauthn.Registration,
+	) (credentialID []byte, err error)
+	BeginPasskeyLogin(
+		ctx context.Context,
+		appID int,
+		nonce string,
+		mfaChallengeID string,
+	) (opts webauthn.RequestOptions, err error)
+	FinishPasskeyLogin(ctx context.Context, assertion webauthn.Assertion) (tokens models.Tokens, err error)
 }
 
 type serverAPI struct {
@@ -37,17 +76,47 @@ func (s *serverAPI) Login(ctx context.Context, req *ssov1.LoginRequest) (*ssov1.
 		return nil, err
 	}
 
-	// TODO: implement login via auth service
-	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
+	tokens, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()), req.GetNonce())
 	if err != nil {
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
 		}
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			return nil, status.Error(codes.FailedPrecondition, "email not verified")
+		}
+		if errors.Is(err, auth.ErrTooManyAttempts) {
+			return nil, status.Error(codes.ResourceExhausted, "too many login attempts, try again later")
+		}
+		if errors.Is(err, auth.ErrAccountLocked) {
+			return nil, status.Error(codes.PermissionDenied, "account temporarily locked")
+		}
 		return nil, status.Error(codes.Internal, "internal error")
 	}
 
 	return &ssov1.LoginResponse{
-		Token: token,
+		Token:          tokens.AccessToken,
+		RefreshToken:   tokens.RefreshToken,
+		IdToken:        tokens.IDToken,
+		MfaChallengeId: tokens.MFAChallengeID,
+	}, nil
+}
+
+func (s *serverAPI) Refresh(ctx context.Context, req *ssov1.RefreshRequest) (*ssov1.RefreshResponse, error) {
+	if err := validateRefresh(req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.Refresh(ctx, req.GetRefreshToken())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefresh) || errors.Is(err, auth.ErrRefreshReused) {
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.RefreshResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}, nil
 }
 
@@ -56,11 +125,17 @@ func (s *serverAPI) Register(ctx context.Context, req *ssov1.RegisterRequest) (*
 		return nil, err
 	}
 
-	userId, err := s.auth.RegisterNewUser(ctx, req.GetEmail(), req.GetPassword())
+	userId, err := s.auth.RegisterNewUser(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
 	if err != nil {
 		if errors.Is(err, storage.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
+		if errors.Is(err, auth.ErrInvalidEmail) {
+			return nil, status.Error(codes.InvalidArgument, "invalid email")
+		}
+		if policyErr, ok := passwordPolicyError(err); ok {
+			return nil, policyErr
+		}
 		return nil, status.Error(codes.Internal, "internal error")
 	}
 
@@ -87,11 +162,224 @@ func (s *serverAPI) IsAdmin(ctx context.Context, req *ssov1.IsAdminRequest) (*ss
 	}, nil
 }
 
+func (s *serverAPI) Logout(ctx context.Context, req *ssov1.LogoutRequest) (*ssov1.LogoutResponse, error) {
+	if err := validateLogout(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.Logout(ctx, req.GetToken(), req.GetRefreshToken()); err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.LogoutResponse{}, nil
+}
+
+func (s *serverAPI) RevokeToken(ctx context.Context, req *ssov1.RevokeTokenRequest) (*ssov1.RevokeTokenResponse, error) {
+	if err := validateRevokeToken(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RevokeToken(ctx, req.GetToken()); err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.RevokeTokenResponse{}, nil
+}
+
+func (s *serverAPI) RevokeAllSessions(
+	ctx context.Context,
+	req *ssov1.RevokeAllSessionsRequest,
+) (*ssov1.RevokeAllSessionsResponse, error) {
+	if err := validateRevokeAllSessions(req); err != nil {
+		return nil, err
+	}
+
+	if c, ok := caller.FromContext(ctx); !ok || !c.CanActFor(req.GetUserId()) {
+		return nil, status.Error(codes.PermissionDenied, "sessions may be revoked only by the user or an admin")
+	}
+
+	if err := s.auth.RevokeAllSessions(ctx, req.GetUserId()); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.RevokeAllSessionsResponse{}, nil
+}
+
+func (s *serverAPI) UnlockUser(ctx context.Context, req *ssov1.UnlockUserRequest) (*ssov1.UnlockUserResponse, error) {
+	if err := validateUnlockUser(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.UnlockUser(ctx, req.GetUserId()); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.UnlockUserResponse{}, nil
+}
+
+func (s *serverAPI) Introspect(ctx context.Context, req *ssov1.IntrospectRequest) (*ssov1.IntrospectResponse, error) {
+	if err := validateIntrospect(req); err != nil {
+		return nil, err
+	}
+
+	claims, active, err := s.auth.Introspect(ctx, req.GetToken())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	if !active {
+		return &ssov1.IntrospectResponse{Active: false}, nil
+	}
+
+	return &ssov1.IntrospectResponse{
+		Active:        true,
+		UserId:        claims.UserID,
+		Email:         claims.Email,
+		AppId:         int32(claims.AppID),
+		Jti:           claims.ID,
+		IssuedAt:      claims.IssuedAt.Unix(),
+		ExpiresAt:     claims.ExpiresAt.Unix(),
+		Sub:           claims.Subject,
+		Scope:         claims.Scope,
+		EmailVerified: claims.EmailVerified,
+		Roles:         claims.Roles,
+	}, nil
+}
+
+func (s *serverAPI) UserInfo(ctx context.Context, req *ssov1.UserInfoRequest) (*ssov1.UserInfoResponse, error) {
+	if err := validateUserInfo(req); err != nil {
+		return nil, err
+	}
+
+	user, err := s.auth.UserInfo(ctx, req.GetToken())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.UserInfoResponse{
+		Sub:           strconv.FormatInt(user.ID, 10),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+	}, nil
+}
+
+func (s *serverAPI) ChangePassword(
+	ctx context.Context,
+	req *ssov1.ChangePasswordRequest,
+) (*ssov1.ChangePasswordResponse, error) {
+	if err := validateChangePassword(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.ChangePassword(ctx, req.GetToken(), req.GetCurrentPassword(), req.GetNewPassword()); err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
+		}
+		if errors.Is(err, auth.ErrTooManyAttempts) {
+			return nil, status.Error(codes.ResourceExhausted, "too many attempts, try again later")
+		}
+		if errors.Is(err, auth.ErrAccountLocked) {
+			return nil, status.Error(codes.PermissionDenied, "account temporarily locked")
+		}
+		if policyErr, ok := passwordPolicyError(err); ok {
+			return nil, policyErr
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.ChangePasswordResponse{}, nil
+}
+
+func (s *serverAPI) RequestPasswordReset(
+	ctx context.Context,
+	req *ssov1.RequestPasswordResetRequest,
+) (*ssov1.RequestPasswordResetResponse, error) {
+	if err := validateRequestPasswordReset(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RequestPasswordReset(ctx, req.GetEmail()); err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.RequestPasswordResetResponse{}, nil
+}
+
+func (s *serverAPI) ResetPassword(
+	ctx context.Context,
+	req *ssov1.ResetPasswordRequest,
+) (*ssov1.ResetPasswordResponse, error) {
+	if err := validateResetPassword(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.ResetPassword(ctx, req.GetToken(), req.GetNewPassword()); err != nil {
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired reset token")
+		}
+		if policyErr, ok := passwordPolicyError(err); ok {
+			return nil, policyErr
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.ResetPasswordResponse{}, nil
+}
+
+func (s *serverAPI) RequestEmailVerification(
+	ctx context.Context,
+	req *ssov1.RequestEmailVerificationRequest,
+) (*ssov1.RequestEmailVerificationResponse, error) {
+	if err := validateRequestEmailVerification(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RequestEmailVerification(ctx, req.GetEmail()); err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.RequestEmailVerificationResponse{}, nil
+}
+
+func (s *serverAPI) VerifyEmail(ctx context.Context, req *ssov1.VerifyEmailRequest) (*ssov1.VerifyEmailResponse, error) {
+	if err := validateVerifyEmail(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.VerifyEmail(ctx, req.GetToken()); err != nil {
+		if errors.Is(err, auth.ErrInvalidVerifyToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired verification token")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.VerifyEmailResponse{}, nil
+}
+
 func validateLogin(req *ssov1.LoginRequest) error {
 	if req.GetEmail() == "" {
 		return status.Error(codes.InvalidArgument, "email is required")
 	}
 
+	if err := emailaddr.Validate(strings.TrimSpace(req.GetEmail())); err != nil {
+		return status.Error(codes.InvalidArgument, "invalid email")
+	}
+
 	if req.GetPassword() == "" {
 		return status.Error(codes.InvalidArgument, "password is required")
 	}
@@ -108,10 +396,126 @@ func validateRegister(req *ssov1.RegisterRequest) error {
 		return status.Error(codes.InvalidArgument, "email is required")
 	}
 
+	if err := emailaddr.Validate(strings.TrimSpace(req.GetEmail())); err != nil {
+		return status.Error(codes.InvalidArgument, "invalid email")
+	}
+
 	if req.GetPassword() == "" {
 		return status.Error(codes.InvalidArgument, "password is required")
 	}
 
+	if req.GetAppId() < lessThanZero {
+		return status.Error(codes.InvalidArgument, "app_id must not be negative")
+	}
+
+	return nil
+}
+
+func validateRefresh(req *ssov1.RefreshRequest) error {
+	if req.GetRefreshToken() == "" {
+		return status.Error(codes.InvalidArgument, "refresh_token is required")
+	}
+
+	return nil
+}
+
+func validateLogout(req *ssov1.LogoutRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	return nil
+}
+
+func validateRevokeToken(req *ssov1.RevokeTokenRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	return nil
+}
+
+func validateRevokeAllSessions(req *ssov1.RevokeAllSessionsRequest) error {
+	if req.GetUserId() <= lessThanZero {
+		return status.Error(codes.InvalidArgument, "user_id is less than zero")
+	}
+
+	return nil
+}
+
+func validateUnlockUser(req *ssov1.UnlockUserRequest) error {
+	if req.GetUserId() <= lessThanZero {
+		return status.Error(codes.InvalidArgument, "user_id is less than zero")
+	}
+
+	return nil
+}
+
+func validateIntrospect(req *ssov1.IntrospectRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	return nil
+}
+
+func validateUserInfo(req *ssov1.UserInfoRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	return nil
+}
+
+func validateChangePassword(req *ssov1.ChangePasswordRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if req.GetCurrentPassword() == "" {
+		return status.Error(codes.InvalidArgument, "current_password is required")
+	}
+
+	if req.GetNewPassword() == "" {
+		return status.Error(codes.InvalidArgument, "new_password is required")
+	}
+
+	return nil
+}
+
+func validateRequestPasswordReset(req *ssov1.RequestPasswordResetRequest) error {
+	if req.GetEmail() == "" {
+		return status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	return nil
+}
+
+func validateResetPassword(req *ssov1.ResetPasswordRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if req.GetNewPassword() == "" {
+		return status.Error(codes.InvalidArgument, "new_password is required")
+	}
+
+	return nil
+}
+
+func validateRequestEmailVerification(req *ssov1.RequestEmailVerificationRequest) error {
+	if req.GetEmail() == "" {
+		return status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	return nil
+}
+
+func validateVerifyEmail(req *ssov1.VerifyEmailRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
 	return nil
 }
 
@@ -0,0 +1,266 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+
+	ssov1 "github.com/nhassl3/gRPC-sso-service/gen/go/sso"
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/services/authorization"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxTuples limits writes and deletes of a single WriteTuples call
+	maxTuples = 100
+
+	// defaultPageSize and maxPageSize limit objects checked by a single ListObjects call
+	defaultPageSize = 100
+	maxPageSize     = 500
+)
+
+type Authorization interface {
+	WriteTuples(ctx context.Context, writes []models.RelationTuple, deletes []models.RelationTuple) error
+	Check(ctx context.Context, object models.Object, relation string, subject models.Subject) (allowed bool, err error)
+	Expand(ctx context.Context, object models.Object, relation string) (tree authorization.UsersetTree, err error)
+	ListObjects(
+		ctx context.Context,
+		namespace string,
+		relation string,
+		subject models.Subject,
+		after string,
+		limit int,
+	) (objects []models.Object, next string, err error)
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedAuthorizationServer
+	authorization Authorization
+}
+
+func Register(gRPC *grpc.Server, authorization Authorization) {
+	ssov1.RegisterAuthorizationServer(gRPC, &serverAPI{authorization: authorization})
+}
+
+func (s *serverAPI) WriteTuples(
+	ctx context.Context,
+	req *ssov1.WriteTuplesRequest,
+) (*ssov1.WriteTuplesResponse, error) {
+	if err := validateWriteTuples(req); err != nil {
+		return nil, err
+	}
+
+	writes, err := parseTuples(req.GetWrites())
+	if err != nil {
+		return nil, err
+	}
+
+	deletes, err := parseTuples(req.GetDeletes())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.authorization.WriteTuples(ctx, writes, deletes); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.WriteTuplesResponse{}, nil
+}
+
+func (s *serverAPI) Check(ctx context.Context, req *ssov1.CheckRequest) (*ssov1.CheckResponse, error) {
+	if err := validateCheck(req); err != nil {
+		return nil, err
+	}
+
+	object, err := authorization.ParseObject(req.GetObject())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid object")
+	}
+
+	subject, err := authorization.ParseSubject(req.GetSubject())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid subject")
+	}
+
+	allowed, err := s.authorization.Check(ctx, object, req.GetRelation(), subject)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.CheckResponse{Allowed: allowed}, nil
+}
+
+func (s *serverAPI) Expand(ctx context.Context, req *ssov1.ExpandRequest) (*ssov1.ExpandResponse, error) {
+	if err := validateExpand(req); err != nil {
+		return nil, err
+	}
+
+	object, err := authorization.ParseObject(req.GetObject())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid object")
+	}
+
+	tree, err := s.authorization.Expand(ctx, object, req.GetRelation())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.ExpandResponse{Tree: toUsersetTree(tree)}, nil
+}
+
+func (s *serverAPI) ListObjects(
+	ctx context.Context,
+	req *ssov1.ListObjectsRequest,
+) (*ssov1.ListObjectsResponse, error) {
+	if err := validateListObjects(req); err != nil {
+		return nil, err
+	}
+
+	subject, err := authorization.ParseSubject(req.GetSubject())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid subject")
+	}
+
+	pageSize := int(req.GetPageSize())
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+
+	// page token is the last object checked, objects follow in order of their IDs
+	objects, next, err := s.authorization.ListObjects(
+		ctx,
+		req.GetNamespace(),
+		req.GetRelation(),
+		subject,
+		req.GetPageToken(),
+		pageSize,
+	)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListObjectsResponse{
+		Objects:       make([]string, 0, len(objects)),
+		NextPageToken: next,
+	}
+	for _, object := range objects {
+		resp.Objects = append(resp.Objects, object.String())
+	}
+
+	return resp, nil
+}
+
+func validateWriteTuples(req *ssov1.WriteTuplesRequest) error {
+	total := len(req.GetWrites()) + len(req.GetDeletes())
+
+	if total == 0 {
+		return status.Error(codes.InvalidArgument, "writes or deletes are required")
+	}
+
+	if total > maxTuples {
+		return status.Errorf(codes.InvalidArgument, "at most %d tuples are allowed", maxTuples)
+	}
+
+	return nil
+}
+
+func validateCheck(req *ssov1.CheckRequest) error {
+	if req.GetObject() == "" {
+		return status.Error(codes.InvalidArgument, "object is required")
+	}
+
+	if req.GetRelation() == "" {
+		return status.Error(codes.InvalidArgument, "relation is required")
+	}
+
+	if req.GetSubject() == "" {
+		return status.Error(codes.InvalidArgument, "subject is required")
+	}
+
+	return nil
+}
+
+func validateExpand(req *ssov1.ExpandRequest) error {
+	if req.GetObject() == "" {
+		return status.Error(codes.InvalidArgument, "object is required")
+	}
+
+	if req.GetRelation() == "" {
+		return status.Error(codes.InvalidArgument, "relation is required")
+	}
+
+	return nil
+}
+
+func validateListObjects(req *ssov1.ListObjectsRequest) error {
+	if req.GetNamespace() == "" {
+		return status.Error(codes.InvalidArgument, "namespace is required")
+	}
+
+	if req.GetRelation() == "" {
+		return status.Error(codes.InvalidArgument, "relation is required")
+	}
+
+	if req.GetSubject() == "" {
+		return status.Error(codes.InvalidArgument, "subject is required")
+	}
+
+	if req.GetPageSize() < 0 || req.GetPageSize() > maxPageSize {
+		return status.Errorf(codes.InvalidArgument, "page size must be between 0 and %d", maxPageSize)
+	}
+
+	return nil
+}
+
+// parseTuples parses tuples given as object, relation and subject
+func parseTuples(tuples []*ssov1.RelationTuple) ([]models.RelationTuple, error) {
+	parsed := make([]models.RelationTuple, 0, len(tuples))
+	for _, tuple := range tuples {
+		s := tuple.GetObject() + "#" + tuple.GetRelation() + "@" + tuple.GetSubject()
+
+		t, err := authorization.ParseTuple(s)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid tuple %q", s)
+		}
+
+		parsed = append(parsed, t)
+	}
+
+	return parsed, nil
+}
+
+// toStatus maps errors of the authorization service to gRPC statuses
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, authorization.ErrUnknownNamespace):
+		return status.Error(codes.InvalidArgument, "unknown namespace")
+	case errors.Is(err, authorization.ErrUnknownRelation):
+		return status.Error(codes.InvalidArgument, "unknown relation")
+	case errors.Is(err, authorization.ErrDepthExceeded):
+		return status.Error(codes.FailedPrecondition, "usersets are nested too deep")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func toUsersetTree(tree authorization.UsersetTree) *ssov1.UsersetTree {
+	resp := &ssov1.UsersetTree{
+		Object:    tree.Object.String(),
+		Relation:  tree.Relation,
+		Operation: tree.Operation,
+		Subjects:  make([]string, 0, len(tree.Subjects)),
+		Children:  make([]*ssov1.UsersetTree, 0, len(tree.Children)),
+	}
+
+	for _, subject := range tree.Subjects {
+		resp.Subjects = append(resp.Subjects, subject.String())
+	}
+
+	for _, child := range tree.Children {
+		resp.Children = append(resp.Children, toUsersetTree(child))
+	}
+
+	return resp
+}
@@ -0,0 +1,161 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	ssov1 "github.com/nhassl3/gRPC-sso-service/gen/go/sso"
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	"github.com/nhassl3/sso/internal/services/keys"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	emptyValue = 0
+)
+
+type Keys interface {
+	JWKS(ctx context.Context) (keys []jwt.JWK, err error)
+	CreateKey(ctx context.Context, appID int, algorithm string) (key models.SigningKey, err error)
+	ActivateKey(ctx context.Context, keyID string) error
+	ListKeys(ctx context.Context, appID int) (keys []models.SigningKey, err error)
+	DeleteKey(ctx context.Context, keyID string) error
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedKeysServer
+	keys Keys
+}
+
+func Register(gRPC *grpc.Server, keys Keys) {
+	ssov1.RegisterKeysServer(gRPC, &serverAPI{keys: keys})
+}
+
+func (s *serverAPI) GetJWKS(ctx context.Context, _ *ssov1.GetJWKSRequest) (*ssov1.GetJWKSResponse, error) {
+	jwks, err := s.keys.JWKS(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &ssov1.GetJWKSResponse{Keys: make([]*ssov1.Jwk, 0, len(jwks))}
+	for _, jwk := range jwks {
+		resp.Keys = append(resp.Keys, &ssov1.Jwk{
+			Kty: jwk.KeyType,
+			Kid: jwk.KeyID,
+			Use: jwk.Use,
+			Alg: jwk.Algorithm,
+			N:   jwk.N,
+			E:   jwk.E,
+			Crv: jwk.Curve,
+			X:   jwk.X,
+			Y:   jwk.Y,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) CreateSigningKey(
+	ctx context.Context,
+	req *ssov1.CreateSigningKeyRequest,
+) (*ssov1.CreateSigningKeyResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	key, err := s.keys.CreateKey(ctx, int(req.GetAppId()), req.GetAlgorithm())
+	if err != nil {
+		if errors.Is(err, keys.ErrInvalidAppID) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		if errors.Is(err, jwt.ErrUnsupportedKey) {
+			return nil, status.Error(codes.InvalidArgument, "unsupported algorithm")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.CreateSigningKeyResponse{
+		Key: toSigningKey(key),
+	}, nil
+}
+
+func (s *serverAPI) ActivateSigningKey(
+	ctx context.Context,
+	req *ssov1.ActivateSigningKeyRequest,
+) (*ssov1.ActivateSigningKeyResponse, error) {
+	if req.GetKeyId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "key_id is required")
+	}
+
+	if err := s.keys.ActivateKey(ctx, req.GetKeyId()); err != nil {
+		if errors.Is(err, jwt.ErrKeyNotFound) {
+			return nil, status.Error(codes.NotFound, "pending key not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.ActivateSigningKeyResponse{}, nil
+}
+
+func (s *serverAPI) ListSigningKeys(
+	ctx context.Context,
+	req *ssov1.ListSigningKeysRequest,
+) (*ssov1.ListSigningKeysResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	list, err := s.keys.ListKeys(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &ssov1.ListSigningKeysResponse{Keys: make([]*ssov1.SigningKey, 0, len(list))}
+	for _, key := range list {
+		resp.Keys = append(resp.Keys, toSigningKey(key))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) DeleteSigningKey(
+	ctx context.Context,
+	req *ssov1.DeleteSigningKeyRequest,
+) (*ssov1.DeleteSigningKeyResponse, error) {
+	if req.GetKeyId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "key_id is required")
+	}
+
+	if err := s.keys.DeleteKey(ctx, req.GetKeyId()); err != nil {
+		if errors.Is(err, jwt.ErrKeyNotFound) {
+			return nil, status.Error(codes.NotFound, "key not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.DeleteSigningKeyResponse{}, nil
+}
+
+func toSigningKey(key models.SigningKey) *ssov1.SigningKey {
+	return &ssov1.SigningKey{
+		KeyId:       key.ID,
+		AppId:       int32(key.AppID),
+		Algorithm:   key.Algorithm,
+		State:       key.State,
+		CreatedAt:   key.CreatedAt.Unix(),
+		ActivatedAt: unixOrZero(key.ActivatedAt),
+		ExpiresAt:   unixOrZero(key.ExpiresAt),
+	}
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
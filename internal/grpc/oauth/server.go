@@ -0,0 +1,99 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+
+	ssov1 "github.com/nhassl3/gRPC-sso-service/gen/go/sso"
+	"github.com/nhassl3/sso/internal/services/oauth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	emptyValue = 0
+)
+
+type OAuth interface {
+	ClientCredentials(ctx context.Context, appID int, clientSecret string, scope string) (token oauth.AppToken, err error)
+	VerifyDevice(ctx context.Context, accessToken string, userCode string, approve bool) error
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedOAuthServer
+	oauth OAuth
+}
+
+func Register(gRPC *grpc.Server, oauth OAuth) {
+	ssov1.RegisterOAuthServer(gRPC, &serverAPI{oauth: oauth})
+}
+
+func (s *serverAPI) ClientCredentials(
+	ctx context.Context,
+	req *ssov1.ClientCredentialsRequest,
+) (*ssov1.ClientCredentialsResponse, error) {
+	if err := validateClientCredentials(req); err != nil {
+		return nil, err
+	}
+
+	token, err := s.oauth.ClientCredentials(ctx, int(req.GetAppId()), req.GetClientSecret(), req.GetScope())
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidClient) {
+			return nil, status.Error(codes.Unauthenticated, "invalid client credentials")
+		}
+		if errors.Is(err, oauth.ErrInvalidScope) {
+			return nil, status.Error(codes.PermissionDenied, "scope is not allowed")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.ClientCredentialsResponse{
+		Token:     token.AccessToken,
+		Scope:     token.Scope,
+		ExpiresIn: int64(token.ExpiresIn.Seconds()),
+	}, nil
+}
+
+// VerifyDevice is called by the page at device verification URI on behalf of the logged-in user
+func (s *serverAPI) VerifyDevice(ctx context.Context, req *ssov1.VerifyDeviceRequest) (*ssov1.VerifyDeviceResponse, error) {
+	if err := validateVerifyDevice(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.oauth.VerifyDevice(ctx, req.GetToken(), req.GetUserCode(), req.GetApprove()); err != nil {
+		if errors.Is(err, oauth.ErrAccessDenied) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		if errors.Is(err, oauth.ErrInvalidUserCode) {
+			return nil, status.Error(codes.NotFound, "invalid or expired user code")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.VerifyDeviceResponse{}, nil
+}
+
+func validateClientCredentials(req *ssov1.ClientCredentialsRequest) error {
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	if req.GetClientSecret() == "" {
+		return status.Error(codes.InvalidArgument, "client_secret is required")
+	}
+
+	return nil
+}
+
+func validateVerifyDevice(req *ssov1.VerifyDeviceRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if req.GetUserCode() == "" {
+		return status.Error(codes.InvalidArgument, "user_code is required")
+	}
+
+	return nil
+}
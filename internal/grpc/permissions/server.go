@@ -0,0 +1,405 @@
+package permissions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	ssov1 "github.com/nhassl3/gRPC-sso-service/gen/go/sso"
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/services/permissions"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	emptyValue = 0
+	// maxChecks limits checks of a single CheckPermissions call
+	maxChecks = 100
+)
+
+type Permissions interface {
+	CreateRole(ctx context.Context, appID int, name string) (role models.Role, err error)
+	DeleteRole(ctx context.Context, roleID int64) error
+	Roles(ctx context.Context, appID int) (roles []models.Role, err error)
+	CreatePermission(ctx context.Context, appID int, name string) (permission models.Permission, err error)
+	DeletePermission(ctx context.Context, permissionID int64) error
+	Permissions(ctx context.Context, appID int) (permissions []models.Permission, err error)
+	GrantPermission(ctx context.Context, roleID int64, permissionID int64) error
+	RevokePermission(ctx context.Context, roleID int64, permissionID int64) error
+	AssignRole(ctx context.Context, userID int64, roleID int64) error
+	UnassignRole(ctx context.Context, userID int64, roleID int64) error
+	UserRoles(ctx context.Context, userID int64, appID int) (roles []models.Role, err error)
+	HasPermission(ctx context.Context, userID int64, appID int, permission string) (has bool, err error)
+	CheckPermissions(
+		ctx context.Context,
+		checks []models.PermissionCheck,
+	) (decisions []models.PermissionDecision, err error)
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedPermissionsServer
+	permissions Permissions
+}
+
+func Register(gRPC *grpc.Server, permissions Permissions) {
+	ssov1.RegisterPermissionsServer(gRPC, &serverAPI{permissions: permissions})
+}
+
+func (s *serverAPI) CreateRole(
+	ctx context.Context,
+	req *ssov1.CreateRoleRequest,
+) (*ssov1.CreateRoleResponse, error) {
+	if err := validateNamed(req.GetAppId(), req.GetName()); err != nil {
+		return nil, err
+	}
+
+	role, err := s.permissions.CreateRole(ctx, int(req.GetAppId()), strings.TrimSpace(req.GetName()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.CreateRoleResponse{Role: toRole(role)}, nil
+}
+
+func (s *serverAPI) DeleteRole(
+	ctx context.Context,
+	req *ssov1.DeleteRoleRequest,
+) (*ssov1.DeleteRoleResponse, error) {
+	if req.GetRoleId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "role_id is required")
+	}
+
+	if err := s.permissions.DeleteRole(ctx, req.GetRoleId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.DeleteRoleResponse{}, nil
+}
+
+func (s *serverAPI) ListRoles(
+	ctx context.Context,
+	req *ssov1.ListRolesRequest,
+) (*ssov1.ListRolesResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	roles, err := s.permissions.Roles(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.ListRolesResponse{Roles: toRoles(roles)}, nil
+}
+
+func (s *serverAPI) CreatePermission(
+	ctx context.Context,
+	req *ssov1.CreatePermissionRequest,
+) (*ssov1.CreatePermissionResponse, error) {
+	if err := validateNamed(req.GetAppId(), req.GetName()); err != nil {
+		return nil, err
+	}
+
+	permission, err := s.permissions.CreatePermission(ctx, int(req.GetAppId()), strings.TrimSpace(req.GetName()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.CreatePermissionResponse{Permission: toPermission(permission)}, nil
+}
+
+func (s *serverAPI) DeletePermission(
+	ctx context.Context,
+	req *ssov1.DeletePermissionRequest,
+) (*ssov1.DeletePermissionResponse, error) {
+	if req.GetPermissionId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "permission_id is required")
+	}
+
+	if err := s.permissions.DeletePermission(ctx, req.GetPermissionId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.DeletePermissionResponse{}, nil
+}
+
+func (s *serverAPI) ListPermissions(
+	ctx context.Context,
+	req *ssov1.ListPermissionsRequest,
+) (*ssov1.ListPermissionsResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	list, err := s.permissions.Permissions(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListPermissionsResponse{Permissions: make([]*ssov1.Permission, 0, len(list))}
+	for _, permission := range list {
+		resp.Permissions = append(resp.Permissions, toPermission(permission))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) GrantPermission(
+	ctx context.Context,
+	req *ssov1.GrantPermissionRequest,
+) (*ssov1.GrantPermissionResponse, error) {
+	if err := validateGrant(req.GetRoleId(), req.GetPermissionId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.permissions.GrantPermission(ctx, req.GetRoleId(), req.GetPermissionId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.GrantPermissionResponse{}, nil
+}
+
+func (s *serverAPI) RevokePermission(
+	ctx context.Context,
+	req *ssov1.RevokePermissionRequest,
+) (*ssov1.RevokePermissionResponse, error) {
+	if err := validateGrant(req.GetRoleId(), req.GetPermissionId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.permissions.RevokePermission(ctx, req.GetRoleId(), req.GetPermissionId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.RevokePermissionResponse{}, nil
+}
+
+func (s *serverAPI) AssignRole(
+	ctx context.Context,
+	req *ssov1.AssignRoleRequest,
+) (*ssov1.AssignRoleResponse, error) {
+	if err := validateAssignment(req.GetUserId(), req.GetRoleId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.permissions.AssignRole(ctx, req.GetUserId(), req.GetRoleId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.AssignRoleResponse{}, nil
+}
+
+func (s *serverAPI) UnassignRole(
+	ctx context.Context,
+	req *ssov1.UnassignRoleRequest,
+) (*ssov1.UnassignRoleResponse, error) {
+	if err := validateAssignment(req.GetUserId(), req.GetRoleId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.permissions.UnassignRole(ctx, req.GetUserId(), req.GetRoleId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.UnassignRoleResponse{}, nil
+}
+
+func (s *serverAPI) ListUserRoles(
+	ctx context.Context,
+	req *ssov1.ListUserRolesRequest,
+) (*ssov1.ListUserRolesResponse, error) {
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	roles, err := s.permissions.UserRoles(ctx, req.GetUserId(), int(req.GetAppId()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.ListUserRolesResponse{Roles: toRoles(roles)}, nil
+}
+
+func (s *serverAPI) HasPermission(
+	ctx context.Context,
+	req *ssov1.HasPermissionRequest,
+) (*ssov1.HasPermissionResponse, error) {
+	if err := validateHasPermission(req); err != nil {
+		return nil, err
+	}
+
+	has, err := s.permissions.HasPermission(ctx, req.GetUserId(), int(req.GetAppId()), req.GetPermission())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.HasPermissionResponse{HasPermission: has}, nil
+}
+
+func (s *serverAPI) CheckPermissions(
+	ctx context.Context,
+	req *ssov1.CheckPermissionsRequest,
+) (*ssov1.CheckPermissionsResponse, error) {
+	if err := validateCheckPermissions(req); err != nil {
+		return nil, err
+	}
+
+	checks := make([]models.PermissionCheck, 0, len(req.GetChecks()))
+	for _, check := range req.GetChecks() {
+		checks = append(checks, models.PermissionCheck{
+			UserID:   check.GetUserId(),
+			AppID:    int(check.GetAppId()),
+			Resource: check.GetResource(),
+			Action:   check.GetAction(),
+		})
+	}
+
+	decisions, err := s.permissions.CheckPermissions(ctx, checks)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.CheckPermissionsResponse{Decisions: make([]*ssov1.PermissionDecision, 0, len(decisions))}
+	for _, decision := range decisions {
+		resp.Decisions = append(resp.Decisions, &ssov1.PermissionDecision{
+			Allowed: decision.Allowed,
+			Reason:  decision.Reason,
+		})
+	}
+
+	return resp, nil
+}
+
+func validateNamed(appID int32, name string) error {
+	if appID == emptyValue {
+		return status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	if strings.TrimSpace(name) == "" {
+		return status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	return nil
+}
+
+func validateGrant(roleID int64, permissionID int64) error {
+	if roleID == emptyValue {
+		return status.Error(codes.InvalidArgument, "role_id is required")
+	}
+
+	if permissionID == emptyValue {
+		return status.Error(codes.InvalidArgument, "permission_id is required")
+	}
+
+	return nil
+}
+
+func validateAssignment(userID int64, roleID int64) error {
+	if userID == emptyValue {
+		return status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if roleID == emptyValue {
+		return status.Error(codes.InvalidArgument, "role_id is required")
+	}
+
+	return nil
+}
+
+func validateHasPermission(req *ssov1.HasPermissionRequest) error {
+	if req.GetUserId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	if req.GetPermission() == "" {
+		return status.Error(codes.InvalidArgument, "permission is required")
+	}
+
+	return nil
+}
+
+func validateCheckPermissions(req *ssov1.CheckPermissionsRequest) error {
+	if len(req.GetChecks()) == 0 {
+		return status.Error(codes.InvalidArgument, "checks are required")
+	}
+
+	if len(req.GetChecks()) > maxChecks {
+		return status.Errorf(codes.InvalidArgument, "at most %d checks are allowed", maxChecks)
+	}
+
+	for i, check := range req.GetChecks() {
+		field := fmt.Sprintf("checks[%d]", i)
+
+		switch {
+		case check.GetUserId() == emptyValue:
+			return status.Error(codes.InvalidArgument, field+".user_id is required")
+		case check.GetAppId() == emptyValue:
+			return status.Error(codes.InvalidArgument, field+".app_id is required")
+		case check.GetResource() == "":
+			return status.Error(codes.InvalidArgument, field+".resource is required")
+		case check.GetAction() == "":
+			return status.Error(codes.InvalidArgument, field+".action is required")
+		}
+	}
+
+	return nil
+}
+
+// toStatus maps errors of the permissions service to gRPC statuses
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, permissions.ErrInvalidAppID):
+		return status.Error(codes.NotFound, "app not found")
+	case errors.Is(err, permissions.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, permissions.ErrRoleNotFound):
+		return status.Error(codes.NotFound, "role not found")
+	case errors.Is(err, permissions.ErrPermissionNotFound):
+		return status.Error(codes.NotFound, "permission not found")
+	case errors.Is(err, permissions.ErrRoleExists):
+		return status.Error(codes.AlreadyExists, "role already exists")
+	case errors.Is(err, permissions.ErrPermissionExists):
+		return status.Error(codes.AlreadyExists, "permission already exists")
+	case errors.Is(err, permissions.ErrAppMismatch):
+		return status.Error(codes.FailedPrecondition, "role and permission belong to different apps")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func toRole(role models.Role) *ssov1.Role {
+	return &ssov1.Role{
+		Id:          role.ID,
+		AppId:       int32(role.AppID),
+		Name:        role.Name,
+		Permissions: role.Permissions,
+	}
+}
+
+func toRoles(roles []models.Role) []*ssov1.Role {
+	resp := make([]*ssov1.Role, 0, len(roles))
+	for _, role := range roles {
+		resp = append(resp, toRole(role))
+	}
+
+	return resp
+}
+
+func toPermission(permission models.Permission) *ssov1.Permission {
+	return &ssov1.Permission{
+		Id:    permission.ID,
+		AppId: int32(permission.AppID),
+		Name:  permission.Name,
+	}
+}
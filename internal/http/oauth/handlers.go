@@ -0,0 +1,505 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/opaque"
+	"github.com/nhassl3/sso/internal/services/oauth"
+)
+
+const (
+	opAuthorize = "http.oauth.Authorize"
+	opToken     = "http.oauth.Token"
+	opDevice    = "http.oauth.DeviceAuthorization"
+)
+
+// csrfCookie keeps CSRF token of the login form, the form must send the same token back
+const csrfCookie = "sso_csrf"
+
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// OAuth 2.0 error codes (RFC 6749, section 5.2)
+const (
+	errInvalidRequest       = "invalid_request"
+	errInvalidClient        = "invalid_client"
+	errInvalidGrant         = "invalid_grant"
+	errInvalidScope         = "invalid_scope"
+	errUnsupportedGrantType = "unsupported_grant_type"
+	errAccessDenied         = "access_denied"
+	errServerError          = "server_error"
+
+	// device authorization grant error codes (RFC 8628, section 3.5)
+	errAuthorizationPending = "authorization_pending"
+	errSlowDown             = "slow_down"
+	errExpiredToken         = "expired_token"
+)
+
+type OAuth interface {
+	ValidateAuthorizationRequest(ctx context.Context, req oauth.AuthorizationRequest) error
+	Authorize(
+		ctx context.Context,
+		req oauth.AuthorizationRequest,
+		email string,
+		password string,
+		otp string,
+	) (code string, err error)
+	ExchangeCode(
+		ctx context.Context,
+		appID int,
+		clientSecret string,
+		code string,
+		redirectURI string,
+		codeVerifier string,
+	) (tokens models.Tokens, scope string, err error)
+	Refresh(ctx context.Context, appID int, clientSecret string, refreshToken string) (tokens models.Tokens, err error)
+	ClientCredentials(ctx context.Context, appID int, clientSecret string, scope string) (token oauth.AppToken, err error)
+	DeviceAuthorization(
+		ctx context.Context,
+		appID int,
+		clientSecret string,
+		scope string,
+	) (authorization oauth.DeviceAuthorization, err error)
+	PollDeviceCode(
+		ctx context.Context,
+		appID int,
+		clientSecret string,
+		deviceCode string,
+	) (tokens models.Tokens, scope string, err error)
+}
+
+type handlers struct {
+	log      *slog.Logger
+	oauth    OAuth
+	tokenTTL time.Duration
+}
+
+// Register registers OAuth 2.0 authorization and token endpoints
+func Register(mux *http.ServeMux, log *slog.Logger, oauth OAuth, tokenTTL time.Duration) {
+	h := &handlers{log: log, oauth: oauth, tokenTTL: tokenTTL}
+
+	mux.HandleFunc("GET /authorize", h.authorizeForm)
+	mux.HandleFunc("POST /authorize", h.authorize)
+	mux.HandleFunc("POST /token", h.token)
+	mux.HandleFunc("POST /device_authorization", h.deviceAuthorization)
+}
+
+// authorizeForm validates authorization request and shows login form
+//
+// The form is bound to the browser with CSRF token kept in a cookie
+func (h *handlers) authorizeForm(w http.ResponseWriter, r *http.Request) {
+	req := authorizationRequest(r.URL.Query())
+
+	if err := h.oauth.ValidateAuthorizationRequest(r.Context(), req); err != nil {
+		h.authorizeError(w, r, req, err, false)
+		return
+	}
+
+	csrfToken, err := opaque.NewID()
+	if err != nil {
+		h.log.Error("failed to generate csrf token", slog.String("op", opAuthorize), sl.ErrLog(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    csrfToken,
+		Path:     "/authorize",
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	renderLoginForm(w, req, csrfToken, "")
+}
+
+// authorize authenticates user and redirects back to the client with authorization code
+//
+// Forms without CSRF token of the cookie are rejected, so other sites can't log
+// users in on their behalf
+func (h *handlers) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	csrfToken, ok := checkCSRF(r)
+	if !ok {
+		http.Error(w, "invalid csrf token", http.StatusForbidden)
+		return
+	}
+
+	req := authorizationRequest(r.PostForm)
+
+	// redirect uri is verified first, so errors of Authorize may be sent to the client
+	if err := h.oauth.ValidateAuthorizationRequest(r.Context(), req); err != nil {
+		h.authorizeError(w, r, req, err, false)
+		return
+	}
+
+	code, err := h.oauth.Authorize(
+		r.Context(),
+		req,
+		r.PostForm.Get("email"),
+		r.PostForm.Get("password"),
+		r.PostForm.Get("otp"),
+	)
+	if err != nil {
+		if errors.Is(err, oauth.ErrAccessDenied) {
+			renderLoginForm(w, req, csrfToken, "Invalid email, password or one-time code")
+			return
+		}
+		if errors.Is(err, oauth.ErrMFARequired) {
+			renderLoginForm(w, req, csrfToken, "Enter the one-time code from your authenticator app or a recovery code")
+			return
+		}
+		if errors.Is(err, oauth.ErrLoginThrottled) {
+			renderLoginForm(w, req, csrfToken, "Too many failed attempts, try again later")
+			return
+		}
+		if errors.Is(err, oauth.ErrEmailNotVerified) {
+			renderLoginForm(w, req, csrfToken, "Verify your email address before signing in to this app")
+			return
+		}
+
+		h.authorizeError(w, r, req, err, true)
+		return
+	}
+
+	redirect(w, r, req.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+	})
+}
+
+// authorizeError reports error of authorization request
+//
+// Errors about client or redirect URI are shown to the user, the rest are sent to the client.
+// Internal errors are sent to the client only if its redirect URI is verified, otherwise
+// they could redirect the user anywhere. ErrInvalidRequest is returned by
+// ValidateAuthorizationRequest after redirect URI is verified
+func (h *handlers) authorizeError(
+	w http.ResponseWriter,
+	r *http.Request,
+	req oauth.AuthorizationRequest,
+	err error,
+	redirectURIVerified bool,
+) {
+	switch {
+	case errors.Is(err, oauth.ErrInvalidClient):
+		http.Error(w, "unknown client", http.StatusBadRequest)
+	case errors.Is(err, oauth.ErrInvalidRedirectURI):
+		http.Error(w, "redirect_uri is not registered for the client", http.StatusBadRequest)
+	case errors.Is(err, oauth.ErrInvalidRequest):
+		redirect(w, r, req.RedirectURI, url.Values{
+			"error":             {errInvalidRequest},
+			"error_description": {err.Error()},
+			"state":             {req.State},
+		})
+	case !redirectURIVerified:
+		h.log.Error("failed to validate authorization request", slog.String("op", opAuthorize), sl.ErrLog(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	default:
+		h.log.Error("failed to authorize", slog.String("op", opAuthorize), sl.ErrLog(err))
+		redirect(w, r, req.RedirectURI, url.Values{
+			"error": {errServerError},
+			"state": {req.State},
+		})
+	}
+}
+
+// token is the token endpoint
+func (h *handlers) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "malformed form")
+		return
+	}
+
+	appID, clientSecret, ok := clientCredentials(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errInvalidClient, "client_id is required")
+		return
+	}
+
+	var (
+		tokens models.Tokens
+		scope  string
+		err    error
+	)
+
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case grantTypeAuthorizationCode:
+		tokens, scope, err = h.oauth.ExchangeCode(
+			r.Context(),
+			appID,
+			clientSecret,
+			r.PostForm.Get("code"),
+			r.PostForm.Get("redirect_uri"),
+			r.PostForm.Get("code_verifier"),
+		)
+	case grantTypeRefreshToken:
+		tokens, err = h.oauth.Refresh(r.Context(), appID, clientSecret, r.PostForm.Get("refresh_token"))
+	case grantTypeDeviceCode:
+		tokens, scope, err = h.oauth.PollDeviceCode(r.Context(), appID, clientSecret, r.PostForm.Get("device_code"))
+	case grantTypeClientCredentials:
+		h.issueAppToken(w, r, appID, clientSecret)
+		return
+	default:
+		writeError(w, http.StatusBadRequest, errUnsupportedGrantType, "")
+		return
+	}
+
+	if err != nil {
+		h.tokenError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(h.tokenTTL.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Scope:        scope,
+	})
+}
+
+// issueAppToken issues token to the client itself, it never gets a refresh token
+func (h *handlers) issueAppToken(w http.ResponseWriter, r *http.Request, appID int, clientSecret string) {
+	token, err := h.oauth.ClientCredentials(r.Context(), appID, clientSecret, r.PostForm.Get("scope"))
+	if err != nil {
+		h.tokenError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken: token.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(token.ExpiresIn.Seconds()),
+		Scope:       token.Scope,
+	})
+}
+
+// deviceAuthorization is the device authorization endpoint (RFC 8628, section 3.1)
+func (h *handlers) deviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "malformed form")
+		return
+	}
+
+	appID, clientSecret, ok := clientCredentials(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errInvalidClient, "client_id is required")
+		return
+	}
+
+	authorization, err := h.oauth.DeviceAuthorization(r.Context(), appID, clientSecret, r.PostForm.Get("scope"))
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidClient) {
+			writeError(w, http.StatusUnauthorized, errInvalidClient, "")
+			return
+		}
+
+		h.log.Error("failed to authorize device", slog.String("op", opDevice), sl.ErrLog(err))
+		writeError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, deviceAuthorizationResponse{
+		DeviceCode:              authorization.DeviceCode,
+		UserCode:                authorization.UserCode,
+		VerificationURI:         authorization.VerificationURI,
+		VerificationURIComplete: authorization.VerificationURIComplete,
+		ExpiresIn:               int64(authorization.ExpiresIn.Seconds()),
+		Interval:                int64(authorization.Interval.Seconds()),
+	})
+}
+
+func (h *handlers) tokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, oauth.ErrInvalidClient):
+		writeError(w, http.StatusUnauthorized, errInvalidClient, "")
+	case errors.Is(err, oauth.ErrInvalidGrant):
+		writeError(w, http.StatusBadRequest, errInvalidGrant, "")
+	case errors.Is(err, oauth.ErrInvalidRequest):
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "")
+	case errors.Is(err, oauth.ErrInvalidScope):
+		writeError(w, http.StatusBadRequest, errInvalidScope, "")
+	case errors.Is(err, oauth.ErrAuthorizationPending):
+		writeError(w, http.StatusBadRequest, errAuthorizationPending, "")
+	case errors.Is(err, oauth.ErrSlowDown):
+		writeError(w, http.StatusBadRequest, errSlowDown, "")
+	case errors.Is(err, oauth.ErrExpiredToken):
+		writeError(w, http.StatusBadRequest, errExpiredToken, "")
+	case errors.Is(err, oauth.ErrAccessDenied):
+		writeError(w, http.StatusBadRequest, errAccessDenied, "")
+	default:
+		h.log.Error("failed to issue token", slog.String("op", opToken), sl.ErrLog(err))
+		writeError(w, http.StatusInternalServerError, errServerError, "")
+	}
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+func authorizationRequest(v url.Values) oauth.AuthorizationRequest {
+	appID, _ := strconv.Atoi(v.Get("client_id"))
+
+	return oauth.AuthorizationRequest{
+		ResponseType:        v.Get("response_type"),
+		AppID:               appID,
+		RedirectURI:         v.Get("redirect_uri"),
+		Scope:               v.Get("scope"),
+		State:               v.Get("state"),
+		Nonce:               v.Get("nonce"),
+		CodeChallenge:       v.Get("code_challenge"),
+		CodeChallengeMethod: v.Get("code_challenge_method"),
+	}
+}
+
+// clientCredentials returns client id and secret from HTTP Basic auth
+// (client_secret_basic) or from the form (client_secret_post or public client)
+func clientCredentials(r *http.Request) (int, string, bool) {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		// RFC 6749 requires credentials in Basic auth to be form-urlencoded
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	appID, err := strconv.Atoi(id)
+	if err != nil || appID <= 0 {
+		return 0, "", false
+	}
+
+	return appID, secret, true
+}
+
+// checkCSRF returns CSRF token of the form if it matches the one of the cookie
+func checkCSRF(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+
+	token := r.PostForm.Get("csrf_token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) != 1 {
+		return "", false
+	}
+
+	return token, true
+}
+
+func redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	q := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			q.Set(key, values[0])
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func writeError(w http.ResponseWriter, code int, errCode string, description string) {
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+	}
+
+	writeJSON(w, code, struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}{
+		Error:            errCode,
+		ErrorDescription: description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<form method="post" action="/authorize">
+	{{if .Error}}<p>{{.Error}}</p>{{end}}
+	<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+	<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+	<input type="hidden" name="client_id" value="{{.Request.AppID}}">
+	<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+	<input type="hidden" name="scope" value="{{.Request.Scope}}">
+	<input type="hidden" name="state" value="{{.Request.State}}">
+	<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+	<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+	<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+	<label>Email <input type="email" name="email" required></label>
+	<label>Password <input type="password" name="password" required></label>
+	<label>One-time code <input type="text" name="otp" autocomplete="one-time-code"></label>
+	<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+func renderLoginForm(w http.ResponseWriter, req oauth.AuthorizationRequest, csrfToken string, errMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Cache-Control", "no-store")
+
+	_ = loginForm.Execute(w, struct {
+		Request   oauth.AuthorizationRequest
+		CSRFToken string
+		Error     string
+	}{
+		Request:   req,
+		CSRFToken: csrfToken,
+		Error:     errMsg,
+	})
+}
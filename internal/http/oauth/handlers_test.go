@@ -0,0 +1,112 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/lib/logger/handlers/slogdiscard"
+	"github.com/nhassl3/sso/internal/services/oauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURI = "https://client.example.com/cb"
+
+var csrfInput = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// fakeOAuth fails validation with validateErr and counts authorizations
+type fakeOAuth struct {
+	OAuth
+	validateErr error
+	authorized  int
+}
+
+func (f *fakeOAuth) ValidateAuthorizationRequest(context.Context, oauth.AuthorizationRequest) error {
+	return f.validateErr
+}
+
+func (f *fakeOAuth) Authorize(context.Context, oauth.AuthorizationRequest, string, string, string) (string, error) {
+	f.authorized++
+
+	return "code", nil
+}
+
+func newTestMux(o OAuth) *http.ServeMux {
+	mux := http.NewServeMux()
+	Register(mux, slogdiscard.NewDiscardLogger(), o, time.Hour)
+
+	return mux
+}
+
+func authorizeQuery() url.Values {
+	return url.Values{
+		"response_type":         {oauth.ResponseTypeCode},
+		"client_id":             {"1"},
+		"redirect_uri":          {redirectURI},
+		"state":                 {"state"},
+		"code_challenge":        {"challenge"},
+		"code_challenge_method": {oauth.ChallengeMethodS256},
+	}
+}
+
+func TestAuthorize_ValidationErrorIsNotRedirected(t *testing.T) {
+	mux := newTestMux(&fakeOAuth{validateErr: errors.New("database is locked")})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/authorize?"+authorizeQuery().Encode(), nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Empty(t, rec.Header().Get("Location"), "unverified redirect uri isn't followed")
+}
+
+func TestAuthorize_CSRF(t *testing.T) {
+	o := &fakeOAuth{}
+	mux := newTestMux(o)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/authorize?"+authorizeQuery().Encode(), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	match := csrfInput.FindStringSubmatch(rec.Body.String())
+	require.NotNil(t, match, "login form has csrf token")
+	assert.Equal(t, cookies[0].Value, match[1])
+
+	post := func(csrfToken string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		form := authorizeQuery()
+		form.Set("email", "user@example.com")
+		form.Set("password", "password")
+		form.Set("csrf_token", csrfToken)
+
+		req := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	// cross-site form doesn't have the cookie, nor can it read the token
+	rec = post("", nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = post("guess", cookies[0])
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Zero(t, o.authorized, "credentials aren't checked without csrf token")
+
+	rec = post(match[1], cookies[0])
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Location"), redirectURI+"?code=code"))
+}
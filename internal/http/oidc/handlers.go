@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/services/auth"
+)
+
+const (
+	opUserInfo = "http.oidc.UserInfo"
+)
+
+type UserInfoProvider interface {
+	UserInfo(ctx context.Context, accessToken string) (user models.User, err error)
+}
+
+type handlers struct {
+	log  *slog.Logger
+	auth UserInfoProvider
+}
+
+// Register registers OpenID Connect endpoints
+func Register(mux *http.ServeMux, log *slog.Logger, auth UserInfoProvider) {
+	h := &handlers{log: log, auth: auth}
+
+	mux.HandleFunc("GET /userinfo", h.userInfo)
+	mux.HandleFunc("POST /userinfo", h.userInfo)
+}
+
+func (h *handlers) userInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.auth.UserInfo(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		h.log.Error("failed to get user info", slog.String("op", opUserInfo), sl.ErrLog(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}{
+		Subject:       strconv.FormatInt(user.ID, 10),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+	})
+}
+
+// bearerToken extracts token from "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,107 @@
+package wellknown
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+)
+
+const (
+	opJWKS = "http.wellknown.JWKS"
+)
+
+type Keys interface {
+	JWKS(ctx context.Context) (keys []jwt.JWK, err error)
+}
+
+// Discovery is OpenID Provider metadata (OpenID Connect Discovery 1.0)
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type handlers struct {
+	log       *slog.Logger
+	keys      Keys
+	discovery Discovery
+}
+
+// Register registers /.well-known/* endpoints
+//
+// issuer is the external base URL of the service, all endpoints in discovery document are relative to it
+func Register(mux *http.ServeMux, log *slog.Logger, keys Keys, issuer string) {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	h := &handlers{
+		log:  log,
+		keys: keys,
+		discovery: Discovery{
+			Issuer:                      issuer,
+			AuthorizationEndpoint:       issuer + "/authorize",
+			TokenEndpoint:               issuer + "/token",
+			DeviceAuthorizationEndpoint: issuer + "/device_authorization",
+			JWKSURI:                     issuer + "/.well-known/jwks.json",
+			UserInfoEndpoint:            issuer + "/userinfo",
+			ScopesSupported:             []string{"openid", "email"},
+			ResponseTypesSupported:      []string{"code"},
+			GrantTypesSupported: []string{
+				"authorization_code",
+				"refresh_token",
+				"client_credentials",
+				"urn:ietf:params:oauth:grant-type:device_code",
+			},
+			SubjectTypesSupported: []string{"public"},
+			IDTokenSigningAlgValuesSupported: []string{
+				jwt.AlgRS256, jwt.AlgES256, jwt.AlgES384, jwt.AlgES512, jwt.AlgEdDSA, "HS256",
+			},
+			TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post"},
+			CodeChallengeMethodsSupported:     []string{"S256"},
+			ClaimsSupported:                   []string{"iss", "sub", "aud", "iat", "exp", "auth_time", "nonce", "email", "email_verified"},
+		},
+	}
+
+	mux.HandleFunc("GET /.well-known/jwks.json", h.jwks)
+	mux.HandleFunc("GET /.well-known/openid-configuration", h.openIDConfiguration)
+}
+
+func (h *handlers) jwks(w http.ResponseWriter, r *http.Request) {
+	jwks, err := h.keys.JWKS(r.Context())
+	if err != nil {
+		h.log.Error("failed to get keys", slog.String("op", opJWKS), sl.ErrLog(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, struct {
+		Keys []jwt.JWK `json:"keys"`
+	}{Keys: jwks})
+}
+
+func (h *handlers) openIDConfiguration(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, h.discovery)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
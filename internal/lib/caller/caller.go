@@ -0,0 +1,32 @@
+// Package caller carries the authenticated caller of a request through request
+// context, so handlers can authorize requests without parsing tokens themselves
+package caller
+
+import "context"
+
+// Caller is a user, or a client with zero UserID, whose access token came with the request
+type Caller struct {
+	UserID int64
+	AppID  int
+	Admin  bool
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying the caller
+func NewContext(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, ctxKey{}, c)
+}
+
+// FromContext returns the caller carried by ctx and false if there is none
+func FromContext(ctx context.Context) (Caller, bool) {
+	c, ok := ctx.Value(ctxKey{}).(Caller)
+
+	return c, ok
+}
+
+// CanActFor reports if the caller may act on behalf of the user: admins may act
+// for anyone, other users only for themselves
+func (c Caller) CanActFor(userID int64) bool {
+	return c.Admin || c.UserID == userID
+}
@@ -0,0 +1,33 @@
+// Package clientip carries network address of the client through request context,
+// so services can account requests per client without knowing the transport
+package clientip
+
+import (
+	"context"
+	"net"
+)
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying client IP address
+func NewContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, ip)
+}
+
+// FromContext returns client IP address carried by ctx, empty if there is none
+func FromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(ctxKey{}).(string)
+
+	return ip
+}
+
+// FromAddr returns IP address of the network address, e.g. "203.0.113.7" of
+// "203.0.113.7:52314". Address without port is returned as is
+func FromAddr(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
@@ -0,0 +1,21 @@
+package clientip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	assert.Empty(t, FromContext(context.Background()))
+
+	ctx := NewContext(context.Background(), "203.0.113.7")
+	assert.Equal(t, "203.0.113.7", FromContext(ctx))
+}
+
+func TestFromAddr(t *testing.T) {
+	assert.Equal(t, "203.0.113.7", FromAddr("203.0.113.7:52314"))
+	assert.Equal(t, "2001:db8::1", FromAddr("[2001:db8::1]:443"))
+	assert.Equal(t, "203.0.113.7", FromAddr("203.0.113.7"))
+}
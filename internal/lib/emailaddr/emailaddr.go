@@ -0,0 +1,134 @@
+package emailaddr
+
+import (
+	"errors"
+	"net/mail"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	// maxLength is the longest address that fits into SMTP path, RFC 5321
+	maxLength = 254
+	// maxLocalLength is the longest local part, RFC 5321
+	maxLocalLength = 64
+)
+
+// ErrInvalid is returned for strings that aren't a bare email address
+var ErrInvalid = errors.New("invalid email address")
+
+// Validate checks that addr is a single address without display name,
+// e.g. "bob@example.com" but not "Bob <bob@example.com>"
+func Validate(addr string) error {
+	if utf8.RuneCountInString(addr) > maxLength {
+		return ErrInvalid
+	}
+
+	if strings.TrimSpace(addr) != addr || strings.HasPrefix(addr, "<") {
+		return ErrInvalid
+	}
+
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil || parsed.Name != "" {
+		return ErrInvalid
+	}
+
+	local, _ := split(addr)
+	if utf8.RuneCountInString(local) > maxLocalLength {
+		return ErrInvalid
+	}
+
+	return nil
+}
+
+// Normalizer makes the canonical form of addresses, the same for
+// addresses delivered to the same mailbox
+//
+// Surrounding spaces are trimmed, the domain is lowercased and converted
+// to punycode. Local part is case-sensitive by RFC 5321, though most mail
+// servers ignore its case, FoldLocalPart lowercases it as well
+type Normalizer struct {
+	FoldLocalPart bool
+}
+
+// Normalize returns canonical form of addr or ErrInvalid
+func (n Normalizer) Normalize(addr string) (string, error) {
+	addr = strings.TrimSpace(addr)
+	if err := Validate(addr); err != nil {
+		return "", err
+	}
+
+	local, domain := split(addr)
+
+	domain, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", ErrInvalid
+	}
+
+	if n.FoldLocalPart {
+		local = strings.ToLower(local)
+	}
+
+	return local + "@" + domain, nil
+}
+
+// Key returns canonical form of addr to key per-address state by, e.g. lookups
+// or rate limits. Invalid addresses are returned trimmed, so they match no valid one
+func (n Normalizer) Key(addr string) string {
+	normalized, err := n.Normalize(addr)
+	if err != nil {
+		return strings.TrimSpace(addr)
+	}
+
+	return normalized
+}
+
+// split splits addr at the last "@", as quoted local part may contain it too
+func split(addr string) (local string, domain string) {
+	i := strings.LastIndexByte(addr, '@')
+	if i < 0 {
+		return addr, ""
+	}
+
+	return addr[:i], addr[i+1:]
+}
+
+// Collision is a group of different addresses with the same canonical form
+type Collision struct {
+	Normalized string
+	IDs        []int64
+}
+
+// Collisions groups addresses by ID into collisions of their canonical forms.
+// IDs of addresses that can't be normalized are returned as invalid
+func (n Normalizer) Collisions(addrs map[int64]string) (collisions []Collision, invalid []int64) {
+	groups := make(map[string][]int64, len(addrs))
+
+	for id, addr := range addrs {
+		normalized, err := n.Normalize(addr)
+		if err != nil {
+			invalid = append(invalid, id)
+
+			continue
+		}
+
+		groups[normalized] = append(groups[normalized], id)
+	}
+
+	for normalized, ids := range groups {
+		if len(ids) > 1 {
+			slices.Sort(ids)
+			collisions = append(collisions, Collision{Normalized: normalized, IDs: ids})
+		}
+	}
+
+	slices.SortFunc(collisions, func(a, b Collision) int {
+		return strings.Compare(a.Normalized, b.Normalized)
+	})
+	slices.Sort(invalid)
+
+	return collisions, invalid
+}
@@ -0,0 +1,89 @@
+package emailaddr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []string{
+		"bob@example.com",
+		"bob.smith+tag@sub.example.co.uk",
+		`"bob@home"@example.com`,
+		"боб@пример.рф",
+	}
+
+	for _, addr := range valid {
+		assert.NoError(t, Validate(addr), addr)
+	}
+
+	invalid := []string{
+		"",
+		"bob",
+		"bob@",
+		"@example.com",
+		"Bob <bob@example.com>",
+		"<bob@example.com>",
+		"bob@example.com, alice@example.com",
+		" bob@example.com",
+		strings.Repeat("a", 65) + "@example.com",
+		"bob@" + strings.Repeat("a", 250) + ".com",
+	}
+
+	for _, addr := range invalid {
+		assert.ErrorIs(t, Validate(addr), ErrInvalid, addr)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		fold bool
+		addr string
+		want string
+	}{
+		{name: "domain case", addr: "Bob@Example.COM", want: "Bob@example.com"},
+		{name: "fold local part", fold: true, addr: "Bob@Example.COM", want: "bob@example.com"},
+		{name: "spaces", addr: "  bob@example.com\t", want: "bob@example.com"},
+		{name: "idna", addr: "bob@Bücher.example", want: "bob@xn--bcher-kva.example"},
+		{name: "unicode local part kept", fold: true, addr: "Боб@пример.рф", want: "боб@xn--e1afmkfd.xn--p1ai"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalizer{FoldLocalPart: tt.fold}.Normalize(tt.addr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := Normalizer{}.Normalize("not an email")
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestKey(t *testing.T) {
+	n := Normalizer{FoldLocalPart: true}
+
+	assert.Equal(t, "bob@example.com", n.Key(" Bob@EXAMPLE.com "))
+	assert.Equal(t, "not an email", n.Key(" not an email "))
+}
+
+func TestCollisions(t *testing.T) {
+	addrs := map[int64]string{
+		1: "bob@example.com",
+		2: "Bob@EXAMPLE.com",
+		3: "alice@example.com",
+		4: "bob@Example.com",
+		5: "broken",
+	}
+
+	collisions, invalid := Normalizer{FoldLocalPart: true}.Collisions(addrs)
+	assert.Equal(t, []Collision{{Normalized: "bob@example.com", IDs: []int64{1, 2, 4}}}, collisions)
+	assert.Equal(t, []int64{5}, invalid)
+
+	collisions, _ = Normalizer{}.Collisions(addrs)
+	assert.Equal(t, []Collision{{Normalized: "bob@example.com", IDs: []int64{1, 4}}}, collisions)
+}
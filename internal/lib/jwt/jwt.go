@@ -1,26 +1,180 @@
 package jwt
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"time"
 
 	JWT "github.com/golang-jwt/jwt"
 	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/opaque"
 )
 
+var (
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Claims is a set of claims of the token generated by NewToken or NewAppToken
+//
+// UserID is zero for tokens of the app itself
+type Claims struct {
+	ID            string
+	Subject       string
+	UserID        int64
+	Email         string
+	EmailVerified bool
+	AppID         int
+	Scope         string
+	Roles         []string
+	IssuedAt      time.Time
+	ExpiresAt     time.Time
+}
+
+// IDToken describes OpenID Connect ID token generated by NewIDToken
+type IDToken struct {
+	Issuer   string
+	Nonce    string
+	AuthTime time.Time
+}
+
+// Option configures token generated by NewToken
+type Option func(o *options)
+
+type options struct {
+	key   *Key
+	roles []string
+}
+
+// WithKey signs token with the given asymmetric key instead of app secret
+func WithKey(key Key) Option {
+	return func(o *options) {
+		o.key = &key
+	}
+}
+
+// WithRoles adds names of user roles in the app as the "roles" claim
+func WithRoles(roles []string) Option {
+	return func(o *options) {
+		o.roles = roles
+	}
+}
+
 // NewToken generate JWToken that let user get some actions in some services
-func NewToken(user models.User, app models.App, duration time.Duration) (string, error) {
-	if app.Secret == "" || duration == time.Duration(0) {
+//
+// By default token is signed with HS256 using app secret
+func NewToken(user models.User, app models.App, duration time.Duration, opts ...Option) (string, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if (o.key == nil && app.Secret == "") || duration == time.Duration(0) {
+		return "", fmt.Errorf("not valid input token data")
+	}
+
+	jti, err := opaque.NewID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	claims := JWT.MapClaims{
+		"jti":            jti,
+		"uid":            user.ID,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"iat":            numericDate(now),
+		"exp":            now.Add(duration).Unix(),
+		"app_id":         app.ID,
+	}
+	if len(o.roles) > 0 {
+		claims["roles"] = o.roles
+	}
+
+	return sign(claims, app, o)
+}
+
+// NewAppToken generate JWToken that represents the app itself rather than a user
+//
+// Subject of the token is app id, scope is a space-delimited list of granted scopes.
+// Like NewToken, it's signed with app secret by default
+func NewAppToken(app models.App, duration time.Duration, scope string, opts ...Option) (string, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if (o.key == nil && app.Secret == "") || duration == time.Duration(0) {
+		return "", fmt.Errorf("not valid input token data")
+	}
+
+	jti, err := opaque.NewID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	claims := JWT.MapClaims{
+		"jti":    jti,
+		"sub":    strconv.Itoa(app.ID),
+		"iat":    numericDate(now),
+		"exp":    now.Add(duration).Unix(),
+		"app_id": app.ID,
+	}
+
+	if scope != "" {
+		claims["scope"] = scope
+	}
+
+	return sign(claims, app, o)
+}
+
+// NewIDToken generate OpenID Connect ID token for the user authenticated in the app
+//
+// Audience of the token is app id. Like NewToken, it's signed with app secret by default
+func NewIDToken(user models.User, app models.App, duration time.Duration, id IDToken, opts ...Option) (string, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if (o.key == nil && app.Secret == "") || duration == time.Duration(0) || id.Issuer == "" {
 		return "", fmt.Errorf("not valid input token data")
 	}
 
-	token := JWT.New(JWT.SigningMethodHS256)
+	now := time.Now()
 
-	claims := token.Claims.(JWT.MapClaims)
-	claims["uid"] = user.ID
-	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(duration).Unix()
-	claims["app_id"] = app.ID
+	claims := JWT.MapClaims{
+		"iss":            id.Issuer,
+		"sub":            strconv.FormatInt(user.ID, 10),
+		"aud":            strconv.Itoa(app.ID),
+		"iat":            now.Unix(),
+		"exp":            now.Add(duration).Unix(),
+		"auth_time":      id.AuthTime.Unix(),
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+	}
+
+	if id.Nonce != "" {
+		claims["nonce"] = id.Nonce
+	}
+
+	return sign(claims, app, o)
+}
+
+func sign(claims JWT.MapClaims, app models.App, o options) (string, error) {
+	if o.key != nil {
+		return o.key.sign(claims)
+	}
+
+	token := JWT.NewWithClaims(JWT.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString([]byte(app.Secret))
 	if err != nil {
@@ -29,3 +183,116 @@ func NewToken(user models.User, app models.App, duration time.Duration) (string,
 
 	return tokenString, nil
 }
+
+// KeyFunc returns key to verify token with
+//
+// kid is empty for tokens signed with app secret, then secret of the app
+// must be returned as []byte. Otherwise public key with given id is expected
+type KeyFunc func(appID int, kid string) (interface{}, error)
+
+// Parse verifies token generated by NewToken and returns its claims
+//
+// Error returned by keyFunc is passed to the caller as is, any other failure is ErrInvalidToken
+func Parse(tokenString string, keyFunc KeyFunc) (Claims, error) {
+	var keyErr error
+
+	token, err := JWT.Parse(tokenString, func(token *JWT.Token) (interface{}, error) {
+		claims, ok := token.Claims.(JWT.MapClaims)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+
+		appID, ok := claims["app_id"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("app_id claim is missing")
+		}
+
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := keyFunc(int(appID), kid)
+		if err != nil {
+			keyErr = err
+			return nil, err
+		}
+
+		// prevents algorithm confusion, e.g. HS256 token "signed" with a public key
+		if err = checkMethod(token.Method, key); err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	})
+	if keyErr != nil {
+		return Claims{}, keyErr
+	}
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	return claimsFromMap(token.Claims.(JWT.MapClaims))
+}
+
+func checkMethod(method JWT.SigningMethod, key interface{}) error {
+	var ok bool
+
+	switch key.(type) {
+	case []byte:
+		_, ok = method.(*JWT.SigningMethodHMAC)
+	case *rsa.PublicKey:
+		_, ok = method.(*JWT.SigningMethodRSA)
+	case *ecdsa.PublicKey:
+		_, ok = method.(*JWT.SigningMethodECDSA)
+	case ed25519.PublicKey:
+		_, ok = method.(*JWT.SigningMethodEd25519)
+	}
+
+	if !ok {
+		return fmt.Errorf("unexpected signing method: %s", method.Alg())
+	}
+
+	return nil
+}
+
+// numericDate returns t as NumericDate with millisecond precision
+//
+// NumericDate may be fractional, so tokens issued within the same second as
+// sessions were revoked can be told apart by their issue time
+func numericDate(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1e3
+}
+
+func claimsFromMap(m JWT.MapClaims) (Claims, error) {
+	jti, _ := m["jti"].(string)
+	sub, _ := m["sub"].(string)
+	scope, _ := m["scope"].(string)
+	uid, _ := m["uid"].(float64)
+	email, _ := m["email"].(string)
+	emailVerified, _ := m["email_verified"].(bool)
+	appID, _ := m["app_id"].(float64)
+	iat, _ := m["iat"].(float64)
+	exp, ok := m["exp"].(float64)
+	if !ok || jti == "" {
+		return Claims{}, fmt.Errorf("%w: required claims are missing", ErrInvalidToken)
+	}
+
+	var roles []string
+	list, _ := m["roles"].([]interface{})
+	for _, role := range list {
+		if name, ok := role.(string); ok {
+			roles = append(roles, name)
+		}
+	}
+
+	return Claims{
+		ID:            jti,
+		Subject:       sub,
+		UserID:        int64(uid),
+		Email:         email,
+		EmailVerified: emailVerified,
+		AppID:         int(appID),
+		Scope:         scope,
+		Roles:         roles,
+		IssuedAt:      time.UnixMilli(int64(math.Round(iat * 1e3))),
+		ExpiresAt:     time.Unix(int64(exp), 0),
+	}, nil
+}
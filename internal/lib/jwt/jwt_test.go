@@ -94,6 +94,7 @@ func TestNewToken(t *testing.T) {
 				assert.EqualValues(t, tt.user.ID, claims["uid"])
 				assert.Equal(t, tt.user.Email, claims["email"])
 				assert.EqualValues(t, tt.app.ID, claims["app_id"])
+				assert.NotEmpty(t, claims["jti"])
 
 				exp := claims["exp"].(float64)
 				assert.WithinDuration(t, time.Unix(int64(exp), 0), time.Now().Add(tt.duration), time.Minute)
@@ -101,3 +102,89 @@ func TestNewToken(t *testing.T) {
 		})
 	}
 }
+
+func TestParse(t *testing.T) {
+	user := models.User{ID: 42, Email: "user@example.com", EmailVerified: true}
+	app := models.App{ID: 7, Secret: "mysecret"}
+	issuedAfter := time.Now().Truncate(time.Millisecond)
+
+	tokenString, err := NewToken(user, app, time.Hour, WithRoles([]string{"admin", "editor"}))
+	assert.NoError(t, err)
+
+	claims, err := Parse(tokenString, func(appID int, kid string) (interface{}, error) {
+		assert.Equal(t, app.ID, appID)
+		assert.Empty(t, kid)
+		return []byte(app.Secret), nil
+	})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, claims.ID)
+	assert.Equal(t, user.ID, claims.UserID)
+	assert.Equal(t, user.Email, claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, app.ID, claims.AppID)
+	assert.Equal(t, []string{"admin", "editor"}, claims.Roles)
+	// issue time keeps milliseconds
+	assert.False(t, claims.IssuedAt.Before(issuedAfter))
+	assert.WithinDuration(t, issuedAfter, claims.IssuedAt, time.Second)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), claims.ExpiresAt, time.Minute)
+
+	_, err = Parse(tokenString, func(int, string) (interface{}, error) { return []byte("wrong"), nil })
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	expired, err := NewToken(user, app, -time.Minute)
+	assert.NoError(t, err)
+
+	_, err = Parse(expired, func(int, string) (interface{}, error) { return []byte(app.Secret), nil })
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestNewIDToken(t *testing.T) {
+	user := models.User{ID: 42, Email: "user@example.com"}
+	app := models.App{ID: 7, Secret: "mysecret"}
+	authTime := time.Now().Add(-time.Minute)
+
+	tokenString, err := NewIDToken(user, app, time.Hour, IDToken{
+		Issuer:   "https://sso.example.com",
+		Nonce:    "n-0S6_WzA2Mj",
+		AuthTime: authTime,
+	})
+	assert.NoError(t, err)
+
+	parsedToken, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(app.Secret), nil
+	})
+	assert.NoError(t, err)
+
+	claims := parsedToken.Claims.(jwt.MapClaims)
+	assert.Equal(t, "https://sso.example.com", claims["iss"])
+	assert.Equal(t, "42", claims["sub"])
+	assert.Equal(t, "7", claims["aud"])
+	assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+	assert.EqualValues(t, authTime.Unix(), claims["auth_time"])
+
+	// ID token can't be used as access token
+	_, err = Parse(tokenString, func(int, string) (interface{}, error) { return []byte(app.Secret), nil })
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = NewIDToken(user, app, time.Hour, IDToken{})
+	assert.Error(t, err)
+}
+
+func TestNewAppToken(t *testing.T) {
+	app := models.App{ID: 7, Secret: "mysecret"}
+
+	tokenString, err := NewAppToken(app, time.Minute, "reports:read reports:write")
+	assert.NoError(t, err)
+
+	claims, err := Parse(tokenString, func(int, string) (interface{}, error) { return []byte(app.Secret), nil })
+	assert.NoError(t, err)
+	assert.NotEmpty(t, claims.ID)
+	assert.Equal(t, "7", claims.Subject)
+	assert.Zero(t, claims.UserID)
+	assert.Equal(t, app.ID, claims.AppID)
+	assert.Equal(t, "reports:read reports:write", claims.Scope)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), claims.ExpiresAt, 5*time.Second)
+
+	_, err = NewAppToken(models.App{ID: 7}, time.Minute, "")
+	assert.Error(t, err)
+}
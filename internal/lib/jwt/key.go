@@ -0,0 +1,209 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	JWT "github.com/golang-jwt/jwt"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgES384 = "ES384"
+	AlgES512 = "ES512"
+	AlgEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+)
+
+var (
+	ErrUnsupportedKey = errors.New("unsupported key")
+	ErrKeyNotFound    = errors.New("key not found")
+)
+
+// Key is an asymmetric key used to sign tokens
+//
+// ID is put to the kid header of the token, so verifiers can find matching public key
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.PrivateKey
+	Public    crypto.PublicKey
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// LoadKey reads PEM encoded private key from file
+func LoadKey(id string, path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to read key %q: %w", id, err)
+	}
+
+	return ParseKey(id, data)
+}
+
+// ParseKey parses PEM encoded RSA, ECDSA or Ed25519 private key
+//
+// Algorithm is chosen by the key type: RS256 for RSA, ES256/ES384/ES512 for
+// ECDSA depending on the curve and EdDSA for Ed25519
+func ParseKey(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %q: no PEM data found", id)
+	}
+
+	var (
+		private crypto.PrivateKey
+		err     error
+	)
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("key %q: %w", id, err)
+	}
+
+	return NewKey(id, private)
+}
+
+// NewKey creates Key from private key
+func NewKey(id string, private crypto.PrivateKey) (Key, error) {
+	key := Key{ID: id, Private: private}
+
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm = AlgRS256
+		key.Public = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			key.Algorithm = AlgES256
+		case elliptic.P384():
+			key.Algorithm = AlgES384
+		case elliptic.P521():
+			key.Algorithm = AlgES512
+		default:
+			return Key{}, fmt.Errorf("key %q: %w: curve %s", id, ErrUnsupportedKey, k.Curve.Params().Name)
+		}
+		key.Public = &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Algorithm = AlgEdDSA
+		key.Public = k.Public()
+	default:
+		return Key{}, fmt.Errorf("key %q: %w: %T", id, ErrUnsupportedKey, private)
+	}
+
+	return key, nil
+}
+
+// JWK returns public part of the key in JSON Web Key format
+func (k Key) JWK() JWK {
+	jwk := JWK{
+		KeyID:     k.ID,
+		Use:       "sig",
+		Algorithm: k.Algorithm,
+	}
+
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encode(pub.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		jwk.X = encode(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = encode(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = encode(pub)
+	}
+
+	return jwk
+}
+
+func (k Key) sign(claims JWT.MapClaims) (string, error) {
+	method := JWT.GetSigningMethod(k.Algorithm)
+	if method == nil {
+		return "", fmt.Errorf("key %q: %w: algorithm %s", k.ID, ErrUnsupportedKey, k.Algorithm)
+	}
+
+	token := JWT.NewWithClaims(method, claims)
+	token.Header["kid"] = k.ID
+
+	return token.SignedString(k.Private)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// GenerateKey generates new private key for given algorithm
+func GenerateKey(id string, algorithm string) (Key, error) {
+	var (
+		private crypto.PrivateKey
+		err     error
+	)
+
+	switch algorithm {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgES384:
+		private, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case AlgES512:
+		private, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return Key{}, fmt.Errorf("key %q: %w: algorithm %s", id, ErrUnsupportedKey, algorithm)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("key %q: %w", id, err)
+	}
+
+	return NewKey(id, private)
+}
+
+// MarshalPrivateKey encodes private part of the key to PEM (PKCS #8)
+func MarshalPrivateKey(key Key) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", key.ID, err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,93 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKey(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgES256, AlgES384, AlgES512, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := GenerateKey("kid-1", alg)
+			require.NoError(t, err)
+			assert.Equal(t, alg, key.Algorithm)
+
+			data, err := MarshalPrivateKey(key)
+			require.NoError(t, err)
+
+			parsed, err := ParseKey("kid-1", data)
+			require.NoError(t, err)
+			assert.Equal(t, key.JWK(), parsed.JWK())
+		})
+	}
+
+	_, err := GenerateKey("kid-1", "HS256")
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+}
+
+func TestSignedToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		private crypto.PrivateKey
+		alg     string
+		kty     string
+	}{
+		{name: "RSA", private: rsaKey, alg: AlgRS256, kty: "RSA"},
+		{name: "ECDSA", private: ecKey, alg: AlgES256, kty: "EC"},
+		{name: "Ed25519", private: edKey, alg: AlgEdDSA, kty: "OKP"},
+	}
+
+	user := models.User{ID: 42, Email: "user@example.com"}
+	app := models.App{ID: 7}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			der, err := x509.MarshalPKCS8PrivateKey(tt.private)
+			require.NoError(t, err)
+
+			key, err := ParseKey("kid-1", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, key.Algorithm)
+
+			jwk := key.JWK()
+			assert.Equal(t, tt.kty, jwk.KeyType)
+			assert.Equal(t, "kid-1", jwk.KeyID)
+			assert.Equal(t, tt.alg, jwk.Algorithm)
+
+			tokenString, err := NewToken(user, app, time.Hour, WithKey(key))
+			require.NoError(t, err)
+
+			claims, err := Parse(tokenString, func(appID int, kid string) (interface{}, error) {
+				assert.Equal(t, "kid-1", kid)
+				return key.Public, nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, claims.UserID)
+
+			// public key must never be accepted as HMAC secret
+			_, err = Parse(tokenString, func(int, string) (interface{}, error) {
+				return []byte("secret"), nil
+			})
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"mime"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMessage = Message{
+	To:      "user@example.com",
+	Subject: "Сброс пароля",
+	Body:    "line one\nline two",
+}
+
+func TestOutbox(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+
+	outbox, err := NewOutbox(dir, "SSO <noreply@example.com>")
+	require.NoError(t, err)
+
+	require.NoError(t, outbox.Send(context.Background(), testMessage))
+	require.NoError(t, outbox.Send(context.Background(), testMessage))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	f, err := os.Open(files[0])
+	require.NoError(t, err)
+	defer f.Close()
+
+	msg, err := mail.ReadMessage(f)
+	require.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "user@example.com", msg.Header.Get("To"))
+	assert.Equal(t, testMessage.Subject, subject)
+}
+
+func TestSend_HeaderInjection(t *testing.T) {
+	outbox, err := NewOutbox(t.TempDir(), "noreply@example.com")
+	require.NoError(t, err)
+
+	msg := testMessage
+	msg.To = "user@example.com\r\nBcc: victim@example.com"
+
+	assert.ErrorIs(t, outbox.Send(context.Background(), msg), ErrInvalidHeader)
+}
+
+func TestSMTP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go serveSMTP(t, ln, received)
+
+	addr := ln.Addr().(*net.TCPAddr)
+	mailer := NewSMTP("127.0.0.1", addr.Port, "", "", "SSO <noreply@example.com>")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, mailer.Send(ctx, testMessage))
+
+	commands := <-received
+	assert.Contains(t, commands, "MAIL FROM:<noreply@example.com>")
+	assert.Contains(t, commands, "RCPT TO:<user@example.com>")
+	assert.Contains(t, commands, "line two")
+}
+
+// serveSMTP accepts a single SMTP session and reports every line the client sent
+func serveSMTP(t *testing.T, ln net.Listener, received chan<- []string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var lines []string
+	defer func() { received <- lines }()
+
+	r := bufio.NewReader(conn)
+	reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+
+	data := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+
+		switch {
+		case data && line == ".":
+			data = false
+			reply("250 queued")
+		case data:
+		case strings.HasPrefix(line, "EHLO"):
+			reply("250 localhost")
+		case line == "DATA":
+			data = true
+			reply("354 go ahead")
+		case line == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
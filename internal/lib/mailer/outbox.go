@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Outbox writes messages to .eml files in a directory instead of sending them
+//
+// It's meant for local development and tests, the files open in any mail client
+type Outbox struct {
+	dir  string
+	from string
+	seq  atomic.Uint64
+}
+
+// NewOutbox returns a new instance of the Outbox writing to given directory,
+// which is created if it doesn't exist
+func NewOutbox(dir string, from string) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create outbox: %w", err)
+	}
+
+	return &Outbox{dir: dir, from: from}, nil
+}
+
+// Send writes the message to a new file of the outbox
+func (o *Outbox) Send(_ context.Context, msg Message) error {
+	now := time.Now()
+
+	data, err := msg.format(o.from, now)
+	if err != nil {
+		return err
+	}
+
+	name := strconv.FormatInt(now.UnixNano(), 10) + "-" + strconv.FormatUint(o.seq.Add(1), 10) + ".eml"
+
+	if err = os.WriteFile(filepath.Join(o.dir, name), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return nil
+}
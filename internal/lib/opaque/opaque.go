@@ -0,0 +1,45 @@
+package opaque
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	tokenSize = 32
+	idSize    = 16
+)
+
+// NewToken generates random URL-safe opaque token
+//
+// Returns raw token (give it to the client) and its hash (keep it in storage)
+func NewToken() (token string, hash string, err error) {
+	b := make([]byte, tokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(b)
+
+	return token, Hash(token), nil
+}
+
+// NewID generates random hex identifier
+func NewID() (string, error) {
+	b := make([]byte, idSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Hash returns SHA-256 hash of the token in hex
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,140 @@
+package password
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+)
+
+// maxLineSize is more than enough for a hash with its count and line ending
+const maxLineSize = 128
+
+// BreachedList is a file of SHA-1 hashes of breached passwords
+//
+// Every line holds a hash in hex, optionally followed by ":" and the number
+// of times it was seen, like downloads of Have I Been Pwned. Lines must be
+// sorted by hash, so it's searched without loading the file into memory
+type BreachedList struct {
+	file *os.File
+	size int64
+}
+
+// OpenBreachedList opens the sorted list at path
+func OpenBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+
+		return nil, err
+	}
+
+	return &BreachedList{file: file, size: info.Size()}, nil
+}
+
+// Close closes the list file
+func (l *BreachedList) Close() error {
+	return l.file.Close()
+}
+
+// Contains reports whether password is in the list. It's safe for concurrent use
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := bytes.ToUpper([]byte(hex.EncodeToString(sum[:])))
+
+	// lo is always the start of a line, lines before it are less than target
+	// and lines starting at hi or after it are greater
+	lo, hi := int64(0), l.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, err := l.lineStart(mid, lo)
+		if err != nil {
+			return false, err
+		}
+
+		if start >= hi {
+			hi = mid
+
+			continue
+		}
+
+		line, next, err := l.readLine(start)
+		if err != nil {
+			return false, err
+		}
+
+		switch bytes.Compare(hashOf(line), target) {
+		case 0:
+			return true, nil
+		case -1:
+			lo = next
+		default:
+			hi = mid
+		}
+	}
+
+	return false, nil
+}
+
+// lineStart returns offset of the first line starting at off or after it
+func (l *BreachedList) lineStart(off int64, lo int64) (int64, error) {
+	if off == lo {
+		return off, nil
+	}
+
+	buf, err := l.read(off - 1)
+	if err != nil {
+		return 0, err
+	}
+
+	i := bytes.IndexByte(buf, '\n')
+	if i < 0 {
+		return l.size, nil
+	}
+
+	return off + int64(i), nil
+}
+
+// readLine returns the line starting at off and offset of the next one
+func (l *BreachedList) readLine(off int64) ([]byte, int64, error) {
+	buf, err := l.read(off)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	i := bytes.IndexByte(buf, '\n')
+	if i < 0 {
+		return buf, off + int64(len(buf)), nil
+	}
+
+	return buf[:i], off + int64(i) + 1, nil
+}
+
+func (l *BreachedList) read(off int64) ([]byte, error) {
+	buf := make([]byte, maxLineSize)
+
+	n, err := l.file.ReadAt(buf, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return buf[:n], nil
+}
+
+// hashOf strips count and line ending from the line
+func hashOf(line []byte) []byte {
+	line = bytes.TrimRight(line, "\r")
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+
+	return bytes.ToUpper(line)
+}
@@ -0,0 +1,79 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBreachedList(t *testing.T, passwords []string, format func(hash string, i int) string) string {
+	t.Helper()
+
+	hashes := make([]string, 0, len(passwords))
+	for _, p := range passwords {
+		sum := sha1.Sum([]byte(p))
+		hashes = append(hashes, strings.ToUpper(hex.EncodeToString(sum[:])))
+	}
+	slices.Sort(hashes)
+
+	var b strings.Builder
+	for i, hash := range hashes {
+		b.WriteString(format(hash, i))
+	}
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte(b.String()), 0o600))
+
+	return path
+}
+
+func TestBreachedList(t *testing.T) {
+	var breached []string
+	for i := range 500 {
+		breached = append(breached, fmt.Sprintf("password%d", i))
+	}
+
+	formats := map[string]func(hash string, i int) string{
+		"plain":      func(hash string, _ int) string { return hash + "\n" },
+		"counts":     func(hash string, i int) string { return fmt.Sprintf("%s:%d\r\n", hash, i+1) },
+		"lower case": func(hash string, _ int) string { return strings.ToLower(hash) + "\n" },
+	}
+
+	for name, format := range formats {
+		t.Run(name, func(t *testing.T) {
+			list, err := OpenBreachedList(writeBreachedList(t, breached, format))
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = list.Close() })
+
+			for _, p := range breached {
+				found, err := list.Contains(p)
+				require.NoError(t, err)
+				assert.True(t, found, p)
+			}
+
+			for i := range 500 {
+				found, err := list.Contains(fmt.Sprintf("safe%d", i))
+				require.NoError(t, err)
+				assert.False(t, found)
+			}
+		})
+	}
+}
+
+func TestBreachedList_Empty(t *testing.T) {
+	list, err := OpenBreachedList(writeBreachedList(t, nil, nil))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = list.Close() })
+
+	found, err := list.Contains("password")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
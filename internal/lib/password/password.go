@@ -0,0 +1,178 @@
+package password
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	argon2idID      = "argon2id"
+	argon2idVersion = argon2.Version
+	saltSize        = 16
+	keySize         = 32
+)
+
+var (
+	// ErrMismatch is returned when password doesn't match the hash
+	ErrMismatch = errors.New("password doesn't match the hash")
+	// ErrUnknownFormat is returned for hashes of unsupported algorithms
+	ErrUnknownFormat = errors.New("unknown password hash format")
+)
+
+var encoding = base64.RawStdEncoding
+
+// Compare checks password against hash of any supported algorithm,
+// whatever algorithm new hashes are made with
+func Compare(hash []byte, password string) error {
+	switch {
+	case isBcrypt(hash):
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return ErrMismatch
+			}
+
+			return err
+		}
+
+		return nil
+	case isArgon2id(hash):
+		params, salt, key, err := parseArgon2id(hash)
+		if err != nil {
+			return err
+		}
+
+		got := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(got, key) != 1 {
+			return ErrMismatch
+		}
+
+		return nil
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+// Bcrypt hashes passwords with bcrypt in its modular crypt format, e.g. "$2a$10$..."
+type Bcrypt struct {
+	Cost int
+}
+
+// Hash hashes password with the configured cost
+func (b Bcrypt) Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+}
+
+// Compare checks password against hash of any supported algorithm
+func (b Bcrypt) Compare(hash []byte, password string) error {
+	return Compare(hash, password)
+}
+
+// NeedsRehash reports whether hash isn't a bcrypt hash of the configured cost
+func (b Bcrypt) NeedsRehash(hash []byte) bool {
+	if !isBcrypt(hash) {
+		return true
+	}
+
+	cost, err := bcrypt.Cost(hash)
+
+	return err != nil || cost != b.Cost
+}
+
+// Argon2id hashes passwords with argon2id in PHC string format,
+// e.g. "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>"
+type Argon2id struct {
+	// Memory is in KiB
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+}
+
+// Hash hashes password with random salt and the configured parameters
+func (a Argon2id) Hash(password string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Parallelism, keySize)
+
+	return []byte(fmt.Sprintf(
+		"$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idID, argon2idVersion,
+		a.Memory, a.Time, a.Parallelism,
+		encoding.EncodeToString(salt), encoding.EncodeToString(key),
+	)), nil
+}
+
+// Compare checks password against hash of any supported algorithm
+func (a Argon2id) Compare(hash []byte, password string) error {
+	return Compare(hash, password)
+}
+
+// NeedsRehash reports whether hash isn't an argon2id hash of the configured parameters
+func (a Argon2id) NeedsRehash(hash []byte) bool {
+	if !isArgon2id(hash) {
+		return true
+	}
+
+	params, salt, key, err := parseArgon2id(hash)
+
+	return err != nil || params != a || len(salt) != saltSize || len(key) != keySize
+}
+
+func isBcrypt(hash []byte) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if bytes.HasPrefix(hash, []byte(prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isArgon2id(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$"+argon2idID+"$"))
+}
+
+func parseArgon2id(hash []byte) (Argon2id, []byte, []byte, error) {
+	var (
+		params  Argon2id
+		version int
+	)
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := bytes.Split(hash, []byte("$"))
+	if len(parts) != 6 {
+		return Argon2id{}, nil, nil, ErrUnknownFormat
+	}
+
+	if _, err := fmt.Sscanf(string(parts[2]), "v=%d", &version); err != nil || version != argon2idVersion {
+		return Argon2id{}, nil, nil, ErrUnknownFormat
+	}
+
+	if _, err := fmt.Sscanf(
+		string(parts[3]), "m=%d,t=%d,p=%d",
+		&params.Memory, &params.Time, &params.Parallelism,
+	); err != nil {
+		return Argon2id{}, nil, nil, ErrUnknownFormat
+	}
+
+	salt, err := encoding.DecodeString(string(parts[4]))
+	if err != nil {
+		return Argon2id{}, nil, nil, ErrUnknownFormat
+	}
+
+	key, err := encoding.DecodeString(string(parts[5]))
+	if err != nil || len(key) == 0 {
+		return Argon2id{}, nil, nil, ErrUnknownFormat
+	}
+
+	return params, salt, key, nil
+}
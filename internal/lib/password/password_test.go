@@ -0,0 +1,70 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2id = Argon2id{Memory: 1024, Time: 1, Parallelism: 1}
+
+func TestArgon2id(t *testing.T) {
+	hash, err := testArgon2id.Hash("password")
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(string(hash), "$argon2id$v=19$m=1024,t=1,p=1$"))
+	assert.NoError(t, testArgon2id.Compare(hash, "password"))
+	assert.ErrorIs(t, testArgon2id.Compare(hash, "wrong"), ErrMismatch)
+	assert.False(t, testArgon2id.NeedsRehash(hash))
+
+	again, err := testArgon2id.Hash("password")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, again, "salt is random")
+}
+
+func TestBcrypt(t *testing.T) {
+	b := Bcrypt{Cost: bcrypt.MinCost}
+
+	hash, err := b.Hash("password")
+	require.NoError(t, err)
+
+	assert.NoError(t, b.Compare(hash, "password"))
+	assert.ErrorIs(t, b.Compare(hash, "wrong"), ErrMismatch)
+	assert.False(t, b.NeedsRehash(hash))
+	assert.True(t, Bcrypt{Cost: bcrypt.MinCost + 1}.NeedsRehash(hash))
+}
+
+func TestCompare_AnyAlgorithm(t *testing.T) {
+	bcryptHash, err := Bcrypt{Cost: bcrypt.MinCost}.Hash("password")
+	require.NoError(t, err)
+
+	argonHash, err := testArgon2id.Hash("password")
+	require.NoError(t, err)
+
+	assert.NoError(t, testArgon2id.Compare(bcryptHash, "password"))
+	assert.NoError(t, Bcrypt{Cost: bcrypt.MinCost}.Compare(argonHash, "password"))
+
+	assert.True(t, testArgon2id.NeedsRehash(bcryptHash))
+	assert.True(t, Bcrypt{Cost: bcrypt.MinCost}.NeedsRehash(argonHash))
+	assert.True(t, Argon2id{Memory: 2048, Time: 1, Parallelism: 1}.NeedsRehash(argonHash))
+}
+
+func TestCompare_Malformed(t *testing.T) {
+	tests := []string{
+		"",
+		"plain",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$!!",
+	}
+
+	for _, hash := range tests {
+		t.Run(hash, func(t *testing.T) {
+			assert.ErrorIs(t, Compare([]byte(hash), "password"), ErrUnknownFormat)
+		})
+	}
+}
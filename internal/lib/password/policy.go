@@ -0,0 +1,116 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rules of Policy reported in violations
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleUpper     = "upper"
+	RuleLower     = "lower"
+	RuleDigit     = "digit"
+	RuleSymbol    = "symbol"
+	RuleEmail     = "email"
+	RuleBreached  = "breached"
+)
+
+// minEmailPart is the shortest local part of email checked against passwords,
+// shorter ones match too many passwords by chance
+const minEmailPart = 3
+
+// Policy describes passwords users may choose. Zero value allows any password
+//
+// MinLength counts characters, MaxLength counts bytes, as bcrypt ignores
+// everything after the first 72 bytes
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// ForbidEmail rejects passwords containing email of the user or its local part
+	ForbidEmail bool
+}
+
+// Violation is a rule of Policy the password doesn't follow
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+// Check returns every rule password of the user with the email violates
+func (p Policy) Check(password string, email string) []Violation {
+	var violations []Violation
+
+	if p.MinLength > 0 && utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("must be at least %d characters long", p.MinLength),
+		})
+	}
+
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("must be at most %d bytes long", p.MaxLength),
+		})
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	classes := []struct {
+		required bool
+		present  bool
+		rule     string
+		message  string
+	}{
+		{p.RequireUpper, upper, RuleUpper, "must contain an uppercase letter"},
+		{p.RequireLower, lower, RuleLower, "must contain a lowercase letter"},
+		{p.RequireDigit, digit, RuleDigit, "must contain a digit"},
+		{p.RequireSymbol, symbol, RuleSymbol, "must contain a symbol"},
+	}
+
+	for _, class := range classes {
+		if class.required && !class.present {
+			violations = append(violations, Violation{Rule: class.rule, Message: class.message})
+		}
+	}
+
+	if p.ForbidEmail && containsEmail(password, email) {
+		violations = append(violations, Violation{Rule: RuleEmail, Message: "must not contain the email"})
+	}
+
+	return violations
+}
+
+func containsEmail(password string, email string) bool {
+	password, email = strings.ToLower(password), strings.ToLower(email)
+	if email == "" {
+		return false
+	}
+
+	local, _, _ := strings.Cut(email, "@")
+	if utf8.RuneCountInString(local) < minEmailPart {
+		return strings.Contains(password, email)
+	}
+
+	return strings.Contains(password, local)
+}
@@ -0,0 +1,61 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	policy := Policy{
+		MinLength:     8,
+		MaxLength:     72,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		ForbidEmail:   true,
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		rules    []string
+	}{
+		{name: "valid", password: "Correct-horse-1", email: "user@example.com"},
+		{name: "short", password: "Ab1!", email: "user@example.com", rules: []string{RuleMinLength}},
+		{
+			name:     "too long",
+			password: "Ab1!" + strings.Repeat("x", 72),
+			email:    "user@example.com",
+			rules:    []string{RuleMaxLength},
+		},
+		{
+			name:     "letters only",
+			password: "abcdefghij",
+			email:    "user@example.com",
+			rules:    []string{RuleUpper, RuleDigit, RuleSymbol},
+		},
+		{name: "email local part", password: "My-JohnDoe-1", email: "johndoe@example.com", rules: []string{RuleEmail}},
+		{name: "short local part", password: "Joe-1-Abcdef", email: "jo@example.com"},
+		{name: "non ascii", password: "Пароль-надёжный-1", email: "user@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []string
+			for _, v := range policy.Check(tt.password, tt.email) {
+				rules = append(rules, v.Rule)
+				assert.NotEmpty(t, v.Message)
+			}
+
+			assert.Equal(t, tt.rules, rules)
+		})
+	}
+}
+
+func TestPolicy_Zero(t *testing.T) {
+	assert.Empty(t, Policy{}.Check("a", "a@example.com"))
+}
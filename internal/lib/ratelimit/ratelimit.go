@@ -0,0 +1,91 @@
+// Package ratelimit implements in-memory token bucket rate limiting of arbitrary keys
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Per on average, bursts of up to Requests at once
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Limiter keeps a token bucket per key
+//
+// Buckets that have refilled completely are equivalent to missing ones,
+// they're dropped from time to time, so memory is bounded by active keys
+type Limiter struct {
+	capacity float64
+	rate     float64 // tokens per second
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// New returns a new instance of the Limiter
+func New(limit Limit) *Limiter {
+	return &Limiter{
+		capacity: float64(limit.Requests),
+		rate:     float64(limit.Requests) / limit.Per.Seconds(),
+		buckets:  map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from the bucket of the key at the given time
+//
+// If the bucket is empty, returns false with the time until the next token
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.capacity, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.refill(now, l.capacity, l.rate)
+
+	if b.tokens < 1 {
+		wait := (1 - b.tokens) / l.rate
+
+		return false, time.Duration(wait * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+// sweep drops full buckets, at most once per time the empty bucket takes to refill
+func (l *Limiter) sweep(now time.Time) {
+	refill := time.Duration(l.capacity / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if b.refill(now, l.capacity, l.rate); b.tokens >= l.capacity {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.lastSweep = now
+}
+
+func (b *bucket) refill(now time.Time, capacity float64, rate float64) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = min(capacity, b.tokens+elapsed*rate)
+		b.updated = now
+	}
+}
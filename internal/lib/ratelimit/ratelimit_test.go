@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New(Limit{Requests: 3, Per: 3 * time.Second})
+	now := time.Unix(1_700_000_000, 0)
+
+	for range 3 {
+		ok, _ := l.Allow("a", now)
+		assert.True(t, ok, "burst")
+	}
+
+	ok, retryAfter := l.Allow("a", now)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, retryAfter)
+
+	ok, _ = l.Allow("b", now)
+	assert.True(t, ok, "keys are limited independently")
+
+	ok, retryAfter = l.Allow("a", now.Add(500*time.Millisecond))
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	ok, _ = l.Allow("a", now.Add(time.Second))
+	assert.True(t, ok, "token is refilled")
+
+	ok, _ = l.Allow("a", now.Add(time.Second))
+	assert.False(t, ok)
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	l := New(Limit{Requests: 2, Per: time.Minute})
+	now := time.Unix(1_700_000_000, 0)
+
+	l.Allow("a", now)
+	l.Allow("b", now)
+	assert.Len(t, l.buckets, 2)
+
+	l.Allow("c", now.Add(time.Hour))
+	assert.Len(t, l.buckets, 1, "refilled buckets are dropped")
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import "time"
+
+// Rule limits requests of a route per client IP and, if ByEmail is set,
+// per email of the request as well. Zero Requests disables the limit
+type Rule struct {
+	Requests int
+	Per      time.Duration
+	ByEmail  bool
+}
+
+// Rules configures rate limiting of routes, e.g. full gRPC method names
+// or HTTP method and path. Default limits every other route, each one separately
+type Rules struct {
+	Default Rule
+	Routes  map[string]Rule
+}
+
+// Routes holds token buckets of the routes
+type Routes struct {
+	def      *routeLimiter
+	routes   map[string]*routeLimiter
+	emailKey func(email string) string
+}
+
+type routeLimiter struct {
+	byIP    *Limiter
+	byEmail *Limiter
+}
+
+// NewRoutes returns limiter of the routes. Emails are keyed by emailKey,
+// so different spellings of the same address share the bucket
+func NewRoutes(rules Rules, emailKey func(email string) string) *Routes {
+	r := &Routes{
+		def:      newRouteLimiter(rules.Default),
+		routes:   map[string]*routeLimiter{},
+		emailKey: emailKey,
+	}
+
+	for route, rule := range rules.Routes {
+		r.routes[route] = newRouteLimiter(rule)
+	}
+
+	return r
+}
+
+func newRouteLimiter(rule Rule) *routeLimiter {
+	if rule.Requests <= 0 || rule.Per <= 0 {
+		return nil
+	}
+
+	l := &routeLimiter{
+		byIP: New(Limit{Requests: rule.Requests, Per: rule.Per}),
+	}
+
+	if rule.ByEmail {
+		l.byEmail = New(Limit{Requests: rule.Requests, Per: rule.Per})
+	}
+
+	return l
+}
+
+// Allow takes a token of the client IP and, if the route is limited by email,
+// of the email at the given time. Email is only asked for then, empty one isn't limited
+//
+// If either bucket is empty, returns false with the time until the next token
+func (r *Routes) Allow(route string, ip string, email func() string, now time.Time) (bool, time.Duration) {
+	limiter, ok := r.routes[route]
+	key := ip
+	if !ok {
+		// default buckets are shared by routes, so the key has to tell them apart
+		limiter = r.def
+		key = route + " " + ip
+	}
+
+	if limiter == nil {
+		return true, 0
+	}
+
+	if allowed, retryAfter := limiter.byIP.Allow(key, now); !allowed {
+		return false, retryAfter
+	}
+
+	if limiter.byEmail == nil {
+		return true, 0
+	}
+
+	if e := email(); e != "" {
+		return limiter.byEmail.Allow(r.emailKey(e), now)
+	}
+
+	return true, 0
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutes(t *testing.T) {
+	r := NewRoutes(Rules{
+		Default: Rule{Requests: 1, Per: time.Minute},
+		Routes: map[string]Rule{
+			"POST /authorize": {Requests: 2, Per: time.Minute, ByEmail: true},
+			"GET /jwks":       {},
+		},
+	}, strings.ToLower)
+	now := time.Unix(1_700_000_000, 0)
+
+	email := func(e string) func() string {
+		return func() string { return e }
+	}
+
+	ok, _ := r.Allow("POST /authorize", "203.0.113.1", email("Bob@example.com"), now)
+	assert.True(t, ok)
+
+	ok, _ = r.Allow("POST /authorize", "203.0.113.2", email("bob@example.com"), now)
+	assert.True(t, ok)
+
+	ok, retryAfter := r.Allow("POST /authorize", "203.0.113.3", email("BOB@example.com"), now)
+	assert.False(t, ok, "email is limited by its key whatever the client IP")
+	assert.Equal(t, 30*time.Second, retryAfter)
+
+	ok, _ = r.Allow("POST /authorize", "203.0.113.3", email("alice@example.com"), now)
+	assert.True(t, ok)
+
+	ok, _ = r.Allow("POST /token", "203.0.113.1", email("bob@example.com"), now)
+	assert.True(t, ok, "default buckets are separate from the route ones")
+
+	ok, _ = r.Allow("POST /token", "203.0.113.1", email(""), now)
+	assert.False(t, ok)
+
+	ok, _ = r.Allow("POST /device_authorization", "203.0.113.1", email(""), now)
+	assert.True(t, ok, "every other route is limited separately")
+
+	for range 10 {
+		ok, _ = r.Allow("GET /jwks", "203.0.113.1", email(""), now)
+		assert.True(t, ok, "zero rule disables the limit")
+	}
+}
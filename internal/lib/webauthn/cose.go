@@ -0,0 +1,159 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms of credential public keys, see RFC 9053
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters, see RFC 9052, section 7
+const (
+	coseKeyType   = 1
+	coseAlgorithm = 3
+	coseCurve     = -1 // n of RSA key
+	coseX         = -2 // e of RSA key
+	coseY         = -3
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+
+	minRSABits = 2048
+)
+
+// publicKey is a credential public key with the algorithm it signs with
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes COSE_Key of the credential
+//
+// Returns the key and the rest of data following it
+func parsePublicKey(data []byte) (publicKey, []byte, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		return publicKey{}, nil, fmt.Errorf("%w: public key: %w", ErrMalformed, err)
+	}
+
+	params, ok := item.(map[any]any)
+	if !ok {
+		return publicKey{}, nil, fmt.Errorf("%w: public key is not a map", ErrMalformed)
+	}
+
+	kty, _ := params[int64(coseKeyType)].(int64)
+	alg, _ := params[int64(coseAlgorithm)].(int64)
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		key, err := parseEC2Key(params)
+		return publicKey{alg: alg, key: key}, rest, err
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		key, err := parseOKPKey(params)
+		return publicKey{alg: alg, key: key}, rest, err
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		key, err := parseRSAKey(params)
+		return publicKey{alg: alg, key: key}, rest, err
+	default:
+		return publicKey{}, nil, fmt.Errorf("%w: key type %d with algorithm %d", ErrUnsupported, kty, alg)
+	}
+}
+
+func parseEC2Key(params map[any]any) (*ecdsa.PublicKey, error) {
+	crv, _ := params[int64(coseCurve)].(int64)
+	x, _ := params[int64(coseX)].([]byte)
+	y, _ := params[int64(coseY)].([]byte)
+
+	if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+		return nil, fmt.Errorf("%w: invalid ec2 key", ErrMalformed)
+	}
+
+	// ecdh rejects points which are not on the curve
+	point := append(append([]byte{4}, x...), y...)
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, fmt.Errorf("%w: invalid ec2 key: %w", ErrMalformed, err)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+func parseOKPKey(params map[any]any) (ed25519.PublicKey, error) {
+	crv, _ := params[int64(coseCurve)].(int64)
+	x, _ := params[int64(coseX)].([]byte)
+
+	if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: invalid okp key", ErrMalformed)
+	}
+
+	return ed25519.PublicKey(x), nil
+}
+
+func parseRSAKey(params map[any]any) (*rsa.PublicKey, error) {
+	n, _ := params[int64(coseCurve)].([]byte)
+	e, _ := params[int64(coseX)].([]byte)
+
+	if len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("%w: invalid rsa key", ErrMalformed)
+	}
+
+	key := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+	if key.N.BitLen() < minRSABits || key.E < 3 {
+		return nil, fmt.Errorf("%w: invalid rsa key", ErrMalformed)
+	}
+
+	return key, nil
+}
+
+// verify checks signature of the data made with the key
+func (k publicKey) verify(data []byte, sig []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	default:
+		return false
+	}
+}
+
+// certificateAlgorithm maps COSE algorithm of attestation statement to the x509 one
+func certificateAlgorithm(alg int64) (x509.SignatureAlgorithm, error) {
+	switch alg {
+	case AlgES256:
+		return x509.ECDSAWithSHA256, nil
+	case AlgEdDSA:
+		return x509.PureEd25519, nil
+	case AlgRS256:
+		return x509.SHA256WithRSA, nil
+	default:
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("%w: attestation algorithm %d", ErrUnsupported, alg)
+	}
+}
@@ -0,0 +1,575 @@
+// Package webauthn implements server side of WebAuthn ceremonies,
+// see https://www.w3.org/TR/webauthn-2/
+//
+// Only "none" and "packed" attestation formats are verified. Attestation is
+// requested as "none", so certificate chains aren't checked against any roots:
+// credentials are trusted as the user's own, not as made by a certain model
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	challengeSize = 32
+
+	// maxCredentialIDSize is the limit of credential ID length from the spec
+	maxCredentialIDSize = 1023
+
+	typePublicKey = "public-key"
+	typeCreate    = "webauthn.create"
+	typeGet       = "webauthn.get"
+)
+
+// User verification requirements
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+)
+
+// authenticator data flags
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+	flagExtensionData    = 0x80
+)
+
+var (
+	ErrMalformed    = errors.New("malformed webauthn data")
+	ErrUnsupported  = errors.New("unsupported webauthn feature")
+	ErrVerification = errors.New("webauthn verification failed")
+)
+
+// RelyingParty is the service credentials are scoped to
+//
+// ID is the domain of the service, Origins are origins of the pages
+// allowed to run ceremonies, e.g. https://login.example.com
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// User is the account the credential is created for
+//
+// ID is the opaque user handle, it must not contain personal information
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// CreationOptions are the options for navigator.credentials.create()
+// in the JSON form of WebAuthn Level 3
+type CreationOptions struct {
+	Challenge              URLEncoded             `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the options for navigator.credentials.get()
+// in the JSON form of WebAuthn Level 3
+type RequestOptions struct {
+	Challenge        URLEncoded             `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          URLEncoded `json:"id"`
+	Name        string     `json:"name"`
+	DisplayName string     `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string     `json:"type"`
+	ID   URLEncoded `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// Registration is the response of the authenticator to navigator.credentials.create()
+type Registration struct {
+	ID                []byte
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// Assertion is the response of the authenticator to navigator.credentials.get()
+type Assertion struct {
+	ID                []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+// Credential is a verified credential to be stored for the user
+//
+// PublicKey is kept COSE-encoded as received from the authenticator
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte
+	SignCount    uint32
+	UserVerified bool
+}
+
+// URLEncoded is binary data encoded in JSON as unpadded base64url string
+type URLEncoded []byte
+
+func (u URLEncoded) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(u))
+}
+
+func (u *URLEncoded) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+
+	*u = b
+
+	return nil
+}
+
+// NewChallenge generates random challenge of a ceremony
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// CreationOptions returns options of registration ceremony
+//
+// Credentials the user already has are excluded, so the same authenticator
+// isn't registered twice. Discoverable credentials are preferred,
+// they can be used for passwordless login
+func (rp RelyingParty) CreationOptions(
+	challenge []byte,
+	user User,
+	exclude [][]byte,
+	timeout time.Duration,
+) CreationOptions {
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:      UserEntity{ID: user.ID, Name: user.Name, DisplayName: user.DisplayName},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: typePublicKey, Alg: AlgES256},
+			{Type: typePublicKey, Alg: AlgEdDSA},
+			{Type: typePublicKey, Alg: AlgRS256},
+		},
+		Timeout:            timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: UserVerificationPreferred,
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns options of authentication ceremony
+//
+// Empty allow list lets the user pick any discoverable credential of the relying party
+func (rp RelyingParty) RequestOptions(
+	challenge []byte,
+	allow [][]byte,
+	userVerification string,
+	timeout time.Duration,
+) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: userVerification,
+	}
+}
+
+// ParseRegistration decodes PublicKeyCredential with attestation response
+// serialized with its toJSON() method
+func ParseRegistration(data []byte) (Registration, error) {
+	var credential struct {
+		RawID    URLEncoded `json:"rawId"`
+		Type     string     `json:"type"`
+		Response struct {
+			ClientDataJSON    URLEncoded `json:"clientDataJSON"`
+			AttestationObject URLEncoded `json:"attestationObject"`
+		} `json:"response"`
+	}
+
+	if err := json.Unmarshal(data, &credential); err != nil {
+		return Registration{}, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+
+	if credential.Type != typePublicKey || len(credential.RawID) == 0 ||
+		len(credential.Response.ClientDataJSON) == 0 || len(credential.Response.AttestationObject) == 0 {
+		return Registration{}, fmt.Errorf("%w: incomplete registration", ErrMalformed)
+	}
+
+	return Registration{
+		ID:                credential.RawID,
+		ClientDataJSON:    credential.Response.ClientDataJSON,
+		AttestationObject: credential.Response.AttestationObject,
+	}, nil
+}
+
+// ParseAssertion decodes PublicKeyCredential with assertion response
+// serialized with its toJSON() method
+func ParseAssertion(data []byte) (Assertion, error) {
+	var credential struct {
+		RawID    URLEncoded `json:"rawId"`
+		Type     string     `json:"type"`
+		Response struct {
+			ClientDataJSON    URLEncoded `json:"clientDataJSON"`
+			AuthenticatorData URLEncoded `json:"authenticatorData"`
+			Signature         URLEncoded `json:"signature"`
+			UserHandle        URLEncoded `json:"userHandle"`
+		} `json:"response"`
+	}
+
+	if err := json.Unmarshal(data, &credential); err != nil {
+		return Assertion{}, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+
+	if credential.Type != typePublicKey || len(credential.RawID) == 0 || len(credential.Response.ClientDataJSON) == 0 ||
+		len(credential.Response.AuthenticatorData) == 0 || len(credential.Response.Signature) == 0 {
+		return Assertion{}, fmt.Errorf("%w: incomplete assertion", ErrMalformed)
+	}
+
+	return Assertion{
+		ID:                credential.RawID,
+		ClientDataJSON:    credential.Response.ClientDataJSON,
+		AuthenticatorData: credential.Response.AuthenticatorData,
+		Signature:         credential.Response.Signature,
+		UserHandle:        credential.Response.UserHandle,
+	}, nil
+}
+
+// Challenge returns challenge signed by the authenticator, so the ceremony it
+// belongs to can be found. It's not verified, the ceremony must still be verified
+func Challenge(clientDataJSON []byte) ([]byte, error) {
+	clientData, err := parseClientData(clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return clientData.Challenge, nil
+}
+
+// VerifyRegistration verifies response to the registration ceremony with given challenge
+//
+// Returns the new credential of the user
+func (rp RelyingParty) VerifyRegistration(reg Registration, challenge []byte, requireUV bool) (Credential, error) {
+	clientData, err := rp.verifyClientData(reg.ClientDataJSON, typeCreate, challenge)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	item, rest, err := decodeCBOR(reg.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return Credential{}, fmt.Errorf("%w: attestation object", ErrMalformed)
+	}
+
+	object, _ := item.(map[any]any)
+	format, _ := object["fmt"].(string)
+	statement, _ := object["attStmt"].(map[any]any)
+	rawAuthData, _ := object["authData"].([]byte)
+	if format == "" || statement == nil || rawAuthData == nil {
+		return Credential{}, fmt.Errorf("%w: attestation object", ErrMalformed)
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData, requireUV)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	if authData.flags&flagAttestedCredData == 0 {
+		return Credential{}, fmt.Errorf("%w: no attested credential data", ErrMalformed)
+	}
+
+	if !bytes.Equal(authData.credentialID, reg.ID) {
+		return Credential{}, fmt.Errorf("%w: credential id mismatch", ErrVerification)
+	}
+
+	signed := append(rawAuthData[:len(rawAuthData):len(rawAuthData)], sha256Sum(clientData.raw)...)
+
+	if err = verifyAttestation(format, statement, authData.publicKey, signed); err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:           authData.credentialID,
+		PublicKey:    authData.rawPublicKey,
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion verifies response to the authentication ceremony with given challenge
+// made with the credential with given COSE-encoded public key
+//
+// Returns new signature counter of the credential, it's up to the caller
+// to compare it with the stored one
+func (rp RelyingParty) VerifyAssertion(
+	assertion Assertion,
+	challenge []byte,
+	credentialPublicKey []byte,
+	requireUV bool,
+) (uint32, error) {
+	clientData, err := rp.verifyClientData(assertion.ClientDataJSON, typeGet, challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.verifyAuthenticatorData(assertion.AuthenticatorData, requireUV)
+	if err != nil {
+		return 0, err
+	}
+
+	key, _, err := parsePublicKey(credentialPublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	signed := append(assertion.AuthenticatorData[:len(assertion.AuthenticatorData):len(assertion.AuthenticatorData)],
+		sha256Sum(clientData.raw)...)
+
+	if !key.verify(signed, assertion.Signature) {
+		return 0, fmt.Errorf("%w: invalid signature", ErrVerification)
+	}
+
+	return authData.signCount, nil
+}
+
+type clientData struct {
+	Type        string     `json:"type"`
+	Challenge   URLEncoded `json:"challenge"`
+	Origin      string     `json:"origin"`
+	CrossOrigin bool       `json:"crossOrigin"`
+
+	raw []byte
+}
+
+func parseClientData(data []byte) (clientData, error) {
+	var cd clientData
+	if err := json.Unmarshal(data, &cd); err != nil {
+		return clientData{}, fmt.Errorf("%w: client data: %w", ErrMalformed, err)
+	}
+	cd.raw = data
+
+	return cd, nil
+}
+
+func (rp RelyingParty) verifyClientData(data []byte, ceremony string, challenge []byte) (clientData, error) {
+	cd, err := parseClientData(data)
+	if err != nil {
+		return clientData{}, err
+	}
+
+	switch {
+	case cd.Type != ceremony:
+		return clientData{}, fmt.Errorf("%w: unexpected ceremony %q", ErrVerification, cd.Type)
+	case subtle.ConstantTimeCompare(cd.Challenge, challenge) != 1:
+		return clientData{}, fmt.Errorf("%w: challenge mismatch", ErrVerification)
+	case !slices.Contains(rp.Origins, cd.Origin):
+		return clientData{}, fmt.Errorf("%w: unexpected origin %q", ErrVerification, cd.Origin)
+	case cd.CrossOrigin:
+		return clientData{}, fmt.Errorf("%w: cross-origin ceremony", ErrVerification)
+	}
+
+	return cd, nil
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	rawPublicKey []byte
+	publicKey    publicKey
+}
+
+// verifyAuthenticatorData parses authenticator data and checks it's scoped
+// to the relying party and the user was present
+func (rp RelyingParty) verifyAuthenticatorData(data []byte, requireUV bool) (authenticatorData, error) {
+	// rpIdHash (32) | flags (1) | signCount (4)
+	const headerSize = 37
+
+	if len(data) < headerSize {
+		return authenticatorData{}, fmt.Errorf("%w: authenticator data too short", ErrMalformed)
+	}
+
+	if subtle.ConstantTimeCompare(data[:32], sha256Sum([]byte(rp.ID))) != 1 {
+		return authenticatorData{}, fmt.Errorf("%w: rp id mismatch", ErrVerification)
+	}
+
+	authData := authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	if authData.flags&flagUserPresent == 0 {
+		return authenticatorData{}, fmt.Errorf("%w: user not present", ErrVerification)
+	}
+
+	if requireUV && authData.flags&flagUserVerified == 0 {
+		return authenticatorData{}, fmt.Errorf("%w: user not verified", ErrVerification)
+	}
+
+	rest := data[headerSize:]
+
+	if authData.flags&flagAttestedCredData != 0 {
+		// aaguid (16) | credentialIdLength (2) | credentialId | credentialPublicKey
+		if len(rest) < 18 {
+			return authenticatorData{}, fmt.Errorf("%w: attested credential data too short", ErrMalformed)
+		}
+
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > maxCredentialIDSize || len(rest) < idLen {
+			return authenticatorData{}, fmt.Errorf("%w: invalid credential id", ErrMalformed)
+		}
+
+		authData.credentialID = rest[:idLen:idLen]
+		rest = rest[idLen:]
+
+		key, afterKey, err := parsePublicKey(rest)
+		if err != nil {
+			return authenticatorData{}, err
+		}
+
+		authData.publicKey = key
+		authData.rawPublicKey = rest[: len(rest)-len(afterKey) : len(rest)-len(afterKey)]
+		rest = afterKey
+	}
+
+	if authData.flags&flagExtensionData != 0 {
+		var err error
+		if _, rest, err = decodeCBOR(rest); err != nil {
+			return authenticatorData{}, fmt.Errorf("%w: extensions: %w", ErrMalformed, err)
+		}
+	}
+
+	if len(rest) != 0 {
+		return authenticatorData{}, fmt.Errorf("%w: trailing authenticator data", ErrMalformed)
+	}
+
+	return authData, nil
+}
+
+// verifyAttestation checks attestation statement over authenticator data and client data hash
+func verifyAttestation(format string, statement map[any]any, credentialKey publicKey, signed []byte) error {
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return fmt.Errorf("%w: none attestation with statement", ErrMalformed)
+		}
+		return nil
+	case "packed":
+		return verifyPackedAttestation(statement, credentialKey, signed)
+	default:
+		return fmt.Errorf("%w: attestation format %q", ErrUnsupported, format)
+	}
+}
+
+// verifyPackedAttestation checks packed attestation statement, see section 8.2 of the spec
+//
+// Full attestation is checked against its leaf certificate only, see package doc
+func verifyPackedAttestation(statement map[any]any, credentialKey publicKey, signed []byte) error {
+	alg, _ := statement["alg"].(int64)
+	sig, _ := statement["sig"].([]byte)
+	if sig == nil {
+		return fmt.Errorf("%w: packed attestation without signature", ErrMalformed)
+	}
+
+	chain, ok := statement["x5c"].([]any)
+	if !ok {
+		// self attestation is signed with the credential key itself
+		if alg != credentialKey.alg {
+			return fmt.Errorf("%w: self attestation algorithm mismatch", ErrVerification)
+		}
+		if !credentialKey.verify(signed, sig) {
+			return fmt.Errorf("%w: invalid attestation signature", ErrVerification)
+		}
+		return nil
+	}
+
+	if len(chain) == 0 {
+		return fmt.Errorf("%w: empty attestation certificate chain", ErrMalformed)
+	}
+
+	der, _ := chain[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("%w: attestation certificate: %w", ErrMalformed, err)
+	}
+
+	sigAlg, err := certificateAlgorithm(alg)
+	if err != nil {
+		return err
+	}
+
+	if err = cert.CheckSignature(sigAlg, signed, sig); err != nil {
+		return fmt.Errorf("%w: invalid attestation signature: %w", ErrVerification, err)
+	}
+
+	return nil
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, CredentialDescriptor{Type: typePublicKey, ID: id})
+	}
+
+	return list
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+
+	return sum[:]
+}
@@ -0,0 +1,195 @@
+package webauthn_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/lib/webauthn"
+	"github.com/nhassl3/sso/internal/lib/webauthn/webauthntest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const origin = "https://login.example.com"
+
+var rp = webauthn.RelyingParty{
+	ID:      "example.com",
+	Name:    "Example",
+	Origins: []string{origin},
+}
+
+func register(t *testing.T, authenticator *webauthntest.Authenticator, challenge []byte) (webauthn.Credential, error) {
+	t.Helper()
+
+	opts := rp.CreationOptions(challenge, webauthn.User{ID: []byte{1}, Name: "user@example.com"}, nil, time.Minute)
+
+	response, err := authenticator.Register(opts)
+	require.NoError(t, err)
+
+	reg, err := webauthn.ParseRegistration(response)
+	require.NoError(t, err)
+
+	return rp.VerifyRegistration(reg, challenge, true)
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	for _, format := range []string{"none", "packed"} {
+		t.Run(format, func(t *testing.T) {
+			authenticator, err := webauthntest.New(origin)
+			require.NoError(t, err)
+			authenticator.Attestation = format
+
+			challenge, err := webauthn.NewChallenge()
+			require.NoError(t, err)
+
+			credential, err := register(t, authenticator, challenge)
+			require.NoError(t, err)
+			assert.Equal(t, authenticator.CredentialID(), credential.ID)
+			assert.True(t, credential.UserVerified)
+			assert.Zero(t, credential.SignCount)
+
+			challenge, err = webauthn.NewChallenge()
+			require.NoError(t, err)
+
+			response, err := authenticator.Login(rp.RequestOptions(
+				challenge, [][]byte{credential.ID}, webauthn.UserVerificationRequired, time.Minute,
+			))
+			require.NoError(t, err)
+
+			assertion, err := webauthn.ParseAssertion(response)
+			require.NoError(t, err)
+			assert.Equal(t, []byte{1}, assertion.UserHandle)
+
+			signed, err := webauthn.Challenge(assertion.ClientDataJSON)
+			require.NoError(t, err)
+			assert.Equal(t, challenge, signed)
+
+			signCount, err := rp.VerifyAssertion(assertion, challenge, credential.PublicKey, true)
+			require.NoError(t, err)
+			assert.Equal(t, uint32(1), signCount)
+		})
+	}
+}
+
+func TestVerifyRegistration_Rejected(t *testing.T) {
+	challenge, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+
+	t.Run("wrong challenge", func(t *testing.T) {
+		authenticator, err := webauthntest.New(origin)
+		require.NoError(t, err)
+
+		opts := rp.CreationOptions(challenge, webauthn.User{ID: []byte{1}}, nil, time.Minute)
+		response, err := authenticator.Register(opts)
+		require.NoError(t, err)
+
+		reg, err := webauthn.ParseRegistration(response)
+		require.NoError(t, err)
+
+		other, err := webauthn.NewChallenge()
+		require.NoError(t, err)
+
+		_, err = rp.VerifyRegistration(reg, other, true)
+		assert.ErrorIs(t, err, webauthn.ErrVerification)
+	})
+
+	t.Run("foreign origin", func(t *testing.T) {
+		authenticator, err := webauthntest.New("https://evil.example.net")
+		require.NoError(t, err)
+
+		_, err = register(t, authenticator, challenge)
+		assert.ErrorIs(t, err, webauthn.ErrVerification)
+	})
+
+	t.Run("user not verified", func(t *testing.T) {
+		authenticator, err := webauthntest.New(origin)
+		require.NoError(t, err)
+		authenticator.NoUserVerification = true
+
+		_, err = register(t, authenticator, challenge)
+		assert.ErrorIs(t, err, webauthn.ErrVerification)
+	})
+
+	t.Run("unsupported attestation", func(t *testing.T) {
+		authenticator, err := webauthntest.New(origin)
+		require.NoError(t, err)
+		authenticator.Attestation = "tpm"
+
+		_, err = register(t, authenticator, challenge)
+		assert.ErrorIs(t, err, webauthn.ErrUnsupported)
+	})
+}
+
+func TestVerifyAssertion_Rejected(t *testing.T) {
+	authenticator, err := webauthntest.New(origin)
+	require.NoError(t, err)
+
+	challenge, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+
+	credential, err := register(t, authenticator, challenge)
+	require.NoError(t, err)
+
+	login := func(rpID string) webauthn.Assertion {
+		response, err := authenticator.Login(webauthn.RequestOptions{Challenge: challenge, RPID: rpID})
+		require.NoError(t, err)
+
+		assertion, err := webauthn.ParseAssertion(response)
+		require.NoError(t, err)
+
+		return assertion
+	}
+
+	t.Run("tampered signature", func(t *testing.T) {
+		assertion := login(rp.ID)
+		assertion.Signature[len(assertion.Signature)-1] ^= 0xff
+
+		_, err := rp.VerifyAssertion(assertion, challenge, credential.PublicKey, false)
+		assert.ErrorIs(t, err, webauthn.ErrVerification)
+	})
+
+	t.Run("other rp", func(t *testing.T) {
+		_, err := rp.VerifyAssertion(login("evil.example.net"), challenge, credential.PublicKey, false)
+		assert.ErrorIs(t, err, webauthn.ErrVerification)
+	})
+
+	t.Run("other credential", func(t *testing.T) {
+		other, err := webauthntest.New(origin)
+		require.NoError(t, err)
+
+		otherCredential, err := register(t, other, challenge)
+		require.NoError(t, err)
+
+		_, err = rp.VerifyAssertion(login(rp.ID), challenge, otherCredential.PublicKey, false)
+		assert.ErrorIs(t, err, webauthn.ErrVerification)
+	})
+}
+
+func TestParseRegistration_Malformed(t *testing.T) {
+	testCases := []string{
+		`not json`,
+		`{"type":"public-key","rawId":"AQ","response":{"clientDataJSON":"e30"}}`,
+		`{"type":"password","rawId":"AQ","response":{"clientDataJSON":"e30","attestationObject":"oA"}}`,
+	}
+
+	for _, tc := range testCases {
+		_, err := webauthn.ParseRegistration([]byte(tc))
+		assert.ErrorIs(t, err, webauthn.ErrMalformed, tc)
+	}
+}
+
+func TestCreationOptions_JSON(t *testing.T) {
+	opts := rp.CreationOptions([]byte{0xfb, 0xff}, webauthn.User{ID: []byte{1}, Name: "user"}, [][]byte{{2}}, time.Minute)
+
+	data, err := json.Marshal(opts)
+	require.NoError(t, err)
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	assert.Equal(t, "-_8", decoded["challenge"], "challenge is base64url without padding")
+	assert.Equal(t, "AQ", decoded["user"].(map[string]any)["id"])
+	assert.Equal(t, float64(60000), decoded["timeout"])
+	assert.Len(t, decoded["excludeCredentials"], 1)
+}
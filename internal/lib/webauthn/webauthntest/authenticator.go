@@ -0,0 +1,185 @@
+// Package webauthntest provides a software authenticator for testing WebAuthn ceremonies
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nhassl3/sso/internal/lib/webauthn"
+)
+
+const credentialIDSize = 16
+
+// Authenticator is a software authenticator holding a single ES256 credential
+//
+// Its responses are what a browser would pass to the relying party: the
+// credential serialized with PublicKeyCredential.toJSON()
+type Authenticator struct {
+	// Origin is the origin of the page running the ceremony
+	Origin string
+	// Attestation is the attestation format, "none" or "packed" (self attestation)
+	Attestation string
+	// NoUserVerification makes the authenticator check user presence only
+	NoUserVerification bool
+	// SignCount is the signature counter, it's incremented before every signature
+	SignCount uint32
+
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+}
+
+// New returns authenticator with a new credential for pages of given origin
+func New(origin string) (*Authenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, credentialIDSize)
+	if _, err = rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &Authenticator{
+		Origin:       origin,
+		Attestation:  "none",
+		key:          key,
+		credentialID: id,
+	}, nil
+}
+
+// CredentialID returns ID of the credential of the authenticator
+func (a *Authenticator) CredentialID() []byte {
+	return a.credentialID
+}
+
+// Register creates credential response to navigator.credentials.create() with given options
+func (a *Authenticator) Register(opts webauthn.CreationOptions) ([]byte, error) {
+	a.userHandle = opts.User.ID
+
+	clientData, err := a.clientData("webauthn.create", opts.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	authData := a.authenticatorData(opts.RP.ID, true)
+
+	statement := cborMap{}
+	if a.Attestation == "packed" {
+		sig, err := a.sign(authData, clientData)
+		if err != nil {
+			return nil, err
+		}
+		statement = cborMap{{"alg", webauthn.AlgES256}, {"sig", sig}}
+	}
+
+	attestation := encodeCBOR(cborMap{
+		{"fmt", a.Attestation},
+		{"attStmt", statement},
+		{"authData", authData},
+	})
+
+	return json.Marshal(map[string]any{
+		"id":    webauthn.URLEncoded(a.credentialID),
+		"rawId": webauthn.URLEncoded(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    webauthn.URLEncoded(clientData),
+			"attestationObject": webauthn.URLEncoded(attestation),
+		},
+	})
+}
+
+// Login creates assertion response to navigator.credentials.get() with given options
+func (a *Authenticator) Login(opts webauthn.RequestOptions) ([]byte, error) {
+	if len(opts.AllowCredentials) != 0 && !a.allowed(opts.AllowCredentials) {
+		return nil, fmt.Errorf("credential is not allowed")
+	}
+
+	clientData, err := a.clientData("webauthn.get", opts.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	a.SignCount++
+	authData := a.authenticatorData(opts.RPID, false)
+
+	sig, err := a.sign(authData, clientData)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    webauthn.URLEncoded(a.credentialID),
+		"rawId": webauthn.URLEncoded(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    webauthn.URLEncoded(clientData),
+			"authenticatorData": webauthn.URLEncoded(authData),
+			"signature":         webauthn.URLEncoded(sig),
+			"userHandle":        webauthn.URLEncoded(a.userHandle),
+		},
+	})
+}
+
+func (a *Authenticator) allowed(list []webauthn.CredentialDescriptor) bool {
+	for _, descriptor := range list {
+		if string(descriptor.ID) == string(a.credentialID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   webauthn.URLEncoded(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
+
+func (a *Authenticator) authenticatorData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	flags := byte(0x01)
+	if !a.NoUserVerification {
+		flags |= 0x04
+	}
+	if attested {
+		flags |= 0x40
+	}
+
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.SignCount)
+
+	if attested {
+		data = append(data, make([]byte, 16)...) // zero aaguid
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, encodeCBOR(cborMap{
+			{int64(1), int64(2)},
+			{int64(3), int64(webauthn.AlgES256)},
+			{int64(-1), int64(1)},
+			{int64(-2), a.key.X.FillBytes(make([]byte, 32))},
+			{int64(-3), a.key.Y.FillBytes(make([]byte, 32))},
+		})...)
+	}
+
+	return data
+}
+
+func (a *Authenticator) sign(authData []byte, clientData []byte) ([]byte, error) {
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData[:len(authData):len(authData)], clientDataHash[:]...))
+
+	return ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+}
@@ -0,0 +1,56 @@
+package webauthntest
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// cborMap is a CBOR map encoded with its entries in the given order
+type cborMap []struct {
+	key   any
+	value any
+}
+
+// encodeCBOR encodes values authenticators produce: integers, byte and
+// text strings and maps of them
+func encodeCBOR(value any) []byte {
+	switch v := value.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case cborMap:
+		data := cborHead(5, uint64(len(v)))
+		for _, entry := range v {
+			data = append(data, encodeCBOR(entry.key)...)
+			data = append(data, encodeCBOR(entry.value)...)
+		}
+		return data
+	default:
+		panic(fmt.Sprintf("webauthntest: can't encode %T", value))
+	}
+}
+
+func cborHead(major byte, arg uint64) []byte {
+	major <<= 5
+
+	switch {
+	case arg < 24:
+		return []byte{major | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major | 25}, uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major | 26}, uint32(arg))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major | 27}, arg)
+	}
+}
@@ -5,41 +5,110 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/clientip"
+	"github.com/nhassl3/sso/internal/lib/emailaddr"
 	"github.com/nhassl3/sso/internal/lib/jwt"
 	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
 	"github.com/nhassl3/sso/internal/storage"
-	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	opRegisterUser = "auth.RegisterNewUser"
-	opLogin        = "auth.Login"
-	opIsAdmin      = "auth.IsAdmin"
+	opRegisterUser  = "auth.RegisterNewUser"
+	opLogin         = "auth.Login"
+	opAuthenticate  = "auth.Authenticate"
+	opIssueTokens   = "auth.IssueTokens"
+	opIssueApp      = "auth.IssueAppToken"
+	opIsAdmin       = "auth.IsAdmin"
+	opRefresh       = "auth.Refresh"
+	opLogout        = "auth.Logout"
+	opRevokeToken   = "auth.RevokeToken"
+	opRevokeAll     = "auth.RevokeAllSessions"
+	opPruneTokens   = "auth.PruneExpiredTokens"
+	opIntrospect    = "auth.Introspect"
+	opUserInfo      = "auth.UserInfo"
+	opEnrollTOTP    = "auth.EnrollTOTP"
+	opConfirmTOTP   = "auth.ConfirmTOTP"
+	opVerifyTOTP    = "auth.VerifyTOTP"
+	opVerifyCode    = "auth.VerifyMFACode"
+	opRegenerate    = "auth.RegenerateRecoveryCodes"
+	opCountCodes    = "auth.RecoveryCodesRemaining"
+	opVerifyMFA     = "auth.VerifyMFA"
+	opBeginPasskey  = "auth.BeginPasskeyRegistration"
+	opAddPasskey    = "auth.FinishPasskeyRegistration"
+	opBeginLogin    = "auth.BeginPasskeyLogin"
+	opPasskeyLogin  = "auth.FinishPasskeyLogin"
+	opChangePass    = "auth.ChangePassword"
+	opRequestReset  = "auth.RequestPasswordReset"
+	opResetPass     = "auth.ResetPassword"
+	opRequestVerify = "auth.RequestEmailVerification"
+	opVerifyEmail   = "auth.VerifyEmail"
+	opStartPwdless  = "auth.StartPasswordlessLogin"
+	opFinishPwdless = "auth.CompletePasswordlessLogin"
+	opUnlockUser    = "auth.UnlockUser"
+	opVerifyLogin   = "auth.VerifyLoginMFACode"
 )
 
 var (
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrInvalidAppID       = errors.New("invalid app id")
-	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrInvalidAppID        = errors.New("invalid app id")
+	ErrUserExists          = errors.New("user already exists")
+	ErrInvalidRefresh      = errors.New("invalid refresh token")
+	ErrRefreshReused       = errors.New("refresh token reused")
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrMFAAlreadyEnabled   = errors.New("mfa already enabled")
+	ErrMFANotEnrolled      = errors.New("mfa not enrolled")
+	ErrInvalidMFACode      = errors.New("invalid mfa code")
+	ErrInvalidMFAChallenge = errors.New("invalid mfa challenge")
+	ErrInvalidPasskey      = errors.New("invalid passkey")
+	ErrPasskeyExists       = errors.New("passkey already registered")
+	ErrInvalidResetToken   = errors.New("invalid password reset token")
+	ErrInvalidVerifyToken  = errors.New("invalid email verification token")
+	ErrEmailNotVerified    = errors.New("email not verified")
+	ErrInvalidPasswordless = errors.New("invalid passwordless login")
+	ErrInvalidLoginCode    = errors.New("invalid passwordless code")
+	ErrTooManyAttempts     = errors.New("too many login attempts")
+	ErrAccountLocked       = errors.New("account temporarily locked")
+	ErrWeakPassword        = errors.New("password violates policy")
+	ErrInvalidEmail        = errors.New("invalid email")
 )
 
 type Auth struct {
-	log         *slog.Logger
-	usrSaver    UserSaver
-	usrProvider UserProvider
-	appProvider AppProvider
-	tokenTTL    time.Duration
+	log             *slog.Logger
+	usrSaver        UserSaver
+	usrProvider     UserProvider
+	appProvider     AppProvider
+	tokenStorage    TokenStorage
+	keyProvider     KeyProvider
+	mfaStorage      MFAStorage
+	attemptStorage  AttemptStorage
+	roleProvider    RoleProvider
+	hasher          PasswordHasher
+	dummyHash       func() ([]byte, error)
+	issuer          string
+	tokenTTL        time.Duration
+	refreshTokenTTL time.Duration
+	mfa             MFA
+	mail            Mail
+	lockout         Lockout
+	policy          PasswordPolicy
+	emails          emailaddr.Normalizer
 }
 
 type UserSaver interface {
-	SaveUser(ctx context.Context, email string, password []byte) (uid int64, err error)
+	SaveUser(ctx context.Context, email string, normalizedEmail string, password []byte) (uid int64, err error)
+	UpdatePasswordHash(ctx context.Context, userID int64, expected []byte, passHash []byte) error
+	ReplacePassword(ctx context.Context, userID int64, expected []byte, passHash []byte, revokeBefore time.Time) error
+	MarkEmailVerified(ctx context.Context, userID int64, email string) error
 }
 
 type UserProvider interface {
 	User(ctx context.Context, email string) (user models.User, err error)
+	UserByID(ctx context.Context, userID int64) (user models.User, err error)
 	IsAdmin(ctx context.Context, userID int64) (isAdmin bool, err error)
 }
 
@@ -47,20 +116,119 @@ type AppProvider interface {
 	App(ctx context.Context, appD int) (app models.App, err error)
 }
 
+type TokenStorage interface {
+	SaveRefreshToken(ctx context.Context, token models.RefreshToken) error
+	RefreshToken(ctx context.Context, tokenHash string) (token models.RefreshToken, err error)
+	RotateRefreshToken(ctx context.Context, usedHash string, next models.RefreshToken) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeToken(ctx context.Context, jti string, userID int64, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (revoked bool, err error)
+	RevokeUserSessions(ctx context.Context, userID int64, before time.Time) error
+	DeleteExpiredTokens(ctx context.Context, before time.Time) (deleted int64, err error)
+	SavePasswordResetToken(ctx context.Context, token models.PasswordResetToken) error
+	PasswordResetToken(ctx context.Context, tokenHash string) (token models.PasswordResetToken, err error)
+	DeletePasswordResetToken(ctx context.Context, tokenHash string) error
+	SaveEmailVerificationToken(ctx context.Context, token models.EmailVerificationToken) error
+	EmailVerificationToken(ctx context.Context, tokenHash string) (token models.EmailVerificationToken, err error)
+	DeleteEmailVerificationToken(ctx context.Context, tokenHash string) error
+	DeleteUserEmailVerificationTokens(ctx context.Context, userID int64) error
+	SavePasswordlessLogin(ctx context.Context, login models.PasswordlessLogin) error
+	PasswordlessLogin(ctx context.Context, idHash string) (login models.PasswordlessLogin, err error)
+	UsePasswordlessAttempt(ctx context.Context, idHash string, maxAttempts int) error
+	DeletePasswordlessLogin(ctx context.Context, idHash string) error
+}
+
+type MFAStorage interface {
+	SaveTOTP(ctx context.Context, userID int64, secret []byte) error
+	TOTP(ctx context.Context, userID int64) (totp models.TOTP, err error)
+	EnableTOTP(ctx context.Context, userID int64, step int64) error
+	UseTOTPStep(ctx context.Context, userID int64, step int64) error
+	SaveMFAChallenge(ctx context.Context, challenge models.MFAChallenge) error
+	MFAChallenge(ctx context.Context, idHash string) (challenge models.MFAChallenge, err error)
+	UseMFAChallengeAttempt(ctx context.Context, idHash string, maxAttempts int) error
+	DeleteMFAChallenge(ctx context.Context, idHash string) error
+	DeleteExpiredMFAChallenges(ctx context.Context, before time.Time) (deleted int64, err error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes [][]byte) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) error
+	CountRecoveryCodes(ctx context.Context, userID int64) (count int, err error)
+	SavePasskey(ctx context.Context, passkey models.Passkey) error
+	Passkey(ctx context.Context, id []byte) (passkey models.Passkey, err error)
+	Passkeys(ctx context.Context, userID int64) (passkeys []models.Passkey, err error)
+	UpdatePasskeySignCount(ctx context.Context, id []byte, signCount uint32, usedAt time.Time) error
+	SaveWebAuthnSession(ctx context.Context, session models.WebAuthnSession) error
+	WebAuthnSession(ctx context.Context, challengeHash string) (session models.WebAuthnSession, err error)
+	DeleteWebAuthnSession(ctx context.Context, challengeHash string) error
+	DeleteExpiredWebAuthnSessions(ctx context.Context, before time.Time) (deleted int64, err error)
+}
+
+type AttemptStorage interface {
+	LoginFailures(ctx context.Context, subject string) (failures models.LoginFailures, err error)
+	ReserveLoginAttempt(ctx context.Context, seen models.LoginFailures, at time.Time, windowStart time.Time) error
+	ReleaseLoginAttempt(ctx context.Context, subject string) error
+	ResetLoginFailures(ctx context.Context, subject string) error
+	DeleteStaleLoginFailures(ctx context.Context, before time.Time) (deleted int64, err error)
+}
+
+// RoleProvider returns roles of users put into access tokens
+type RoleProvider interface {
+	UserRoles(ctx context.Context, userID int64, appID int) (roles []models.Role, err error)
+}
+
+// PasswordHasher hashes passwords and checks them against stored hashes
+type PasswordHasher interface {
+	Hash(password string) (hash []byte, err error)
+	// Compare returns nil if password matches hash of any supported algorithm
+	Compare(hash []byte, password string) error
+	// NeedsRehash reports whether hash is made with outdated algorithm or parameters
+	NeedsRehash(hash []byte) bool
+}
+
+type KeyProvider interface {
+	SigningKey(ctx context.Context, appID int) (key *jwt.Key, err error)
+	VerificationKey(ctx context.Context, appID int, kid string) (key jwt.Key, err error)
+}
+
 // New returns a new instance of the Auth service
 func New(
 	log *slog.Logger,
 	usrSaver UserSaver,
 	usrProvider UserProvider,
 	appProvider AppProvider,
+	tokenStorage TokenStorage,
+	keyProvider KeyProvider,
+	mfaStorage MFAStorage,
+	attemptStorage AttemptStorage,
+	roleProvider RoleProvider,
+	hasher PasswordHasher,
+	issuer string,
 	tokenTTL time.Duration,
+	refreshTokenTTL time.Duration,
+	mfa MFA,
+	mail Mail,
+	lockout Lockout,
+	policy PasswordPolicy,
+	emails emailaddr.Normalizer,
 ) *Auth {
 	return &Auth{
-		log:         log,
-		usrSaver:    usrSaver,
-		usrProvider: usrProvider,
-		appProvider: appProvider,
-		tokenTTL:    tokenTTL,
+		log:             log,
+		usrSaver:        usrSaver,
+		usrProvider:     usrProvider,
+		appProvider:     appProvider,
+		tokenStorage:    tokenStorage,
+		keyProvider:     keyProvider,
+		mfaStorage:      mfaStorage,
+		attemptStorage:  attemptStorage,
+		roleProvider:    roleProvider,
+		hasher:          hasher,
+		dummyHash:       newDummyHash(hasher),
+		issuer:          issuer,
+		tokenTTL:        tokenTTL,
+		refreshTokenTTL: refreshTokenTTL,
+		mfa:             mfa,
+		mail:            mail,
+		lockout:         lockout,
+		policy:          policy,
+		emails:          emails,
 	}
 }
 
@@ -68,66 +236,276 @@ func New(
 //
 // If user exists with given email, but password is incorrect, returns error
 // If user doesn't exist, returns error
-// Else returns string value (token) and nil for error object
+// If the app requires verified email and user hasn't verified it, returns ErrEmailNotVerified
+// If user has enabled MFA, returns only MFA challenge ID to be completed with VerifyMFA
+// Else returns access token with a refresh token starting a new token family
+// and OpenID Connect ID token with given nonce
 func (a *Auth) Login(
 	ctx context.Context,
 	email string,
 	password string,
 	appID int,
-) (string, error) {
+	nonce string,
+) (models.Tokens, error) {
 	log := a.log.With(
 		slog.String("op", opLogin),
 		slog.String("email", email),
 		slog.Int("AppID", appID),
 	)
 
+	user, err := a.Authenticate(ctx, email, password)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opLogin, err)
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opLogin, err)
+	}
+
+	if err = checkEmailVerified(user, app); err != nil {
+		log.Warn("email not verified")
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opLogin, err)
+	}
+
+	if user.MFAEnabled {
+		challengeID, err := a.newMFAChallenge(ctx, user, app, nonce)
+		if err != nil {
+			log.Error("failed to create mfa challenge", sl.ErrLog(err))
+
+			return models.Tokens{}, fmt.Errorf("%s: %w", opLogin, err)
+		}
+
+		log.Info("mfa challenge issued")
+
+		return models.Tokens{MFAChallengeID: challengeID}, nil
+	}
+
+	tokens, err := a.newSession(ctx, user, app, nonce, time.Now())
+	if err != nil {
+		log.Error("failed to issue tokens", sl.ErrLog(err))
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opLogin, err)
+	}
+
+	return tokens, nil
+}
+
+// Authenticate checks user credentials without issuing any tokens
+//
+// Users are looked up by canonical form of the email.
+// If user doesn't exist or password is incorrect, returns ErrInvalidCredentials.
+// Failures are counted per email and client IP: after a failure the next attempt
+// has to wait, returning ErrTooManyAttempts, and too many failures lock the email
+// with ErrAccountLocked. Locked attempts aren't checked at all
+func (a *Auth) Authenticate(ctx context.Context, email string, password string) (models.User, error) {
+	email = a.canonicalEmail(email)
+
+	log := a.log.With(
+		slog.String("op", opAuthenticate),
+		slog.String("email", email),
+		slog.String("ip", clientip.FromContext(ctx)),
+	)
+
+	if err := a.reserveLoginAttempt(ctx, email); err != nil {
+		if errors.Is(err, ErrTooManyAttempts) || errors.Is(err, ErrAccountLocked) {
+			log.Warn("login attempt rejected", sl.ErrLog(err))
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", opAuthenticate, err)
+	}
+
 	user, err := a.usrProvider.User(ctx, email)
 	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			log.Warn("user not found", sl.ErrLog(err))
+		if !errors.Is(err, storage.ErrUserNotFound) {
+			log.Error("failed to get user", sl.ErrLog(err))
 
-			return "", fmt.Errorf("%s: %w", opLogin, ErrInvalidCredentials)
+			return models.User{}, a.loginError(ctx, log, email, err)
 		}
+
+		dummyHash, hashErr := a.dummyHash()
+		if hashErr != nil {
+			log.Error("failed to generate dummy hash", sl.ErrLog(hashErr))
+
+			return models.User{}, a.loginError(ctx, log, email, hashErr)
+		}
+
+		// compare the password anyway, so that unknown emails take as long
+		// as wrong passwords and can't be told apart by response time
+		_ = a.hasher.Compare(dummyHash, password)
+
+		log.Warn("user not found", sl.ErrLog(err))
+
+		return models.User{}, fmt.Errorf("%s: %w", opAuthenticate, ErrInvalidCredentials)
 	}
 
-	if err = bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)); err != nil {
+	if err = a.hasher.Compare(user.PasswordHash, password); err != nil {
 		log.Warn("invalid credentials", sl.ErrLog(err))
 
-		return "", fmt.Errorf("%s: %w", opLogin, ErrInvalidCredentials)
+		return models.User{}, fmt.Errorf("%s: %w", opAuthenticate, ErrInvalidCredentials)
+	}
+
+	if err = a.loginSucceeded(ctx, email); err != nil {
+		log.Error("failed to reset login failures", sl.ErrLog(err))
+
+		return models.User{}, fmt.Errorf("%s: %w", opAuthenticate, err)
+	}
+
+	return a.rehashPassword(ctx, log, user, password), nil
+}
+
+// canonicalEmail returns canonical form of the email users are looked up by.
+// Invalid emails are returned trimmed, so they just match no user
+func (a *Auth) canonicalEmail(email string) string {
+	return a.emails.Key(email)
+}
+
+// newDummyHash returns lazily made hash to compare passwords of unknown users
+// against. It has the algorithm and parameters of new password hashes
+func newDummyHash(hasher PasswordHasher) func() ([]byte, error) {
+	return sync.OnceValues(func() ([]byte, error) {
+		return hasher.Hash("dummy password")
+	})
+}
+
+// rehashPassword replaces hash of the user's password if it's made with
+// outdated algorithm or parameters. Failures are logged only, as the user
+// has already logged in
+func (a *Auth) rehashPassword(ctx context.Context, log *slog.Logger, user models.User, password string) models.User {
+	if !a.hasher.NeedsRehash(user.PasswordHash) {
+		return user
+	}
+
+	passHash, err := a.hasher.Hash(password)
+	if err != nil {
+		log.Error("failed to generate password hash", sl.ErrLog(err))
+
+		return user
+	}
+
+	if err = a.usrSaver.UpdatePasswordHash(ctx, user.ID, user.PasswordHash, passHash); err != nil {
+		if errors.Is(err, storage.ErrPasswordHashMismatch) {
+			log.Warn("password changed concurrently, hash not upgraded")
+
+			return user
+		}
+
+		log.Error("failed to upgrade password hash", sl.ErrLog(err))
+
+		return user
+	}
+
+	log.Info("password hash upgraded")
+
+	user.PasswordHash = passHash
+
+	return user
+}
+
+// loginError takes back reserved login attempt which has failed with err
+// rather than wrong credentials and returns err
+func (a *Auth) loginError(ctx context.Context, log *slog.Logger, email string, err error) error {
+	if releaseErr := a.releaseLoginAttempt(ctx, email); releaseErr != nil {
+		log.Error("failed to release login attempt", sl.ErrLog(releaseErr))
+	}
+
+	return fmt.Errorf("%s: %w", opAuthenticate, err)
+}
+
+// IssueTokens issues the same tokens as Login to the user authenticated at authTime
+// by other means, e.g. through OAuth 2.0 authorization code
+func (a *Auth) IssueTokens(
+	ctx context.Context,
+	userID int64,
+	appID int,
+	nonce string,
+	authTime time.Time,
+) (models.Tokens, error) {
+	log := a.log.With(
+		slog.String("op", opIssueTokens),
+		slog.Int64("userID", userID),
+		slog.Int("appID", appID),
+	)
+
+	user, err := a.usrProvider.UserByID(ctx, userID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opIssueTokens, err)
 	}
 
 	app, err := a.appProvider.App(ctx, appID)
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", opLogin, err)
+		return models.Tokens{}, fmt.Errorf("%s: %w", opIssueTokens, err)
+	}
+
+	tokens, err := a.newSession(ctx, user, app, nonce, authTime)
+	if err != nil {
+		log.Error("failed to issue tokens", sl.ErrLog(err))
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opIssueTokens, err)
+	}
+
+	return tokens, nil
+}
+
+// IssueAppToken issues access token that represents the app itself,
+// e.g. to the client authenticated through OAuth 2.0 client credentials grant
+func (a *Auth) IssueAppToken(ctx context.Context, app models.App, scope string, ttl time.Duration) (string, error) {
+	key, err := a.keyProvider.SigningKey(ctx, app.ID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", opIssueApp, err)
+	}
+
+	var opts []jwt.Option
+	if key != nil {
+		opts = append(opts, jwt.WithKey(*key))
 	}
 
-	token, err := jwt.NewToken(user, app, a.tokenTTL)
+	token, err := jwt.NewAppToken(app, ttl, scope, opts...)
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", opLogin, err)
+		return "", fmt.Errorf("%s: %w", opIssueApp, err)
 	}
 
 	return token, nil
 }
 
 // RegisterNewUser lets user register in system with given credentials
+//
+// Email is stored as given along with its canonical form, unique among users.
+// Password must follow policy of the app, zero appID stands for the default one.
+// Email verification link is sent to the user in background
 func (a *Auth) RegisterNewUser(
 	ctx context.Context,
 	email string,
 	password string,
+	appID int,
 ) (int64, error) {
 	log := a.log.With(
 		slog.String("op", opRegisterUser),
 		slog.String("email", email),
 	)
 
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	email = strings.TrimSpace(email)
+
+	normalized, err := a.emails.Normalize(email)
+	if err != nil {
+		log.Warn("invalid email", sl.ErrLog(err))
+
+		return 0, fmt.Errorf("%s: %w", opRegisterUser, ErrInvalidEmail)
+	}
+
+	if err = a.checkPassword(log, appID, password, email); err != nil {
+		return 0, fmt.Errorf("%s: %w", opRegisterUser, err)
+	}
+
+	passHash, err := a.hasher.Hash(password)
 	if err != nil {
 		log.Error("failed to generate password hash", sl.ErrLog(err))
 
 		return 0, fmt.Errorf("%s: %w", opRegisterUser, err)
 	}
 
-	id, err := a.usrSaver.SaveUser(ctx, email, passHash)
+	id, err := a.usrSaver.SaveUser(ctx, email, normalized, passHash)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserExists) {
 			log.Warn("user already exists", sl.ErrLog(err))
@@ -139,6 +517,8 @@ func (a *Auth) RegisterNewUser(
 
 	log.Info("User registered", slog.Int64("id", id))
 
+	go a.sendVerificationLink(context.WithoutCancel(ctx), models.User{ID: id, Email: email}, log)
+
 	return id, nil
 }
 
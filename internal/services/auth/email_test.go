@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister_NormalizedEmail(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	id, err := a.RegisterNewUser(ctx, " Bob@Example.COM ", "password", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "Bob@Example.COM", st.users[id].Email, "email is stored as given, but trimmed")
+
+	_, err = a.RegisterNewUser(ctx, "bob@example.com", "password", 0)
+	assert.ErrorIs(t, err, ErrUserExists)
+
+	_, err = a.RegisterNewUser(ctx, "bob", "password", 0)
+	assert.ErrorIs(t, err, ErrInvalidEmail)
+
+	tokens, err := a.Login(ctx, "BOB@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	claims, _, err := a.Introspect(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, id, claims.UserID)
+}
+
+func TestLockout_EmailVariants(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	variants := []string{"user@example.com", "USER@example.com", "User@Example.com", " user@EXAMPLE.COM"}
+
+	for i := range a.lockout.MaxFailures {
+		_, err := a.Login(ctx, variants[i%len(variants)], "wrong", 1, "")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	_, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	assert.ErrorIs(t, err, ErrAccountLocked, "variants of the email share the counter")
+}
@@ -0,0 +1,884 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/crypt"
+	"github.com/nhassl3/sso/internal/lib/emailaddr"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	"github.com/nhassl3/sso/internal/lib/logger/handlers/slogdiscard"
+	"github.com/nhassl3/sso/internal/lib/mailer"
+	"github.com/nhassl3/sso/internal/lib/password"
+	"github.com/nhassl3/sso/internal/lib/webauthn"
+	"github.com/nhassl3/sso/internal/storage"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeStorage struct {
+	mu     sync.Mutex
+	users  map[int64]models.User
+	apps   map[int]models.App
+	tokens map[string]models.RefreshToken
+
+	revoked       map[string]time.Time
+	revokedBefore map[int64]time.Time
+
+	totp          map[int64]models.TOTP
+	challenges    map[string]models.MFAChallenge
+	recoveryCodes map[int64][][]byte
+
+	resetTokens  map[string]models.PasswordResetToken
+	verifyTokens map[string]models.EmailVerificationToken
+	passwordless map[string]models.PasswordlessLogin
+
+	loginFailures map[string]models.LoginFailures
+
+	passkeys         map[string]models.Passkey
+	webAuthnSessions map[string]models.WebAuthnSession
+
+	roles map[int64][]models.Role
+}
+
+func newFakeStorage(t *testing.T) *fakeStorage {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	return &fakeStorage{
+		users:  map[int64]models.User{1: {ID: 1, Email: "user@example.com", PasswordHash: hash}},
+		apps:   map[int]models.App{1: {ID: 1, Name: "test", Secret: "secret"}},
+		tokens: map[string]models.RefreshToken{},
+
+		revoked:       map[string]time.Time{},
+		revokedBefore: map[int64]time.Time{},
+
+		totp:          map[int64]models.TOTP{},
+		challenges:    map[string]models.MFAChallenge{},
+		recoveryCodes: map[int64][][]byte{},
+
+		resetTokens:  map[string]models.PasswordResetToken{},
+		verifyTokens: map[string]models.EmailVerificationToken{},
+		passwordless: map[string]models.PasswordlessLogin{},
+
+		loginFailures: map[string]models.LoginFailures{},
+
+		passkeys:         map[string]models.Passkey{},
+		webAuthnSessions: map[string]models.WebAuthnSession{},
+
+		roles: map[int64][]models.Role{},
+	}
+}
+
+// fakeNormalizer makes canonical emails of fake users, stored emails are
+// normalized on the fly instead of keeping another column
+var fakeNormalizer = emailaddr.Normalizer{FoldLocalPart: true}
+
+func (s *fakeStorage) SaveUser(_ context.Context, email string, normalizedEmail string, passHash []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if existing, _ := fakeNormalizer.Normalize(u.Email); existing == normalizedEmail {
+			return 0, storage.ErrUserExists
+		}
+	}
+
+	id := int64(len(s.users) + 1)
+	s.users[id] = models.User{ID: id, Email: email, PasswordHash: passHash}
+
+	return id, nil
+}
+
+func (s *fakeStorage) UpdatePasswordHash(_ context.Context, userID int64, expected []byte, passHash []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || !bytes.Equal(u.PasswordHash, expected) {
+		return storage.ErrPasswordHashMismatch
+	}
+
+	u.PasswordHash = passHash
+	s.users[userID] = u
+
+	return nil
+}
+
+func (s *fakeStorage) ReplacePassword(
+	_ context.Context,
+	userID int64,
+	expected []byte,
+	passHash []byte,
+	revokeBefore time.Time,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || !bytes.Equal(u.PasswordHash, expected) {
+		return storage.ErrPasswordHashMismatch
+	}
+
+	u.PasswordHash = passHash
+	s.users[userID] = u
+
+	s.revokedBefore[userID] = revokeBefore.Truncate(time.Millisecond)
+	for hash, token := range s.tokens {
+		if token.UserID == userID {
+			token.Revoked = true
+			s.tokens[hash] = token
+		}
+	}
+
+	for hash, token := range s.resetTokens {
+		if token.UserID == userID {
+			delete(s.resetTokens, hash)
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeStorage) MarkEmailVerified(_ context.Context, userID int64, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || u.Email != email {
+		return storage.ErrUserNotFound
+	}
+
+	u.EmailVerified = true
+	s.users[userID] = u
+
+	return nil
+}
+
+func (s *fakeStorage) User(_ context.Context, email string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if normalized, _ := fakeNormalizer.Normalize(u.Email); normalized == email {
+			return s.withPasskeys(u), nil
+		}
+	}
+
+	return models.User{}, storage.ErrUserNotFound
+}
+
+func (s *fakeStorage) UserByID(_ context.Context, userID int64) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return s.withPasskeys(u), nil
+}
+
+// withPasskeys enables MFA of the user with a passkey, like storage does
+func (s *fakeStorage) withPasskeys(u models.User) models.User {
+	for _, passkey := range s.passkeys {
+		if passkey.UserID == u.ID {
+			u.MFAEnabled = true
+		}
+	}
+
+	return u
+}
+
+func (s *fakeStorage) IsAdmin(_ context.Context, _ int64) (bool, error) {
+	return false, nil
+}
+
+func (s *fakeStorage) App(_ context.Context, appID int) (models.App, error) {
+	app, ok := s.apps[appID]
+	if !ok {
+		return models.App{}, storage.ErrAppNotFound
+	}
+
+	return app, nil
+}
+
+func (s *fakeStorage) SaveRefreshToken(_ context.Context, token models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token.TokenHash] = token
+
+	return nil
+}
+
+func (s *fakeStorage) RefreshToken(_ context.Context, tokenHash string) (models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenHash]
+	if !ok {
+		return models.RefreshToken{}, storage.ErrRefreshTokenNotFound
+	}
+
+	return token, nil
+}
+
+func (s *fakeStorage) RotateRefreshToken(_ context.Context, usedHash string, next models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used := s.tokens[usedHash]
+	if used.Used || used.Revoked {
+		return storage.ErrRefreshTokenAlreadyUsed
+	}
+
+	used.Used = true
+	s.tokens[usedHash] = used
+	s.tokens[next.TokenHash] = next
+
+	return nil
+}
+
+func (s *fakeStorage) RevokeRefreshTokenFamily(_ context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, token := range s.tokens {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+			s.tokens[hash] = token
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeStorage) RevokeToken(_ context.Context, jti string, _ int64, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revoked[jti] = expiresAt
+
+	return nil
+}
+
+func (s *fakeStorage) IsTokenRevoked(_ context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revoked[jti]; ok {
+		return true, nil
+	}
+
+	before, ok := s.revokedBefore[userID]
+
+	return ok && issuedAt.Before(before), nil
+}
+
+func (s *fakeStorage) RevokeUserSessions(_ context.Context, userID int64, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokedBefore[userID] = before.Truncate(time.Millisecond)
+	for hash, token := range s.tokens {
+		if token.UserID == userID {
+			token.Revoked = true
+			s.tokens[hash] = token
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeStorage) DeleteExpiredTokens(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for jti, expiresAt := range s.revoked {
+		if expiresAt.Before(before) {
+			delete(s.revoked, jti)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+type fakeKeys struct {
+	keys   map[string]jwt.Key
+	active string
+}
+
+func (k *fakeKeys) SigningKey(_ context.Context, _ int) (*jwt.Key, error) {
+	if k.active == "" {
+		return nil, nil
+	}
+
+	key := k.keys[k.active]
+
+	return &key, nil
+}
+
+func (k *fakeKeys) VerificationKey(_ context.Context, _ int, kid string) (jwt.Key, error) {
+	key, ok := k.keys[kid]
+	if !ok {
+		return jwt.Key{}, jwt.ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+// testOrigin is the origin of the login page passkeys are used on in tests
+const testOrigin = "https://login.example.com"
+
+func newTestAuth(t *testing.T) (*Auth, *fakeStorage) {
+	t.Helper()
+
+	return newTestAuthWithKeys(t, nil, "")
+}
+
+func newTestAuthWithKeys(t *testing.T, signingKeys []jwt.Key, activeID string) (*Auth, *fakeStorage) {
+	t.Helper()
+
+	st := newFakeStorage(t)
+
+	kp := &fakeKeys{keys: map[string]jwt.Key{}, active: activeID}
+	for _, key := range signingKeys {
+		kp.keys[key.ID] = key
+	}
+
+	cipher, err := crypt.New(bytes.Repeat([]byte{1}, crypt.KeySize))
+	require.NoError(t, err)
+
+	return New(
+		slogdiscard.NewDiscardLogger(),
+		st,
+		st,
+		st,
+		st,
+		kp,
+		st,
+		st,
+		st,
+		password.Bcrypt{Cost: bcrypt.MinCost},
+		"https://sso.example.com",
+		time.Hour,
+		24*time.Hour,
+		MFA{
+			Cipher:          cipher,
+			RecoveryCodeKey: bytes.Repeat([]byte{2}, 32),
+			TOTPIssuer:      "sso",
+			ChallengeTTL:    5 * time.Minute,
+			MaxAttempts:     3,
+			RelyingParty: webauthn.RelyingParty{
+				ID:      "example.com",
+				Name:    "Example",
+				Origins: []string{testOrigin},
+			},
+		},
+		Mail{
+			Mailer: newFakeMailer(),
+			PasswordReset: Link{
+				URL:      "https://login.example.com/reset?lang=en",
+				TokenTTL: time.Hour,
+			},
+			EmailVerification: Link{
+				URL:      "https://login.example.com/verify?lang=en",
+				TokenTTL: time.Hour,
+			},
+			Passwordless: Passwordless{
+				Link: Link{
+					URL:      "https://login.example.com/passwordless?lang=en",
+					TokenTTL: time.Hour,
+				},
+				MaxAttempts: 3,
+			},
+		},
+		Lockout{
+			MaxFailures:   5,
+			MaxIPFailures: 10,
+			LockDuration:  15 * time.Minute,
+			Window:        time.Hour,
+		},
+		PasswordPolicy{},
+		fakeNormalizer,
+	), st
+}
+
+func (s *fakeStorage) SaveTOTP(_ context.Context, userID int64, secret []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.totp[userID] = models.TOTP{UserID: userID, Secret: secret}
+
+	return nil
+}
+
+func (s *fakeStorage) TOTP(_ context.Context, userID int64) (models.TOTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totp[userID]
+	if !ok {
+		return models.TOTP{}, storage.ErrTOTPNotFound
+	}
+
+	return totp, nil
+}
+
+func (s *fakeStorage) EnableTOTP(_ context.Context, userID int64, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totp[userID]
+	if !ok {
+		return storage.ErrTOTPNotFound
+	}
+
+	totp.Enabled = true
+	totp.LastStep = step
+	s.totp[userID] = totp
+
+	user := s.users[userID]
+	user.MFAEnabled = true
+	s.users[userID] = user
+
+	return nil
+}
+
+func (s *fakeStorage) UseTOTPStep(_ context.Context, userID int64, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp := s.totp[userID]
+	if totp.LastStep >= step {
+		return storage.ErrTOTPStepUsed
+	}
+
+	totp.LastStep = step
+	s.totp[userID] = totp
+
+	return nil
+}
+
+func (s *fakeStorage) SaveMFAChallenge(_ context.Context, challenge models.MFAChallenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.challenges[challenge.IDHash] = challenge
+
+	return nil
+}
+
+func (s *fakeStorage) MFAChallenge(_ context.Context, idHash string) (models.MFAChallenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	challenge, ok := s.challenges[idHash]
+	if !ok {
+		return models.MFAChallenge{}, storage.ErrMFAChallengeNotFound
+	}
+
+	return challenge, nil
+}
+
+func (s *fakeStorage) UseMFAChallengeAttempt(_ context.Context, idHash string, maxAttempts int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	challenge, ok := s.challenges[idHash]
+	if !ok || challenge.Attempts >= maxAttempts {
+		return storage.ErrMFAChallengeNotFound
+	}
+
+	challenge.Attempts++
+	s.challenges[idHash] = challenge
+
+	return nil
+}
+
+func (s *fakeStorage) DeleteMFAChallenge(_ context.Context, idHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.challenges[idHash]; !ok {
+		return storage.ErrMFAChallengeNotFound
+	}
+
+	delete(s.challenges, idHash)
+
+	return nil
+}
+
+func (s *fakeStorage) DeleteExpiredMFAChallenges(_ context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStorage) ReplaceRecoveryCodes(_ context.Context, userID int64, codeHashes [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recoveryCodes[userID] = slices.Clone(codeHashes)
+
+	return nil
+}
+
+func (s *fakeStorage) UseRecoveryCode(_ context.Context, userID int64, codeHash []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes := s.recoveryCodes[userID]
+
+	i := slices.IndexFunc(codes, func(hash []byte) bool { return bytes.Equal(hash, codeHash) })
+	if i < 0 {
+		return storage.ErrRecoveryCodeNotFound
+	}
+
+	s.recoveryCodes[userID] = slices.Delete(codes, i, i+1)
+
+	return nil
+}
+
+func (s *fakeStorage) CountRecoveryCodes(_ context.Context, userID int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.recoveryCodes[userID]), nil
+}
+
+func (s *fakeStorage) SavePasskey(_ context.Context, passkey models.Passkey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.passkeys[string(passkey.ID)]; ok {
+		return storage.ErrPasskeyExists
+	}
+
+	s.passkeys[string(passkey.ID)] = passkey
+
+	return nil
+}
+
+func (s *fakeStorage) Passkey(_ context.Context, id []byte) (models.Passkey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	passkey, ok := s.passkeys[string(id)]
+	if !ok {
+		return models.Passkey{}, storage.ErrPasskeyNotFound
+	}
+
+	return passkey, nil
+}
+
+func (s *fakeStorage) Passkeys(_ context.Context, userID int64) ([]models.Passkey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var passkeys []models.Passkey
+	for _, passkey := range s.passkeys {
+		if passkey.UserID == userID {
+			passkeys = append(passkeys, passkey)
+		}
+	}
+
+	return passkeys, nil
+}
+
+func (s *fakeStorage) UpdatePasskeySignCount(_ context.Context, id []byte, signCount uint32, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	passkey, ok := s.passkeys[string(id)]
+	if !ok || (signCount <= passkey.SignCount && (signCount != 0 || passkey.SignCount != 0)) {
+		return storage.ErrPasskeySignCount
+	}
+
+	passkey.SignCount = signCount
+	passkey.LastUsedAt = usedAt
+	s.passkeys[string(id)] = passkey
+
+	return nil
+}
+
+func (s *fakeStorage) SaveWebAuthnSession(_ context.Context, session models.WebAuthnSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.webAuthnSessions[session.ChallengeHash] = session
+
+	return nil
+}
+
+func (s *fakeStorage) WebAuthnSession(_ context.Context, challengeHash string) (models.WebAuthnSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.webAuthnSessions[challengeHash]
+	if !ok {
+		return models.WebAuthnSession{}, storage.ErrWebAuthnSessionNotFound
+	}
+
+	return session, nil
+}
+
+func (s *fakeStorage) DeleteWebAuthnSession(_ context.Context, challengeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webAuthnSessions[challengeHash]; !ok {
+		return storage.ErrWebAuthnSessionNotFound
+	}
+
+	delete(s.webAuthnSessions, challengeHash)
+
+	return nil
+}
+
+func (s *fakeStorage) DeleteExpiredWebAuthnSessions(_ context.Context, _ time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStorage) SavePasswordResetToken(_ context.Context, token models.PasswordResetToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resetTokens[token.TokenHash] = token
+
+	return nil
+}
+
+func (s *fakeStorage) PasswordResetToken(_ context.Context, tokenHash string) (models.PasswordResetToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.resetTokens[tokenHash]
+	if !ok {
+		return models.PasswordResetToken{}, storage.ErrResetTokenNotFound
+	}
+
+	return token, nil
+}
+
+func (s *fakeStorage) DeletePasswordResetToken(_ context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.resetTokens[tokenHash]; !ok {
+		return storage.ErrResetTokenNotFound
+	}
+
+	delete(s.resetTokens, tokenHash)
+
+	return nil
+}
+
+func (s *fakeStorage) SaveEmailVerificationToken(_ context.Context, token models.EmailVerificationToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.verifyTokens[token.TokenHash] = token
+
+	return nil
+}
+
+func (s *fakeStorage) EmailVerificationToken(_ context.Context, tokenHash string) (models.EmailVerificationToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.verifyTokens[tokenHash]
+	if !ok {
+		return models.EmailVerificationToken{}, storage.ErrVerifyTokenNotFound
+	}
+
+	return token, nil
+}
+
+func (s *fakeStorage) DeleteEmailVerificationToken(_ context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.verifyTokens[tokenHash]; !ok {
+		return storage.ErrVerifyTokenNotFound
+	}
+
+	delete(s.verifyTokens, tokenHash)
+
+	return nil
+}
+
+func (s *fakeStorage) DeleteUserEmailVerificationTokens(_ context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, token := range s.verifyTokens {
+		if token.UserID == userID {
+			delete(s.verifyTokens, hash)
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeStorage) SavePasswordlessLogin(_ context.Context, login models.PasswordlessLogin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.passwordless[login.IDHash] = login
+
+	return nil
+}
+
+func (s *fakeStorage) PasswordlessLogin(_ context.Context, idHash string) (models.PasswordlessLogin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login, ok := s.passwordless[idHash]
+	if !ok {
+		return models.PasswordlessLogin{}, storage.ErrPasswordlessNotFound
+	}
+
+	return login, nil
+}
+
+func (s *fakeStorage) UsePasswordlessAttempt(_ context.Context, idHash string, maxAttempts int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login, ok := s.passwordless[idHash]
+	if !ok || login.Attempts >= maxAttempts {
+		return storage.ErrPasswordlessNotFound
+	}
+
+	login.Attempts++
+	s.passwordless[idHash] = login
+
+	return nil
+}
+
+func (s *fakeStorage) DeletePasswordlessLogin(_ context.Context, idHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.passwordless[idHash]; !ok {
+		return storage.ErrPasswordlessNotFound
+	}
+
+	delete(s.passwordless, idHash)
+
+	return nil
+}
+
+func (s *fakeStorage) LoginFailures(_ context.Context, subject string) (models.LoginFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures, ok := s.loginFailures[subject]
+	if !ok {
+		return models.LoginFailures{Subject: subject}, nil
+	}
+
+	return failures, nil
+}
+
+func (s *fakeStorage) ReserveLoginAttempt(_ context.Context, seen models.LoginFailures, at time.Time, windowStart time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures := s.loginFailures[seen.Subject]
+	if failures.Failures != seen.Failures || !failures.LastFailureAt.Equal(seen.LastFailureAt) {
+		return storage.ErrLoginFailuresChanged
+	}
+
+	if failures.LastFailureAt.Before(windowStart) {
+		failures.Failures = 0
+	}
+
+	failures.Subject = seen.Subject
+	failures.Failures++
+	failures.LastFailureAt = at
+	s.loginFailures[seen.Subject] = failures
+
+	return nil
+}
+
+func (s *fakeStorage) ReleaseLoginAttempt(_ context.Context, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures, ok := s.loginFailures[subject]
+	if !ok || failures.Failures == 0 {
+		return nil
+	}
+
+	failures.Failures--
+	s.loginFailures[subject] = failures
+
+	return nil
+}
+
+func (s *fakeStorage) ResetLoginFailures(_ context.Context, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loginFailures, subject)
+
+	return nil
+}
+
+func (s *fakeStorage) DeleteStaleLoginFailures(_ context.Context, _ time.Time) (int64, error) {
+	return 0, nil
+}
+
+// fakeMailer keeps sent messages until the test reads them
+type fakeMailer struct {
+	sent chan mailer.Message
+}
+
+func newFakeMailer() *fakeMailer {
+	return &fakeMailer{sent: make(chan mailer.Message, 16)}
+}
+
+func (m *fakeMailer) Send(_ context.Context, msg mailer.Message) error {
+	m.sent <- msg
+
+	return nil
+}
+
+// next waits for the next sent message
+func (m *fakeMailer) next(t *testing.T) mailer.Message {
+	t.Helper()
+
+	select {
+	case msg := <-m.sent:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message sent")
+
+		return mailer.Message{}
+	}
+}
+
+func (s *fakeStorage) UserRoles(_ context.Context, userID int64, appID int) ([]models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var roles []models.Role
+	for _, role := range s.roles[userID] {
+		if role.AppID == appID {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+)
+
+// Introspect checks token signature, expiry and revocation, like RFC 7662
+//
+// Returns claims and true if token is active. Inactive token isn't an error:
+// callers only need to know they must not trust it
+func (a *Auth) Introspect(ctx context.Context, token string) (jwt.Claims, bool, error) {
+	log := a.log.With(slog.String("op", opIntrospect))
+
+	claims, err := a.parseToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			log.Debug("token is not active", sl.ErrLog(err))
+
+			return jwt.Claims{}, false, nil
+		}
+
+		log.Error("failed to parse token", sl.ErrLog(err))
+
+		return jwt.Claims{}, false, fmt.Errorf("%s: %w", opIntrospect, err)
+	}
+
+	revoked, err := a.tokenStorage.IsTokenRevoked(ctx, claims.ID, claims.UserID, claims.IssuedAt)
+	if err != nil {
+		log.Error("failed to check token revocation", sl.ErrLog(err))
+
+		return jwt.Claims{}, false, fmt.Errorf("%s: %w", opIntrospect, err)
+	}
+
+	if revoked {
+		log.Debug("token is revoked", slog.Int64("userID", claims.UserID))
+
+		return jwt.Claims{}, false, nil
+	}
+
+	return claims, true, nil
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntrospect(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	claims, active, err := a.Introspect(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, active)
+	assert.EqualValues(t, 1, claims.UserID)
+	assert.Equal(t, "user@example.com", claims.Email)
+	assert.Equal(t, 1, claims.AppID)
+
+	require.NoError(t, a.RevokeToken(ctx, tokens.AccessToken))
+
+	_, active, err = a.Introspect(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	// expired token
+	expired, err := jwt.NewToken(st.users[1], st.apps[1], -time.Minute)
+	require.NoError(t, err)
+
+	_, active, err = a.Introspect(ctx, expired)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	// token of unknown app
+	unknownApp := st.apps[1]
+	unknownApp.ID = 404
+	foreign, err := jwt.NewToken(st.users[1], unknownApp, time.Hour)
+	require.NoError(t, err)
+
+	_, active, err = a.Introspect(ctx, foreign)
+	require.NoError(t, err)
+	assert.False(t, active)
+}
+
+func TestIntrospect_Roles(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	st.roles[1] = []models.Role{
+		{ID: 1, AppID: 1, Name: "admin"},
+		{ID: 2, AppID: 2, Name: "other app"},
+	}
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	claims, active, err := a.Introspect(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, active)
+	assert.Equal(t, []string{"admin"}, claims.Roles)
+
+	st.roles[1] = append(st.roles[1], models.Role{ID: 3, AppID: 1, Name: "editor"})
+
+	rotated, err := a.Refresh(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+
+	claims, _, err = a.Introspect(ctx, rotated.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin", "editor"}, claims.Roles, "refreshed token gets the current roles")
+}
+
+func TestIntrospect_SignedWithKey(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := jwt.NewKey("kid-1", private)
+	require.NoError(t, err)
+
+	a, _ := newTestAuthWithKeys(t, []jwt.Key{key}, "kid-1")
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	claims, active, err := a.Introspect(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, active)
+	assert.EqualValues(t, 1, claims.UserID)
+
+	// the same token is not accepted once its key is gone
+	other, _ := newTestAuth(t)
+
+	_, active, err = other.Introspect(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.False(t, active)
+}
+
+func TestUserInfo(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "nonce")
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.IDToken)
+
+	user, err := a.UserInfo(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, user.ID)
+	assert.Equal(t, "user@example.com", user.Email)
+
+	_, err = a.UserInfo(ctx, tokens.IDToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/clientip"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+// maxReserveTries limits how many times attempt of a subject is reserved
+// while concurrent attempts keep changing its failures
+const maxReserveTries = 3
+
+// Lockout configures brute-force protection of password login
+//
+// Failures are counted per email, known or not, and per client IP. Every failure
+// delays the next attempt of the subject: the delay starts at BaseDelay and doubles
+// up to MaxDelay. After MaxFailures failures of the email, or MaxIPFailures of the IP,
+// the subject is locked for LockDuration. Counter starts over after Window
+// without failures. Zero limit or delay disables the check.
+//
+// Every attempt is counted as failed before the password is compared and taken back
+// if it succeeds, so concurrent attempts can't get past the limits
+type Lockout struct {
+	MaxFailures   int
+	MaxIPFailures int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	LockDuration  time.Duration
+	Window        time.Duration
+}
+
+// UnlockUser forgets failed logins of the user, lifting the lock and delays of their email
+//
+// Locks of client IPs stay in place
+func (a *Auth) UnlockUser(ctx context.Context, userID int64) error {
+	log := a.log.With(
+		slog.String("op", opUnlockUser),
+		slog.Int64("userID", userID),
+	)
+
+	user, err := a.usrProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", sl.ErrLog(err))
+		}
+
+		return fmt.Errorf("%s: %w", opUnlockUser, err)
+	}
+
+	for _, subject := range []string{emailSubject(a.canonicalEmail(user.Email)), mfaSubject(user.ID)} {
+		if err = a.attemptStorage.ResetLoginFailures(ctx, subject); err != nil {
+			log.Error("failed to reset login failures", sl.ErrLog(err))
+
+			return fmt.Errorf("%s: %w", opUnlockUser, err)
+		}
+	}
+
+	log.Info("user unlocked")
+
+	return nil
+}
+
+// VerifyLoginMFACode checks second factor code of the user who has just passed
+// Authenticate without an MFA challenge, e.g. in a single-step login form
+//
+// There is no challenge to limit attempts, so invalid codes are counted per user
+// and locked out like failed logins of emails. Otherwise codes could be guessed
+// by repeating the whole login with a known password
+func (a *Auth) VerifyLoginMFACode(ctx context.Context, userID int64, code string) error {
+	log := a.log.With(
+		slog.String("op", opVerifyLogin),
+		slog.Int64("userID", userID),
+	)
+
+	subject := mfaSubject(userID)
+
+	if err := a.reserveAttempt(ctx, subject, a.lockoutError); err != nil {
+		if errors.Is(err, ErrTooManyAttempts) || errors.Is(err, ErrAccountLocked) {
+			log.Warn("mfa code rejected", sl.ErrLog(err))
+		}
+
+		return fmt.Errorf("%s: %w", opVerifyLogin, err)
+	}
+
+	err := a.VerifyMFACode(ctx, userID, code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			log.Warn("invalid mfa code")
+		} else if err := a.attemptStorage.ReleaseLoginAttempt(ctx, subject); err != nil {
+			log.Error("failed to release mfa attempt", sl.ErrLog(err))
+		}
+
+		return fmt.Errorf("%s: %w", opVerifyLogin, err)
+	}
+
+	if err = a.attemptStorage.ResetLoginFailures(ctx, subject); err != nil {
+		log.Error("failed to reset mfa failures", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opVerifyLogin, err)
+	}
+
+	return nil
+}
+
+// reserveLoginAttempt counts login attempt of the email from the client IP of ctx
+// as failed before the password is compared, rejecting it if either of them is locked
+// or has to wait after the last failure
+//
+// The client IP is reserved first, so attempts rejected for a locked email still
+// count against the IP
+func (a *Auth) reserveLoginAttempt(ctx context.Context, email string) error {
+	if ip := clientip.FromContext(ctx); ip != "" {
+		if err := a.reserveAttempt(ctx, ipSubject(ip), a.ipLockoutError); err != nil {
+			return err
+		}
+	}
+
+	return a.reserveAttempt(ctx, emailSubject(email), a.lockoutError)
+}
+
+// loginSucceeded resets failures of the email and takes back the attempt
+// reserved for the client IP of ctx. Failures of the IP aren't reset, otherwise
+// a single known password would let the client guess others
+func (a *Auth) loginSucceeded(ctx context.Context, email string) error {
+	if err := a.attemptStorage.ResetLoginFailures(ctx, emailSubject(email)); err != nil {
+		return err
+	}
+
+	if ip := clientip.FromContext(ctx); ip != "" {
+		return a.attemptStorage.ReleaseLoginAttempt(ctx, ipSubject(ip))
+	}
+
+	return nil
+}
+
+// releaseLoginAttempt takes back the attempt reserved by reserveLoginAttempt
+// which has failed for reasons other than wrong credentials
+func (a *Auth) releaseLoginAttempt(ctx context.Context, email string) error {
+	if err := a.attemptStorage.ReleaseLoginAttempt(ctx, emailSubject(email)); err != nil {
+		return err
+	}
+
+	if ip := clientip.FromContext(ctx); ip != "" {
+		return a.attemptStorage.ReleaseLoginAttempt(ctx, ipSubject(ip))
+	}
+
+	return nil
+}
+
+// reserveAttempt counts attempt of the subject as failed, unless lockoutError
+// rejects it for failures of the subject so far
+//
+// The attempt is counted only if failures haven't changed since they were checked,
+// otherwise they are checked again. Subjects contended for too long are rejected
+// with ErrTooManyAttempts
+func (a *Auth) reserveAttempt(
+	ctx context.Context,
+	subject string,
+	lockoutError func(failures models.LoginFailures, now time.Time) error,
+) error {
+	for range maxReserveTries {
+		failures, err := a.attemptStorage.LoginFailures(ctx, subject)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		if err = lockoutError(failures, now); err != nil {
+			return err
+		}
+
+		err = a.attemptStorage.ReserveLoginAttempt(ctx, failures, now, now.Add(-a.lockout.Window))
+		if !errors.Is(err, storage.ErrLoginFailuresChanged) {
+			return err
+		}
+	}
+
+	return ErrTooManyAttempts
+}
+
+// lockoutError returns ErrAccountLocked or ErrTooManyAttempts if the user
+// subject with given failures has to wait at the moment, else nil
+func (a *Auth) lockoutError(failures models.LoginFailures, now time.Time) error {
+	if !now.Before(a.lockedUntil(failures, a.lockout.MaxFailures)) {
+		return nil
+	}
+
+	if a.lockout.MaxFailures > 0 && failures.Failures >= a.lockout.MaxFailures {
+		return ErrAccountLocked
+	}
+
+	return ErrTooManyAttempts
+}
+
+// ipLockoutError returns ErrTooManyAttempts if the client IP with given failures
+// has to wait at the moment, else nil
+func (a *Auth) ipLockoutError(failures models.LoginFailures, now time.Time) error {
+	if now.Before(a.lockedUntil(failures, a.lockout.MaxIPFailures)) {
+		return ErrTooManyAttempts
+	}
+
+	return nil
+}
+
+// lockedUntil returns the time the subject with given failures may try again
+func (a *Auth) lockedUntil(failures models.LoginFailures, maxFailures int) time.Time {
+	if failures.Failures == 0 {
+		return time.Time{}
+	}
+
+	if maxFailures > 0 && failures.Failures >= maxFailures {
+		return failures.LastFailureAt.Add(a.lockout.LockDuration)
+	}
+
+	delay := a.lockout.BaseDelay
+	for i := 1; i < failures.Failures && delay < a.lockout.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return failures.LastFailureAt.Add(min(delay, a.lockout.MaxDelay))
+}
+
+func emailSubject(email string) string {
+	return "email:" + email
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+func mfaSubject(userID int64) string {
+	return "mfa:" + strconv.FormatInt(userID, 10)
+}
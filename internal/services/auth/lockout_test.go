@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/clientip"
+	"github.com/nhassl3/sso/internal/lib/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockout(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	for range a.lockout.MaxFailures - 1 {
+		_, err := a.Login(ctx, "user@example.com", "wrong", 1, "")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	_, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err, "success resets the counter")
+
+	for range a.lockout.MaxFailures {
+		_, err = a.Login(ctx, "user@example.com", "wrong", 1, "")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	_, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	assert.ErrorIs(t, err, ErrAccountLocked, "correct password isn't checked")
+
+	require.NoError(t, a.UnlockUser(ctx, 1))
+
+	_, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	assert.NoError(t, err)
+}
+
+func TestLockout_Concurrent(t *testing.T) {
+	a, _ := newTestAuth(t)
+	hasher := &countingHasher{PasswordHasher: a.hasher}
+	a.hasher = hasher
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for range 4 * a.lockout.MaxFailures {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := a.Login(ctx, "user@example.com", "wrong", 1, "")
+			assert.Error(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, len(hasher.compared), a.lockout.MaxFailures, "concurrent attempts don't get past the limit")
+}
+
+func TestVerifyLoginMFACode(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	secret, _ := enrollTOTP(t, a, tokens.AccessToken)
+
+	for range a.lockout.MaxFailures {
+		// correct password doesn't reset failures of the second factor
+		_, err = a.Authenticate(ctx, "user@example.com", "password")
+		require.NoError(t, err)
+
+		err = a.VerifyLoginMFACode(ctx, 1, "000000")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	}
+
+	code := totp.Code(secret, totp.Step(time.Now()))
+
+	err = a.VerifyLoginMFACode(ctx, 1, code)
+	assert.ErrorIs(t, err, ErrAccountLocked, "correct code isn't checked")
+
+	require.NoError(t, a.UnlockUser(ctx, 1))
+
+	assert.NoError(t, a.VerifyLoginMFACode(ctx, 1, code))
+}
+
+func TestLockout_UnknownEmail(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	for range a.lockout.MaxFailures {
+		_, err := a.Login(ctx, "nobody@example.com", "password", 1, "")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	_, err := a.Login(ctx, "nobody@example.com", "password", 1, "")
+	assert.ErrorIs(t, err, ErrAccountLocked, "unknown email is locked like a known one")
+}
+
+func TestLockout_IP(t *testing.T) {
+	a, _ := newTestAuth(t)
+	attacker := clientip.NewContext(context.Background(), "203.0.113.7")
+
+	for i := range a.lockout.MaxIPFailures {
+		_, err := a.Login(attacker, fmt.Sprintf("user%d@example.com", i), "password", 1, "")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	_, err := a.Login(attacker, "user@example.com", "password", 1, "")
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+
+	_, err = a.Login(clientip.NewContext(context.Background(), "198.51.100.1"), "user@example.com", "password", 1, "")
+	assert.NoError(t, err, "other clients aren't affected")
+}
+
+func TestLockout_Delay(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	a.lockout.BaseDelay = time.Hour
+	a.lockout.MaxDelay = time.Hour
+
+	_, err := a.Login(ctx, "user@example.com", "wrong", 1, "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+}
+
+func TestLockedUntil(t *testing.T) {
+	a := &Auth{lockout: Lockout{
+		MaxFailures:  5,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Second,
+		LockDuration: time.Hour,
+	}}
+	last := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 1, want: time.Second},
+		{failures: 2, want: 2 * time.Second},
+		{failures: 3, want: 4 * time.Second},
+		{failures: 4, want: 5 * time.Second},
+		{failures: 5, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		got := a.lockedUntil(models.LoginFailures{Failures: tt.failures, LastFailureAt: last}, a.lockout.MaxFailures)
+		assert.Equal(t, tt.want, got.Sub(last), "failures: %d", tt.failures)
+	}
+
+	assert.True(t, a.lockedUntil(models.LoginFailures{}, a.lockout.MaxFailures).IsZero())
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/password"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLogin_UnknownUser checks that the password of unknown email is compared
+// against the dummy hash, so it takes as long as a wrong password and emails
+// can't be enumerated
+func TestLogin_UnknownUser(t *testing.T) {
+	a, _ := newTestAuth(t)
+	hasher := &countingHasher{PasswordHasher: a.hasher}
+	a.hasher = hasher
+	a.dummyHash = newDummyHash(hasher)
+	ctx := context.Background()
+
+	_, err := a.Login(ctx, "nobody@example.com", "wrong", 1, "")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	dummyHash, err := a.dummyHash()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{dummyHash}, hasher.compared)
+	assert.Equal(t, 1, hasher.hashed, "dummy hash is made once")
+
+	_, err = a.Login(ctx, "nobody@example.com", "wrong", 1, "")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Equal(t, [][]byte{dummyHash, dummyHash}, hasher.compared)
+	assert.Equal(t, 1, hasher.hashed, "dummy hash is reused")
+}
+
+func TestLogin_DummyHashError(t *testing.T) {
+	a, st := newTestAuth(t)
+	a.dummyHash = newDummyHash(&countingHasher{PasswordHasher: a.hasher, err: errors.New("out of memory")})
+	ctx := context.Background()
+
+	_, err := a.Login(ctx, "nobody@example.com", "wrong", 1, "")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredentials)
+
+	failures, err := st.LoginFailures(ctx, emailSubject("nobody@example.com"))
+	require.NoError(t, err)
+	assert.Zero(t, failures.Failures, "hashing errors aren't failed attempts")
+
+	_, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	assert.NoError(t, err, "known users don't need the dummy hash")
+}
+
+func TestLogin_RehashesPassword(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	a.hasher = password.Argon2id{Memory: 1024, Time: 1, Parallelism: 1}
+
+	_, err := a.Login(ctx, "user@example.com", "wrong", 1, "")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.True(t, a.hasher.NeedsRehash(st.users[1].PasswordHash), "wrong password doesn't upgrade the hash")
+
+	_, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	upgraded := st.users[1].PasswordHash
+	assert.False(t, a.hasher.NeedsRehash(upgraded), "bcrypt hash is replaced by argon2id one")
+
+	_, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+	assert.Equal(t, upgraded, st.users[1].PasswordHash, "up-to-date hash is kept")
+}
+
+func TestLogin_StorageError(t *testing.T) {
+	a, st := newTestAuth(t)
+	a.usrProvider = failingUsers{fakeStorage: st, err: errors.New("database is locked")}
+
+	_, err := a.Login(context.Background(), "user@example.com", "password", 1, "")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredentials)
+
+	failures, err := st.LoginFailures(context.Background(), emailSubject("user@example.com"))
+	require.NoError(t, err)
+	assert.Zero(t, failures.Failures, "storage errors aren't failed attempts")
+}
+
+// failingUsers fails to look users up by email
+type failingUsers struct {
+	*fakeStorage
+	err error
+}
+
+func (f failingUsers) User(context.Context, string) (models.User, error) {
+	return models.User{}, f.err
+}
+
+// countingHasher records hashes passwords are compared against and counts
+// new hashes, failing them with err if it's set
+type countingHasher struct {
+	PasswordHasher
+	err error
+
+	mu       sync.Mutex
+	hashed   int
+	compared [][]byte
+}
+
+func (h *countingHasher) Hash(password string) ([]byte, error) {
+	h.mu.Lock()
+	h.hashed++
+	h.mu.Unlock()
+
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	return h.PasswordHasher.Hash(password)
+}
+
+func (h *countingHasher) Compare(hash []byte, password string) error {
+	h.mu.Lock()
+	h.compared = append(h.compared, hash)
+	h.mu.Unlock()
+
+	return h.PasswordHasher.Compare(hash, password)
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/nhassl3/sso/internal/lib/mailer"
+)
+
+// mailTimeout limits delivery of a single email
+const mailTimeout = 30 * time.Second
+
+// Mail configures emails with links sent to users
+//
+// Mailer delivers the emails of password reset, email verification and passwordless login
+type Mail struct {
+	Mailer            mailer.Mailer
+	PasswordReset     Link
+	EmailVerification Link
+	Passwordless      Passwordless
+}
+
+// Link describes a page users open from the email
+//
+// URL is the page of the link, it gets the token in "token" query parameter.
+// Links expire after TokenTTL
+type Link struct {
+	URL      string
+	TokenTTL time.Duration
+}
+
+// Passwordless configures login with one-time code or link mailed to the user
+//
+// Link gets login id in "login_id" query parameter besides the token. Login is
+// rejected after TokenTTL or MaxAttempts wrong codes, whichever comes first
+type Passwordless struct {
+	Link
+	MaxAttempts int
+}
+
+// withToken returns URL of the link with given token
+func (l Link) withToken(token string) (string, error) {
+	return l.withQuery(url.Values{"token": {token}})
+}
+
+// withQuery returns URL of the link with given query parameters added to its own
+func (l Link) withQuery(params url.Values) (string, error) {
+	link, err := url.Parse(l.URL)
+	if err != nil {
+		return "", err
+	}
+
+	query := link.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	link.RawQuery = query.Encode()
+
+	return link.String(), nil
+}
@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/crypt"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/opaque"
+	"github.com/nhassl3/sso/internal/lib/totp"
+	"github.com/nhassl3/sso/internal/lib/webauthn"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+// totpSkew is the number of time steps around the current one codes are accepted from,
+// it compensates clock drift of the device and the time user needs to type the code
+const totpSkew = 1
+
+// MFA configures multi-factor authentication
+//
+// Cipher encrypts TOTP secrets at rest. RecoveryCodeKey is the key recovery codes
+// are hashed with, it's kept out of storage, so leaked hashes can't be brute-forced.
+// TOTPIssuer is the name of the service shown in authenticator apps. Login MFA
+// challenge is rejected after ChallengeTTL or MaxAttempts wrong codes, whichever
+// comes first. RelyingParty identifies the service to passkeys, WebAuthn ceremonies
+// expire after ChallengeTTL as well
+type MFA struct {
+	Cipher          *crypt.Cipher
+	RecoveryCodeKey []byte
+	TOTPIssuer      string
+	ChallengeTTL    time.Duration
+	MaxAttempts     int
+	RelyingParty    webauthn.RelyingParty
+}
+
+// EnrollTOTP starts enrollment of TOTP authenticator for the owner of the access token
+//
+// Returns otpauth:// provisioning URI to be shown as a QR code. Authenticator
+// isn't used until it's confirmed with ConfirmTOTP. Enrolling again before
+// confirmation replaces the secret
+func (a *Auth) EnrollTOTP(ctx context.Context, accessToken string) (string, error) {
+	user, err := a.tokenOwner(ctx, accessToken)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", opEnrollTOTP, err)
+	}
+
+	log := a.log.With(
+		slog.String("op", opEnrollTOTP),
+		slog.Int64("userID", user.ID),
+	)
+
+	current, err := a.mfaStorage.TOTP(ctx, user.ID)
+	switch {
+	case err == nil && current.Enabled:
+		return "", fmt.Errorf("%s: %w", opEnrollTOTP, ErrMFAAlreadyEnabled)
+	case err != nil && !errors.Is(err, storage.ErrTOTPNotFound):
+		return "", fmt.Errorf("%s: %w", opEnrollTOTP, err)
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", opEnrollTOTP, err)
+	}
+
+	encrypted, err := a.mfa.Cipher.Encrypt(secret, totpAdditionalData(user.ID))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", opEnrollTOTP, err)
+	}
+
+	if err = a.mfaStorage.SaveTOTP(ctx, user.ID, encrypted); err != nil {
+		log.Error("failed to save totp secret", sl.ErrLog(err))
+
+		return "", fmt.Errorf("%s: %w", opEnrollTOTP, err)
+	}
+
+	log.Info("totp enrollment started")
+
+	return totp.URI(a.mfa.TOTPIssuer, user.Email, secret), nil
+}
+
+// ConfirmTOTP enables enrolled TOTP authenticator once user proves it works with a code
+//
+// Returns recovery codes to be shown to the user once, they replace the
+// authenticator if it's lost
+func (a *Auth) ConfirmTOTP(ctx context.Context, accessToken string, code string) ([]string, error) {
+	user, err := a.tokenOwner(ctx, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opConfirmTOTP, err)
+	}
+
+	log := a.log.With(
+		slog.String("op", opConfirmTOTP),
+		slog.Int64("userID", user.ID),
+	)
+
+	authenticator, err := a.mfaStorage.TOTP(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return nil, fmt.Errorf("%s: %w", opConfirmTOTP, ErrMFANotEnrolled)
+		}
+
+		return nil, fmt.Errorf("%s: %w", opConfirmTOTP, err)
+	}
+
+	if authenticator.Enabled {
+		return nil, fmt.Errorf("%s: %w", opConfirmTOTP, ErrMFAAlreadyEnabled)
+	}
+
+	step, err := a.validateTOTP(authenticator, code)
+	if err != nil {
+		log.Warn("invalid totp code", sl.ErrLog(err))
+
+		return nil, fmt.Errorf("%s: %w", opConfirmTOTP, err)
+	}
+
+	if err = a.mfaStorage.EnableTOTP(ctx, user.ID, step); err != nil {
+		log.Error("failed to enable totp", sl.ErrLog(err))
+
+		return nil, fmt.Errorf("%s: %w", opConfirmTOTP, err)
+	}
+
+	recoveryCodes, err := a.newRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to generate recovery codes", sl.ErrLog(err))
+
+		return nil, fmt.Errorf("%s: %w", opConfirmTOTP, err)
+	}
+
+	log.Info("totp enabled")
+
+	return recoveryCodes, nil
+}
+
+// VerifyTOTP checks code of the enabled TOTP authenticator of the user
+//
+// Each code is accepted once, so it can't be replayed within its time step
+func (a *Auth) VerifyTOTP(ctx context.Context, userID int64, code string) error {
+	authenticator, err := a.mfaStorage.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return fmt.Errorf("%s: %w", opVerifyTOTP, ErrMFANotEnrolled)
+		}
+
+		return fmt.Errorf("%s: %w", opVerifyTOTP, err)
+	}
+
+	if !authenticator.Enabled {
+		return fmt.Errorf("%s: %w", opVerifyTOTP, ErrMFANotEnrolled)
+	}
+
+	step, err := a.validateTOTP(authenticator, code)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opVerifyTOTP, err)
+	}
+
+	if err = a.mfaStorage.UseTOTPStep(ctx, userID, step); err != nil {
+		if errors.Is(err, storage.ErrTOTPStepUsed) {
+			return fmt.Errorf("%s: %w", opVerifyTOTP, ErrInvalidMFACode)
+		}
+
+		return fmt.Errorf("%s: %w", opVerifyTOTP, err)
+	}
+
+	return nil
+}
+
+// VerifyMFA completes login started with Login for the user with MFA enabled
+//
+// Returns the same tokens as Login does for the user without MFA
+func (a *Auth) VerifyMFA(ctx context.Context, challengeID string, code string) (models.Tokens, error) {
+	log := a.log.With(slog.String("op", opVerifyMFA))
+
+	hash := opaque.Hash(challengeID)
+
+	challenge, err := a.mfaStorage.MFAChallenge(ctx, hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFAChallengeNotFound) {
+			return models.Tokens{}, fmt.Errorf("%s: %w", opVerifyMFA, ErrInvalidMFAChallenge)
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opVerifyMFA, err)
+	}
+
+	log = log.With(slog.Int64("userID", challenge.UserID))
+
+	if time.Now().After(challenge.ExpiresAt) {
+		log.Warn("mfa challenge expired")
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opVerifyMFA, ErrInvalidMFAChallenge)
+	}
+
+	// attempt is used before the code is checked, so concurrent guesses
+	// can't exceed the limit
+	if err = a.mfaStorage.UseMFAChallengeAttempt(ctx, hash, a.mfa.MaxAttempts); err != nil {
+		if errors.Is(err, storage.ErrMFAChallengeNotFound) {
+			log.Warn("mfa challenge exhausted")
+
+			return models.Tokens{}, fmt.Errorf("%s: %w", opVerifyMFA, ErrInvalidMFAChallenge)
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opVerifyMFA, err)
+	}
+
+	if err = a.VerifyMFACode(ctx, challenge.UserID, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			log.Warn("invalid mfa code")
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opVerifyMFA, err)
+	}
+
+	// challenge is deleted before tokens are issued, so it can't be completed twice
+	if err = a.mfaStorage.DeleteMFAChallenge(ctx, hash); err != nil {
+		if errors.Is(err, storage.ErrMFAChallengeNotFound) {
+			return models.Tokens{}, fmt.Errorf("%s: %w", opVerifyMFA, ErrInvalidMFAChallenge)
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opVerifyMFA, err)
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, challenge.UserID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opVerifyMFA, err)
+	}
+
+	app, err := a.appProvider.App(ctx, challenge.AppID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opVerifyMFA, err)
+	}
+
+	tokens, err := a.newSession(ctx, user, app, challenge.Nonce, time.Now())
+	if err != nil {
+		log.Error("failed to issue tokens", sl.ErrLog(err))
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opVerifyMFA, err)
+	}
+
+	log.Info("mfa challenge completed")
+
+	return tokens, nil
+}
+
+// newMFAChallenge starts second step of the login of the user who has passed the first one
+func (a *Auth) newMFAChallenge(ctx context.Context, user models.User, app models.App, nonce string) (string, error) {
+	challengeID, hash, err := opaque.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err = a.mfaStorage.SaveMFAChallenge(ctx, models.MFAChallenge{
+		IDHash:    hash,
+		UserID:    user.ID,
+		AppID:     app.ID,
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(a.mfa.ChallengeTTL),
+	}); err != nil {
+		return "", err
+	}
+
+	return challengeID, nil
+}
+
+// validateTOTP decrypts secret of the authenticator and checks the code against it
+//
+// Returns time step of the code, codes not newer than the last accepted one are rejected
+func (a *Auth) validateTOTP(authenticator models.TOTP, code string) (int64, error) {
+	secret, err := a.mfa.Cipher.Decrypt(authenticator.Secret, totpAdditionalData(authenticator.UserID))
+	if err != nil {
+		return 0, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok || step <= authenticator.LastStep {
+		return 0, ErrInvalidMFACode
+	}
+
+	return step, nil
+}
+
+// totpAdditionalData binds encrypted TOTP secret to its user
+func totpAdditionalData(userID int64) []byte {
+	return []byte("totp:" + strconv.FormatInt(userID, 10))
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/lib/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// enrollTOTP enables TOTP for user 1 and returns its secret and recovery codes
+func enrollTOTP(t *testing.T, a *Auth, accessToken string) ([]byte, []string) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	uri, err := a.EnrollTOTP(ctx, accessToken)
+	require.NoError(t, err)
+
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "/sso:user@example.com", u.Path)
+
+	secret, err := totpEncoding.DecodeString(u.Query().Get("secret"))
+	require.NoError(t, err)
+
+	// code of the previous step, so the current one is left for login
+	recoveryCodes, err := a.ConfirmTOTP(ctx, accessToken, totp.Code(secret, totp.Step(time.Now())-1))
+	require.NoError(t, err)
+
+	return secret, recoveryCodes
+}
+
+func TestTOTP_Login(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	_, err = a.ConfirmTOTP(ctx, tokens.AccessToken, "000000")
+	assert.ErrorIs(t, err, ErrMFANotEnrolled)
+
+	secret, _ := enrollTOTP(t, a, tokens.AccessToken)
+	assert.NotContains(t, string(st.totp[1].Secret), string(secret), "secret is encrypted at rest")
+
+	_, err = a.EnrollTOTP(ctx, tokens.AccessToken)
+	assert.ErrorIs(t, err, ErrMFAAlreadyEnabled)
+
+	tokens, err = a.Login(ctx, "user@example.com", "password", 1, "nonce")
+	require.NoError(t, err)
+	assert.Empty(t, tokens.AccessToken, "no tokens before second factor")
+	require.NotEmpty(t, tokens.MFAChallengeID)
+
+	code := totp.Code(secret, totp.Step(time.Now()))
+
+	_, err = a.VerifyMFA(ctx, "unknown", code)
+	assert.ErrorIs(t, err, ErrInvalidMFAChallenge)
+
+	_, err = a.VerifyMFA(ctx, tokens.MFAChallengeID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+
+	verified, err := a.VerifyMFA(ctx, tokens.MFAChallengeID, code)
+	require.NoError(t, err)
+	assert.NotEmpty(t, verified.AccessToken)
+	assert.NotEmpty(t, verified.RefreshToken)
+	assert.NotEmpty(t, verified.IDToken)
+
+	_, err = a.VerifyMFA(ctx, tokens.MFAChallengeID, code)
+	assert.ErrorIs(t, err, ErrInvalidMFAChallenge, "challenge is one-time")
+
+	// the same code can't be used for another login
+	tokens, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	_, err = a.VerifyMFA(ctx, tokens.MFAChallengeID, code)
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+}
+
+func TestTOTP_ChallengeAttempts(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	secret, _ := enrollTOTP(t, a, tokens.AccessToken)
+
+	tokens, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = a.VerifyMFA(ctx, tokens.MFAChallengeID, "000000")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	}
+
+	_, err = a.VerifyMFA(ctx, tokens.MFAChallengeID, totp.Code(secret, totp.Step(time.Now())))
+	assert.ErrorIs(t, err, ErrInvalidMFAChallenge, "challenge is exhausted")
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+	accessToken := tokens.AccessToken
+
+	_, err = a.RegenerateRecoveryCodes(ctx, accessToken)
+	assert.ErrorIs(t, err, ErrMFANotEnrolled)
+
+	_, recoveryCodes := enrollTOTP(t, a, accessToken)
+	require.Len(t, recoveryCodes, recoveryCodeCount)
+
+	remaining, err := a.RecoveryCodesRemaining(ctx, accessToken)
+	require.NoError(t, err)
+	assert.Equal(t, recoveryCodeCount, remaining)
+
+	tokens, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	// codes are case-insensitive and separators are optional
+	code := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+
+	verified, err := a.VerifyMFA(ctx, tokens.MFAChallengeID, code)
+	require.NoError(t, err)
+	assert.NotEmpty(t, verified.AccessToken)
+
+	remaining, err = a.RecoveryCodesRemaining(ctx, accessToken)
+	require.NoError(t, err)
+	assert.Equal(t, recoveryCodeCount-1, remaining)
+
+	tokens, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	_, err = a.VerifyMFA(ctx, tokens.MFAChallengeID, recoveryCodes[0])
+	assert.ErrorIs(t, err, ErrInvalidMFACode, "recovery code is single-use")
+
+	regenerated, err := a.RegenerateRecoveryCodes(ctx, accessToken)
+	require.NoError(t, err)
+	require.Len(t, regenerated, recoveryCodeCount)
+
+	_, err = a.VerifyMFA(ctx, tokens.MFAChallengeID, recoveryCodes[1])
+	assert.ErrorIs(t, err, ErrInvalidMFACode, "old codes are replaced")
+
+	_, err = a.VerifyMFA(ctx, tokens.MFAChallengeID, regenerated[1])
+	assert.NoError(t, err)
+}
+
+func TestRecoveryCodes_StoredHashed(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	_, recoveryCodes := enrollTOTP(t, a, tokens.AccessToken)
+
+	for _, hash := range st.recoveryCodes[1] {
+		assert.NotContains(t, recoveryCodes, string(hash))
+	}
+
+	hasher := &countingHasher{PasswordHasher: a.hasher}
+	a.hasher = hasher
+
+	assert.ErrorIs(t, a.VerifyMFACode(ctx, 1, "aaaaa-aaaaa"), ErrInvalidMFACode)
+	assert.NoError(t, a.VerifyMFACode(ctx, 1, recoveryCodes[0]))
+	assert.Empty(t, hasher.compared, "recovery codes aren't compared with the password hasher")
+}
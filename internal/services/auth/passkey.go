@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/opaque"
+	"github.com/nhassl3/sso/internal/lib/webauthn"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+// BeginPasskeyRegistration starts registration of a passkey for the owner of the access token
+//
+// Returns options for navigator.credentials.create(), the response is passed
+// to FinishPasskeyRegistration
+func (a *Auth) BeginPasskeyRegistration(ctx context.Context, accessToken string) (webauthn.CreationOptions, error) {
+	user, err := a.tokenOwner(ctx, accessToken)
+	if err != nil {
+		return webauthn.CreationOptions{}, fmt.Errorf("%s: %w", opBeginPasskey, err)
+	}
+
+	passkeys, err := a.mfaStorage.Passkeys(ctx, user.ID)
+	if err != nil {
+		return webauthn.CreationOptions{}, fmt.Errorf("%s: %w", opBeginPasskey, err)
+	}
+
+	challenge, err := a.newWebAuthnSession(ctx, models.WebAuthnSession{
+		Ceremony: models.WebAuthnRegistration,
+		UserID:   user.ID,
+	})
+	if err != nil {
+		a.log.Error("failed to start passkey registration", slog.Int64("userID", user.ID), sl.ErrLog(err))
+
+		return webauthn.CreationOptions{}, fmt.Errorf("%s: %w", opBeginPasskey, err)
+	}
+
+	return a.mfa.RelyingParty.CreationOptions(
+		challenge,
+		webauthn.User{ID: userHandle(user.ID), Name: user.Email, DisplayName: user.Email},
+		passkeyIDs(passkeys),
+		a.mfa.ChallengeTTL,
+	), nil
+}
+
+// FinishPasskeyRegistration verifies response to the registration started
+// with BeginPasskeyRegistration and saves the passkey
+//
+// Returns credential ID of the passkey
+func (a *Auth) FinishPasskeyRegistration(
+	ctx context.Context,
+	accessToken string,
+	registration webauthn.Registration,
+) ([]byte, error) {
+	user, err := a.tokenOwner(ctx, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opAddPasskey, err)
+	}
+
+	log := a.log.With(
+		slog.String("op", opAddPasskey),
+		slog.Int64("userID", user.ID),
+	)
+
+	session, challenge, err := a.consumeWebAuthnSession(ctx, registration.ClientDataJSON, models.WebAuthnRegistration)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opAddPasskey, err)
+	}
+
+	if session.UserID != user.ID {
+		log.Warn("passkey registration started by another user")
+
+		return nil, fmt.Errorf("%s: %w", opAddPasskey, ErrInvalidPasskey)
+	}
+
+	credential, err := a.mfa.RelyingParty.VerifyRegistration(registration, challenge, false)
+	if err != nil {
+		log.Warn("invalid passkey registration", sl.ErrLog(err))
+
+		return nil, fmt.Errorf("%s: %w", opAddPasskey, ErrInvalidPasskey)
+	}
+
+	if err = a.mfaStorage.SavePasskey(ctx, models.Passkey{
+		ID:        credential.ID,
+		UserID:    user.ID,
+		PublicKey: credential.PublicKey,
+		SignCount: credential.SignCount,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		if errors.Is(err, storage.ErrPasskeyExists) {
+			return nil, fmt.Errorf("%s: %w", opAddPasskey, ErrPasskeyExists)
+		}
+
+		log.Error("failed to save passkey", sl.ErrLog(err))
+
+		return nil, fmt.Errorf("%s: %w", opAddPasskey, err)
+	}
+
+	log.Info("passkey registered")
+
+	return credential.ID, nil
+}
+
+// BeginPasskeyLogin starts login with a passkey
+//
+// With mfaChallengeID the passkey is the second factor completing the MFA
+// challenge returned by Login, and only passkeys of that user are allowed.
+// Else it's passwordless login to the app with given nonce: any passkey of
+// the service may be picked, and user verification is required
+//
+// Returns options for navigator.credentials.get(), the response is passed to FinishPasskeyLogin
+func (a *Auth) BeginPasskeyLogin(
+	ctx context.Context,
+	appID int,
+	nonce string,
+	mfaChallengeID string,
+) (webauthn.RequestOptions, error) {
+	log := a.log.With(slog.String("op", opBeginLogin))
+
+	session := models.WebAuthnSession{
+		Ceremony: models.WebAuthnLogin,
+		AppID:    appID,
+		Nonce:    nonce,
+	}
+	userVerification := webauthn.UserVerificationRequired
+
+	var allow [][]byte
+
+	if mfaChallengeID != "" {
+		hash := opaque.Hash(mfaChallengeID)
+
+		challenge, err := a.mfaStorage.MFAChallenge(ctx, hash)
+		if err != nil {
+			if errors.Is(err, storage.ErrMFAChallengeNotFound) {
+				return webauthn.RequestOptions{}, fmt.Errorf("%s: %w", opBeginLogin, ErrInvalidMFAChallenge)
+			}
+
+			return webauthn.RequestOptions{}, fmt.Errorf("%s: %w", opBeginLogin, err)
+		}
+
+		if time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= a.mfa.MaxAttempts {
+			return webauthn.RequestOptions{}, fmt.Errorf("%s: %w", opBeginLogin, ErrInvalidMFAChallenge)
+		}
+
+		passkeys, err := a.mfaStorage.Passkeys(ctx, challenge.UserID)
+		if err != nil {
+			return webauthn.RequestOptions{}, fmt.Errorf("%s: %w", opBeginLogin, err)
+		}
+
+		if len(passkeys) == 0 {
+			return webauthn.RequestOptions{}, fmt.Errorf("%s: %w", opBeginLogin, ErrMFANotEnrolled)
+		}
+
+		session = models.WebAuthnSession{
+			Ceremony:         models.WebAuthnLogin,
+			UserID:           challenge.UserID,
+			AppID:            challenge.AppID,
+			Nonce:            challenge.Nonce,
+			MFAChallengeHash: hash,
+		}
+		userVerification = webauthn.UserVerificationPreferred
+		allow = passkeyIDs(passkeys)
+	} else if _, err := a.appProvider.App(ctx, appID); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return webauthn.RequestOptions{}, fmt.Errorf("%s: %w", opBeginLogin, ErrInvalidAppID)
+		}
+
+		return webauthn.RequestOptions{}, fmt.Errorf("%s: %w", opBeginLogin, err)
+	}
+
+	challenge, err := a.newWebAuthnSession(ctx, session)
+	if err != nil {
+		log.Error("failed to start passkey login", sl.ErrLog(err))
+
+		return webauthn.RequestOptions{}, fmt.Errorf("%s: %w", opBeginLogin, err)
+	}
+
+	return a.mfa.RelyingParty.RequestOptions(challenge, allow, userVerification, a.mfa.ChallengeTTL), nil
+}
+
+// FinishPasskeyLogin verifies response to the login started with BeginPasskeyLogin
+//
+// Returns the same tokens as Login. Passwordless login with a user-verifying
+// passkey is multi-factor by itself, so it isn't followed by MFA challenge
+func (a *Auth) FinishPasskeyLogin(ctx context.Context, assertion webauthn.Assertion) (models.Tokens, error) {
+	log := a.log.With(slog.String("op", opPasskeyLogin))
+
+	session, challenge, err := a.consumeWebAuthnSession(ctx, assertion.ClientDataJSON, models.WebAuthnLogin)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, err)
+	}
+
+	passkey, err := a.mfaStorage.Passkey(ctx, assertion.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrPasskeyNotFound) {
+			log.Warn("unknown passkey")
+
+			return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, ErrInvalidPasskey)
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, err)
+	}
+
+	log = log.With(slog.Int64("userID", passkey.UserID))
+
+	passwordless := session.UserID == 0
+
+	switch {
+	case !passwordless && passkey.UserID != session.UserID:
+		log.Warn("passkey of another user")
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, ErrInvalidPasskey)
+	case passwordless && !bytes.Equal(assertion.UserHandle, userHandle(passkey.UserID)):
+		log.Warn("user handle mismatch")
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, ErrInvalidPasskey)
+	}
+
+	signCount, err := a.mfa.RelyingParty.VerifyAssertion(assertion, challenge, passkey.PublicKey, passwordless)
+	if err != nil {
+		log.Warn("invalid passkey assertion", sl.ErrLog(err))
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, ErrInvalidPasskey)
+	}
+
+	if err = a.mfaStorage.UpdatePasskeySignCount(ctx, passkey.ID, signCount, time.Now()); err != nil {
+		if errors.Is(err, storage.ErrPasskeySignCount) {
+			log.Warn(
+				"passkey signature counter not increased, passkey may be cloned",
+				slog.Uint64("stored", uint64(passkey.SignCount)),
+				slog.Uint64("received", uint64(signCount)),
+			)
+
+			return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, ErrInvalidPasskey)
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, err)
+	}
+
+	if session.MFAChallengeHash != "" {
+		if err = a.mfaStorage.DeleteMFAChallenge(ctx, session.MFAChallengeHash); err != nil {
+			if errors.Is(err, storage.ErrMFAChallengeNotFound) {
+				return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, ErrInvalidMFAChallenge)
+			}
+
+			return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, err)
+		}
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, passkey.UserID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, err)
+	}
+
+	app, err := a.appProvider.App(ctx, session.AppID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, err)
+	}
+
+	tokens, err := a.newSession(ctx, user, app, session.Nonce, time.Now())
+	if err != nil {
+		log.Error("failed to issue tokens", sl.ErrLog(err))
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opPasskeyLogin, err)
+	}
+
+	log.Info("logged in with passkey", slog.Bool("passwordless", passwordless))
+
+	return tokens, nil
+}
+
+// newWebAuthnSession saves pending ceremony and returns its challenge
+func (a *Auth) newWebAuthnSession(ctx context.Context, session models.WebAuthnSession) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	session.ChallengeHash = opaque.Hash(string(challenge))
+	session.ExpiresAt = time.Now().Add(a.mfa.ChallengeTTL)
+
+	if err = a.mfaStorage.SaveWebAuthnSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// consumeWebAuthnSession finds pending ceremony by challenge of the client data and deletes it,
+// so each challenge is answered once, even if the answer turns out to be invalid
+func (a *Auth) consumeWebAuthnSession(
+	ctx context.Context,
+	clientDataJSON []byte,
+	ceremony string,
+) (models.WebAuthnSession, []byte, error) {
+	challenge, err := webauthn.Challenge(clientDataJSON)
+	if err != nil {
+		return models.WebAuthnSession{}, nil, ErrInvalidPasskey
+	}
+
+	hash := opaque.Hash(string(challenge))
+
+	session, err := a.mfaStorage.WebAuthnSession(ctx, hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrWebAuthnSessionNotFound) {
+			return models.WebAuthnSession{}, nil, ErrInvalidPasskey
+		}
+
+		return models.WebAuthnSession{}, nil, err
+	}
+
+	if err = a.mfaStorage.DeleteWebAuthnSession(ctx, hash); err != nil {
+		if errors.Is(err, storage.ErrWebAuthnSessionNotFound) {
+			return models.WebAuthnSession{}, nil, ErrInvalidPasskey
+		}
+
+		return models.WebAuthnSession{}, nil, err
+	}
+
+	if session.Ceremony != ceremony || time.Now().After(session.ExpiresAt) {
+		return models.WebAuthnSession{}, nil, ErrInvalidPasskey
+	}
+
+	return session, challenge, nil
+}
+
+// userHandle is the WebAuthn user handle of the user, it identifies
+// the account of a discoverable passkey on passwordless login
+func userHandle(userID int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+func passkeyIDs(passkeys []models.Passkey) [][]byte {
+	ids := make([][]byte, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		ids = append(ids, passkey.ID)
+	}
+
+	return ids
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nhassl3/sso/internal/lib/webauthn"
+	"github.com/nhassl3/sso/internal/lib/webauthn/webauthntest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registerPasskey registers a new software passkey for the owner of the access token
+func registerPasskey(t *testing.T, a *Auth, accessToken string) *webauthntest.Authenticator {
+	t.Helper()
+
+	authenticator, err := webauthntest.New(testOrigin)
+	require.NoError(t, err)
+
+	require.NoError(t, finishRegistration(t, a, accessToken, authenticator))
+
+	return authenticator
+}
+
+func finishRegistration(t *testing.T, a *Auth, accessToken string, authenticator *webauthntest.Authenticator) error {
+	t.Helper()
+	ctx := context.Background()
+
+	opts, err := a.BeginPasskeyRegistration(ctx, accessToken)
+	require.NoError(t, err)
+
+	response, err := authenticator.Register(opts)
+	require.NoError(t, err)
+
+	registration, err := webauthn.ParseRegistration(response)
+	require.NoError(t, err)
+
+	id, err := a.FinishPasskeyRegistration(ctx, accessToken, registration)
+	if err == nil {
+		assert.Equal(t, authenticator.CredentialID(), id)
+	}
+
+	return err
+}
+
+// passkeyAssertion answers passkey login started with BeginPasskeyLogin
+func passkeyAssertion(
+	t *testing.T,
+	authenticator *webauthntest.Authenticator,
+	opts webauthn.RequestOptions,
+) webauthn.Assertion {
+	t.Helper()
+
+	response, err := authenticator.Login(opts)
+	require.NoError(t, err)
+
+	assertion, err := webauthn.ParseAssertion(response)
+	require.NoError(t, err)
+
+	return assertion
+}
+
+func TestPasskey_Passwordless(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	authenticator := registerPasskey(t, a, tokens.AccessToken)
+
+	err = finishRegistration(t, a, tokens.AccessToken, authenticator)
+	assert.ErrorIs(t, err, ErrPasskeyExists)
+
+	opts, err := a.BeginPasskeyLogin(ctx, 1, "nonce", "")
+	require.NoError(t, err)
+	assert.Empty(t, opts.AllowCredentials, "any discoverable passkey may be used")
+	assert.Equal(t, webauthn.UserVerificationRequired, opts.UserVerification)
+
+	assertion := passkeyAssertion(t, authenticator, opts)
+
+	tokens, err = a.FinishPasskeyLogin(ctx, assertion)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.NotEmpty(t, tokens.IDToken)
+
+	claims, active, err := a.Introspect(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, active)
+	assert.Equal(t, int64(1), claims.UserID)
+
+	_, err = a.FinishPasskeyLogin(ctx, assertion)
+	assert.ErrorIs(t, err, ErrInvalidPasskey, "challenge is answered once")
+
+	_, err = a.BeginPasskeyLogin(ctx, 42, "", "")
+	assert.ErrorIs(t, err, ErrInvalidAppID)
+}
+
+func TestPasskey_Rejected(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	authenticator := registerPasskey(t, a, tokens.AccessToken)
+
+	t.Run("cloned passkey", func(t *testing.T) {
+		opts, err := a.BeginPasskeyLogin(ctx, 1, "", "")
+		require.NoError(t, err)
+
+		_, err = a.FinishPasskeyLogin(ctx, passkeyAssertion(t, authenticator, opts))
+		require.NoError(t, err)
+
+		// the clone signs with the counter the original has already used
+		authenticator.SignCount--
+
+		opts, err = a.BeginPasskeyLogin(ctx, 1, "", "")
+		require.NoError(t, err)
+
+		_, err = a.FinishPasskeyLogin(ctx, passkeyAssertion(t, authenticator, opts))
+		assert.ErrorIs(t, err, ErrInvalidPasskey)
+	})
+
+	t.Run("user not verified", func(t *testing.T) {
+		authenticator.NoUserVerification = true
+		defer func() { authenticator.NoUserVerification = false }()
+
+		opts, err := a.BeginPasskeyLogin(ctx, 1, "", "")
+		require.NoError(t, err)
+
+		_, err = a.FinishPasskeyLogin(ctx, passkeyAssertion(t, authenticator, opts))
+		assert.ErrorIs(t, err, ErrInvalidPasskey)
+	})
+
+	t.Run("unknown passkey", func(t *testing.T) {
+		other, err := webauthntest.New(testOrigin)
+		require.NoError(t, err)
+
+		opts, err := a.BeginPasskeyLogin(ctx, 1, "", "")
+		require.NoError(t, err)
+
+		_, err = a.FinishPasskeyLogin(ctx, passkeyAssertion(t, other, opts))
+		assert.ErrorIs(t, err, ErrInvalidPasskey)
+	})
+
+	t.Run("registration challenge", func(t *testing.T) {
+		opts, err := a.BeginPasskeyRegistration(ctx, tokens.AccessToken)
+		require.NoError(t, err)
+
+		assertion := passkeyAssertion(t, authenticator, webauthn.RequestOptions{Challenge: opts.Challenge, RPID: opts.RP.ID})
+
+		_, err = a.FinishPasskeyLogin(ctx, assertion)
+		assert.ErrorIs(t, err, ErrInvalidPasskey)
+	})
+}
+
+func TestPasskey_OnlySecondFactor(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	authenticator := registerPasskey(t, a, tokens.AccessToken)
+
+	// passkey is a second factor even without TOTP
+	challenge, err := a.Login(ctx, "user@example.com", "password", 1, "nonce")
+	require.NoError(t, err)
+	assert.Empty(t, challenge.AccessToken, "no tokens before second factor")
+	require.NotEmpty(t, challenge.MFAChallengeID)
+
+	opts, err := a.BeginPasskeyLogin(ctx, 0, "", challenge.MFAChallengeID)
+	require.NoError(t, err)
+
+	tokens, err = a.FinishPasskeyLogin(ctx, passkeyAssertion(t, authenticator, opts))
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.IDToken)
+}
+
+func TestPasskey_SecondFactor(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	enrollTOTP(t, a, tokens.AccessToken)
+
+	challenge, err := a.Login(ctx, "user@example.com", "password", 1, "nonce")
+	require.NoError(t, err)
+	require.NotEmpty(t, challenge.MFAChallengeID)
+
+	_, err = a.BeginPasskeyLogin(ctx, 0, "", challenge.MFAChallengeID)
+	assert.ErrorIs(t, err, ErrMFANotEnrolled, "user has no passkeys yet")
+
+	authenticator := registerPasskey(t, a, tokens.AccessToken)
+
+	opts, err := a.BeginPasskeyLogin(ctx, 0, "", challenge.MFAChallengeID)
+	require.NoError(t, err)
+	require.Len(t, opts.AllowCredentials, 1)
+	assert.Equal(t, authenticator.CredentialID(), []byte(opts.AllowCredentials[0].ID))
+
+	// second factor doesn't have to verify the user, password was the first one
+	authenticator.NoUserVerification = true
+
+	tokens, err = a.FinishPasskeyLogin(ctx, passkeyAssertion(t, authenticator, opts))
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	_, err = a.VerifyMFA(ctx, challenge.MFAChallengeID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidMFAChallenge, "challenge is completed")
+
+	_, err = a.BeginPasskeyLogin(ctx, 0, "", "unknown")
+	assert.ErrorIs(t, err, ErrInvalidMFAChallenge)
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+// ChangePassword replaces password of the owner of the access token
+//
+// Current password must be given even though the user is logged in, so a stolen
+// token isn't enough to take over the account. Every access and refresh token
+// issued to the user so far is revoked, including the given one, and reset links
+// stop working, all in the same transaction as the password is changed.
+// Wrong current passwords count as failed logins of the user's email, so they're
+// delayed and locked out the same way, returning ErrTooManyAttempts and ErrAccountLocked.
+// New password must follow policy of the app the token is issued to
+func (a *Auth) ChangePassword(ctx context.Context, accessToken string, currentPassword string, newPassword string) error {
+	user, claims, err := a.tokenSession(ctx, accessToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opChangePass, err)
+	}
+
+	log := a.log.With(
+		slog.String("op", opChangePass),
+		slog.Int64("userID", user.ID),
+	)
+
+	email := a.canonicalEmail(user.Email)
+
+	if err = a.reserveLoginAttempt(ctx, email); err != nil {
+		if errors.Is(err, ErrTooManyAttempts) || errors.Is(err, ErrAccountLocked) {
+			log.Warn("password change attempt rejected", sl.ErrLog(err))
+		}
+
+		return fmt.Errorf("%s: %w", opChangePass, err)
+	}
+
+	if err = a.hasher.Compare(user.PasswordHash, currentPassword); err != nil {
+		log.Warn("invalid current password", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opChangePass, ErrInvalidCredentials)
+	}
+
+	if err = a.loginSucceeded(ctx, email); err != nil {
+		log.Error("failed to reset login failures", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opChangePass, err)
+	}
+
+	if err = a.checkPassword(log, claims.AppID, newPassword, user.Email); err != nil {
+		return fmt.Errorf("%s: %w", opChangePass, err)
+	}
+
+	passHash, err := a.hasher.Hash(newPassword)
+	if err != nil {
+		log.Error("failed to generate password hash", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opChangePass, err)
+	}
+
+	if err = a.usrSaver.ReplacePassword(ctx, user.ID, user.PasswordHash, passHash, time.Now()); err != nil {
+		if errors.Is(err, storage.ErrPasswordHashMismatch) {
+			log.Warn("password changed concurrently")
+
+			return fmt.Errorf("%s: %w", opChangePass, ErrInvalidCredentials)
+		}
+
+		log.Error("failed to replace password", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opChangePass, err)
+	}
+
+	log.Info("password changed, all sessions revoked")
+
+	return nil
+}
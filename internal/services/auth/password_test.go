@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangePassword(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	err = a.ChangePassword(ctx, tokens.AccessToken, "wrong", "new-password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	require.NoError(t, a.ChangePassword(ctx, tokens.AccessToken, "password", "new-password"))
+
+	_, active, err := a.Introspect(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.False(t, active, "access token is revoked")
+
+	_, err = a.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefresh)
+
+	_, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = a.Login(ctx, "user@example.com", "new-password", 1, "")
+	assert.NoError(t, err)
+
+	err = a.ChangePassword(ctx, tokens.AccessToken, "new-password", "another-password")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestChangePassword_Lockout(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	for range a.lockout.MaxFailures {
+		err = a.ChangePassword(ctx, tokens.AccessToken, "wrong", "new-password")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	err = a.ChangePassword(ctx, tokens.AccessToken, "password", "new-password")
+	assert.ErrorIs(t, err, ErrAccountLocked, "correct password isn't checked")
+
+	_, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	assert.ErrorIs(t, err, ErrAccountLocked, "failures are shared with login")
+}
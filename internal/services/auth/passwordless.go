@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/mailer"
+	"github.com/nhassl3/sso/internal/lib/opaque"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+// passwordlessCodeDigits is the length of one-time code of passwordless login
+const passwordlessCodeDigits = 6
+
+// StartPasswordlessLogin mails one-time code and login link to the user with given email
+//
+// Returns login id to be completed with CompletePasswordlessLogin. Login id
+// is returned for unknown email as well, and the email is sent in background,
+// so neither the response nor its timing tells the caller if the user exists
+func (a *Auth) StartPasswordlessLogin(ctx context.Context, email string, appID int, nonce string) (string, error) {
+	email = a.canonicalEmail(email)
+
+	log := a.log.With(
+		slog.String("op", opStartPwdless),
+		slog.String("email", email),
+		slog.Int("appID", appID),
+	)
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found", sl.ErrLog(err))
+
+			return "", fmt.Errorf("%s: %w", opStartPwdless, ErrInvalidAppID)
+		}
+
+		return "", fmt.Errorf("%s: %w", opStartPwdless, err)
+	}
+
+	loginID, idHash, err := opaque.NewToken()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", opStartPwdless, err)
+	}
+
+	user, err := a.usrProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("passwordless login requested for unknown email")
+
+			return loginID, nil
+		}
+
+		return "", fmt.Errorf("%s: %w", opStartPwdless, err)
+	}
+
+	go a.sendPasswordlessLogin(context.WithoutCancel(ctx), models.PasswordlessLogin{
+		IDHash: idHash,
+		UserID: user.ID,
+		AppID:  app.ID,
+		Nonce:  nonce,
+	}, loginID, user.Email, log)
+
+	return loginID, nil
+}
+
+// CompletePasswordlessLogin completes login started with StartPasswordlessLogin
+//
+// Code is either the one-time code or the token of the link from the email.
+// Completed login proves the user owns the email, so it gets verified.
+// Returns the same tokens as Login does, including MFA challenge for users with MFA enabled
+func (a *Auth) CompletePasswordlessLogin(ctx context.Context, loginID string, code string) (models.Tokens, error) {
+	log := a.log.With(slog.String("op", opFinishPwdless))
+
+	idHash := opaque.Hash(loginID)
+
+	login, err := a.tokenStorage.PasswordlessLogin(ctx, idHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrPasswordlessNotFound) {
+			return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, ErrInvalidPasswordless)
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, err)
+	}
+
+	log = log.With(slog.Int64("userID", login.UserID))
+
+	if time.Now().After(login.ExpiresAt) {
+		log.Warn("passwordless login expired")
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, ErrInvalidPasswordless)
+	}
+
+	// attempt is used before the code is checked, so concurrent guesses
+	// can't exceed the limit
+	if err = a.tokenStorage.UsePasswordlessAttempt(ctx, idHash, a.mail.Passwordless.MaxAttempts); err != nil {
+		if errors.Is(err, storage.ErrPasswordlessNotFound) {
+			log.Warn("passwordless login exhausted")
+
+			return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, ErrInvalidPasswordless)
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, err)
+	}
+
+	hash := []byte(opaque.Hash(strings.TrimSpace(code)))
+	if subtle.ConstantTimeCompare(hash, []byte(login.CodeHash)) != 1 &&
+		subtle.ConstantTimeCompare(hash, []byte(login.TokenHash)) != 1 {
+		log.Warn("invalid passwordless code")
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, ErrInvalidLoginCode)
+	}
+
+	// login is deleted before tokens are issued, so it can't be completed twice
+	if err = a.tokenStorage.DeletePasswordlessLogin(ctx, idHash); err != nil {
+		if errors.Is(err, storage.ErrPasswordlessNotFound) {
+			return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, ErrInvalidPasswordless)
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, err)
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, login.UserID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, err)
+	}
+
+	if !user.EmailVerified {
+		if err = a.usrSaver.MarkEmailVerified(ctx, user.ID, user.Email); err != nil {
+			log.Error("failed to mark email verified", sl.ErrLog(err))
+
+			return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, err)
+		}
+
+		user.EmailVerified = true
+	}
+
+	app, err := a.appProvider.App(ctx, login.AppID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, err)
+	}
+
+	if user.MFAEnabled {
+		challengeID, err := a.newMFAChallenge(ctx, user, app, login.Nonce)
+		if err != nil {
+			log.Error("failed to create mfa challenge", sl.ErrLog(err))
+
+			return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, err)
+		}
+
+		log.Info("mfa challenge issued")
+
+		return models.Tokens{MFAChallengeID: challengeID}, nil
+	}
+
+	tokens, err := a.newSession(ctx, user, app, login.Nonce, time.Now())
+	if err != nil {
+		log.Error("failed to issue tokens", sl.ErrLog(err))
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opFinishPwdless, err)
+	}
+
+	log.Info("passwordless login completed")
+
+	return tokens, nil
+}
+
+// sendPasswordlessLogin issues code and link token of the login and mails them to the user
+func (a *Auth) sendPasswordlessLogin(
+	ctx context.Context,
+	login models.PasswordlessLogin,
+	loginID string,
+	email string,
+	log *slog.Logger,
+) {
+	ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+	defer cancel()
+
+	code, err := newPasswordlessCode()
+	if err != nil {
+		log.Error("failed to generate passwordless code", sl.ErrLog(err))
+
+		return
+	}
+
+	token, tokenHash, err := opaque.NewToken()
+	if err != nil {
+		log.Error("failed to generate passwordless token", sl.ErrLog(err))
+
+		return
+	}
+
+	login.CodeHash = opaque.Hash(code)
+	login.TokenHash = tokenHash
+	login.ExpiresAt = time.Now().Add(a.mail.Passwordless.TokenTTL)
+
+	if err = a.tokenStorage.SavePasswordlessLogin(ctx, login); err != nil {
+		log.Error("failed to save passwordless login", sl.ErrLog(err))
+
+		return
+	}
+
+	link, err := a.mail.Passwordless.withQuery(url.Values{
+		"login_id": {loginID},
+		"token":    {token},
+	})
+	if err != nil {
+		log.Error("invalid passwordless url", sl.ErrLog(err))
+
+		return
+	}
+
+	if err = a.mail.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Your sign-in code",
+		Body: fmt.Sprintf(
+			"Your sign-in code is %s\n\n"+
+				"Or open the link below to sign in:\n\n%s\n\n"+
+				"The code and the link expire in %s. If it wasn't you, ignore this email.\n",
+			code, link, a.mail.Passwordless.TokenTTL,
+		),
+	}); err != nil {
+		log.Error("failed to send passwordless login", sl.ErrLog(err))
+
+		return
+	}
+
+	log.Info("passwordless login sent", slog.Int64("userID", login.UserID))
+}
+
+// newPasswordlessCode generates random numeric one-time code
+func newPasswordlessCode() (string, error) {
+	limit := big.NewInt(1)
+	for range passwordlessCodeDigits {
+		limit.Mul(limit, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", passwordlessCodeDigits, n), nil
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var passwordlessCode = regexp.MustCompile(`code is (\d{6})`)
+
+// startPasswordless starts passwordless login of the test user and returns
+// login id with the code and the link from the email
+func startPasswordless(t *testing.T, a *Auth) (loginID string, code string, link *url.URL) {
+	t.Helper()
+
+	loginID, err := a.StartPasswordlessLogin(context.Background(), "user@example.com", 1, "n")
+	require.NoError(t, err)
+
+	body := a.mail.Mailer.(*fakeMailer).next(t).Body
+
+	match := passwordlessCode.FindStringSubmatch(body)
+	require.Len(t, match, 2)
+
+	link, err = url.Parse(mailLink.FindString(body))
+	require.NoError(t, err)
+	assert.Equal(t, loginID, link.Query().Get("login_id"))
+
+	return loginID, match[1], link
+}
+
+func TestPasswordlessLogin(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	loginID, code, _ := startPasswordless(t, a)
+
+	_, err := a.CompletePasswordlessLogin(ctx, loginID, "garbage")
+	assert.ErrorIs(t, err, ErrInvalidLoginCode)
+
+	tokens, err := a.CompletePasswordlessLogin(ctx, loginID, code)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.NotEmpty(t, tokens.IDToken)
+
+	_, err = a.CompletePasswordlessLogin(ctx, loginID, code)
+	assert.ErrorIs(t, err, ErrInvalidPasswordless, "login is single-use")
+
+	st.mu.Lock()
+	assert.True(t, st.users[1].EmailVerified, "email is proven by the login")
+	st.mu.Unlock()
+}
+
+func TestPasswordlessLogin_Link(t *testing.T) {
+	a, _ := newTestAuth(t)
+
+	loginID, _, link := startPasswordless(t, a)
+	assert.Equal(t, "en", link.Query().Get("lang"))
+
+	tokens, err := a.CompletePasswordlessLogin(context.Background(), loginID, link.Query().Get("token"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+}
+
+func TestPasswordlessLogin_MFA(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+	enrollTOTP(t, a, tokens.AccessToken)
+
+	loginID, code, _ := startPasswordless(t, a)
+
+	tokens, err = a.CompletePasswordlessLogin(ctx, loginID, code)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.MFAChallengeID)
+	assert.Empty(t, tokens.AccessToken, "second factor is still required")
+}
+
+func TestPasswordlessLogin_Rejected(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	loginID, code, _ := startPasswordless(t, a)
+	for range a.mail.Passwordless.MaxAttempts {
+		_, err := a.CompletePasswordlessLogin(ctx, loginID, "garbage")
+		assert.ErrorIs(t, err, ErrInvalidLoginCode)
+	}
+
+	_, err := a.CompletePasswordlessLogin(ctx, loginID, code)
+	assert.ErrorIs(t, err, ErrInvalidPasswordless, "attempts are exhausted")
+
+	a.mail.Passwordless.TokenTTL = -time.Second
+
+	loginID, code, _ = startPasswordless(t, a)
+
+	_, err = a.CompletePasswordlessLogin(ctx, loginID, code)
+	assert.ErrorIs(t, err, ErrInvalidPasswordless, "login expired")
+}
+
+func TestPasswordlessLogin_UnknownEmail(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	loginID, err := a.StartPasswordlessLogin(ctx, "nobody@example.com", 1, "")
+	require.NoError(t, err)
+	assert.NotEmpty(t, loginID, "unknown email isn't revealed")
+
+	select {
+	case msg := <-a.mail.Mailer.(*fakeMailer).sent:
+		t.Fatalf("unexpected message to %s", msg.To)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, err = a.CompletePasswordlessLogin(ctx, loginID, "123456")
+	assert.ErrorIs(t, err, ErrInvalidPasswordless)
+
+	_, err = a.StartPasswordlessLogin(ctx, "user@example.com", 42, "")
+	assert.ErrorIs(t, err, ErrInvalidAppID)
+
+	st.mu.Lock()
+	assert.Empty(t, st.passwordless)
+	st.mu.Unlock()
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/password"
+)
+
+// PasswordPolicy configures passwords users may choose
+type PasswordPolicy struct {
+	Default password.Policy
+	// Apps replace Default for users registering in the app or changing
+	// password with its access token
+	Apps map[int]password.Policy
+	// Breached passwords are rejected whatever the policy, nil disables the check
+	Breached BreachedPasswords
+}
+
+// BreachedPasswords is a list of passwords known from data breaches
+type BreachedPasswords interface {
+	Contains(password string) (bool, error)
+}
+
+// PasswordPolicyError lists every rule the password violates
+type PasswordPolicyError struct {
+	Violations []password.Violation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+
+	return fmt.Sprintf("%s: %s", ErrWeakPassword, strings.Join(rules, ", "))
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// checkPassword returns *PasswordPolicyError if the password isn't allowed
+// by policy of the app, zero appID stands for the default policy
+func (a *Auth) checkPassword(log *slog.Logger, appID int, pass string, email string) error {
+	policy, ok := a.policy.Apps[appID]
+	if !ok {
+		policy = a.policy.Default
+	}
+
+	violations := policy.Check(pass, email)
+
+	if a.policy.Breached != nil {
+		breached, err := a.policy.Breached.Contains(pass)
+		if err != nil {
+			log.Error("failed to check breached passwords", sl.ErrLog(err))
+
+			return err
+		}
+
+		if breached {
+			violations = append(violations, password.Violation{
+				Rule:    password.RuleBreached,
+				Message: "appeared in a data breach, choose another one",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		err := &PasswordPolicyError{Violations: violations}
+		log.Warn("password rejected", sl.ErrLog(err))
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nhassl3/sso/internal/lib/password"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// breachedSet is an in-memory list of breached passwords
+type breachedSet map[string]bool
+
+func (b breachedSet) Contains(pass string) (bool, error) {
+	return b[pass], nil
+}
+
+func violatedRules(t *testing.T, err error) []string {
+	t.Helper()
+
+	var policyErr *PasswordPolicyError
+	require.True(t, errors.As(err, &policyErr), "got %v", err)
+	assert.ErrorIs(t, err, ErrWeakPassword)
+
+	rules := make([]string, 0, len(policyErr.Violations))
+	for _, v := range policyErr.Violations {
+		rules = append(rules, v.Rule)
+	}
+
+	return rules
+}
+
+func TestRegister_PasswordPolicy(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	a.policy = PasswordPolicy{
+		Default:  password.Policy{MinLength: 12, RequireDigit: true, ForbidEmail: true},
+		Apps:     map[int]password.Policy{2: {MinLength: 4}},
+		Breached: breachedSet{"correct horse battery staple 1": true},
+	}
+
+	_, err := a.RegisterNewUser(ctx, "alice@example.com", "alice", 0)
+	assert.Equal(t, []string{password.RuleMinLength, password.RuleDigit, password.RuleEmail}, violatedRules(t, err))
+
+	_, err = a.RegisterNewUser(ctx, "alice@example.com", "correct horse battery staple 1", 0)
+	assert.Equal(t, []string{password.RuleBreached}, violatedRules(t, err))
+
+	_, err = a.RegisterNewUser(ctx, "alice@example.com", "alice", 2)
+	assert.NoError(t, err, "app policy replaces the default one")
+
+	_, err = a.RegisterNewUser(ctx, "bob@example.com", "long enough passphrase 2", 0)
+	assert.NoError(t, err)
+}
+
+func TestChangePassword_AppPolicy(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	a.policy = PasswordPolicy{Apps: map[int]password.Policy{1: {MinLength: 20}}}
+
+	err = a.ChangePassword(ctx, tokens.AccessToken, "password", "new-password")
+	assert.Equal(t, []string{password.RuleMinLength}, violatedRules(t, err))
+
+	_, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	assert.NoError(t, err, "password is kept")
+}
+
+func TestPasswordReset_WeakPasswordKeepsToken(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+	mail := a.mail.Mailer.(*fakeMailer)
+
+	a.policy = PasswordPolicy{Default: password.Policy{MinLength: 12}}
+
+	require.NoError(t, a.RequestPasswordReset(ctx, "user@example.com"))
+	token := linkToken(t, mail.next(t).Body)
+
+	err := a.ResetPassword(ctx, token, "short")
+	assert.Equal(t, []string{password.RuleMinLength}, violatedRules(t, err))
+
+	require.NoError(t, a.ResetPassword(ctx, token, "long enough password"))
+
+	_, err = a.Login(ctx, "user@example.com", "long enough password", 1, "")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/totp"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+
+	// recoveryCodeAlphabet has no look-alike characters, codes are typed from a printout
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// VerifyMFACode checks second factor of the user with MFA enabled
+//
+// code is either a TOTP code or one of the recovery codes, used recovery code is deleted
+func (a *Auth) VerifyMFACode(ctx context.Context, userID int64, code string) error {
+	var err error
+	if isTOTPCode(code) {
+		err = a.VerifyTOTP(ctx, userID, code)
+	} else {
+		err = a.useRecoveryCode(ctx, userID, code)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", opVerifyCode, err)
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces recovery codes of the owner of the access token
+//
+// Old codes stop working, new ones must be shown to the user once
+func (a *Auth) RegenerateRecoveryCodes(ctx context.Context, accessToken string) ([]string, error) {
+	user, err := a.tokenOwner(ctx, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opRegenerate, err)
+	}
+
+	log := a.log.With(
+		slog.String("op", opRegenerate),
+		slog.Int64("userID", user.ID),
+	)
+
+	if !user.MFAEnabled {
+		return nil, fmt.Errorf("%s: %w", opRegenerate, ErrMFANotEnrolled)
+	}
+
+	codes, err := a.newRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to generate recovery codes", sl.ErrLog(err))
+
+		return nil, fmt.Errorf("%s: %w", opRegenerate, err)
+	}
+
+	log.Info("recovery codes regenerated")
+
+	return codes, nil
+}
+
+// RecoveryCodesRemaining returns number of unused recovery codes of the owner of the access token
+func (a *Auth) RecoveryCodesRemaining(ctx context.Context, accessToken string) (int, error) {
+	user, err := a.tokenOwner(ctx, accessToken)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opCountCodes, err)
+	}
+
+	count, err := a.mfaStorage.CountRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opCountCodes, err)
+	}
+
+	return count, nil
+}
+
+// newRecoveryCodes generates recovery codes for the user and stores their hashes
+func (a *Auth) newRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, formatRecoveryCode(code))
+		hashes = append(hashes, a.recoveryCodeHash(code))
+	}
+
+	if err := a.mfaStorage.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// useRecoveryCode deletes matching recovery code of the user
+//
+// The code is looked up by its hash, so a guess costs a single query
+func (a *Auth) useRecoveryCode(ctx context.Context, userID int64, code string) error {
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeLength {
+		return ErrInvalidMFACode
+	}
+
+	if err := a.mfaStorage.UseRecoveryCode(ctx, userID, a.recoveryCodeHash(code)); err != nil {
+		if errors.Is(err, storage.ErrRecoveryCodeNotFound) {
+			return ErrInvalidMFACode
+		}
+
+		return err
+	}
+
+	a.log.Info("recovery code used", slog.Int64("userID", userID))
+
+	return nil
+}
+
+// recoveryCodeHash returns HMAC-SHA256 of the normalized recovery code
+//
+// Codes are random, so unlike passwords they don't need a slow hash,
+// as long as the key isn't leaked along with the hashes
+func (a *Auth) recoveryCodeHash(code string) []byte {
+	mac := hmac.New(sha256.New, a.mfa.RecoveryCodeKey)
+	mac.Write([]byte(code))
+
+	return mac.Sum(nil)
+}
+
+func newRecoveryCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+
+	code := make([]byte, recoveryCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		code[i] = recoveryCodeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// formatRecoveryCode splits recovery code in halves for readability, e.g. k7d2m-qx9ha
+func formatRecoveryCode(code string) string {
+	return code[:len(code)/2] + "-" + code[len(code)/2:]
+}
+
+// normalizeRecoveryCode makes user input comparable with generated code:
+// the code is case-insensitive and separators are ignored
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+}
+
+// isTOTPCode reports whether the code looks like TOTP code rather than a recovery code
+func isTOTPCode(code string) bool {
+	code = strings.TrimSpace(code)
+	if len(code) != totp.Digits {
+		return false
+	}
+
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/opaque"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+// Refresh exchanges refresh token for a new pair of tokens
+//
+// Given refresh token is rotated: it can't be used again. If already
+// rotated token is presented once more, the whole token family is revoked,
+// so both the attacker and the legitimate client have to log in again
+func (a *Auth) Refresh(ctx context.Context, refreshToken string) (models.Tokens, error) {
+	return a.refresh(ctx, refreshToken, 0)
+}
+
+// RefreshApp is like Refresh, but the refresh token must have been issued to the app
+//
+// Tokens of other apps are rejected before rotation, so a client can't use or
+// burn refresh tokens it got hold of
+func (a *Auth) RefreshApp(ctx context.Context, appID int, refreshToken string) (models.Tokens, error) {
+	return a.refresh(ctx, refreshToken, appID)
+}
+
+// refresh rotates refresh token of the app, or of any app if appID is zero
+func (a *Auth) refresh(ctx context.Context, refreshToken string, appID int) (models.Tokens, error) {
+	log := a.log.With(slog.String("op", opRefresh))
+
+	hash := opaque.Hash(refreshToken)
+
+	stored, err := a.tokenStorage.RefreshToken(ctx, hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			log.Warn("refresh token not found")
+
+			return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, ErrInvalidRefresh)
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, err)
+	}
+
+	log = log.With(slog.Int64("userID", stored.UserID), slog.String("family", stored.FamilyID))
+
+	if appID != 0 && stored.AppID != appID {
+		log.Warn("refresh token of another app", slog.Int("appID", appID))
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, ErrInvalidRefresh)
+	}
+
+	if stored.Revoked {
+		log.Warn("refresh token revoked")
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, ErrInvalidRefresh)
+	}
+
+	if stored.Used {
+		return models.Tokens{}, a.revokeReusedFamily(ctx, log, stored.FamilyID)
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		log.Warn("refresh token expired")
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, ErrInvalidRefresh)
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", sl.ErrLog(err))
+
+			return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, ErrInvalidRefresh)
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, err)
+	}
+
+	app, err := a.appProvider.App(ctx, stored.AppID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, err)
+	}
+
+	accessToken, err := a.newAccessToken(ctx, user, app)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, err)
+	}
+
+	next, nextHash, err := opaque.NewToken()
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, err)
+	}
+
+	err = a.tokenStorage.RotateRefreshToken(ctx, hash, models.RefreshToken{
+		TokenHash: nextHash,
+		FamilyID:  stored.FamilyID,
+		UserID:    user.ID,
+		AppID:     app.ID,
+		ExpiresAt: time.Now().Add(a.refreshTokenTTL),
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenAlreadyUsed) {
+			// token was rotated concurrently: it is a reuse as well
+			return models.Tokens{}, a.revokeReusedFamily(ctx, log, stored.FamilyID)
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, err)
+	}
+
+	log.Info("refresh token rotated")
+
+	return models.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: next,
+	}, nil
+}
+
+// newSession issues tokens to the user who has just authenticated in the app
+//
+// Refresh token starts a new token family, nonce is put to the ID token as is.
+// Users whose email isn't verified get no session in apps requiring it
+func (a *Auth) newSession(
+	ctx context.Context,
+	user models.User,
+	app models.App,
+	nonce string,
+	authTime time.Time,
+) (models.Tokens, error) {
+	if err := checkEmailVerified(user, app); err != nil {
+		return models.Tokens{}, err
+	}
+
+	familyID, err := opaque.NewID()
+	if err != nil {
+		return models.Tokens{}, err
+	}
+
+	key, err := a.keyProvider.SigningKey(ctx, app.ID)
+	if err != nil {
+		return models.Tokens{}, err
+	}
+
+	var opts []jwt.Option
+	if key != nil {
+		opts = append(opts, jwt.WithKey(*key))
+	}
+
+	accessToken, err := a.signAccessToken(ctx, user, app, opts...)
+	if err != nil {
+		return models.Tokens{}, err
+	}
+
+	idToken, err := jwt.NewIDToken(user, app, a.tokenTTL, jwt.IDToken{
+		Issuer:   a.issuer,
+		Nonce:    nonce,
+		AuthTime: authTime,
+	}, opts...)
+	if err != nil {
+		return models.Tokens{}, err
+	}
+
+	refreshToken, hash, err := opaque.NewToken()
+	if err != nil {
+		return models.Tokens{}, err
+	}
+
+	if err = a.tokenStorage.SaveRefreshToken(ctx, models.RefreshToken{
+		TokenHash: hash,
+		FamilyID:  familyID,
+		UserID:    user.ID,
+		AppID:     app.ID,
+		ExpiresAt: time.Now().Add(a.refreshTokenTTL),
+	}); err != nil {
+		return models.Tokens{}, err
+	}
+
+	return models.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		IDToken:      idToken,
+	}, nil
+}
+
+// newAccessToken creates access token signed with the current signing key of the app
+func (a *Auth) newAccessToken(ctx context.Context, user models.User, app models.App) (string, error) {
+	key, err := a.keyProvider.SigningKey(ctx, app.ID)
+	if err != nil {
+		return "", err
+	}
+
+	if key == nil {
+		return a.signAccessToken(ctx, user, app)
+	}
+
+	return a.signAccessToken(ctx, user, app, jwt.WithKey(*key))
+}
+
+// signAccessToken creates access token with names of user roles in the app
+func (a *Auth) signAccessToken(
+	ctx context.Context,
+	user models.User,
+	app models.App,
+	opts ...jwt.Option,
+) (string, error) {
+	roles, err := a.roleProvider.UserRoles(ctx, user.ID, app.ID)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+
+	return jwt.NewToken(user, app, a.tokenTTL, append(opts, jwt.WithRoles(names))...)
+}
+
+func (a *Auth) revokeReusedFamily(ctx context.Context, log *slog.Logger, familyID string) error {
+	log.Warn("refresh token reuse detected, revoking token family")
+
+	if err := a.tokenStorage.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+		log.Error("failed to revoke token family", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opRefresh, err)
+	}
+
+	return fmt.Errorf("%s: %w", opRefresh, ErrRefreshReused)
+}
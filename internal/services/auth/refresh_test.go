@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefresh_Rotation(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+	require.NotEmpty(t, tokens.RefreshToken)
+
+	rotated, err := a.Refresh(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEmpty(t, rotated.AccessToken)
+	assert.NotEqual(t, tokens.RefreshToken, rotated.RefreshToken)
+
+	_, err = a.Refresh(ctx, rotated.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestRefresh_ReuseRevokesFamily(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	rotated, err := a.Refresh(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+
+	// replay of the already rotated token
+	_, err = a.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshReused)
+
+	// the legitimate successor is revoked too
+	_, err = a.Refresh(ctx, rotated.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefresh)
+}
+
+func TestRefreshApp(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	// token of another app is rejected and stays usable
+	_, err = a.RefreshApp(ctx, 2, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefresh)
+
+	_, err = a.RefreshApp(ctx, 1, tokens.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestRefresh_Invalid(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	_, err := a.Refresh(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrInvalidRefresh)
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	for hash, token := range st.tokens {
+		token.ExpiresAt = time.Now().Add(-time.Minute)
+		st.tokens[hash] = token
+	}
+
+	_, err = a.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefresh)
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/mailer"
+	"github.com/nhassl3/sso/internal/lib/opaque"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+// RequestPasswordReset sends password reset link to the email if there is a user with it
+//
+// The result is the same whether the email is registered or not, and the link
+// is issued and sent in background, so neither the response nor its timing
+// tells the caller if the user exists
+func (a *Auth) RequestPasswordReset(ctx context.Context, email string) error {
+	email = a.canonicalEmail(email)
+
+	log := a.log.With(
+		slog.String("op", opRequestReset),
+		slog.String("email", email),
+	)
+
+	user, err := a.usrProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("password reset requested for unknown email")
+
+			return nil
+		}
+
+		return fmt.Errorf("%s: %w", opRequestReset, err)
+	}
+
+	go a.sendResetLink(context.WithoutCancel(ctx), user, log)
+
+	return nil
+}
+
+// ResetPassword sets new password of the user the reset token was sent to.
+// The password must follow the default policy
+//
+// Token is single-use, other reset links of the user stop working as well.
+// Every session of the user is revoked, the account may have been compromised
+func (a *Auth) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	log := a.log.With(slog.String("op", opResetPass))
+
+	hash := opaque.Hash(token)
+
+	stored, err := a.tokenStorage.PasswordResetToken(ctx, hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrResetTokenNotFound) {
+			log.Warn("unknown reset token")
+
+			return fmt.Errorf("%s: %w", opResetPass, ErrInvalidResetToken)
+		}
+
+		return fmt.Errorf("%s: %w", opResetPass, err)
+	}
+
+	log = log.With(slog.Int64("userID", stored.UserID))
+
+	if time.Now().After(stored.ExpiresAt) {
+		log.Warn("reset token expired")
+
+		if err = a.tokenStorage.DeletePasswordResetToken(ctx, hash); err != nil && !errors.Is(err, storage.ErrResetTokenNotFound) {
+			return fmt.Errorf("%s: %w", opResetPass, err)
+		}
+
+		return fmt.Errorf("%s: %w", opResetPass, ErrInvalidResetToken)
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, stored.UserID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opResetPass, err)
+	}
+
+	// token is kept, so the user may retry with another password
+	if err = a.checkPassword(log, 0, newPassword, user.Email); err != nil {
+		return fmt.Errorf("%s: %w", opResetPass, err)
+	}
+
+	if err = a.tokenStorage.DeletePasswordResetToken(ctx, hash); err != nil {
+		if errors.Is(err, storage.ErrResetTokenNotFound) {
+			return fmt.Errorf("%s: %w", opResetPass, ErrInvalidResetToken)
+		}
+
+		return fmt.Errorf("%s: %w", opResetPass, err)
+	}
+
+	passHash, err := a.hasher.Hash(newPassword)
+	if err != nil {
+		log.Error("failed to generate password hash", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opResetPass, err)
+	}
+
+	if err = a.usrSaver.ReplacePassword(ctx, user.ID, user.PasswordHash, passHash, time.Now()); err != nil {
+		if errors.Is(err, storage.ErrPasswordHashMismatch) {
+			log.Warn("password changed concurrently")
+
+			return fmt.Errorf("%s: %w", opResetPass, ErrInvalidResetToken)
+		}
+
+		log.Error("failed to replace password", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opResetPass, err)
+	}
+
+	log.Info("password reset, all sessions revoked")
+
+	return nil
+}
+
+// sendResetLink issues password reset token and mails the link with it to the user
+func (a *Auth) sendResetLink(ctx context.Context, user models.User, log *slog.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+	defer cancel()
+
+	token, hash, err := opaque.NewToken()
+	if err != nil {
+		log.Error("failed to generate reset token", sl.ErrLog(err))
+
+		return
+	}
+
+	if err = a.tokenStorage.SavePasswordResetToken(ctx, models.PasswordResetToken{
+		TokenHash: hash,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(a.mail.PasswordReset.TokenTTL),
+	}); err != nil {
+		log.Error("failed to save reset token", sl.ErrLog(err))
+
+		return
+	}
+
+	link, err := a.mail.PasswordReset.withToken(token)
+	if err != nil {
+		log.Error("invalid reset url", sl.ErrLog(err))
+
+		return
+	}
+
+	if err = a.mail.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Someone requested a password reset for your account.\n\n"+
+				"To choose a new password, open the link below within %s:\n\n%s\n\n"+
+				"If it wasn't you, ignore this email, your password stays the same.\n",
+			a.mail.PasswordReset.TokenTTL, link,
+		),
+	}); err != nil {
+		log.Error("failed to send reset link", sl.ErrLog(err))
+
+		return
+	}
+
+	log.Info("password reset link sent", slog.Int64("userID", user.ID))
+}
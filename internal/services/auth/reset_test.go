@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var mailLink = regexp.MustCompile(`https://\S+`)
+
+// linkToken extracts token from the link in the message
+func linkToken(t *testing.T, body string) string {
+	t.Helper()
+
+	link, err := url.Parse(mailLink.FindString(body))
+	require.NoError(t, err)
+	assert.Equal(t, "en", link.Query().Get("lang"), "query of the link url is kept")
+
+	return link.Query().Get("token")
+}
+
+func TestPasswordReset(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+	mail := a.mail.Mailer.(*fakeMailer)
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	require.NoError(t, a.RequestPasswordReset(ctx, "user@example.com"))
+	require.NoError(t, a.RequestPasswordReset(ctx, "user@example.com"))
+
+	msg := mail.next(t)
+	assert.Equal(t, "user@example.com", msg.To)
+	first := linkToken(t, msg.Body)
+	second := linkToken(t, mail.next(t).Body)
+
+	err = a.ResetPassword(ctx, "garbage", "new-password")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+
+	require.NoError(t, a.ResetPassword(ctx, first, "new-password"))
+
+	err = a.ResetPassword(ctx, first, "another-password")
+	assert.ErrorIs(t, err, ErrInvalidResetToken, "token is single-use")
+
+	err = a.ResetPassword(ctx, second, "another-password")
+	assert.ErrorIs(t, err, ErrInvalidResetToken, "other links of the user are invalidated")
+
+	_, err = a.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefresh, "sessions are revoked")
+
+	_, err = a.Login(ctx, "user@example.com", "new-password", 1, "")
+	assert.NoError(t, err)
+
+	st.mu.Lock()
+	assert.Empty(t, st.resetTokens)
+	st.mu.Unlock()
+}
+
+func TestPasswordReset_Expired(t *testing.T) {
+	a, _ := newTestAuth(t)
+	ctx := context.Background()
+	mail := a.mail.Mailer.(*fakeMailer)
+
+	a.mail.PasswordReset.TokenTTL = -time.Second
+
+	require.NoError(t, a.RequestPasswordReset(ctx, "user@example.com"))
+
+	err := a.ResetPassword(ctx, linkToken(t, mail.next(t).Body), "new-password")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+}
+
+func TestPasswordReset_UnknownEmail(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+	mail := a.mail.Mailer.(*fakeMailer)
+
+	require.NoError(t, a.RequestPasswordReset(ctx, "nobody@example.com"), "unknown email isn't revealed")
+
+	select {
+	case msg := <-mail.sent:
+		t.Fatalf("unexpected message to %s", msg.To)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	st.mu.Lock()
+	assert.Empty(t, st.resetTokens)
+	st.mu.Unlock()
+}
@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/opaque"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+// Logout revokes given access token and, if passed, the refresh token family
+// issued together with it
+func (a *Auth) Logout(ctx context.Context, token string, refreshToken string) error {
+	log := a.log.With(slog.String("op", opLogout))
+
+	claims, err := a.parseToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			log.Warn("invalid token", sl.ErrLog(err))
+
+			return fmt.Errorf("%s: %w", opLogout, ErrInvalidToken)
+		}
+
+		return fmt.Errorf("%s: %w", opLogout, err)
+	}
+
+	log = log.With(slog.Int64("userID", claims.UserID))
+
+	if err = a.tokenStorage.RevokeToken(ctx, claims.ID, claims.UserID, claims.ExpiresAt); err != nil {
+		log.Error("failed to revoke token", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opLogout, err)
+	}
+
+	if refreshToken != "" {
+		stored, err := a.tokenStorage.RefreshToken(ctx, opaque.Hash(refreshToken))
+		if err != nil && !errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			return fmt.Errorf("%s: %w", opLogout, err)
+		}
+
+		// refresh token of another user can't be revoked by this one
+		if err == nil && stored.UserID == claims.UserID {
+			if err = a.tokenStorage.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+				log.Error("failed to revoke refresh token", sl.ErrLog(err))
+
+				return fmt.Errorf("%s: %w", opLogout, err)
+			}
+		}
+	}
+
+	log.Info("user logged out")
+
+	return nil
+}
+
+// RevokeToken revokes access or refresh token
+//
+// Like RFC 7009, unknown or invalid tokens aren't an error: there is nothing to revoke
+func (a *Auth) RevokeToken(ctx context.Context, token string) error {
+	log := a.log.With(slog.String("op", opRevokeToken))
+
+	stored, err := a.tokenStorage.RefreshToken(ctx, opaque.Hash(token))
+	switch {
+	case err == nil:
+		if err = a.tokenStorage.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+			log.Error("failed to revoke refresh token", sl.ErrLog(err))
+
+			return fmt.Errorf("%s: %w", opRevokeToken, err)
+		}
+
+		log.Info("refresh token revoked", slog.Int64("userID", stored.UserID))
+
+		return nil
+	case !errors.Is(err, storage.ErrRefreshTokenNotFound):
+		return fmt.Errorf("%s: %w", opRevokeToken, err)
+	}
+
+	claims, err := a.parseToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			log.Info("nothing to revoke", sl.ErrLog(err))
+
+			return nil
+		}
+
+		return fmt.Errorf("%s: %w", opRevokeToken, err)
+	}
+
+	if err = a.tokenStorage.RevokeToken(ctx, claims.ID, claims.UserID, claims.ExpiresAt); err != nil {
+		log.Error("failed to revoke token", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opRevokeToken, err)
+	}
+
+	log.Info("access token revoked", slog.Int64("userID", claims.UserID))
+
+	return nil
+}
+
+// RevokeAllSessions revokes every access and refresh token issued to the user so far
+func (a *Auth) RevokeAllSessions(ctx context.Context, userID int64) error {
+	log := a.log.With(
+		slog.String("op", opRevokeAll),
+		slog.Int64("userID", userID),
+	)
+
+	if _, err := a.usrProvider.UserByID(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", sl.ErrLog(err))
+		}
+
+		return fmt.Errorf("%s: %w", opRevokeAll, err)
+	}
+
+	if err := a.tokenStorage.RevokeUserSessions(ctx, userID, time.Now()); err != nil {
+		log.Error("failed to revoke sessions", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opRevokeAll, err)
+	}
+
+	log.Info("all sessions revoked")
+
+	return nil
+}
+
+// PruneExpiredTokens removes revocation entries, refresh tokens and MFA challenges that have expired,
+// and login failure counters that no longer matter
+//
+// Expired tokens are rejected anyway, so keeping them in storage is pointless
+func (a *Auth) PruneExpiredTokens(ctx context.Context) error {
+	now := time.Now()
+
+	deleted, err := a.tokenStorage.DeleteExpiredTokens(ctx, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opPruneTokens, err)
+	}
+
+	deletedChallenges, err := a.mfaStorage.DeleteExpiredMFAChallenges(ctx, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opPruneTokens, err)
+	}
+
+	deletedSessions, err := a.mfaStorage.DeleteExpiredWebAuthnSessions(ctx, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opPruneTokens, err)
+	}
+
+	// counters are kept while they may still lock the subject or add up with new failures
+	deletedFailures, err := a.attemptStorage.DeleteStaleLoginFailures(
+		ctx,
+		now.Add(-max(a.lockout.Window, a.lockout.LockDuration)),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opPruneTokens, err)
+	}
+
+	a.log.Debug(
+		"expired tokens pruned",
+		slog.String("op", opPruneTokens),
+		slog.Int64("deleted", deleted),
+		slog.Int64("mfa_challenges", deletedChallenges),
+		slog.Int64("webauthn_sessions", deletedSessions),
+		slog.Int64("login_failures", deletedFailures),
+	)
+
+	return nil
+}
+
+// parseToken verifies access token with the key from its kid header or,
+// if there is no kid, with secret of the app it was issued for
+//
+// Token of unknown app or key is invalid, other storage errors are returned as is
+func (a *Auth) parseToken(ctx context.Context, token string) (jwt.Claims, error) {
+	return jwt.Parse(token, func(appID int, kid string) (interface{}, error) {
+		if kid != "" {
+			key, err := a.keyProvider.VerificationKey(ctx, appID, kid)
+			if err != nil {
+				if errors.Is(err, jwt.ErrKeyNotFound) {
+					return nil, fmt.Errorf("%w: %w", jwt.ErrInvalidToken, err)
+				}
+
+				return nil, err
+			}
+
+			return key.Public, nil
+		}
+
+		app, err := a.appProvider.App(ctx, appID)
+		if err != nil {
+			if errors.Is(err, storage.ErrAppNotFound) {
+				return nil, fmt.Errorf("%w: %w", jwt.ErrInvalidToken, err)
+			}
+
+			return nil, err
+		}
+
+		return []byte(app.Secret), nil
+	})
+}
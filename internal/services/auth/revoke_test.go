@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogout(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	require.NoError(t, a.Logout(ctx, tokens.AccessToken, tokens.RefreshToken))
+	assert.Len(t, st.revoked, 1)
+
+	_, err = a.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefresh)
+
+	assert.ErrorIs(t, a.Logout(ctx, "garbage", ""), ErrInvalidToken)
+}
+
+func TestRevokeToken(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	require.NoError(t, a.RevokeToken(ctx, tokens.RefreshToken))
+	_, err = a.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefresh)
+
+	require.NoError(t, a.RevokeToken(ctx, tokens.AccessToken))
+	assert.Len(t, st.revoked, 1)
+
+	// unknown tokens are silently ignored
+	assert.NoError(t, a.RevokeToken(ctx, "garbage"))
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, a.RevokeAllSessions(ctx, 1))
+
+	_, err = a.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefresh)
+
+	assert.True(t, isRevoked(t, a, st, tokens.AccessToken))
+
+	// tokens issued within the same second as the revocation are still valid
+	time.Sleep(2 * time.Millisecond)
+	tokens, err = a.Login(ctx, "user@example.com", "password", 1, "")
+	require.NoError(t, err)
+
+	assert.False(t, isRevoked(t, a, st, tokens.AccessToken))
+
+	assert.Error(t, a.RevokeAllSessions(ctx, 404))
+}
+
+func isRevoked(t *testing.T, a *Auth, st *fakeStorage, token string) bool {
+	t.Helper()
+
+	claims, err := a.parseToken(context.Background(), token)
+	require.NoError(t, err)
+
+	revoked, err := st.IsTokenRevoked(context.Background(), claims.ID, claims.UserID, claims.IssuedAt)
+	require.NoError(t, err)
+
+	return revoked
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+// UserInfo returns owner of the access token, like OpenID Connect UserInfo endpoint
+func (a *Auth) UserInfo(ctx context.Context, accessToken string) (models.User, error) {
+	user, err := a.tokenOwner(ctx, accessToken)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", opUserInfo, err)
+	}
+
+	return user, nil
+}
+
+// tokenOwner returns user the active access token was issued to
+//
+// Tokens of apps themselves have no owner and are rejected with ErrInvalidToken
+func (a *Auth) tokenOwner(ctx context.Context, accessToken string) (models.User, error) {
+	user, _, err := a.tokenSession(ctx, accessToken)
+
+	return user, err
+}
+
+// tokenSession is tokenOwner that returns claims of the token as well
+func (a *Auth) tokenSession(ctx context.Context, accessToken string) (models.User, jwt.Claims, error) {
+	claims, active, err := a.Introspect(ctx, accessToken)
+	if err != nil {
+		return models.User{}, jwt.Claims{}, err
+	}
+
+	if !active || claims.UserID == 0 {
+		return models.User{}, jwt.Claims{}, ErrInvalidToken
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			a.log.Warn("user of active token not found", slog.Int64("userID", claims.UserID), sl.ErrLog(err))
+
+			return models.User{}, jwt.Claims{}, ErrInvalidToken
+		}
+
+		return models.User{}, jwt.Claims{}, err
+	}
+
+	return user, claims, nil
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/mailer"
+	"github.com/nhassl3/sso/internal/lib/opaque"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+// RequestEmailVerification sends a new verification link to the email
+// if there is a user with it who hasn't verified it yet
+//
+// Like RequestPasswordReset, the result doesn't tell the caller if the user exists
+func (a *Auth) RequestEmailVerification(ctx context.Context, email string) error {
+	email = a.canonicalEmail(email)
+
+	log := a.log.With(
+		slog.String("op", opRequestVerify),
+		slog.String("email", email),
+	)
+
+	user, err := a.usrProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("email verification requested for unknown email")
+
+			return nil
+		}
+
+		return fmt.Errorf("%s: %w", opRequestVerify, err)
+	}
+
+	if user.EmailVerified {
+		log.Info("email already verified", slog.Int64("userID", user.ID))
+
+		return nil
+	}
+
+	go a.sendVerificationLink(context.WithoutCancel(ctx), user, log)
+
+	return nil
+}
+
+// VerifyEmail marks email of the user the verification token was sent to as verified
+//
+// Token is single-use, other verification links of the user stop working as well.
+// Token sent to the address the user no longer has is rejected
+func (a *Auth) VerifyEmail(ctx context.Context, token string) error {
+	log := a.log.With(slog.String("op", opVerifyEmail))
+
+	hash := opaque.Hash(token)
+
+	stored, err := a.tokenStorage.EmailVerificationToken(ctx, hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrVerifyTokenNotFound) {
+			log.Warn("unknown verification token")
+
+			return fmt.Errorf("%s: %w", opVerifyEmail, ErrInvalidVerifyToken)
+		}
+
+		return fmt.Errorf("%s: %w", opVerifyEmail, err)
+	}
+
+	log = log.With(slog.Int64("userID", stored.UserID))
+
+	if err = a.tokenStorage.DeleteEmailVerificationToken(ctx, hash); err != nil {
+		if errors.Is(err, storage.ErrVerifyTokenNotFound) {
+			return fmt.Errorf("%s: %w", opVerifyEmail, ErrInvalidVerifyToken)
+		}
+
+		return fmt.Errorf("%s: %w", opVerifyEmail, err)
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		log.Warn("verification token expired")
+
+		return fmt.Errorf("%s: %w", opVerifyEmail, ErrInvalidVerifyToken)
+	}
+
+	if err = a.usrSaver.MarkEmailVerified(ctx, stored.UserID, stored.Email); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("email changed since the token was sent")
+
+			return fmt.Errorf("%s: %w", opVerifyEmail, ErrInvalidVerifyToken)
+		}
+
+		log.Error("failed to mark email verified", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opVerifyEmail, err)
+	}
+
+	if err = a.tokenStorage.DeleteUserEmailVerificationTokens(ctx, stored.UserID); err != nil {
+		log.Error("failed to delete verification tokens", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opVerifyEmail, err)
+	}
+
+	log.Info("email verified")
+
+	return nil
+}
+
+// checkEmailVerified rejects the user whose email isn't verified
+// if the app lets only users with verified email in
+func checkEmailVerified(user models.User, app models.App) error {
+	if app.RequireVerifiedEmail && !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+
+	return nil
+}
+
+// sendVerificationLink issues email verification token and mails the link with it to the user
+func (a *Auth) sendVerificationLink(ctx context.Context, user models.User, log *slog.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+	defer cancel()
+
+	token, hash, err := opaque.NewToken()
+	if err != nil {
+		log.Error("failed to generate verification token", sl.ErrLog(err))
+
+		return
+	}
+
+	if err = a.tokenStorage.SaveEmailVerificationToken(ctx, models.EmailVerificationToken{
+		TokenHash: hash,
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(a.mail.EmailVerification.TokenTTL),
+	}); err != nil {
+		log.Error("failed to save verification token", sl.ErrLog(err))
+
+		return
+	}
+
+	link, err := a.mail.EmailVerification.withToken(token)
+	if err != nil {
+		log.Error("invalid verification url", sl.ErrLog(err))
+
+		return
+	}
+
+	if err = a.mail.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"To confirm this is your email address, open the link below within %s:\n\n%s\n\n"+
+				"If you didn't create an account, ignore this email.\n",
+			a.mail.EmailVerification.TokenTTL, link,
+		),
+	}); err != nil {
+		log.Error("failed to send verification link", sl.ErrLog(err))
+
+		return
+	}
+
+	log.Info("email verification link sent", slog.Int64("userID", user.ID))
+}
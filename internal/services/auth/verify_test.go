@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// strictApp lets only users with verified email in
+var strictApp = models.App{ID: 2, Name: "strict", Secret: "strict-secret", RequireVerifiedEmail: true}
+
+func TestEmailVerification(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+	mail := a.mail.Mailer.(*fakeMailer)
+
+	st.apps[strictApp.ID] = strictApp
+
+	_, err := a.RegisterNewUser(ctx, "new@example.com", "password", 0)
+	require.NoError(t, err)
+
+	msg := mail.next(t)
+	assert.Equal(t, "new@example.com", msg.To)
+	token := linkToken(t, msg.Body)
+
+	_, err = a.Login(ctx, "new@example.com", "password", strictApp.ID, "")
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+
+	tokens, err := a.Login(ctx, "new@example.com", "password", 1, "")
+	require.NoError(t, err, "other apps let unverified users in")
+
+	claims, _, err := a.Introspect(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.False(t, claims.EmailVerified)
+
+	assert.ErrorIs(t, a.VerifyEmail(ctx, "garbage"), ErrInvalidVerifyToken)
+
+	require.NoError(t, a.VerifyEmail(ctx, token))
+	assert.ErrorIs(t, a.VerifyEmail(ctx, token), ErrInvalidVerifyToken, "token is single-use")
+
+	tokens, err = a.Login(ctx, "new@example.com", "password", strictApp.ID, "")
+	require.NoError(t, err)
+
+	claims, _, err = a.Introspect(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, claims.EmailVerified)
+}
+
+func TestRequestEmailVerification(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+	mail := a.mail.Mailer.(*fakeMailer)
+
+	require.NoError(t, a.RequestEmailVerification(ctx, "user@example.com"))
+	require.NoError(t, a.RequestEmailVerification(ctx, "user@example.com"))
+
+	first := linkToken(t, mail.next(t).Body)
+	second := linkToken(t, mail.next(t).Body)
+
+	require.NoError(t, a.VerifyEmail(ctx, second))
+	assert.ErrorIs(t, a.VerifyEmail(ctx, first), ErrInvalidVerifyToken, "other links of the user are invalidated")
+
+	require.NoError(t, a.RequestEmailVerification(ctx, "user@example.com"), "verified email isn't revealed")
+	require.NoError(t, a.RequestEmailVerification(ctx, "nobody@example.com"), "unknown email isn't revealed")
+
+	select {
+	case msg := <-mail.sent:
+		t.Fatalf("unexpected message to %s", msg.To)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	st.mu.Lock()
+	assert.Empty(t, st.verifyTokens)
+	st.mu.Unlock()
+}
+
+func TestVerifyEmail_Rejected(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+	mail := a.mail.Mailer.(*fakeMailer)
+
+	a.mail.EmailVerification.TokenTTL = -time.Second
+
+	require.NoError(t, a.RequestEmailVerification(ctx, "user@example.com"))
+	assert.ErrorIs(t, a.VerifyEmail(ctx, linkToken(t, mail.next(t).Body)), ErrInvalidVerifyToken, "expired")
+
+	a.mail.EmailVerification.TokenTTL = time.Hour
+
+	require.NoError(t, a.RequestEmailVerification(ctx, "user@example.com"))
+	token := linkToken(t, mail.next(t).Body)
+
+	st.mu.Lock()
+	user := st.users[1]
+	user.Email = "changed@example.com"
+	st.users[1] = user
+	st.mu.Unlock()
+
+	assert.ErrorIs(t, a.VerifyEmail(ctx, token), ErrInvalidVerifyToken, "sent to the old address")
+}
@@ -0,0 +1,467 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+)
+
+const (
+	opNew         = "authorization.New"
+	opWriteTuples = "authorization.WriteTuples"
+	opCheck       = "authorization.Check"
+	opExpand      = "authorization.Expand"
+	opListObjects = "authorization.ListObjects"
+)
+
+// maxDepth limits nesting of usersets followed by Check and Expand
+const maxDepth = 25
+
+// Operations of UsersetTree nodes
+const (
+	OpLeaf         = "leaf"
+	OpUnion        = "union"
+	OpIntersection = "intersection"
+)
+
+var (
+	ErrInvalidTuple     = errors.New("invalid relation tuple")
+	ErrUnknownNamespace = errors.New("unknown namespace")
+	ErrUnknownRelation  = errors.New("unknown relation")
+	ErrDepthExceeded    = errors.New("usersets are nested too deep")
+)
+
+// Authorization decides whether subjects have relations to objects,
+// following relation tuples like "document:readme#viewer@group:eng#member"
+// and rewrites of relations defined by namespaces
+//
+// Namespace and ID of subjects are up to clients, users of this service
+// are usually "user:<user ID>"
+type Authorization struct {
+	log          *slog.Logger
+	tupleStorage TupleStorage
+	namespaces   map[string]Namespace
+}
+
+type TupleStorage interface {
+	WriteTuples(ctx context.Context, writes []models.RelationTuple, deletes []models.RelationTuple) error
+	Subjects(ctx context.Context, object models.Object, relation string) (subjects []models.Subject, err error)
+	ObjectIDs(ctx context.Context, namespace string, after string, limit int) (ids []string, err error)
+}
+
+// UsersetTree is the userset of Relation of Object made up of subjects of a leaf
+// or of children combined by Operation
+type UsersetTree struct {
+	Object    models.Object
+	Relation  string
+	Operation string
+	Subjects  []models.Subject
+	Children  []UsersetTree
+}
+
+// New returns a new instance of the Authorization service,
+// it fails if any rewrite of namespaces is invalid
+func New(log *slog.Logger, tupleStorage TupleStorage, namespaces map[string]Namespace) (*Authorization, error) {
+	if err := validateNamespaces(namespaces); err != nil {
+		return nil, fmt.Errorf("%s: %w", opNew, err)
+	}
+
+	return &Authorization{
+		log:          log,
+		tupleStorage: tupleStorage,
+		namespaces:   namespaces,
+	}, nil
+}
+
+// WriteTuples saves writes and deletes deletes at once
+//
+// Objects and usersets of tuples must be of relations defined by namespaces
+func (a *Authorization) WriteTuples(ctx context.Context, writes []models.RelationTuple, deletes []models.RelationTuple) error {
+	log := a.log.With(
+		slog.String("op", opWriteTuples),
+		slog.Int("writes", len(writes)),
+		slog.Int("deletes", len(deletes)),
+	)
+
+	for _, tuple := range slices.Concat(writes, deletes) {
+		if err := a.checkTuple(tuple); err != nil {
+			return fmt.Errorf("%s: %w", opWriteTuples, err)
+		}
+	}
+
+	if err := a.tupleStorage.WriteTuples(ctx, writes, deletes); err != nil {
+		log.Error("failed to write tuples", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opWriteTuples, err)
+	}
+
+	log.Info("tuples written")
+
+	return nil
+}
+
+// Check reports whether subject has relation to object
+func (a *Authorization) Check(
+	ctx context.Context,
+	object models.Object,
+	relation string,
+	subject models.Subject,
+) (bool, error) {
+	rewrite, err := a.rewrite(object, relation)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", opCheck, err)
+	}
+
+	c := checker{a: a, subject: subject, path: map[models.Subject]bool{}}
+
+	allowed, err := c.check(ctx, object, relation, rewrite, 0)
+	if err != nil {
+		if !errors.Is(err, ErrDepthExceeded) {
+			a.log.Error("failed to check relation",
+				slog.String("op", opCheck),
+				slog.String("object", object.String()),
+				slog.String("relation", relation),
+				slog.String("subject", subject.String()),
+				sl.ErrLog(err),
+			)
+		}
+
+		return false, fmt.Errorf("%s: %w", opCheck, err)
+	}
+
+	return allowed, nil
+}
+
+// Expand returns the userset tree of relation of object
+//
+// Rewrites are expanded, while usersets of tuples stay in leaves
+// to be expanded by the caller if needed
+func (a *Authorization) Expand(ctx context.Context, object models.Object, relation string) (UsersetTree, error) {
+	rewrite, err := a.rewrite(object, relation)
+	if err != nil {
+		return UsersetTree{}, fmt.Errorf("%s: %w", opExpand, err)
+	}
+
+	e := expander{a: a, path: map[models.Subject]bool{}}
+
+	tree, err := e.expand(ctx, object, relation, rewrite, 0)
+	if err != nil {
+		if !errors.Is(err, ErrDepthExceeded) {
+			a.log.Error("failed to expand relation",
+				slog.String("op", opExpand),
+				slog.String("object", object.String()),
+				slog.String("relation", relation),
+				sl.ErrLog(err),
+			)
+		}
+
+		return UsersetTree{}, fmt.Errorf("%s: %w", opExpand, err)
+	}
+
+	return tree, nil
+}
+
+// ListObjects returns objects of the namespace subject has relation to
+// among at most limit objects having any tuple and following after in order,
+// limit must be positive,
+// next is the last of them if more objects follow and empty otherwise
+//
+// Every object is checked on its own, so limit bounds the work of a single call
+// rather than the number of objects found
+func (a *Authorization) ListObjects(
+	ctx context.Context,
+	namespace string,
+	relation string,
+	subject models.Subject,
+	after string,
+	limit int,
+) (objects []models.Object, next string, err error) {
+	log := a.log.With(
+		slog.String("op", opListObjects),
+		slog.String("namespace", namespace),
+		slog.String("relation", relation),
+		slog.String("subject", subject.String()),
+	)
+
+	rewrite, err := a.rewrite(models.Object{Namespace: namespace}, relation)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", opListObjects, err)
+	}
+
+	// one more object tells whether there is a next page
+	ids, err := a.tupleStorage.ObjectIDs(ctx, namespace, after, limit+1)
+	if err != nil {
+		log.Error("failed to get objects", sl.ErrLog(err))
+
+		return nil, "", fmt.Errorf("%s: %w", opListObjects, err)
+	}
+
+	if len(ids) > limit {
+		ids = ids[:limit]
+		next = ids[limit-1]
+	}
+
+	for _, id := range ids {
+		object := models.Object{Namespace: namespace, ID: id}
+
+		c := checker{a: a, subject: subject, path: map[models.Subject]bool{}}
+
+		allowed, err := c.check(ctx, object, relation, rewrite, 0)
+		if err != nil {
+			log.Error("failed to check relation", slog.String("object", object.String()), sl.ErrLog(err))
+
+			return nil, "", fmt.Errorf("%s: %w", opListObjects, err)
+		}
+
+		if allowed {
+			objects = append(objects, object)
+		}
+	}
+
+	return objects, next, nil
+}
+
+// rewrite returns rewrite of relation of objects of the namespace
+func (a *Authorization) rewrite(object models.Object, relation string) (Rewrite, error) {
+	namespace, ok := a.namespaces[object.Namespace]
+	if !ok {
+		return Rewrite{}, fmt.Errorf("%w %q", ErrUnknownNamespace, object.Namespace)
+	}
+
+	rewrite, ok := namespace.Relations[relation]
+	if !ok {
+		return Rewrite{}, fmt.Errorf("%w %q of namespace %q", ErrUnknownRelation, relation, object.Namespace)
+	}
+
+	return rewrite, nil
+}
+
+// checkTuple checks that relation of the object and of the subject userset are defined,
+// subjects that are objects themselves may be of any namespace
+func (a *Authorization) checkTuple(tuple models.RelationTuple) error {
+	if _, err := a.rewrite(tuple.Object, tuple.Relation); err != nil {
+		return err
+	}
+
+	if tuple.Subject.Relation == "" {
+		return nil
+	}
+
+	_, err := a.rewrite(tuple.Subject.Object, tuple.Subject.Relation)
+
+	return err
+}
+
+// checker walks usersets looking for the subject, path holds usersets
+// being checked to stop at cycles
+type checker struct {
+	a       *Authorization
+	subject models.Subject
+	path    map[models.Subject]bool
+}
+
+func (c checker) check(
+	ctx context.Context,
+	object models.Object,
+	relation string,
+	rewrite Rewrite,
+	depth int,
+) (bool, error) {
+	userset := models.Subject{Object: object, Relation: relation}
+	if userset == c.subject {
+		return true, nil
+	}
+
+	if c.path[userset] {
+		return false, nil
+	}
+
+	if depth > maxDepth {
+		return false, ErrDepthExceeded
+	}
+
+	c.path[userset] = true
+	defer delete(c.path, userset)
+
+	return c.rewrite(ctx, object, relation, rewrite, depth)
+}
+
+func (c checker) rewrite(
+	ctx context.Context,
+	object models.Object,
+	relation string,
+	rewrite Rewrite,
+	depth int,
+) (bool, error) {
+	switch {
+	case rewrite.ComputedUserset != "":
+		return c.relation(ctx, object, rewrite.ComputedUserset, depth+1)
+	case rewrite.TupleToUserset != nil:
+		related, err := c.a.tupleStorage.Subjects(ctx, object, rewrite.TupleToUserset.Tupleset)
+		if err != nil {
+			return false, err
+		}
+
+		for _, subject := range related {
+			ok, err := c.relation(ctx, subject.Object, rewrite.TupleToUserset.ComputedUserset, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+
+		return false, nil
+	case rewrite.Union != nil:
+		for _, child := range rewrite.Union {
+			ok, err := c.rewrite(ctx, object, relation, child, depth)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+
+		return false, nil
+	case rewrite.Intersection != nil:
+		for _, child := range rewrite.Intersection {
+			ok, err := c.rewrite(ctx, object, relation, child, depth)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+
+		return len(rewrite.Intersection) > 0, nil
+	default:
+		subjects, err := c.a.tupleStorage.Subjects(ctx, object, relation)
+		if err != nil {
+			return false, err
+		}
+
+		for _, subject := range subjects {
+			if subject == c.subject {
+				return true, nil
+			}
+		}
+
+		for _, subject := range subjects {
+			if subject.Relation == "" {
+				continue
+			}
+
+			ok, err := c.relation(ctx, subject.Object, subject.Relation, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+
+		return false, nil
+	}
+}
+
+// relation checks relation of another object, relations of namespaces
+// not defined have no subjects
+func (c checker) relation(ctx context.Context, object models.Object, relation string, depth int) (bool, error) {
+	rewrite, err := c.a.rewrite(object, relation)
+	if err != nil {
+		return false, nil
+	}
+
+	return c.check(ctx, object, relation, rewrite, depth)
+}
+
+// expander builds userset trees, path holds usersets being expanded to stop at cycles
+type expander struct {
+	a    *Authorization
+	path map[models.Subject]bool
+}
+
+func (e expander) expand(
+	ctx context.Context,
+	object models.Object,
+	relation string,
+	rewrite Rewrite,
+	depth int,
+) (UsersetTree, error) {
+	userset := models.Subject{Object: object, Relation: relation}
+	if e.path[userset] {
+		return UsersetTree{Object: object, Relation: relation, Operation: OpUnion}, nil
+	}
+
+	if depth > maxDepth {
+		return UsersetTree{}, ErrDepthExceeded
+	}
+
+	e.path[userset] = true
+	defer delete(e.path, userset)
+
+	return e.rewrite(ctx, object, relation, rewrite, depth)
+}
+
+func (e expander) rewrite(
+	ctx context.Context,
+	object models.Object,
+	relation string,
+	rewrite Rewrite,
+	depth int,
+) (UsersetTree, error) {
+	tree := UsersetTree{Object: object, Relation: relation}
+
+	switch {
+	case rewrite.ComputedUserset != "":
+		return e.relation(ctx, object, rewrite.ComputedUserset, depth+1)
+	case rewrite.TupleToUserset != nil:
+		related, err := e.a.tupleStorage.Subjects(ctx, object, rewrite.TupleToUserset.Tupleset)
+		if err != nil {
+			return UsersetTree{}, err
+		}
+
+		tree.Operation = OpUnion
+		for _, subject := range related {
+			child, err := e.relation(ctx, subject.Object, rewrite.TupleToUserset.ComputedUserset, depth+1)
+			if err != nil {
+				return UsersetTree{}, err
+			}
+
+			tree.Children = append(tree.Children, child)
+		}
+	case rewrite.Union != nil || rewrite.Intersection != nil:
+		children := rewrite.Union
+		tree.Operation = OpUnion
+		if rewrite.Intersection != nil {
+			children = rewrite.Intersection
+			tree.Operation = OpIntersection
+		}
+
+		for _, child := range children {
+			subtree, err := e.rewrite(ctx, object, relation, child, depth)
+			if err != nil {
+				return UsersetTree{}, err
+			}
+
+			tree.Children = append(tree.Children, subtree)
+		}
+	default:
+		subjects, err := e.a.tupleStorage.Subjects(ctx, object, relation)
+		if err != nil {
+			return UsersetTree{}, err
+		}
+
+		tree.Operation = OpLeaf
+		tree.Subjects = subjects
+	}
+
+	return tree, nil
+}
+
+// relation expands relation of another object, relations of namespaces
+// not defined make empty leaves
+func (e expander) relation(ctx context.Context, object models.Object, relation string, depth int) (UsersetTree, error) {
+	rewrite, err := e.a.rewrite(object, relation)
+	if err != nil {
+		return UsersetTree{Object: object, Relation: relation, Operation: OpLeaf}, nil
+	}
+
+	return e.expand(ctx, object, relation, rewrite, depth)
+}
@@ -0,0 +1,359 @@
+package authorization
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/logger/handlers/slogdiscard"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStorage struct {
+	mu     sync.Mutex
+	tuples map[models.RelationTuple]bool
+}
+
+func (s *fakeStorage) WriteTuples(_ context.Context, writes []models.RelationTuple, deletes []models.RelationTuple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tuple := range deletes {
+		delete(s.tuples, tuple)
+	}
+
+	for _, tuple := range writes {
+		s.tuples[tuple] = true
+	}
+
+	return nil
+}
+
+func (s *fakeStorage) Subjects(_ context.Context, object models.Object, relation string) ([]models.Subject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var subjects []models.Subject
+	for tuple := range s.tuples {
+		if tuple.Object == object && tuple.Relation == relation {
+			subjects = append(subjects, tuple.Subject)
+		}
+	}
+
+	sort.Slice(subjects, func(i, j int) bool { return subjects[i].String() < subjects[j].String() })
+
+	return subjects, nil
+}
+
+func (s *fakeStorage) ObjectIDs(_ context.Context, namespace string, after string, limit int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := map[string]bool{}
+	var ids []string
+	for tuple := range s.tuples {
+		if tuple.Object.Namespace == namespace && tuple.Object.ID > after && !seen[tuple.Object.ID] {
+			seen[tuple.Object.ID] = true
+			ids = append(ids, tuple.Object.ID)
+		}
+	}
+
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	return ids, nil
+}
+
+// testNamespaces describe documents shared with users and groups, inheriting
+// viewers from their folders. Only viewers who passed the training may comment
+var testNamespaces = map[string]Namespace{
+	"group": {Relations: map[string]Rewrite{
+		"member": {},
+	}},
+	"folder": {Relations: map[string]Rewrite{
+		"parent": {},
+		"viewer": {Union: []Rewrite{
+			{This: true},
+			{TupleToUserset: &TupleToUserset{Tupleset: "parent", ComputedUserset: "viewer"}},
+		}},
+	}},
+	"document": {Relations: map[string]Rewrite{
+		"owner":  {},
+		"parent": {},
+		"editor": {Union: []Rewrite{
+			{This: true},
+			{ComputedUserset: "owner"},
+		}},
+		"viewer": {Union: []Rewrite{
+			{This: true},
+			{ComputedUserset: "editor"},
+			{TupleToUserset: &TupleToUserset{Tupleset: "parent", ComputedUserset: "viewer"}},
+		}},
+		"trained": {},
+		"commenter": {Intersection: []Rewrite{
+			{ComputedUserset: "viewer"},
+			{ComputedUserset: "trained"},
+		}},
+	}},
+}
+
+func newTestAuthorization(t *testing.T, tuples ...string) *Authorization {
+	t.Helper()
+
+	a, err := New(slogdiscard.NewDiscardLogger(), &fakeStorage{tuples: map[models.RelationTuple]bool{}}, testNamespaces)
+	require.NoError(t, err)
+
+	writes := make([]models.RelationTuple, 0, len(tuples))
+	for _, s := range tuples {
+		tuple, err := ParseTuple(s)
+		require.NoError(t, err)
+
+		writes = append(writes, tuple)
+	}
+
+	require.NoError(t, a.WriteTuples(context.Background(), writes, nil))
+
+	return a
+}
+
+func mustSubject(t *testing.T, s string) models.Subject {
+	t.Helper()
+
+	subject, err := ParseSubject(s)
+	require.NoError(t, err)
+
+	return subject
+}
+
+func TestCheck(t *testing.T) {
+	a := newTestAuthorization(t,
+		"document:readme#owner@user:1",
+		"document:readme#viewer@group:eng#member",
+		"document:readme#parent@folder:docs",
+		"document:readme#trained@user:2",
+		"document:readme#trained@user:4",
+		"group:eng#member@user:2",
+		"folder:docs#parent@folder:root",
+		"folder:root#viewer@user:3",
+	)
+
+	readme := models.Object{Namespace: "document", ID: "readme"}
+
+	tests := []struct {
+		name     string
+		relation string
+		subject  string
+		allowed  bool
+	}{
+		{"direct", "owner", "user:1", true},
+		{"computed userset", "editor", "user:1", true},
+		{"nested computed userset", "viewer", "user:1", true},
+		{"userset of tuple", "viewer", "user:2", true},
+		{"userset itself", "viewer", "group:eng#member", true},
+		{"tuple to userset through folders", "viewer", "user:3", true},
+		{"not related", "viewer", "user:4", false},
+		{"no rewrite grants", "editor", "user:2", false},
+		{"intersection", "commenter", "user:2", true},
+		{"intersection without viewer", "commenter", "user:4", false},
+		{"intersection without trained", "commenter", "user:3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, err := a.Check(context.Background(), readme, tt.relation, mustSubject(t, tt.subject))
+			require.NoError(t, err)
+			assert.Equal(t, tt.allowed, allowed)
+		})
+	}
+}
+
+func TestCheck_Cycle(t *testing.T) {
+	a := newTestAuthorization(t,
+		"group:a#member@group:b#member",
+		"group:b#member@group:a#member",
+		"group:b#member@user:1",
+	)
+
+	allowed, err := a.Check(context.Background(), models.Object{Namespace: "group", ID: "a"}, "member", mustSubject(t, "user:1"))
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, err = a.Check(context.Background(), models.Object{Namespace: "group", ID: "a"}, "member", mustSubject(t, "user:2"))
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestCheck_Unknown(t *testing.T) {
+	a := newTestAuthorization(t)
+	ctx := context.Background()
+
+	_, err := a.Check(ctx, models.Object{Namespace: "video", ID: "1"}, "viewer", mustSubject(t, "user:1"))
+	assert.ErrorIs(t, err, ErrUnknownNamespace)
+
+	_, err = a.Check(ctx, models.Object{Namespace: "document", ID: "1"}, "approver", mustSubject(t, "user:1"))
+	assert.ErrorIs(t, err, ErrUnknownRelation)
+
+	err = a.WriteTuples(ctx, []models.RelationTuple{{
+		Object:   models.Object{Namespace: "document", ID: "1"},
+		Relation: "viewer",
+		Subject:  mustSubject(t, "group:eng#admin"),
+	}}, nil)
+	assert.ErrorIs(t, err, ErrUnknownRelation)
+}
+
+func TestExpand(t *testing.T) {
+	a := newTestAuthorization(t,
+		"folder:docs#viewer@user:1",
+		"folder:docs#parent@folder:root",
+		"folder:root#viewer@group:eng#member",
+	)
+
+	tree, err := a.Expand(context.Background(), models.Object{Namespace: "folder", ID: "docs"}, "viewer")
+	require.NoError(t, err)
+
+	docs := models.Object{Namespace: "folder", ID: "docs"}
+	root := models.Object{Namespace: "folder", ID: "root"}
+
+	assert.Equal(t, UsersetTree{
+		Object:    docs,
+		Relation:  "viewer",
+		Operation: OpUnion,
+		Children: []UsersetTree{
+			{Object: docs, Relation: "viewer", Operation: OpLeaf, Subjects: []models.Subject{mustSubject(t, "user:1")}},
+			{Object: docs, Relation: "viewer", Operation: OpUnion, Children: []UsersetTree{{
+				Object:    root,
+				Relation:  "viewer",
+				Operation: OpUnion,
+				Children: []UsersetTree{
+					{
+						Object:    root,
+						Relation:  "viewer",
+						Operation: OpLeaf,
+						Subjects:  []models.Subject{mustSubject(t, "group:eng#member")},
+					},
+					{Object: root, Relation: "viewer", Operation: OpUnion},
+				},
+			}}},
+		},
+	}, tree)
+}
+
+func TestListObjects(t *testing.T) {
+	a := newTestAuthorization(t,
+		"document:a#owner@user:1",
+		"document:b#viewer@user:1",
+		"document:c#parent@folder:docs",
+		"document:d#owner@user:2",
+		"folder:docs#viewer@user:1",
+	)
+
+	objects, next, err := a.ListObjects(context.Background(), "document", "viewer", mustSubject(t, "user:1"), "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, next)
+
+	var ids []string
+	for _, object := range objects {
+		ids = append(ids, object.ID)
+	}
+
+	assert.Equal(t, []string{"a", "b", "c"}, ids)
+
+	objects, _, err = a.ListObjects(context.Background(), "document", "editor", mustSubject(t, "user:1"), "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Object{{Namespace: "document", ID: "a"}}, objects)
+}
+
+func TestListObjects_Pages(t *testing.T) {
+	a := newTestAuthorization(t,
+		"document:a#owner@user:2",
+		"document:b#viewer@user:1",
+		"document:c#owner@user:2",
+		"document:d#owner@user:2",
+		"document:e#viewer@user:1",
+	)
+
+	var (
+		ids   []string
+		pages int
+		after string
+	)
+	for {
+		objects, next, err := a.ListObjects(context.Background(), "document", "viewer", mustSubject(t, "user:1"), after, 2)
+		require.NoError(t, err)
+
+		for _, object := range objects {
+			ids = append(ids, object.ID)
+		}
+
+		pages++
+		if next == "" {
+			break
+		}
+
+		after = next
+	}
+
+	assert.Equal(t, []string{"b", "e"}, ids)
+	assert.Equal(t, 3, pages, "every page checks at most 2 objects")
+}
+
+func TestNew_InvalidNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace Namespace
+	}{
+		{"unknown computed userset", Namespace{Relations: map[string]Rewrite{
+			"viewer": {ComputedUserset: "editor"},
+		}}},
+		{"unknown tupleset", Namespace{Relations: map[string]Rewrite{
+			"viewer": {TupleToUserset: &TupleToUserset{Tupleset: "parent", ComputedUserset: "viewer"}},
+		}}},
+		{"several operations", Namespace{Relations: map[string]Rewrite{
+			"owner":  {},
+			"viewer": {This: true, ComputedUserset: "owner"},
+		}}},
+		{"nested", Namespace{Relations: map[string]Rewrite{
+			"viewer": {Union: []Rewrite{{This: true}, {ComputedUserset: "editor"}}},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(slogdiscard.NewDiscardLogger(), &fakeStorage{}, map[string]Namespace{"document": tt.namespace})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseTuple(t *testing.T) {
+	tuple, err := ParseTuple("document:readme#viewer@group:eng#member")
+	require.NoError(t, err)
+	assert.Equal(t, models.RelationTuple{
+		Object:   models.Object{Namespace: "document", ID: "readme"},
+		Relation: "viewer",
+		Subject: models.Subject{
+			Object:   models.Object{Namespace: "group", ID: "eng"},
+			Relation: "member",
+		},
+	}, tuple)
+	assert.Equal(t, "document:readme#viewer@group:eng#member", tuple.String())
+
+	for _, s := range []string{
+		"",
+		"document:readme#viewer",
+		"document:readme@user:1",
+		"document#viewer@user:1",
+		"document:#viewer@user:1",
+		"Document:readme#viewer@user:1",
+		"document:readme#viewer@user",
+		"document:readme#viewer@user:1#",
+	} {
+		_, err := ParseTuple(s)
+		assert.ErrorIs(t, err, ErrInvalidTuple, s)
+	}
+}
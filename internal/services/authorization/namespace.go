@@ -0,0 +1,91 @@
+package authorization
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Namespace defines relations objects of the namespace may have, keyed by name
+type Namespace struct {
+	Relations map[string]Rewrite
+}
+
+// Rewrite defines the userset of a relation, at most one field is set
+//
+// Zero Rewrite, like This, stands for subjects of tuples with the relation itself.
+// ComputedUserset stands for subjects of another relation of the same object,
+// e.g. every editor is a viewer. TupleToUserset stands for subjects of a relation
+// of objects related to the object, e.g. viewers of the parent folder.
+// Union and Intersection combine usersets of their rewrites
+type Rewrite struct {
+	This            bool
+	ComputedUserset string
+	TupleToUserset  *TupleToUserset
+	Union           []Rewrite
+	Intersection    []Rewrite
+}
+
+// TupleToUserset takes objects having Tupleset relation to the object,
+// e.g. "parent", and stands for their ComputedUserset relation, e.g. "viewer"
+type TupleToUserset struct {
+	Tupleset        string
+	ComputedUserset string
+}
+
+// validateNamespaces checks that every rewrite sets at most one field and refers
+// to relations defined in its namespace
+func validateNamespaces(namespaces map[string]Namespace) error {
+	for name, namespace := range namespaces {
+		for relation, rewrite := range namespace.Relations {
+			if err := validateRewrite(namespace, rewrite); err != nil {
+				return fmt.Errorf("%s#%s: %w", name, relation, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateRewrite(namespace Namespace, rewrite Rewrite) error {
+	set := 0
+	for _, ok := range []bool{
+		rewrite.This,
+		rewrite.ComputedUserset != "",
+		rewrite.TupleToUserset != nil,
+		rewrite.Union != nil,
+		rewrite.Intersection != nil,
+	} {
+		if ok {
+			set++
+		}
+	}
+
+	if set > 1 {
+		return errors.New("rewrite must set at most one of this, computed_userset, " +
+			"tuple_to_userset, union and intersection")
+	}
+
+	switch {
+	case rewrite.ComputedUserset != "":
+		if _, ok := namespace.Relations[rewrite.ComputedUserset]; !ok {
+			return fmt.Errorf("computed userset of unknown relation %q", rewrite.ComputedUserset)
+		}
+	case rewrite.TupleToUserset != nil:
+		// computed userset is a relation of related objects of any namespace,
+		// so only the tupleset is known to be in this one
+		if _, ok := namespace.Relations[rewrite.TupleToUserset.Tupleset]; !ok {
+			return fmt.Errorf("tupleset of unknown relation %q", rewrite.TupleToUserset.Tupleset)
+		}
+		if rewrite.TupleToUserset.ComputedUserset == "" {
+			return errors.New("tuple to userset without computed userset")
+		}
+	case rewrite.Union != nil || rewrite.Intersection != nil:
+		for _, child := range append(rewrite.Union, rewrite.Intersection...) {
+			if err := validateRewrite(namespace, child); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package authorization
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+)
+
+// ParseObject parses object like "document:readme"
+func ParseObject(s string) (models.Object, error) {
+	namespace, id, ok := strings.Cut(s, ":")
+	if !ok || !validName(namespace) || id == "" || strings.ContainsAny(id, "#@") {
+		return models.Object{}, fmt.Errorf("%w: object %q", ErrInvalidTuple, s)
+	}
+
+	return models.Object{Namespace: namespace, ID: id}, nil
+}
+
+// ParseSubject parses subject like "user:42" or userset like "group:eng#member"
+func ParseSubject(s string) (models.Subject, error) {
+	object, relation, hasRelation := strings.Cut(s, "#")
+	if hasRelation && !validName(relation) {
+		return models.Subject{}, fmt.Errorf("%w: subject %q", ErrInvalidTuple, s)
+	}
+
+	o, err := ParseObject(object)
+	if err != nil {
+		return models.Subject{}, fmt.Errorf("%w: subject %q", ErrInvalidTuple, s)
+	}
+
+	return models.Subject{Object: o, Relation: relation}, nil
+}
+
+// ParseTuple parses tuple like "document:readme#viewer@group:eng#member"
+func ParseTuple(s string) (models.RelationTuple, error) {
+	objectRelation, subject, ok := strings.Cut(s, "@")
+	if !ok {
+		return models.RelationTuple{}, fmt.Errorf("%w: tuple %q", ErrInvalidTuple, s)
+	}
+
+	object, relation, ok := strings.Cut(objectRelation, "#")
+	if !ok || !validName(relation) {
+		return models.RelationTuple{}, fmt.Errorf("%w: tuple %q", ErrInvalidTuple, s)
+	}
+
+	o, err := ParseObject(object)
+	if err != nil {
+		return models.RelationTuple{}, err
+	}
+
+	sub, err := ParseSubject(subject)
+	if err != nil {
+		return models.RelationTuple{}, err
+	}
+
+	return models.RelationTuple{Object: o, Relation: relation, Subject: sub}, nil
+}
+
+// validName reports whether s is a valid name of namespace or relation
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
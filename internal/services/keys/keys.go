@@ -0,0 +1,466 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/crypt"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/opaque"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opNew             = "keys.New"
+	opSigningKey      = "keys.SigningKey"
+	opVerificationKey = "keys.VerificationKey"
+	opJWKS            = "keys.JWKS"
+	opCreateKey       = "keys.CreateKey"
+	opActivateKey     = "keys.ActivateKey"
+	opListKeys        = "keys.ListKeys"
+	opDeleteKey       = "keys.DeleteKey"
+	opRotate          = "keys.Rotate"
+)
+
+var (
+	ErrInvalidAppID = errors.New("invalid app id")
+)
+
+// Keys holds asymmetric keys used to sign tokens
+//
+// Keys of an app are kept in storage and rotated: the active key signs new
+// tokens, while retiring keys still verify tokens issued before rotation.
+// Keys loaded from disk are shared by all apps without a key of their own.
+// Private keys are kept in storage encrypted
+type Keys struct {
+	log         *slog.Logger
+	keyStorage  KeyStorage
+	appProvider AppProvider
+	cipher      *crypt.Cipher
+	rotation    Rotation
+
+	static       map[string]jwt.Key
+	staticActive string
+
+	mu     sync.RWMutex
+	parsed map[string]jwt.Key
+}
+
+// Rotation describes how signing keys of apps are rotated
+type Rotation struct {
+	// Algorithm of generated keys
+	Algorithm string
+	// Period is how long a key stays active. Zero disables automatic rotation
+	Period time.Duration
+	// PublishDelay is how long a new key is published in JWKS before it
+	// starts signing tokens, so verifiers can refresh their caches
+	PublishDelay time.Duration
+	// Overlap is how long a retired key still verifies tokens; at least token TTL
+	Overlap time.Duration
+}
+
+type KeyStorage interface {
+	SaveSigningKey(ctx context.Context, key models.SigningKey) error
+	SigningKey(ctx context.Context, keyID string) (key models.SigningKey, err error)
+	ActiveSigningKey(ctx context.Context, appID int) (key models.SigningKey, err error)
+	SigningKeys(ctx context.Context) (keys []models.SigningKey, err error)
+	ActivateSigningKey(ctx context.Context, keyID string, activatedAt time.Time, retiredExpiresAt time.Time) error
+	DeleteSigningKey(ctx context.Context, keyID string) error
+	DeleteExpiredSigningKeys(ctx context.Context, before time.Time) (deleted int64, err error)
+}
+
+type AppProvider interface {
+	App(ctx context.Context, appID int) (app models.App, err error)
+}
+
+// New returns a new instance of the Keys service
+//
+// staticActiveID is id of the key from staticKeys tokens of apps without their own
+// key are signed with. If it's empty, such tokens are signed with app secrets
+func New(
+	log *slog.Logger,
+	keyStorage KeyStorage,
+	appProvider AppProvider,
+	cipher *crypt.Cipher,
+	rotation Rotation,
+	staticKeys []jwt.Key,
+	staticActiveID string,
+) (*Keys, error) {
+	byID := make(map[string]jwt.Key, len(staticKeys))
+	for _, key := range staticKeys {
+		if _, ok := byID[key.ID]; ok {
+			return nil, fmt.Errorf("%s: duplicate key id %q", opNew, key.ID)
+		}
+		byID[key.ID] = key
+	}
+
+	if _, ok := byID[staticActiveID]; staticActiveID != "" && !ok {
+		return nil, fmt.Errorf("%s: active key %q: %w", opNew, staticActiveID, jwt.ErrKeyNotFound)
+	}
+
+	return &Keys{
+		log:          log,
+		keyStorage:   keyStorage,
+		appProvider:  appProvider,
+		cipher:       cipher,
+		rotation:     rotation,
+		static:       byID,
+		staticActive: staticActiveID,
+		parsed:       make(map[string]jwt.Key),
+	}, nil
+}
+
+// SigningKey returns key tokens of the app must be signed with
+//
+// Returns nil if tokens are signed with the app secret
+func (k *Keys) SigningKey(ctx context.Context, appID int) (*jwt.Key, error) {
+	stored, err := k.keyStorage.ActiveSigningKey(ctx, appID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrKeyNotFound) {
+			return nil, fmt.Errorf("%s: %w", opSigningKey, err)
+		}
+
+		if k.staticActive == "" {
+			return nil, nil
+		}
+
+		key := k.static[k.staticActive]
+
+		return &key, nil
+	}
+
+	key, err := k.parse(stored)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opSigningKey, err)
+	}
+
+	return &key, nil
+}
+
+// VerificationKey returns key by id from the kid header of the token issued for the app
+//
+// Pending keys, expired retiring keys and keys of other apps are never returned
+func (k *Keys) VerificationKey(ctx context.Context, appID int, kid string) (jwt.Key, error) {
+	if key, ok := k.static[kid]; ok {
+		return key, nil
+	}
+
+	stored, err := k.keyStorage.SigningKey(ctx, kid)
+	if err != nil {
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return jwt.Key{}, fmt.Errorf("%s: %w", opVerificationKey, jwt.ErrKeyNotFound)
+		}
+
+		return jwt.Key{}, fmt.Errorf("%s: %w", opVerificationKey, err)
+	}
+
+	if stored.AppID != appID || !verifies(stored, time.Now()) {
+		return jwt.Key{}, fmt.Errorf("%s: %w", opVerificationKey, jwt.ErrKeyNotFound)
+	}
+
+	key, err := k.parse(stored)
+	if err != nil {
+		return jwt.Key{}, fmt.Errorf("%s: %w", opVerificationKey, err)
+	}
+
+	return key, nil
+}
+
+// JWKS returns public keys to verify tokens with
+//
+// Pending keys are published too, so verifiers know them before the first token is signed
+func (k *Keys) JWKS(ctx context.Context) ([]jwt.JWK, error) {
+	stored, err := k.keyStorage.SigningKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opJWKS, err)
+	}
+
+	now := time.Now()
+
+	jwks := make([]jwt.JWK, 0, len(k.static)+len(stored))
+	for _, key := range k.static {
+		jwks = append(jwks, key.JWK())
+	}
+
+	for _, s := range stored {
+		if s.State != models.KeyStatePending && !verifies(s, now) {
+			continue
+		}
+
+		key, err := k.parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", opJWKS, err)
+		}
+
+		jwks = append(jwks, key.JWK())
+	}
+
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].KeyID < jwks[j].KeyID })
+
+	return jwks, nil
+}
+
+// CreateKey generates new pending key for the app
+//
+// If algorithm is empty, the one from rotation settings is used
+func (k *Keys) CreateKey(ctx context.Context, appID int, algorithm string) (models.SigningKey, error) {
+	log := k.log.With(
+		slog.String("op", opCreateKey),
+		slog.Int("appID", appID),
+	)
+
+	if _, err := k.appProvider.App(ctx, appID); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found", sl.ErrLog(err))
+
+			return models.SigningKey{}, fmt.Errorf("%s: %w", opCreateKey, ErrInvalidAppID)
+		}
+
+		return models.SigningKey{}, fmt.Errorf("%s: %w", opCreateKey, err)
+	}
+
+	if algorithm == "" {
+		algorithm = k.rotation.Algorithm
+	}
+
+	key, err := k.generate(ctx, appID, algorithm)
+	if err != nil {
+		log.Error("failed to create key", sl.ErrLog(err))
+
+		return models.SigningKey{}, fmt.Errorf("%s: %w", opCreateKey, err)
+	}
+
+	log.Info("signing key created", slog.String("kid", key.ID), slog.String("alg", key.Algorithm))
+
+	return withoutPrivateKey(key), nil
+}
+
+// ActivateKey makes pending key active, current active key of the app becomes retiring
+func (k *Keys) ActivateKey(ctx context.Context, keyID string) error {
+	log := k.log.With(
+		slog.String("op", opActivateKey),
+		slog.String("kid", keyID),
+	)
+
+	now := time.Now()
+
+	if err := k.keyStorage.ActivateSigningKey(ctx, keyID, now, now.Add(k.rotation.Overlap)); err != nil {
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			log.Warn("pending key not found", sl.ErrLog(err))
+
+			return fmt.Errorf("%s: %w", opActivateKey, jwt.ErrKeyNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", opActivateKey, err)
+	}
+
+	log.Info("signing key activated")
+
+	return nil
+}
+
+// ListKeys returns keys of the app without their private parts
+func (k *Keys) ListKeys(ctx context.Context, appID int) ([]models.SigningKey, error) {
+	stored, err := k.keyStorage.SigningKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opListKeys, err)
+	}
+
+	keys := make([]models.SigningKey, 0, len(stored))
+	for _, key := range stored {
+		if key.AppID == appID {
+			keys = append(keys, withoutPrivateKey(key))
+		}
+	}
+
+	return keys, nil
+}
+
+// DeleteKey deletes key immediately, e.g. when it's compromised
+//
+// Tokens signed with the key are no longer valid
+func (k *Keys) DeleteKey(ctx context.Context, keyID string) error {
+	log := k.log.With(
+		slog.String("op", opDeleteKey),
+		slog.String("kid", keyID),
+	)
+
+	if err := k.keyStorage.DeleteSigningKey(ctx, keyID); err != nil {
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			log.Warn("key not found", sl.ErrLog(err))
+
+			return fmt.Errorf("%s: %w", opDeleteKey, jwt.ErrKeyNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", opDeleteKey, err)
+	}
+
+	k.mu.Lock()
+	delete(k.parsed, keyID)
+	k.mu.Unlock()
+
+	log.Warn("signing key deleted")
+
+	return nil
+}
+
+// Rotate rotates keys of apps that have keys in storage
+//
+// Key pending for longer than PublishDelay is activated. When active key is
+// about to outlive Period, its successor is created as pending. Retiring keys
+// past their overlap window are deleted
+func (k *Keys) Rotate(ctx context.Context) error {
+	log := k.log.With(slog.String("op", opRotate))
+
+	stored, err := k.keyStorage.SigningKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opRotate, err)
+	}
+
+	now := time.Now()
+
+	type appKeys struct {
+		active  *models.SigningKey
+		pending *models.SigningKey
+	}
+
+	apps := make(map[int]*appKeys)
+	for i := range stored {
+		key := &stored[i]
+
+		if apps[key.AppID] == nil {
+			apps[key.AppID] = &appKeys{}
+		}
+
+		switch key.State {
+		case models.KeyStateActive:
+			apps[key.AppID].active = key
+		case models.KeyStatePending:
+			// keys are ordered by creation time, so the newest pending key wins
+			apps[key.AppID].pending = key
+		}
+	}
+
+	for appID, keys := range apps {
+		switch {
+		case keys.pending != nil && now.Sub(keys.pending.CreatedAt) >= k.rotation.PublishDelay:
+			if err := k.ActivateKey(ctx, keys.pending.ID); err != nil {
+				return fmt.Errorf("%s: %w", opRotate, err)
+			}
+		case keys.pending == nil && keys.active != nil && k.rotation.Period > 0 &&
+			now.Sub(keys.active.ActivatedAt) >= k.rotation.Period-k.rotation.PublishDelay:
+			key, err := k.generate(ctx, appID, keys.active.Algorithm)
+			if err != nil {
+				return fmt.Errorf("%s: %w", opRotate, err)
+			}
+
+			log.Info("successor key created", slog.Int("appID", appID), slog.String("kid", key.ID))
+		}
+	}
+
+	deleted, err := k.keyStorage.DeleteExpiredSigningKeys(ctx, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opRotate, err)
+	}
+
+	if deleted > 0 {
+		log.Info("expired keys deleted", slog.Int64("deleted", deleted))
+	}
+
+	return nil
+}
+
+// generate generates and saves new pending key
+func (k *Keys) generate(ctx context.Context, appID int, algorithm string) (models.SigningKey, error) {
+	kid, err := opaque.NewID()
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	key, err := jwt.GenerateKey(kid, algorithm)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	private, err := jwt.MarshalPrivateKey(key)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	private, err = k.cipher.Encrypt(private, keyAdditionalData(kid))
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	stored := models.SigningKey{
+		ID:         kid,
+		AppID:      appID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: private,
+		State:      models.KeyStatePending,
+		CreatedAt:  time.Now(),
+	}
+
+	if err = k.keyStorage.SaveSigningKey(ctx, stored); err != nil {
+		return models.SigningKey{}, err
+	}
+
+	return stored, nil
+}
+
+// parse decrypts and parses stored private key, parsed keys are cached by id
+func (k *Keys) parse(stored models.SigningKey) (jwt.Key, error) {
+	k.mu.RLock()
+	key, ok := k.parsed[stored.ID]
+	k.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+
+	private, err := k.cipher.Decrypt(stored.PrivateKey, keyAdditionalData(stored.ID))
+	if err != nil {
+		return jwt.Key{}, err
+	}
+
+	key, err = jwt.ParseKey(stored.ID, private)
+	if err != nil {
+		return jwt.Key{}, err
+	}
+
+	k.mu.Lock()
+	k.parsed[stored.ID] = key
+	k.mu.Unlock()
+
+	return key, nil
+}
+
+// verifies reports whether key may verify tokens at the given moment
+func verifies(key models.SigningKey, now time.Time) bool {
+	switch key.State {
+	case models.KeyStateActive:
+		return true
+	case models.KeyStateRetiring:
+		return now.Before(key.ExpiresAt)
+	default:
+		return false
+	}
+}
+
+// keyAdditionalData binds encrypted private key to its id
+func keyAdditionalData(keyID string) []byte {
+	return []byte("signing-key:" + keyID)
+}
+
+func withoutPrivateKey(key models.SigningKey) models.SigningKey {
+	key.PrivateKey = nil
+
+	return key
+}
@@ -0,0 +1,240 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/crypt"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	"github.com/nhassl3/sso/internal/lib/logger/handlers/slogdiscard"
+	"github.com/nhassl3/sso/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStorage struct {
+	mu   sync.Mutex
+	keys map[string]models.SigningKey
+}
+
+func (s *fakeStorage) SaveSigningKey(_ context.Context, key models.SigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.ID] = key
+
+	return nil
+}
+
+func (s *fakeStorage) SigningKey(_ context.Context, keyID string) (models.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[keyID]
+	if !ok {
+		return models.SigningKey{}, storage.ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+func (s *fakeStorage) ActiveSigningKey(_ context.Context, appID int) (models.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.keys {
+		if key.AppID == appID && key.State == models.KeyStateActive {
+			return key, nil
+		}
+	}
+
+	return models.SigningKey{}, storage.ErrKeyNotFound
+}
+
+func (s *fakeStorage) SigningKeys(_ context.Context) ([]models.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]models.SigningKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+
+	return keys, nil
+}
+
+func (s *fakeStorage) ActivateSigningKey(_ context.Context, keyID string, activatedAt, retiredExpiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[keyID]
+	if !ok || key.State != models.KeyStatePending {
+		return storage.ErrKeyNotFound
+	}
+
+	for id, other := range s.keys {
+		if other.AppID == key.AppID && other.State == models.KeyStateActive {
+			other.State = models.KeyStateRetiring
+			other.ExpiresAt = retiredExpiresAt
+			s.keys[id] = other
+		}
+	}
+
+	key.State = models.KeyStateActive
+	key.ActivatedAt = activatedAt
+	s.keys[keyID] = key
+
+	return nil
+}
+
+func (s *fakeStorage) DeleteSigningKey(_ context.Context, keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[keyID]; !ok {
+		return storage.ErrKeyNotFound
+	}
+
+	delete(s.keys, keyID)
+
+	return nil
+}
+
+func (s *fakeStorage) DeleteExpiredSigningKeys(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, key := range s.keys {
+		if key.State == models.KeyStateRetiring && key.ExpiresAt.Before(before) {
+			delete(s.keys, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// shift moves all timestamps of stored keys back in time
+func (s *fakeStorage) shift(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, key := range s.keys {
+		key.CreatedAt = key.CreatedAt.Add(-d)
+		if !key.ActivatedAt.IsZero() {
+			key.ActivatedAt = key.ActivatedAt.Add(-d)
+		}
+		if !key.ExpiresAt.IsZero() {
+			key.ExpiresAt = key.ExpiresAt.Add(-d)
+		}
+		s.keys[id] = key
+	}
+}
+
+type fakeApps struct{}
+
+func (fakeApps) App(_ context.Context, appID int) (models.App, error) {
+	if appID != 1 {
+		return models.App{}, storage.ErrAppNotFound
+	}
+
+	return models.App{ID: 1, Name: "test", Secret: "secret"}, nil
+}
+
+func newTestCipher(t *testing.T) *crypt.Cipher {
+	t.Helper()
+
+	cipher, err := crypt.New(bytes.Repeat([]byte{1}, crypt.KeySize))
+	require.NoError(t, err)
+
+	return cipher
+}
+
+func TestRotate(t *testing.T) {
+	st := &fakeStorage{keys: map[string]models.SigningKey{}}
+	rotation := Rotation{
+		Algorithm:    jwt.AlgEdDSA,
+		Period:       30 * 24 * time.Hour,
+		PublishDelay: 24 * time.Hour,
+		Overlap:      time.Hour,
+	}
+
+	k, err := New(slogdiscard.NewDiscardLogger(), st, fakeApps{}, newTestCipher(t), rotation, nil, "")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	_, err = k.CreateKey(ctx, 404, "")
+	assert.ErrorIs(t, err, ErrInvalidAppID)
+
+	first, err := k.CreateKey(ctx, 1, "")
+	require.NoError(t, err)
+	assert.Equal(t, models.KeyStatePending, first.State)
+	assert.Empty(t, first.PrivateKey)
+	assert.NotContains(t, string(st.keys[first.ID].PrivateKey), "PRIVATE KEY", "private key is stored encrypted")
+
+	// pending key is published, but doesn't sign or verify tokens yet
+	jwks, err := k.JWKS(ctx)
+	require.NoError(t, err)
+	assert.Len(t, jwks, 1)
+
+	key, err := k.SigningKey(ctx, 1)
+	require.NoError(t, err)
+	assert.Nil(t, key)
+
+	_, err = k.VerificationKey(ctx, 1, first.ID)
+	assert.ErrorIs(t, err, jwt.ErrKeyNotFound)
+
+	// publish delay is over: the key is promoted
+	st.shift(rotation.PublishDelay)
+	require.NoError(t, k.Rotate(ctx))
+
+	key, err = k.SigningKey(ctx, 1)
+	require.NoError(t, err)
+	require.NotNil(t, key)
+	assert.Equal(t, first.ID, key.ID)
+
+	_, err = k.VerificationKey(ctx, 2, first.ID)
+	assert.ErrorIs(t, err, jwt.ErrKeyNotFound, "key of another app")
+
+	// active key is about to outlive its period: successor is created
+	st.shift(rotation.Period - rotation.PublishDelay)
+	require.NoError(t, k.Rotate(ctx))
+
+	list, err := k.ListKeys(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	second := list[1]
+	assert.Equal(t, models.KeyStatePending, second.State)
+
+	// successor is promoted, previous key still verifies tokens
+	st.shift(rotation.PublishDelay)
+	require.NoError(t, k.Rotate(ctx))
+
+	key, err = k.SigningKey(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, key.ID)
+
+	_, err = k.VerificationKey(ctx, 1, first.ID)
+	assert.NoError(t, err)
+
+	// overlap window is over: retired key is gone
+	st.shift(rotation.Overlap + time.Second)
+
+	_, err = k.VerificationKey(ctx, 1, first.ID)
+	assert.ErrorIs(t, err, jwt.ErrKeyNotFound)
+
+	require.NoError(t, k.Rotate(ctx))
+
+	list, err = k.ListKeys(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+}
@@ -0,0 +1,288 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/opaque"
+	"github.com/nhassl3/sso/internal/services/auth"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	// userCodeAlphabet has no vowels to avoid words and no look-alike characters (RFC 8628, section 6.1)
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+
+	// slowDownStep is added to polling interval each time device polls too fast (RFC 8628, section 3.5)
+	slowDownStep = 5 * time.Second
+)
+
+// DeviceFlow configures OAuth 2.0 device authorization grant
+//
+// VerificationURI is the page where logged-in user enters the user code
+type DeviceFlow struct {
+	CodeTTL         time.Duration
+	Interval        time.Duration
+	VerificationURI string
+}
+
+// DeviceAuthorization is a response of the device authorization endpoint
+type DeviceAuthorization struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+}
+
+// DeviceAuthorization issues device code to the client and user code to be entered by the user
+//
+// clientSecret is optional, since device clients are usually public
+func (o *OAuth) DeviceAuthorization(
+	ctx context.Context,
+	appID int,
+	clientSecret string,
+	scope string,
+) (DeviceAuthorization, error) {
+	log := o.log.With(
+		slog.String("op", opDeviceAuth),
+		slog.Int("appID", appID),
+	)
+
+	if _, err := o.authenticateClient(ctx, appID, clientSecret); err != nil {
+		log.Warn("client authentication failed", sl.ErrLog(err))
+
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", opDeviceAuth, err)
+	}
+
+	deviceCode, hash, err := opaque.NewToken()
+	if err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", opDeviceAuth, err)
+	}
+
+	userCode, err := newUserCode()
+	if err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", opDeviceAuth, err)
+	}
+
+	if err = o.codeStorage.SaveDeviceCode(ctx, models.DeviceCode{
+		DeviceCodeHash: hash,
+		UserCode:       userCode,
+		AppID:          appID,
+		Scope:          scope,
+		PollInterval:   o.deviceFlow.Interval,
+		ExpiresAt:      time.Now().Add(o.deviceFlow.CodeTTL),
+	}); err != nil {
+		log.Error("failed to save device code", sl.ErrLog(err))
+
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", opDeviceAuth, err)
+	}
+
+	display := formatUserCode(userCode)
+
+	log.Info("device code issued")
+
+	return DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                display,
+		VerificationURI:         o.deviceFlow.VerificationURI,
+		VerificationURIComplete: o.deviceFlow.VerificationURI + "?user_code=" + url.QueryEscape(display),
+		ExpiresIn:               o.deviceFlow.CodeTTL,
+		Interval:                o.deviceFlow.Interval,
+	}, nil
+}
+
+// VerifyDevice lets the user holding accessToken approve or deny the device
+// that showed them the user code
+//
+// Returns ErrAccessDenied if access token isn't an active token of a user
+// and ErrInvalidUserCode if there is no pending device with given code
+func (o *OAuth) VerifyDevice(ctx context.Context, accessToken string, userCode string, approve bool) error {
+	log := o.log.With(slog.String("op", opVerifyDevice))
+
+	claims, active, err := o.auth.Introspect(ctx, accessToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opVerifyDevice, err)
+	}
+
+	// app tokens have no user to approve anything
+	if !active || claims.UserID == 0 {
+		return fmt.Errorf("%s: %w", opVerifyDevice, ErrAccessDenied)
+	}
+
+	log = log.With(slog.Int64("userID", claims.UserID))
+
+	userCode = normalizeUserCode(userCode)
+
+	code, err := o.codeStorage.DeviceCodeByUserCode(ctx, userCode)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			log.Warn("user code not found")
+
+			return fmt.Errorf("%s: %w", opVerifyDevice, ErrInvalidUserCode)
+		}
+
+		return fmt.Errorf("%s: %w", opVerifyDevice, err)
+	}
+
+	if code.Status != models.DeviceCodePending || time.Now().After(code.ExpiresAt) {
+		log.Warn("user code is not pending", slog.String("status", code.Status))
+
+		return fmt.Errorf("%s: %w", opVerifyDevice, ErrInvalidUserCode)
+	}
+
+	if approve {
+		err = o.codeStorage.ApproveDeviceCode(ctx, userCode, claims.UserID, time.Now())
+	} else {
+		err = o.codeStorage.DenyDeviceCode(ctx, userCode)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotPending) {
+			return fmt.Errorf("%s: %w", opVerifyDevice, ErrInvalidUserCode)
+		}
+
+		log.Error("failed to update device code", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opVerifyDevice, err)
+	}
+
+	log.Info("device verified", slog.Int("appID", code.AppID), slog.Bool("approved", approve))
+
+	return nil
+}
+
+// PollDeviceCode exchanges device code for tokens once the user has approved it
+//
+// Until then it returns ErrAuthorizationPending, or ErrSlowDown if the client
+// polls more often than the interval, which increases the interval
+func (o *OAuth) PollDeviceCode(
+	ctx context.Context,
+	appID int,
+	clientSecret string,
+	deviceCode string,
+) (models.Tokens, string, error) {
+	log := o.log.With(
+		slog.String("op", opPollDevice),
+		slog.Int("appID", appID),
+	)
+
+	if _, err := o.authenticateClient(ctx, appID, clientSecret); err != nil {
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, err)
+	}
+
+	hash := opaque.Hash(deviceCode)
+
+	code, err := o.codeStorage.DeviceCode(ctx, hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, ErrInvalidGrant)
+		}
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, err)
+	}
+
+	if code.AppID != appID {
+		log.Warn("device code issued to another client")
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, ErrInvalidGrant)
+	}
+
+	now := time.Now()
+
+	if now.After(code.ExpiresAt) {
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, ErrExpiredToken)
+	}
+
+	switch code.Status {
+	case models.DeviceCodeDenied:
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, ErrAccessDenied)
+	case models.DeviceCodeRedeemed:
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, ErrInvalidGrant)
+	case models.DeviceCodePending:
+		interval := code.PollInterval
+		if now.Sub(code.LastPolledAt) < interval {
+			interval += slowDownStep
+		}
+
+		if err = o.codeStorage.UpdateDeviceCodePoll(ctx, hash, now, interval); err != nil {
+			return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, err)
+		}
+
+		if interval != code.PollInterval {
+			return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, ErrSlowDown)
+		}
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, ErrAuthorizationPending)
+	}
+
+	if err = o.codeStorage.RedeemDeviceCode(ctx, hash); err != nil {
+		if errors.Is(err, storage.ErrCodeAlreadyUsed) {
+			return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, ErrInvalidGrant)
+		}
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, err)
+	}
+
+	tokens, err := o.auth.IssueTokens(ctx, code.UserID, code.AppID, "", code.AuthTime)
+	if err != nil {
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, ErrAccessDenied)
+		}
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opPollDevice, err)
+	}
+
+	if !HasScope(code.Scope, ScopeOpenID) {
+		tokens.IDToken = ""
+	}
+
+	log.Info("device code exchanged", slog.Int64("userID", code.UserID))
+
+	return tokens, code.Scope, nil
+}
+
+// newUserCode generates random user code from userCodeAlphabet
+func newUserCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(userCodeAlphabet)))
+
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// formatUserCode splits user code in halves for readability, e.g. WDJB-MJHT
+func formatUserCode(code string) string {
+	return code[:len(code)/2] + "-" + code[len(code)/2:]
+}
+
+// normalizeUserCode makes user input comparable with stored code:
+// the code is case-insensitive and punctuation is ignored
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			return r
+		}
+		return -1
+	}, code)
+}
@@ -0,0 +1,458 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/lib/opaque"
+	"github.com/nhassl3/sso/internal/services/auth"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opValidate     = "oauth.ValidateAuthorizationRequest"
+	opAuthorize    = "oauth.Authorize"
+	opExchangeCode = "oauth.ExchangeCode"
+	opRefresh      = "oauth.Refresh"
+	opPruneCodes   = "oauth.PruneExpiredCodes"
+	opClientCreds  = "oauth.ClientCredentials"
+	opDeviceAuth   = "oauth.DeviceAuthorization"
+	opVerifyDevice = "oauth.VerifyDevice"
+	opPollDevice   = "oauth.PollDeviceCode"
+)
+
+const (
+	ResponseTypeCode    = "code"
+	ChallengeMethodS256 = "S256"
+	ScopeOpenID         = "openid"
+
+	minVerifierLength = 43
+	maxVerifierLength = 128
+)
+
+var (
+	// ErrInvalidClient means that client (app) is unknown or its authentication failed
+	ErrInvalidClient = errors.New("invalid client")
+	// ErrInvalidRedirectURI means that redirect URI isn't registered for the client
+	ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+	// ErrInvalidRequest means that request misses required parameter or has an unsupported one
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrInvalidGrant means that code or refresh token is invalid, expired, already used,
+	// issued to another client or PKCE verification failed
+	ErrInvalidGrant = errors.New("invalid grant")
+	// ErrAccessDenied means that user failed to authenticate or denied the request
+	ErrAccessDenied = errors.New("access denied")
+	// ErrMFARequired means that user has MFA enabled, but hasn't given one-time code
+	ErrMFARequired = errors.New("mfa required")
+	// ErrEmailNotVerified means that the client requires verified email and user hasn't verified it
+	ErrEmailNotVerified = errors.New("email not verified")
+	// ErrLoginThrottled means that login is rejected after too many failures of the email or client
+	ErrLoginThrottled = errors.New("login throttled")
+	// ErrInvalidScope means that requested scope isn't allowed for the client
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrInvalidUserCode means that there is no pending device with given user code
+	ErrInvalidUserCode = errors.New("invalid user code")
+	// ErrAuthorizationPending means that user hasn't approved the device yet
+	ErrAuthorizationPending = errors.New("authorization pending")
+	// ErrSlowDown means that device polls too often and must increase the interval
+	ErrSlowDown = errors.New("slow down")
+	// ErrExpiredToken means that device code has expired
+	ErrExpiredToken = errors.New("expired token")
+)
+
+// AuthorizationRequest is a request of the client to the authorization endpoint
+type AuthorizationRequest struct {
+	ResponseType        string
+	AppID               int
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// OAuth implements OAuth 2.0 grants on top of the Auth service
+type OAuth struct {
+	log         *slog.Logger
+	auth        Authenticator
+	appProvider AppProvider
+	codeStorage CodeStorage
+	codeTTL     time.Duration
+	appTokenTTL time.Duration
+	appScopes   map[int][]string
+	deviceFlow  DeviceFlow
+}
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, email string, password string) (user models.User, err error)
+	IssueTokens(ctx context.Context, userID int64, appID int, nonce string, authTime time.Time) (tokens models.Tokens, err error)
+	IssueAppToken(ctx context.Context, app models.App, scope string, ttl time.Duration) (token string, err error)
+	RefreshApp(ctx context.Context, appID int, refreshToken string) (tokens models.Tokens, err error)
+	RevokeAllSessions(ctx context.Context, userID int64) error
+	VerifyLoginMFACode(ctx context.Context, userID int64, code string) error
+	Introspect(ctx context.Context, token string) (claims jwt.Claims, active bool, err error)
+}
+
+type AppProvider interface {
+	App(ctx context.Context, appID int) (app models.App, err error)
+}
+
+type CodeStorage interface {
+	RedirectURIs(ctx context.Context, appID int) (uris []string, err error)
+	SaveAuthorizationCode(ctx context.Context, code models.AuthorizationCode) error
+	AuthorizationCode(ctx context.Context, codeHash string) (code models.AuthorizationCode, err error)
+	RedeemAuthorizationCode(ctx context.Context, codeHash string) error
+	DeleteExpiredAuthorizationCodes(ctx context.Context, before time.Time) (deleted int64, err error)
+	SaveDeviceCode(ctx context.Context, code models.DeviceCode) error
+	DeviceCode(ctx context.Context, deviceCodeHash string) (code models.DeviceCode, err error)
+	DeviceCodeByUserCode(ctx context.Context, userCode string) (code models.DeviceCode, err error)
+	ApproveDeviceCode(ctx context.Context, userCode string, userID int64, authTime time.Time) error
+	DenyDeviceCode(ctx context.Context, userCode string) error
+	UpdateDeviceCodePoll(ctx context.Context, deviceCodeHash string, polledAt time.Time, interval time.Duration) error
+	RedeemDeviceCode(ctx context.Context, deviceCodeHash string) error
+	DeleteExpiredDeviceCodes(ctx context.Context, before time.Time) (deleted int64, err error)
+}
+
+// New returns a new instance of the OAuth service
+//
+// appScopes lists scopes each app may request through client credentials grant
+func New(
+	log *slog.Logger,
+	auth Authenticator,
+	appProvider AppProvider,
+	codeStorage CodeStorage,
+	codeTTL time.Duration,
+	appTokenTTL time.Duration,
+	appScopes map[int][]string,
+	deviceFlow DeviceFlow,
+) *OAuth {
+	return &OAuth{
+		log:         log,
+		auth:        auth,
+		appProvider: appProvider,
+		codeStorage: codeStorage,
+		codeTTL:     codeTTL,
+		appTokenTTL: appTokenTTL,
+		appScopes:   appScopes,
+		deviceFlow:  deviceFlow,
+	}
+}
+
+// ValidateAuthorizationRequest checks authorization request before user is asked to log in
+//
+// ErrInvalidClient and ErrInvalidRedirectURI must be shown to the user: redirecting
+// to unverified URI would make the service an open redirector. ErrInvalidRequest is
+// returned only after the redirect URI is verified, so it may be sent to the client.
+// Other errors may occur before the URI is verified and must be shown to the user too
+func (o *OAuth) ValidateAuthorizationRequest(ctx context.Context, req AuthorizationRequest) error {
+	log := o.log.With(
+		slog.String("op", opValidate),
+		slog.Int("appID", req.AppID),
+	)
+
+	if _, err := o.appProvider.App(ctx, req.AppID); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found", sl.ErrLog(err))
+
+			return fmt.Errorf("%s: %w", opValidate, ErrInvalidClient)
+		}
+
+		return fmt.Errorf("%s: %w", opValidate, err)
+	}
+
+	uris, err := o.codeStorage.RedirectURIs(ctx, req.AppID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opValidate, err)
+	}
+
+	// exact match only, as recommended by OAuth 2.0 Security BCP
+	if !slices.Contains(uris, req.RedirectURI) {
+		log.Warn("redirect uri is not registered", slog.String("redirect_uri", req.RedirectURI))
+
+		return fmt.Errorf("%s: %w", opValidate, ErrInvalidRedirectURI)
+	}
+
+	if req.ResponseType != ResponseTypeCode {
+		return fmt.Errorf("%s: %w: unsupported response_type", opValidate, ErrInvalidRequest)
+	}
+
+	// PKCE is required for every client, not only for public ones
+	if req.CodeChallengeMethod != ChallengeMethodS256 {
+		return fmt.Errorf("%s: %w: code_challenge_method must be S256", opValidate, ErrInvalidRequest)
+	}
+
+	if req.CodeChallenge == "" {
+		return fmt.Errorf("%s: %w: code_challenge is required", opValidate, ErrInvalidRequest)
+	}
+
+	return nil
+}
+
+// Authorize authenticates user and returns one-time authorization code for the client
+//
+// otp is required only from users with MFA enabled, it may be a recovery code as well
+func (o *OAuth) Authorize(
+	ctx context.Context,
+	req AuthorizationRequest,
+	email string,
+	password string,
+	otp string,
+) (string, error) {
+	log := o.log.With(
+		slog.String("op", opAuthorize),
+		slog.Int("appID", req.AppID),
+	)
+
+	if err := o.ValidateAuthorizationRequest(ctx, req); err != nil {
+		return "", fmt.Errorf("%s: %w", opAuthorize, err)
+	}
+
+	user, err := o.auth.Authenticate(ctx, email, password)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return "", fmt.Errorf("%s: %w", opAuthorize, ErrAccessDenied)
+		}
+		if errors.Is(err, auth.ErrTooManyAttempts) || errors.Is(err, auth.ErrAccountLocked) {
+			return "", fmt.Errorf("%s: %w", opAuthorize, ErrLoginThrottled)
+		}
+
+		return "", fmt.Errorf("%s: %w", opAuthorize, err)
+	}
+
+	if user.MFAEnabled {
+		if otp == "" {
+			return "", fmt.Errorf("%s: %w", opAuthorize, ErrMFARequired)
+		}
+
+		if err = o.auth.VerifyLoginMFACode(ctx, user.ID, otp); err != nil {
+			// users with passkeys only can't use codes, but recovery ones
+			if errors.Is(err, auth.ErrInvalidMFACode) || errors.Is(err, auth.ErrMFANotEnrolled) {
+				log.Warn("invalid mfa code", slog.Int64("userID", user.ID))
+
+				return "", fmt.Errorf("%s: %w", opAuthorize, ErrAccessDenied)
+			}
+			if errors.Is(err, auth.ErrTooManyAttempts) || errors.Is(err, auth.ErrAccountLocked) {
+				return "", fmt.Errorf("%s: %w", opAuthorize, ErrLoginThrottled)
+			}
+
+			return "", fmt.Errorf("%s: %w", opAuthorize, err)
+		}
+	}
+
+	app, err := o.appProvider.App(ctx, req.AppID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", opAuthorize, err)
+	}
+
+	if app.RequireVerifiedEmail && !user.EmailVerified {
+		log.Warn("email not verified", slog.Int64("userID", user.ID))
+
+		return "", fmt.Errorf("%s: %w", opAuthorize, ErrEmailNotVerified)
+	}
+
+	code, hash, err := opaque.NewToken()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", opAuthorize, err)
+	}
+
+	now := time.Now()
+
+	if err = o.codeStorage.SaveAuthorizationCode(ctx, models.AuthorizationCode{
+		CodeHash:      hash,
+		AppID:         req.AppID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(o.codeTTL),
+	}); err != nil {
+		log.Error("failed to save authorization code", sl.ErrLog(err))
+
+		return "", fmt.Errorf("%s: %w", opAuthorize, err)
+	}
+
+	log.Info("authorization code issued", slog.Int64("userID", user.ID))
+
+	return code, nil
+}
+
+// ExchangeCode exchanges authorization code for tokens
+//
+// clientSecret is optional: public clients are authenticated by PKCE alone.
+// Returns granted scope along with tokens. If used code is presented again,
+// all sessions of its user are revoked, since the code was evidently stolen
+func (o *OAuth) ExchangeCode(
+	ctx context.Context,
+	appID int,
+	clientSecret string,
+	code string,
+	redirectURI string,
+	codeVerifier string,
+) (models.Tokens, string, error) {
+	log := o.log.With(
+		slog.String("op", opExchangeCode),
+		slog.Int("appID", appID),
+	)
+
+	if _, err := o.authenticateClient(ctx, appID, clientSecret); err != nil {
+		log.Warn("client authentication failed", sl.ErrLog(err))
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opExchangeCode, err)
+	}
+
+	hash := opaque.Hash(code)
+
+	stored, err := o.codeStorage.AuthorizationCode(ctx, hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrCodeNotFound) {
+			log.Warn("authorization code not found")
+
+			return models.Tokens{}, "", fmt.Errorf("%s: %w", opExchangeCode, ErrInvalidGrant)
+		}
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opExchangeCode, err)
+	}
+
+	log = log.With(slog.Int64("userID", stored.UserID))
+
+	switch {
+	case stored.AppID != appID:
+		log.Warn("authorization code issued to another client")
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opExchangeCode, ErrInvalidGrant)
+	case stored.RedirectURI != redirectURI:
+		log.Warn("redirect uri mismatch")
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opExchangeCode, ErrInvalidGrant)
+	case time.Now().After(stored.ExpiresAt):
+		log.Warn("authorization code expired")
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opExchangeCode, ErrInvalidGrant)
+	case !VerifyCodeChallenge(stored.CodeChallenge, codeVerifier):
+		log.Warn("PKCE verification failed")
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opExchangeCode, ErrInvalidGrant)
+	}
+
+	if err = o.codeStorage.RedeemAuthorizationCode(ctx, hash); err != nil {
+		if errors.Is(err, storage.ErrCodeAlreadyUsed) {
+			log.Warn("authorization code reuse detected, revoking sessions")
+
+			if err := o.auth.RevokeAllSessions(ctx, stored.UserID); err != nil {
+				log.Error("failed to revoke sessions", sl.ErrLog(err))
+			}
+
+			return models.Tokens{}, "", fmt.Errorf("%s: %w", opExchangeCode, ErrInvalidGrant)
+		}
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opExchangeCode, err)
+	}
+
+	tokens, err := o.auth.IssueTokens(ctx, stored.UserID, stored.AppID, stored.Nonce, stored.AuthTime)
+	if err != nil {
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			return models.Tokens{}, "", fmt.Errorf("%s: %w", opExchangeCode, ErrInvalidGrant)
+		}
+
+		return models.Tokens{}, "", fmt.Errorf("%s: %w", opExchangeCode, err)
+	}
+
+	if !HasScope(stored.Scope, ScopeOpenID) {
+		tokens.IDToken = ""
+	}
+
+	log.Info("authorization code exchanged")
+
+	return tokens, stored.Scope, nil
+}
+
+// Refresh exchanges refresh token for new tokens on behalf of the client
+func (o *OAuth) Refresh(ctx context.Context, appID int, clientSecret string, refreshToken string) (models.Tokens, error) {
+	if _, err := o.authenticateClient(ctx, appID, clientSecret); err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, err)
+	}
+
+	tokens, err := o.auth.RefreshApp(ctx, appID, refreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefresh) || errors.Is(err, auth.ErrRefreshReused) {
+			return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, ErrInvalidGrant)
+		}
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", opRefresh, err)
+	}
+
+	return tokens, nil
+}
+
+// PruneExpiredCodes removes expired authorization and device codes
+func (o *OAuth) PruneExpiredCodes(ctx context.Context) error {
+	now := time.Now()
+
+	deleted, err := o.codeStorage.DeleteExpiredAuthorizationCodes(ctx, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opPruneCodes, err)
+	}
+
+	deletedDevice, err := o.codeStorage.DeleteExpiredDeviceCodes(ctx, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opPruneCodes, err)
+	}
+
+	o.log.Debug(
+		"expired codes pruned",
+		slog.String("op", opPruneCodes),
+		slog.Int64("authorization_codes", deleted),
+		slog.Int64("device_codes", deletedDevice),
+	)
+
+	return nil
+}
+
+// authenticateClient checks that client exists and, if secret is given, that it's correct
+func (o *OAuth) authenticateClient(ctx context.Context, appID int, clientSecret string) (models.App, error) {
+	app, err := o.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, ErrInvalidClient
+		}
+
+		return models.App{}, err
+	}
+
+	if clientSecret != "" && subtle.ConstantTimeCompare([]byte(clientSecret), []byte(app.Secret)) != 1 {
+		return models.App{}, ErrInvalidClient
+	}
+
+	return app, nil
+}
+
+// VerifyCodeChallenge checks PKCE code verifier against S256 code challenge (RFC 7636)
+func VerifyCodeChallenge(challenge string, verifier string) bool {
+	if len(verifier) < minVerifierLength || len(verifier) > maxVerifierLength {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// HasScope reports whether space-delimited scope list contains given scope
+func HasScope(scopes string, scope string) bool {
+	return slices.Contains(strings.Fields(scopes), scope)
+}
@@ -0,0 +1,510 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/jwt"
+	"github.com/nhassl3/sso/internal/lib/logger/handlers/slogdiscard"
+	"github.com/nhassl3/sso/internal/lib/opaque"
+	"github.com/nhassl3/sso/internal/services/auth"
+	"github.com/nhassl3/sso/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAuth struct {
+	revoked []int64
+}
+
+func (a *fakeAuth) Authenticate(_ context.Context, email string, password string) (models.User, error) {
+	if password != "password" {
+		return models.User{}, auth.ErrInvalidCredentials
+	}
+
+	switch email {
+	case "user@example.com":
+		return models.User{ID: 1, Email: email}, nil
+	case "mfa@example.com":
+		return models.User{ID: 2, Email: email, MFAEnabled: true}, nil
+	case "verified@example.com":
+		return models.User{ID: 3, Email: email, EmailVerified: true}, nil
+	}
+
+	return models.User{}, auth.ErrInvalidCredentials
+}
+
+func (a *fakeAuth) IssueTokens(_ context.Context, userID int64, appID int, nonce string, _ time.Time) (models.Tokens, error) {
+	return models.Tokens{AccessToken: "access", RefreshToken: "refresh", IDToken: "id:" + nonce}, nil
+}
+
+func (a *fakeAuth) IssueAppToken(_ context.Context, app models.App, scope string, _ time.Duration) (string, error) {
+	return "app:" + scope, nil
+}
+
+func (a *fakeAuth) RefreshApp(_ context.Context, appID int, refreshToken string) (models.Tokens, error) {
+	if appID != 1 || refreshToken != "refresh" {
+		return models.Tokens{}, auth.ErrInvalidRefresh
+	}
+
+	return models.Tokens{AccessToken: "access", RefreshToken: "refresh-2"}, nil
+}
+
+func (a *fakeAuth) RevokeAllSessions(_ context.Context, userID int64) error {
+	a.revoked = append(a.revoked, userID)
+
+	return nil
+}
+
+func (a *fakeAuth) VerifyLoginMFACode(_ context.Context, userID int64, code string) error {
+	if code != "123456" {
+		return auth.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+func (a *fakeAuth) Introspect(_ context.Context, token string) (jwt.Claims, bool, error) {
+	switch token {
+	case "user-token":
+		return jwt.Claims{UserID: 1}, true, nil
+	case "app-token":
+		return jwt.Claims{AppID: 1}, true, nil
+	}
+
+	return jwt.Claims{}, false, nil
+}
+
+type fakeStorage struct {
+	mu          sync.Mutex
+	codes       map[string]models.AuthorizationCode
+	deviceCodes map[string]models.DeviceCode
+
+	requireVerifiedEmail bool
+}
+
+func (s *fakeStorage) App(_ context.Context, appID int) (models.App, error) {
+	if appID == 3 {
+		return models.App{ID: 3, Name: "other", Secret: "other-secret"}, nil
+	}
+
+	if appID != 1 {
+		return models.App{}, storage.ErrAppNotFound
+	}
+
+	return models.App{ID: 1, Name: "test", Secret: "secret", RequireVerifiedEmail: s.requireVerifiedEmail}, nil
+}
+
+func (s *fakeStorage) RedirectURIs(_ context.Context, appID int) ([]string, error) {
+	if appID != 1 {
+		return nil, nil
+	}
+
+	return []string{"https://client.example.com/cb"}, nil
+}
+
+func (s *fakeStorage) SaveAuthorizationCode(_ context.Context, code models.AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.codes[code.CodeHash] = code
+
+	return nil
+}
+
+func (s *fakeStorage) AuthorizationCode(_ context.Context, codeHash string) (models.AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[codeHash]
+	if !ok {
+		return models.AuthorizationCode{}, storage.ErrCodeNotFound
+	}
+
+	return code, nil
+}
+
+func (s *fakeStorage) RedeemAuthorizationCode(_ context.Context, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code := s.codes[codeHash]
+	if code.Used {
+		return storage.ErrCodeAlreadyUsed
+	}
+
+	code.Used = true
+	s.codes[codeHash] = code
+
+	return nil
+}
+
+func (s *fakeStorage) DeleteExpiredAuthorizationCodes(_ context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStorage) SaveDeviceCode(_ context.Context, code models.DeviceCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code.Status = models.DeviceCodePending
+	s.deviceCodes[code.DeviceCodeHash] = code
+
+	return nil
+}
+
+func (s *fakeStorage) DeviceCode(_ context.Context, deviceCodeHash string) (models.DeviceCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.deviceCodes[deviceCodeHash]
+	if !ok {
+		return models.DeviceCode{}, storage.ErrDeviceCodeNotFound
+	}
+
+	return code, nil
+}
+
+func (s *fakeStorage) DeviceCodeByUserCode(_ context.Context, userCode string) (models.DeviceCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, code := range s.deviceCodes {
+		if code.UserCode == userCode {
+			return code, nil
+		}
+	}
+
+	return models.DeviceCode{}, storage.ErrDeviceCodeNotFound
+}
+
+func (s *fakeStorage) ApproveDeviceCode(_ context.Context, userCode string, userID int64, authTime time.Time) error {
+	return s.updateDeviceCode(userCode, func(code *models.DeviceCode) {
+		code.Status = models.DeviceCodeApproved
+		code.UserID = userID
+		code.AuthTime = authTime
+	})
+}
+
+func (s *fakeStorage) DenyDeviceCode(_ context.Context, userCode string) error {
+	return s.updateDeviceCode(userCode, func(code *models.DeviceCode) {
+		code.Status = models.DeviceCodeDenied
+	})
+}
+
+func (s *fakeStorage) updateDeviceCode(userCode string, update func(code *models.DeviceCode)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, code := range s.deviceCodes {
+		if code.UserCode == userCode && code.Status == models.DeviceCodePending {
+			update(&code)
+			s.deviceCodes[hash] = code
+
+			return nil
+		}
+	}
+
+	return storage.ErrDeviceCodeNotPending
+}
+
+func (s *fakeStorage) UpdateDeviceCodePoll(
+	_ context.Context,
+	deviceCodeHash string,
+	polledAt time.Time,
+	interval time.Duration,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code := s.deviceCodes[deviceCodeHash]
+	code.LastPolledAt = polledAt
+	code.PollInterval = interval
+	s.deviceCodes[deviceCodeHash] = code
+
+	return nil
+}
+
+func (s *fakeStorage) RedeemDeviceCode(_ context.Context, deviceCodeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code := s.deviceCodes[deviceCodeHash]
+	if code.Status != models.DeviceCodeApproved {
+		return storage.ErrCodeAlreadyUsed
+	}
+
+	code.Status = models.DeviceCodeRedeemed
+	s.deviceCodes[deviceCodeHash] = code
+
+	return nil
+}
+
+func (s *fakeStorage) DeleteExpiredDeviceCodes(_ context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func newTestOAuth() (*OAuth, *fakeAuth, *fakeStorage) {
+	a := &fakeAuth{}
+	st := &fakeStorage{
+		codes:       map[string]models.AuthorizationCode{},
+		deviceCodes: map[string]models.DeviceCode{},
+	}
+
+	return New(
+		slogdiscard.NewDiscardLogger(),
+		a,
+		st,
+		st,
+		time.Minute,
+		5*time.Minute,
+		map[int][]string{1: {"reports:read", "reports:write"}},
+		DeviceFlow{
+			CodeTTL:         10 * time.Minute,
+			Interval:        5 * time.Second,
+			VerificationURI: "https://sso.example.com/device",
+		},
+	), a, st
+}
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// example from RFC 7636, appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	assert.True(t, VerifyCodeChallenge("E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", verifier))
+	assert.False(t, VerifyCodeChallenge("E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", verifier+"x"))
+	assert.False(t, VerifyCodeChallenge(challenge("short"), "short"))
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	o, a, _ := newTestOAuth()
+	ctx := context.Background()
+
+	verifier := strings.Repeat("v", 64)
+	req := AuthorizationRequest{
+		ResponseType:        ResponseTypeCode,
+		AppID:               1,
+		RedirectURI:         "https://client.example.com/cb",
+		Scope:               "openid email",
+		Nonce:               "n",
+		CodeChallenge:       challenge(verifier),
+		CodeChallengeMethod: ChallengeMethodS256,
+	}
+
+	_, err := o.Authorize(ctx, req, "user@example.com", "wrong", "")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+
+	code, err := o.Authorize(ctx, req, "user@example.com", "password", "")
+	require.NoError(t, err)
+
+	_, _, err = o.ExchangeCode(ctx, 1, "", code, req.RedirectURI, strings.Repeat("x", 64))
+	assert.ErrorIs(t, err, ErrInvalidGrant, "wrong verifier")
+
+	_, _, err = o.ExchangeCode(ctx, 1, "", code, "https://evil.example.com/cb", verifier)
+	assert.ErrorIs(t, err, ErrInvalidGrant, "wrong redirect uri")
+
+	_, _, err = o.ExchangeCode(ctx, 1, "wrong", code, req.RedirectURI, verifier)
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	tokens, scope, err := o.ExchangeCode(ctx, 1, "secret", code, req.RedirectURI, verifier)
+	require.NoError(t, err)
+	assert.Equal(t, "access", tokens.AccessToken)
+	assert.Equal(t, "id:n", tokens.IDToken)
+	assert.Equal(t, "openid email", scope)
+
+	// code is one-time, its replay revokes issued sessions
+	_, _, err = o.ExchangeCode(ctx, 1, "", code, req.RedirectURI, verifier)
+	assert.ErrorIs(t, err, ErrInvalidGrant)
+	assert.Equal(t, []int64{1}, a.revoked)
+}
+
+func TestAuthorize_MFA(t *testing.T) {
+	o, _, _ := newTestOAuth()
+	ctx := context.Background()
+
+	req := AuthorizationRequest{
+		ResponseType:        ResponseTypeCode,
+		AppID:               1,
+		RedirectURI:         "https://client.example.com/cb",
+		CodeChallenge:       challenge(strings.Repeat("v", 64)),
+		CodeChallengeMethod: ChallengeMethodS256,
+	}
+
+	_, err := o.Authorize(ctx, req, "mfa@example.com", "password", "")
+	assert.ErrorIs(t, err, ErrMFARequired)
+
+	_, err = o.Authorize(ctx, req, "mfa@example.com", "password", "000000")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+
+	code, err := o.Authorize(ctx, req, "mfa@example.com", "password", "123456")
+	require.NoError(t, err)
+	assert.NotEmpty(t, code)
+}
+
+func TestAuthorize_EmailNotVerified(t *testing.T) {
+	o, _, st := newTestOAuth()
+	ctx := context.Background()
+
+	st.requireVerifiedEmail = true
+
+	req := AuthorizationRequest{
+		ResponseType:        ResponseTypeCode,
+		AppID:               1,
+		RedirectURI:         "https://client.example.com/cb",
+		CodeChallenge:       challenge(strings.Repeat("v", 64)),
+		CodeChallengeMethod: ChallengeMethodS256,
+	}
+
+	_, err := o.Authorize(ctx, req, "user@example.com", "password", "")
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+
+	code, err := o.Authorize(ctx, req, "verified@example.com", "password", "")
+	require.NoError(t, err)
+	assert.NotEmpty(t, code)
+}
+
+func TestValidateAuthorizationRequest(t *testing.T) {
+	o, _, _ := newTestOAuth()
+	ctx := context.Background()
+
+	valid := AuthorizationRequest{
+		ResponseType:        ResponseTypeCode,
+		AppID:               1,
+		RedirectURI:         "https://client.example.com/cb",
+		CodeChallenge:       challenge(strings.Repeat("v", 64)),
+		CodeChallengeMethod: ChallengeMethodS256,
+	}
+	require.NoError(t, o.ValidateAuthorizationRequest(ctx, valid))
+
+	testCases := []struct {
+		name   string
+		modify func(r *AuthorizationRequest)
+		err    error
+	}{
+		{name: "unknown client", modify: func(r *AuthorizationRequest) { r.AppID = 2 }, err: ErrInvalidClient},
+		{name: "unregistered redirect uri", modify: func(r *AuthorizationRequest) { r.RedirectURI += "/x" }, err: ErrInvalidRedirectURI},
+		{name: "implicit flow", modify: func(r *AuthorizationRequest) { r.ResponseType = "token" }, err: ErrInvalidRequest},
+		{name: "plain PKCE", modify: func(r *AuthorizationRequest) { r.CodeChallengeMethod = "plain" }, err: ErrInvalidRequest},
+		{name: "no PKCE", modify: func(r *AuthorizationRequest) { r.CodeChallenge = "" }, err: ErrInvalidRequest},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.modify(&req)
+			assert.ErrorIs(t, o.ValidateAuthorizationRequest(ctx, req), tt.err)
+		})
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	o, _, _ := newTestOAuth()
+	ctx := context.Background()
+
+	token, err := o.ClientCredentials(ctx, 1, "secret", "reports:read")
+	require.NoError(t, err)
+	assert.Equal(t, "app:reports:read", token.AccessToken)
+	assert.Equal(t, "reports:read", token.Scope)
+	assert.Equal(t, 5*time.Minute, token.ExpiresIn)
+
+	token, err = o.ClientCredentials(ctx, 1, "secret", "")
+	require.NoError(t, err)
+	assert.Equal(t, "reports:read reports:write", token.Scope, "all allowed scopes by default")
+
+	_, err = o.ClientCredentials(ctx, 1, "secret", "reports:read users:write")
+	assert.ErrorIs(t, err, ErrInvalidScope)
+
+	_, err = o.ClientCredentials(ctx, 1, "", "")
+	assert.ErrorIs(t, err, ErrInvalidClient, "secret is required")
+
+	_, err = o.ClientCredentials(ctx, 1, "wrong", "")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	_, err = o.ClientCredentials(ctx, 2, "secret", "")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+}
+
+func TestRefresh(t *testing.T) {
+	o, _, _ := newTestOAuth()
+	ctx := context.Background()
+
+	_, err := o.Refresh(ctx, 3, "other-secret", "refresh")
+	assert.ErrorIs(t, err, ErrInvalidGrant, "refresh token of another client")
+
+	_, err = o.Refresh(ctx, 1, "wrong", "refresh")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	tokens, err := o.Refresh(ctx, 1, "secret", "refresh")
+	require.NoError(t, err)
+	assert.Equal(t, "refresh-2", tokens.RefreshToken)
+}
+
+func TestDeviceFlow(t *testing.T) {
+	o, _, st := newTestOAuth()
+	ctx := context.Background()
+
+	authorization, err := o.DeviceAuthorization(ctx, 1, "", "openid")
+	require.NoError(t, err)
+	assert.Regexp(t, `^[B-Z]{4}-[B-Z]{4}$`, authorization.UserCode)
+	assert.Equal(t, "https://sso.example.com/device", authorization.VerificationURI)
+	assert.Contains(t, authorization.VerificationURIComplete, authorization.UserCode)
+	assert.Equal(t, 5*time.Second, authorization.Interval)
+
+	_, _, err = o.PollDeviceCode(ctx, 1, "", authorization.DeviceCode)
+	assert.ErrorIs(t, err, ErrAuthorizationPending)
+
+	_, _, err = o.PollDeviceCode(ctx, 1, "", authorization.DeviceCode)
+	assert.ErrorIs(t, err, ErrSlowDown, "polled before the interval passed")
+
+	code, err := st.DeviceCode(ctx, opaque.Hash(authorization.DeviceCode))
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, code.PollInterval)
+
+	_, _, err = o.PollDeviceCode(ctx, 2, "", authorization.DeviceCode)
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	assert.ErrorIs(t, o.VerifyDevice(ctx, "app-token", authorization.UserCode, true), ErrAccessDenied)
+	assert.ErrorIs(t, o.VerifyDevice(ctx, "user-token", "BBBB-BBBB", true), ErrInvalidUserCode)
+
+	// user codes are case-insensitive and punctuation is ignored
+	userCode := strings.ToLower(strings.ReplaceAll(authorization.UserCode, "-", " "))
+	require.NoError(t, o.VerifyDevice(ctx, "user-token", userCode, true))
+	assert.ErrorIs(t, o.VerifyDevice(ctx, "user-token", authorization.UserCode, false), ErrInvalidUserCode)
+
+	// let the interval pass
+	code, _ = st.DeviceCode(ctx, opaque.Hash(authorization.DeviceCode))
+	require.NoError(t, st.UpdateDeviceCodePoll(ctx, code.DeviceCodeHash, time.Now().Add(-time.Minute), code.PollInterval))
+
+	tokens, scope, err := o.PollDeviceCode(ctx, 1, "", authorization.DeviceCode)
+	require.NoError(t, err)
+	assert.Equal(t, "access", tokens.AccessToken)
+	assert.NotEmpty(t, tokens.IDToken)
+	assert.Equal(t, "openid", scope)
+
+	_, _, err = o.PollDeviceCode(ctx, 1, "", authorization.DeviceCode)
+	assert.ErrorIs(t, err, ErrInvalidGrant, "device code is one-time")
+}
+
+func TestDeviceFlow_Denied(t *testing.T) {
+	o, _, _ := newTestOAuth()
+	ctx := context.Background()
+
+	authorization, err := o.DeviceAuthorization(ctx, 1, "", "")
+	require.NoError(t, err)
+
+	require.NoError(t, o.VerifyDevice(ctx, "user-token", authorization.UserCode, false))
+
+	_, _, err = o.PollDeviceCode(ctx, 1, "", authorization.DeviceCode)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+}
@@ -0,0 +1,462 @@
+package permissions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	sl "github.com/nhassl3/sso/internal/lib/logger/sl"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opCreateRole       = "permissions.CreateRole"
+	opDeleteRole       = "permissions.DeleteRole"
+	opRoles            = "permissions.Roles"
+	opCreatePermission = "permissions.CreatePermission"
+	opDeletePermission = "permissions.DeletePermission"
+	opPermissions      = "permissions.Permissions"
+	opGrantPermission  = "permissions.GrantPermission"
+	opRevokePermission = "permissions.RevokePermission"
+	opAssignRole       = "permissions.AssignRole"
+	opUnassignRole     = "permissions.UnassignRole"
+	opUserRoles        = "permissions.UserRoles"
+	opHasPermission    = "permissions.HasPermission"
+	opCheck            = "permissions.CheckPermissions"
+)
+
+// Reasons of decisions made by CheckPermissions
+const (
+	reasonGranted    = "granted by role %q"
+	reasonNotGranted = "no role of the user grants the permission"
+	reasonNoRoles    = "user has no roles in the app"
+)
+
+var (
+	ErrInvalidAppID       = errors.New("invalid app id")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrRoleExists         = errors.New("role already exists")
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrPermissionExists   = errors.New("permission already exists")
+	ErrPermissionNotFound = errors.New("permission not found")
+	ErrAppMismatch        = errors.New("role and permission belong to different apps")
+)
+
+// Permissions manages role-based access control of users in apps
+//
+// Roles and permissions belong to an app. Users are assigned roles,
+// roles are granted permissions, so a user has a permission in an app
+// if any of their roles in the app grants it
+type Permissions struct {
+	log         *slog.Logger
+	roleStorage RoleStorage
+	usrProvider UserProvider
+	appProvider AppProvider
+}
+
+type RoleStorage interface {
+	SaveRole(ctx context.Context, appID int, name string) (roleID int64, err error)
+	Role(ctx context.Context, roleID int64) (role models.Role, err error)
+	Roles(ctx context.Context, appID int) (roles []models.Role, err error)
+	DeleteRole(ctx context.Context, roleID int64) error
+	SavePermission(ctx context.Context, appID int, name string) (permissionID int64, err error)
+	Permission(ctx context.Context, permissionID int64) (permission models.Permission, err error)
+	Permissions(ctx context.Context, appID int) (permissions []models.Permission, err error)
+	DeletePermission(ctx context.Context, permissionID int64) error
+	GrantPermission(ctx context.Context, roleID int64, permissionID int64) error
+	RevokePermission(ctx context.Context, roleID int64, permissionID int64) error
+	AssignRole(ctx context.Context, userID int64, roleID int64) error
+	UnassignRole(ctx context.Context, userID int64, roleID int64) error
+	UserRoles(ctx context.Context, userID int64, appID int) (roles []models.Role, err error)
+	HasPermission(ctx context.Context, userID int64, appID int, permission string) (has bool, err error)
+	UsersRoles(ctx context.Context, users []models.AppUser) (roles map[models.AppUser][]models.Role, err error)
+}
+
+type UserProvider interface {
+	UserByID(ctx context.Context, userID int64) (user models.User, err error)
+}
+
+type AppProvider interface {
+	App(ctx context.Context, appID int) (app models.App, err error)
+}
+
+// New returns a new instance of the Permissions service
+func New(
+	log *slog.Logger,
+	roleStorage RoleStorage,
+	usrProvider UserProvider,
+	appProvider AppProvider,
+) *Permissions {
+	return &Permissions{
+		log:         log,
+		roleStorage: roleStorage,
+		usrProvider: usrProvider,
+		appProvider: appProvider,
+	}
+}
+
+// CreateRole creates role of the app without any permissions
+func (p *Permissions) CreateRole(ctx context.Context, appID int, name string) (models.Role, error) {
+	log := p.log.With(
+		slog.String("op", opCreateRole),
+		slog.Int("appID", appID),
+		slog.String("role", name),
+	)
+
+	if err := p.checkApp(ctx, appID); err != nil {
+		return models.Role{}, fmt.Errorf("%s: %w", opCreateRole, err)
+	}
+
+	id, err := p.roleStorage.SaveRole(ctx, appID, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrRoleExists) {
+			return models.Role{}, fmt.Errorf("%s: %w", opCreateRole, ErrRoleExists)
+		}
+
+		log.Error("failed to save role", sl.ErrLog(err))
+
+		return models.Role{}, fmt.Errorf("%s: %w", opCreateRole, err)
+	}
+
+	log.Info("role created", slog.Int64("roleID", id))
+
+	return models.Role{ID: id, AppID: appID, Name: name}, nil
+}
+
+// DeleteRole deletes role, taking it away from every user
+func (p *Permissions) DeleteRole(ctx context.Context, roleID int64) error {
+	log := p.log.With(
+		slog.String("op", opDeleteRole),
+		slog.Int64("roleID", roleID),
+	)
+
+	if err := p.roleStorage.DeleteRole(ctx, roleID); err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return fmt.Errorf("%s: %w", opDeleteRole, ErrRoleNotFound)
+		}
+
+		log.Error("failed to delete role", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opDeleteRole, err)
+	}
+
+	log.Info("role deleted")
+
+	return nil
+}
+
+// Roles returns roles of the app with their permissions
+func (p *Permissions) Roles(ctx context.Context, appID int) ([]models.Role, error) {
+	roles, err := p.roleStorage.Roles(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opRoles, err)
+	}
+
+	return roles, nil
+}
+
+// CreatePermission creates permission of the app not granted to any role
+func (p *Permissions) CreatePermission(ctx context.Context, appID int, name string) (models.Permission, error) {
+	log := p.log.With(
+		slog.String("op", opCreatePermission),
+		slog.Int("appID", appID),
+		slog.String("permission", name),
+	)
+
+	if err := p.checkApp(ctx, appID); err != nil {
+		return models.Permission{}, fmt.Errorf("%s: %w", opCreatePermission, err)
+	}
+
+	id, err := p.roleStorage.SavePermission(ctx, appID, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrPermissionExists) {
+			return models.Permission{}, fmt.Errorf("%s: %w", opCreatePermission, ErrPermissionExists)
+		}
+
+		log.Error("failed to save permission", sl.ErrLog(err))
+
+		return models.Permission{}, fmt.Errorf("%s: %w", opCreatePermission, err)
+	}
+
+	log.Info("permission created", slog.Int64("permissionID", id))
+
+	return models.Permission{ID: id, AppID: appID, Name: name}, nil
+}
+
+// DeletePermission deletes permission, revoking it from every role
+func (p *Permissions) DeletePermission(ctx context.Context, permissionID int64) error {
+	log := p.log.With(
+		slog.String("op", opDeletePermission),
+		slog.Int64("permissionID", permissionID),
+	)
+
+	if err := p.roleStorage.DeletePermission(ctx, permissionID); err != nil {
+		if errors.Is(err, storage.ErrPermissionNotFound) {
+			return fmt.Errorf("%s: %w", opDeletePermission, ErrPermissionNotFound)
+		}
+
+		log.Error("failed to delete permission", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opDeletePermission, err)
+	}
+
+	log.Info("permission deleted")
+
+	return nil
+}
+
+// Permissions returns permissions of the app
+func (p *Permissions) Permissions(ctx context.Context, appID int) ([]models.Permission, error) {
+	permissions, err := p.roleStorage.Permissions(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opPermissions, err)
+	}
+
+	return permissions, nil
+}
+
+// GrantPermission grants permission to the role of the same app
+func (p *Permissions) GrantPermission(ctx context.Context, roleID int64, permissionID int64) error {
+	log := p.log.With(
+		slog.String("op", opGrantPermission),
+		slog.Int64("roleID", roleID),
+		slog.Int64("permissionID", permissionID),
+	)
+
+	if err := p.checkSameApp(ctx, roleID, permissionID); err != nil {
+		return fmt.Errorf("%s: %w", opGrantPermission, err)
+	}
+
+	if err := p.roleStorage.GrantPermission(ctx, roleID, permissionID); err != nil {
+		log.Error("failed to grant permission", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opGrantPermission, err)
+	}
+
+	log.Info("permission granted")
+
+	return nil
+}
+
+// RevokePermission revokes permission from the role
+func (p *Permissions) RevokePermission(ctx context.Context, roleID int64, permissionID int64) error {
+	log := p.log.With(
+		slog.String("op", opRevokePermission),
+		slog.Int64("roleID", roleID),
+		slog.Int64("permissionID", permissionID),
+	)
+
+	if err := p.checkSameApp(ctx, roleID, permissionID); err != nil {
+		return fmt.Errorf("%s: %w", opRevokePermission, err)
+	}
+
+	if err := p.roleStorage.RevokePermission(ctx, roleID, permissionID); err != nil {
+		log.Error("failed to revoke permission", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opRevokePermission, err)
+	}
+
+	log.Info("permission revoked")
+
+	return nil
+}
+
+// AssignRole assigns role to the user
+//
+// Roles get into access tokens issued after that, tokens issued before keep
+// the old roles until they expire
+func (p *Permissions) AssignRole(ctx context.Context, userID int64, roleID int64) error {
+	log := p.log.With(
+		slog.String("op", opAssignRole),
+		slog.Int64("userID", userID),
+		slog.Int64("roleID", roleID),
+	)
+
+	if err := p.checkUserRole(ctx, userID, roleID); err != nil {
+		return fmt.Errorf("%s: %w", opAssignRole, err)
+	}
+
+	if err := p.roleStorage.AssignRole(ctx, userID, roleID); err != nil {
+		log.Error("failed to assign role", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opAssignRole, err)
+	}
+
+	log.Info("role assigned")
+
+	return nil
+}
+
+// UnassignRole takes role away from the user
+func (p *Permissions) UnassignRole(ctx context.Context, userID int64, roleID int64) error {
+	log := p.log.With(
+		slog.String("op", opUnassignRole),
+		slog.Int64("userID", userID),
+		slog.Int64("roleID", roleID),
+	)
+
+	if err := p.checkUserRole(ctx, userID, roleID); err != nil {
+		return fmt.Errorf("%s: %w", opUnassignRole, err)
+	}
+
+	if err := p.roleStorage.UnassignRole(ctx, userID, roleID); err != nil {
+		log.Error("failed to unassign role", sl.ErrLog(err))
+
+		return fmt.Errorf("%s: %w", opUnassignRole, err)
+	}
+
+	log.Info("role unassigned")
+
+	return nil
+}
+
+// UserRoles returns roles of the user in the app
+func (p *Permissions) UserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error) {
+	roles, err := p.roleStorage.UserRoles(ctx, userID, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opUserRoles, err)
+	}
+
+	return roles, nil
+}
+
+// HasPermission reports whether any role of the user in the app grants the permission
+//
+// Unknown users, apps and permissions have no permissions rather than an error
+func (p *Permissions) HasPermission(ctx context.Context, userID int64, appID int, permission string) (bool, error) {
+	has, err := p.roleStorage.HasPermission(ctx, userID, appID, permission)
+	if err != nil {
+		p.log.Error("failed to check permission",
+			slog.String("op", opHasPermission),
+			slog.Int64("userID", userID),
+			slog.Int("appID", appID),
+			slog.String("permission", permission),
+			sl.ErrLog(err),
+		)
+
+		return false, fmt.Errorf("%s: %w", opHasPermission, err)
+	}
+
+	return has, nil
+}
+
+// CheckPermissions decides every check with roles of all its users loaded at once,
+// decisions are in the same order as checks
+//
+// Action on resource is allowed if any role of the user in the app grants
+// the permission named "resource:action"
+func (p *Permissions) CheckPermissions(
+	ctx context.Context,
+	checks []models.PermissionCheck,
+) ([]models.PermissionDecision, error) {
+	users := make([]models.AppUser, 0, len(checks))
+	seen := make(map[models.AppUser]bool, len(checks))
+	for _, check := range checks {
+		user := models.AppUser{UserID: check.UserID, AppID: check.AppID}
+		if !seen[user] {
+			seen[user] = true
+			users = append(users, user)
+		}
+	}
+
+	roles, err := p.roleStorage.UsersRoles(ctx, users)
+	if err != nil {
+		p.log.Error("failed to get roles of users",
+			slog.String("op", opCheck),
+			slog.Int("checks", len(checks)),
+			sl.ErrLog(err),
+		)
+
+		return nil, fmt.Errorf("%s: %w", opCheck, err)
+	}
+
+	decisions := make([]models.PermissionDecision, 0, len(checks))
+	for _, check := range checks {
+		user := models.AppUser{UserID: check.UserID, AppID: check.AppID}
+		decisions = append(decisions, decide(roles[user], permissionName(check.Resource, check.Action)))
+	}
+
+	return decisions, nil
+}
+
+// decide checks whether any of roles grants the permission
+func decide(roles []models.Role, permission string) models.PermissionDecision {
+	if len(roles) == 0 {
+		return models.PermissionDecision{Reason: reasonNoRoles}
+	}
+
+	for _, role := range roles {
+		if slices.Contains(role.Permissions, permission) {
+			return models.PermissionDecision{Allowed: true, Reason: fmt.Sprintf(reasonGranted, role.Name)}
+		}
+	}
+
+	return models.PermissionDecision{Reason: reasonNotGranted}
+}
+
+func permissionName(resource string, action string) string {
+	return resource + ":" + action
+}
+
+func (p *Permissions) checkApp(ctx context.Context, appID int) error {
+	if _, err := p.appProvider.App(ctx, appID); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return ErrInvalidAppID
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// checkSameApp checks that both the role and the permission exist and belong to the same app
+func (p *Permissions) checkSameApp(ctx context.Context, roleID int64, permissionID int64) error {
+	role, err := p.roleStorage.Role(ctx, roleID)
+	if err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return ErrRoleNotFound
+		}
+
+		return err
+	}
+
+	permission, err := p.roleStorage.Permission(ctx, permissionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrPermissionNotFound) {
+			return ErrPermissionNotFound
+		}
+
+		return err
+	}
+
+	if role.AppID != permission.AppID {
+		return ErrAppMismatch
+	}
+
+	return nil
+}
+
+// checkUserRole checks that both the user and the role exist
+func (p *Permissions) checkUserRole(ctx context.Context, userID int64, roleID int64) error {
+	if _, err := p.usrProvider.UserByID(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+
+		return err
+	}
+
+	if _, err := p.roleStorage.Role(ctx, roleID); err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return ErrRoleNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
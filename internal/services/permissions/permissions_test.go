@@ -0,0 +1,434 @@
+package permissions
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/lib/logger/handlers/slogdiscard"
+	"github.com/nhassl3/sso/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type grant struct {
+	roleID       int64
+	permissionID int64
+}
+
+type assignment struct {
+	userID int64
+	roleID int64
+}
+
+type fakeStorage struct {
+	mu          sync.Mutex
+	nextID      int64
+	apps        map[int]bool
+	users       map[int64]bool
+	roles       map[int64]models.Role
+	permissions map[int64]models.Permission
+	grants      map[grant]bool
+	assignments map[assignment]bool
+
+	// batches counts calls of UsersRoles
+	batches int
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		apps:        map[int]bool{1: true, 2: true},
+		users:       map[int64]bool{1: true},
+		roles:       map[int64]models.Role{},
+		permissions: map[int64]models.Permission{},
+		grants:      map[grant]bool{},
+		assignments: map[assignment]bool{},
+	}
+}
+
+func (s *fakeStorage) App(_ context.Context, appID int) (models.App, error) {
+	if !s.apps[appID] {
+		return models.App{}, storage.ErrAppNotFound
+	}
+
+	return models.App{ID: appID}, nil
+}
+
+func (s *fakeStorage) UserByID(_ context.Context, userID int64) (models.User, error) {
+	if !s.users[userID] {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return models.User{ID: userID}, nil
+}
+
+func (s *fakeStorage) SaveRole(_ context.Context, appID int, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, role := range s.roles {
+		if role.AppID == appID && role.Name == name {
+			return 0, storage.ErrRoleExists
+		}
+	}
+
+	s.nextID++
+	s.roles[s.nextID] = models.Role{ID: s.nextID, AppID: appID, Name: name}
+
+	return s.nextID, nil
+}
+
+func (s *fakeStorage) Role(_ context.Context, roleID int64) (models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role, ok := s.roles[roleID]
+	if !ok {
+		return models.Role{}, storage.ErrRoleNotFound
+	}
+
+	return role, nil
+}
+
+func (s *fakeStorage) Roles(_ context.Context, appID int) ([]models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var roles []models.Role
+	for _, role := range s.roles {
+		if role.AppID != appID {
+			continue
+		}
+
+		for g := range s.grants {
+			if g.roleID == role.ID {
+				role.Permissions = append(role.Permissions, s.permissions[g.permissionID].Name)
+			}
+		}
+		sort.Strings(role.Permissions)
+
+		roles = append(roles, role)
+	}
+
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+
+	return roles, nil
+}
+
+func (s *fakeStorage) DeleteRole(_ context.Context, roleID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.roles[roleID]; !ok {
+		return storage.ErrRoleNotFound
+	}
+
+	delete(s.roles, roleID)
+
+	for g := range s.grants {
+		if g.roleID == roleID {
+			delete(s.grants, g)
+		}
+	}
+
+	for a := range s.assignments {
+		if a.roleID == roleID {
+			delete(s.assignments, a)
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeStorage) SavePermission(_ context.Context, appID int, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, permission := range s.permissions {
+		if permission.AppID == appID && permission.Name == name {
+			return 0, storage.ErrPermissionExists
+		}
+	}
+
+	s.nextID++
+	s.permissions[s.nextID] = models.Permission{ID: s.nextID, AppID: appID, Name: name}
+
+	return s.nextID, nil
+}
+
+func (s *fakeStorage) Permission(_ context.Context, permissionID int64) (models.Permission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	permission, ok := s.permissions[permissionID]
+	if !ok {
+		return models.Permission{}, storage.ErrPermissionNotFound
+	}
+
+	return permission, nil
+}
+
+func (s *fakeStorage) Permissions(_ context.Context, appID int) ([]models.Permission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var permissions []models.Permission
+	for _, permission := range s.permissions {
+		if permission.AppID == appID {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i].Name < permissions[j].Name })
+
+	return permissions, nil
+}
+
+func (s *fakeStorage) DeletePermission(_ context.Context, permissionID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.permissions[permissionID]; !ok {
+		return storage.ErrPermissionNotFound
+	}
+
+	delete(s.permissions, permissionID)
+
+	for g := range s.grants {
+		if g.permissionID == permissionID {
+			delete(s.grants, g)
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeStorage) GrantPermission(_ context.Context, roleID int64, permissionID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.grants[grant{roleID, permissionID}] = true
+
+	return nil
+}
+
+func (s *fakeStorage) RevokePermission(_ context.Context, roleID int64, permissionID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.grants, grant{roleID, permissionID})
+
+	return nil
+}
+
+func (s *fakeStorage) AssignRole(_ context.Context, userID int64, roleID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.assignments[assignment{userID, roleID}] = true
+
+	return nil
+}
+
+func (s *fakeStorage) UnassignRole(_ context.Context, userID int64, roleID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.assignments, assignment{userID, roleID})
+
+	return nil
+}
+
+func (s *fakeStorage) UserRoles(_ context.Context, userID int64, appID int) ([]models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var roles []models.Role
+	for a := range s.assignments {
+		if role := s.roles[a.roleID]; a.userID == userID && role.AppID == appID {
+			roles = append(roles, role)
+		}
+	}
+
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+
+	return roles, nil
+}
+
+func (s *fakeStorage) HasPermission(_ context.Context, userID int64, appID int, permission string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for a := range s.assignments {
+		if a.userID != userID || s.roles[a.roleID].AppID != appID {
+			continue
+		}
+
+		for g := range s.grants {
+			if g.roleID == a.roleID && s.permissions[g.permissionID].Name == permission {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func (s *fakeStorage) UsersRoles(_ context.Context, users []models.AppUser) (map[models.AppUser][]models.Role, error) {
+	s.mu.Lock()
+	s.batches++
+	s.mu.Unlock()
+
+	roles := make(map[models.AppUser][]models.Role, len(users))
+	for _, user := range users {
+		list, _ := s.Roles(context.Background(), user.AppID)
+		for _, role := range list {
+			if s.assigned(user.UserID, role.ID) {
+				roles[user] = append(roles[user], role)
+			}
+		}
+	}
+
+	return roles, nil
+}
+
+func (s *fakeStorage) assigned(userID int64, roleID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.assignments[assignment{userID, roleID}]
+}
+
+func newTestPermissions() (*Permissions, *fakeStorage) {
+	st := newFakeStorage()
+
+	return New(slogdiscard.NewDiscardLogger(), st, st, st), st
+}
+
+func TestPermissions(t *testing.T) {
+	p, _ := newTestPermissions()
+	ctx := context.Background()
+
+	editor, err := p.CreateRole(ctx, 1, "editor")
+	require.NoError(t, err)
+
+	_, err = p.CreateRole(ctx, 1, "editor")
+	assert.ErrorIs(t, err, ErrRoleExists)
+
+	_, err = p.CreateRole(ctx, 2, "editor")
+	assert.NoError(t, err, "role names are unique per app")
+
+	write, err := p.CreatePermission(ctx, 1, "articles:write")
+	require.NoError(t, err)
+
+	require.NoError(t, p.GrantPermission(ctx, editor.ID, write.ID))
+	require.NoError(t, p.AssignRole(ctx, 1, editor.ID))
+
+	has, err := p.HasPermission(ctx, 1, 1, "articles:write")
+	require.NoError(t, err)
+	assert.True(t, has)
+
+	has, err = p.HasPermission(ctx, 1, 2, "articles:write")
+	require.NoError(t, err)
+	assert.False(t, has, "permissions are scoped to the app")
+
+	roles, err := p.Roles(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, roles, 1)
+	assert.Equal(t, []string{"articles:write"}, roles[0].Permissions)
+
+	require.NoError(t, p.RevokePermission(ctx, editor.ID, write.ID))
+
+	has, err = p.HasPermission(ctx, 1, 1, "articles:write")
+	require.NoError(t, err)
+	assert.False(t, has)
+}
+
+func TestPermissions_Rejected(t *testing.T) {
+	p, _ := newTestPermissions()
+	ctx := context.Background()
+
+	_, err := p.CreateRole(ctx, 42, "editor")
+	assert.ErrorIs(t, err, ErrInvalidAppID)
+
+	_, err = p.CreatePermission(ctx, 42, "articles:write")
+	assert.ErrorIs(t, err, ErrInvalidAppID)
+
+	role, err := p.CreateRole(ctx, 1, "editor")
+	require.NoError(t, err)
+
+	other, err := p.CreatePermission(ctx, 2, "articles:write")
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, p.GrantPermission(ctx, role.ID, other.ID), ErrAppMismatch)
+	assert.ErrorIs(t, p.GrantPermission(ctx, 999, other.ID), ErrRoleNotFound)
+	assert.ErrorIs(t, p.GrantPermission(ctx, role.ID, 999), ErrPermissionNotFound)
+
+	assert.ErrorIs(t, p.AssignRole(ctx, 42, role.ID), ErrUserNotFound)
+	assert.ErrorIs(t, p.AssignRole(ctx, 1, 999), ErrRoleNotFound)
+
+	assert.ErrorIs(t, p.DeleteRole(ctx, 999), ErrRoleNotFound)
+	assert.ErrorIs(t, p.DeletePermission(ctx, 999), ErrPermissionNotFound)
+}
+
+func TestDeleteRole_Unassigns(t *testing.T) {
+	p, _ := newTestPermissions()
+	ctx := context.Background()
+
+	role, err := p.CreateRole(ctx, 1, "editor")
+	require.NoError(t, err)
+	require.NoError(t, p.AssignRole(ctx, 1, role.ID))
+
+	roles, err := p.UserRoles(ctx, 1, 1)
+	require.NoError(t, err)
+	assert.Len(t, roles, 1)
+
+	require.NoError(t, p.DeleteRole(ctx, role.ID))
+
+	roles, err = p.UserRoles(ctx, 1, 1)
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+}
+
+func TestCheckPermissions(t *testing.T) {
+	p, st := newTestPermissions()
+	ctx := context.Background()
+
+	st.users[2] = true
+
+	editor, err := p.CreateRole(ctx, 1, "editor")
+	require.NoError(t, err)
+	viewer, err := p.CreateRole(ctx, 1, "viewer")
+	require.NoError(t, err)
+
+	write, err := p.CreatePermission(ctx, 1, "articles:write")
+	require.NoError(t, err)
+	read, err := p.CreatePermission(ctx, 1, "articles:read")
+	require.NoError(t, err)
+
+	require.NoError(t, p.GrantPermission(ctx, editor.ID, write.ID))
+	require.NoError(t, p.GrantPermission(ctx, editor.ID, read.ID))
+	require.NoError(t, p.GrantPermission(ctx, viewer.ID, read.ID))
+	require.NoError(t, p.AssignRole(ctx, 1, editor.ID))
+	require.NoError(t, p.AssignRole(ctx, 2, viewer.ID))
+
+	decisions, err := p.CheckPermissions(ctx, []models.PermissionCheck{
+		{UserID: 1, AppID: 1, Resource: "articles", Action: "write"},
+		{UserID: 2, AppID: 1, Resource: "articles", Action: "write"},
+		{UserID: 2, AppID: 1, Resource: "articles", Action: "read"},
+		{UserID: 1, AppID: 2, Resource: "articles", Action: "read"},
+		{UserID: 1, AppID: 1, Resource: "comments", Action: "write"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, st.batches, "roles are loaded in a single call")
+
+	assert.Equal(t, []models.PermissionDecision{
+		{Allowed: true, Reason: `granted by role "editor"`},
+		{Allowed: false, Reason: reasonNotGranted},
+		{Allowed: true, Reason: `granted by role "viewer"`},
+		{Allowed: false, Reason: reasonNoRoles},
+		{Allowed: false, Reason: reasonNotGranted},
+	}, decisions)
+}
@@ -0,0 +1,206 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opSaveDeviceCode          = "storage.sqlite.SaveDeviceCode"
+	opDeviceCode              = "storage.sqlite.DeviceCode"
+	opDeviceCodeByUserCode    = "storage.sqlite.DeviceCodeByUserCode"
+	opApproveDeviceCode       = "storage.sqlite.ApproveDeviceCode"
+	opDenyDeviceCode          = "storage.sqlite.DenyDeviceCode"
+	opUpdateDeviceCodePoll    = "storage.sqlite.UpdateDeviceCodePoll"
+	opRedeemDeviceCode        = "storage.sqlite.RedeemDeviceCode"
+	opDeleteExpiredDeviceCode = "storage.sqlite.DeleteExpiredDeviceCodes"
+)
+
+const deviceCodeColumns = `device_code_hash, user_code, app_id, scope, status,
+	COALESCE(user_id, 0), COALESCE(auth_time, 0), poll_interval, last_polled_at, expires_at`
+
+// SaveDeviceCode saves pending device code
+func (s *Storage) SaveDeviceCode(ctx context.Context, code models.DeviceCode) error {
+	stmt, err := s.db.Prepare(`
+		INSERT INTO device_codes(device_code_hash, user_code, app_id, scope, poll_interval, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opSaveDeviceCode, err)
+	}
+
+	if _, err = stmt.ExecContext(
+		ctx,
+		code.DeviceCodeHash, code.UserCode, code.AppID, code.Scope,
+		int64(code.PollInterval.Seconds()), code.ExpiresAt.Unix(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", opSaveDeviceCode, err)
+	}
+
+	return nil
+}
+
+// DeviceCode returns device code by its hash
+func (s *Storage) DeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, error) {
+	stmt, err := s.db.Prepare("SELECT " + deviceCodeColumns + " FROM device_codes WHERE device_code_hash = ?")
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", opDeviceCode, err)
+	}
+
+	code, err := scanDeviceCode(stmt.QueryRowContext(ctx, deviceCodeHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DeviceCode{}, storage.ErrDeviceCodeNotFound
+		}
+
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", opDeviceCode, err)
+	}
+
+	return code, nil
+}
+
+// DeviceCodeByUserCode returns device code by the user code shown to the user
+func (s *Storage) DeviceCodeByUserCode(ctx context.Context, userCode string) (models.DeviceCode, error) {
+	stmt, err := s.db.Prepare("SELECT " + deviceCodeColumns + " FROM device_codes WHERE user_code = ?")
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", opDeviceCodeByUserCode, err)
+	}
+
+	code, err := scanDeviceCode(stmt.QueryRowContext(ctx, userCode))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DeviceCode{}, storage.ErrDeviceCodeNotFound
+		}
+
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", opDeviceCodeByUserCode, err)
+	}
+
+	return code, nil
+}
+
+// ApproveDeviceCode marks pending device code as approved by the user
+//
+// If code isn't pending anymore, returns storage.ErrDeviceCodeNotPending
+func (s *Storage) ApproveDeviceCode(ctx context.Context, userCode string, userID int64, authTime time.Time) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE device_codes SET status = ?, user_id = ?, auth_time = ? WHERE user_code = ? AND status = ?",
+		models.DeviceCodeApproved, userID, authTime.Unix(), userCode, models.DeviceCodePending,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opApproveDeviceCode, err)
+	}
+
+	return checkAffected(opApproveDeviceCode, res, storage.ErrDeviceCodeNotPending)
+}
+
+// DenyDeviceCode marks pending device code as denied by the user
+//
+// If code isn't pending anymore, returns storage.ErrDeviceCodeNotPending
+func (s *Storage) DenyDeviceCode(ctx context.Context, userCode string) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE device_codes SET status = ? WHERE user_code = ? AND status = ?",
+		models.DeviceCodeDenied, userCode, models.DeviceCodePending,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opDenyDeviceCode, err)
+	}
+
+	return checkAffected(opDenyDeviceCode, res, storage.ErrDeviceCodeNotPending)
+}
+
+// UpdateDeviceCodePoll records the time device polled the token endpoint and the interval it must keep
+func (s *Storage) UpdateDeviceCodePoll(
+	ctx context.Context,
+	deviceCodeHash string,
+	polledAt time.Time,
+	interval time.Duration,
+) error {
+	if _, err := s.db.ExecContext(
+		ctx,
+		"UPDATE device_codes SET last_polled_at = ?, poll_interval = ? WHERE device_code_hash = ?",
+		polledAt.Unix(), int64(interval.Seconds()), deviceCodeHash,
+	); err != nil {
+		return fmt.Errorf("%s: %w", opUpdateDeviceCodePoll, err)
+	}
+
+	return nil
+}
+
+// RedeemDeviceCode marks approved device code as redeemed
+//
+// If code was already redeemed, returns storage.ErrCodeAlreadyUsed
+func (s *Storage) RedeemDeviceCode(ctx context.Context, deviceCodeHash string) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE device_codes SET status = ? WHERE device_code_hash = ? AND status = ?",
+		models.DeviceCodeRedeemed, deviceCodeHash, models.DeviceCodeApproved,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opRedeemDeviceCode, err)
+	}
+
+	return checkAffected(opRedeemDeviceCode, res, storage.ErrCodeAlreadyUsed)
+}
+
+// DeleteExpiredDeviceCodes deletes device codes expired before given time
+//
+// Returns number of deleted codes
+func (s *Storage) DeleteExpiredDeviceCodes(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM device_codes WHERE expires_at < ?", before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opDeleteExpiredDeviceCode, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opDeleteExpiredDeviceCode, err)
+	}
+
+	return deleted, nil
+}
+
+func scanDeviceCode(row scanner) (models.DeviceCode, error) {
+	var (
+		code                                        models.DeviceCode
+		authTime, interval, lastPolledAt, expiresAt int64
+	)
+
+	if err := row.Scan(
+		&code.DeviceCodeHash, &code.UserCode, &code.AppID, &code.Scope, &code.Status,
+		&code.UserID, &authTime, &interval, &lastPolledAt, &expiresAt,
+	); err != nil {
+		return models.DeviceCode{}, err
+	}
+
+	if authTime != 0 {
+		code.AuthTime = time.Unix(authTime, 0)
+	}
+	if lastPolledAt != 0 {
+		code.LastPolledAt = time.Unix(lastPolledAt, 0)
+	}
+	code.PollInterval = time.Duration(interval) * time.Second
+	code.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return code, nil
+}
+
+// checkAffected returns errNone if statement hasn't affected any row
+func checkAffected(op string, res sql.Result, errNone error) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, errNone)
+	}
+
+	return nil
+}
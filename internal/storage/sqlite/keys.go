@@ -0,0 +1,214 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opSaveSigningKey           = "storage.sqlite.SaveSigningKey"
+	opSigningKey               = "storage.sqlite.SigningKey"
+	opSigningKeys              = "storage.sqlite.SigningKeys"
+	opActiveSigningKey         = "storage.sqlite.ActiveSigningKey"
+	opActivateSigningKey       = "storage.sqlite.ActivateSigningKey"
+	opDeleteSigningKey         = "storage.sqlite.DeleteSigningKey"
+	opDeleteExpiredSigningKeys = "storage.sqlite.DeleteExpiredSigningKeys"
+)
+
+const signingKeyColumns = "id, app_id, algorithm, private_key, state, created_at, activated_at, expires_at"
+
+// SaveSigningKey saves new signing key
+func (s *Storage) SaveSigningKey(ctx context.Context, key models.SigningKey) error {
+	stmt, err := s.db.Prepare(
+		"INSERT INTO signing_keys(id, app_id, algorithm, private_key, state, created_at) VALUES(?, ?, ?, ?, ?, ?)",
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opSaveSigningKey, err)
+	}
+
+	if _, err = stmt.ExecContext(
+		ctx, key.ID, key.AppID, key.Algorithm, key.PrivateKey, key.State, key.CreatedAt.Unix(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", opSaveSigningKey, err)
+	}
+
+	return nil
+}
+
+// SigningKey returns signing key by id
+func (s *Storage) SigningKey(ctx context.Context, keyID string) (models.SigningKey, error) {
+	stmt, err := s.db.Prepare("SELECT " + signingKeyColumns + " FROM signing_keys WHERE id = ?")
+	if err != nil {
+		return models.SigningKey{}, fmt.Errorf("%s: %w", opSigningKey, err)
+	}
+
+	key, err := scanSigningKey(stmt.QueryRowContext(ctx, keyID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.SigningKey{}, storage.ErrKeyNotFound
+		}
+
+		return models.SigningKey{}, fmt.Errorf("%s: %w", opSigningKey, err)
+	}
+
+	return key, nil
+}
+
+// ActiveSigningKey returns the key tokens of the app are signed with
+func (s *Storage) ActiveSigningKey(ctx context.Context, appID int) (models.SigningKey, error) {
+	stmt, err := s.db.Prepare("SELECT " + signingKeyColumns + " FROM signing_keys WHERE app_id = ? AND state = ?")
+	if err != nil {
+		return models.SigningKey{}, fmt.Errorf("%s: %w", opActiveSigningKey, err)
+	}
+
+	key, err := scanSigningKey(stmt.QueryRowContext(ctx, appID, models.KeyStateActive))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.SigningKey{}, storage.ErrKeyNotFound
+		}
+
+		return models.SigningKey{}, fmt.Errorf("%s: %w", opActiveSigningKey, err)
+	}
+
+	return key, nil
+}
+
+// SigningKeys returns all signing keys of all apps
+func (s *Storage) SigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+signingKeyColumns+" FROM signing_keys ORDER BY app_id, created_at")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opSigningKeys, err)
+	}
+	defer rows.Close()
+
+	var keys []models.SigningKey
+	for rows.Next() {
+		key, err := scanSigningKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", opSigningKeys, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", opSigningKeys, err)
+	}
+
+	return keys, nil
+}
+
+// ActivateSigningKey makes pending key active
+//
+// Currently active key of the same app becomes retiring and expires at given time
+func (s *Storage) ActivateSigningKey(ctx context.Context, keyID string, activatedAt time.Time, retiredExpiresAt time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opActivateSigningKey, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var appID int
+	row := tx.QueryRowContext(ctx, "SELECT app_id FROM signing_keys WHERE id = ? AND state = ?", keyID, models.KeyStatePending)
+	if err = row.Scan(&appID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", opActivateSigningKey, storage.ErrKeyNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", opActivateSigningKey, err)
+	}
+
+	if _, err = tx.ExecContext(
+		ctx,
+		"UPDATE signing_keys SET state = ?, expires_at = ? WHERE app_id = ? AND state = ?",
+		models.KeyStateRetiring, retiredExpiresAt.Unix(), appID, models.KeyStateActive,
+	); err != nil {
+		return fmt.Errorf("%s: %w", opActivateSigningKey, err)
+	}
+
+	if _, err = tx.ExecContext(
+		ctx,
+		"UPDATE signing_keys SET state = ?, activated_at = ? WHERE id = ?",
+		models.KeyStateActive, activatedAt.Unix(), keyID,
+	); err != nil {
+		return fmt.Errorf("%s: %w", opActivateSigningKey, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", opActivateSigningKey, err)
+	}
+
+	return nil
+}
+
+// DeleteSigningKey deletes signing key, e.g. when it's compromised
+func (s *Storage) DeleteSigningKey(ctx context.Context, keyID string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM signing_keys WHERE id = ?", keyID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opDeleteSigningKey, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", opDeleteSigningKey, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", opDeleteSigningKey, storage.ErrKeyNotFound)
+	}
+
+	return nil
+}
+
+// DeleteExpiredSigningKeys deletes retiring keys expired before given time
+//
+// Returns number of deleted keys
+func (s *Storage) DeleteExpiredSigningKeys(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(
+		ctx,
+		"DELETE FROM signing_keys WHERE state = ? AND expires_at < ?",
+		models.KeyStateRetiring, before.Unix(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opDeleteExpiredSigningKeys, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opDeleteExpiredSigningKeys, err)
+	}
+
+	return deleted, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSigningKey(row scanner) (models.SigningKey, error) {
+	var (
+		key                    models.SigningKey
+		createdAt              int64
+		activatedAt, expiresAt sql.NullInt64
+	)
+
+	if err := row.Scan(
+		&key.ID, &key.AppID, &key.Algorithm, &key.PrivateKey, &key.State, &createdAt, &activatedAt, &expiresAt,
+	); err != nil {
+		return models.SigningKey{}, err
+	}
+
+	key.CreatedAt = time.Unix(createdAt, 0)
+	if activatedAt.Valid {
+		key.ActivatedAt = time.Unix(activatedAt.Int64, 0)
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = time.Unix(expiresAt.Int64, 0)
+	}
+
+	return key, nil
+}
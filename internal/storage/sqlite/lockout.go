@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opLoginFailures       = "storage.sqlite.LoginFailures"
+	opReserveLoginAttempt = "storage.sqlite.ReserveLoginAttempt"
+	opReleaseLoginAttempt = "storage.sqlite.ReleaseLoginAttempt"
+	opResetLoginFailures  = "storage.sqlite.ResetLoginFailures"
+	opDeleteStaleFailures = "storage.sqlite.DeleteStaleLoginFailures"
+)
+
+// LoginFailures returns failed logins of the subject
+//
+// Subject without failures gets zero counter rather than an error
+func (s *Storage) LoginFailures(ctx context.Context, subject string) (models.LoginFailures, error) {
+	failures := models.LoginFailures{Subject: subject}
+
+	stmt, err := s.db.Prepare("SELECT failures, last_failure_at FROM login_failures WHERE subject = ?")
+	if err != nil {
+		return models.LoginFailures{}, fmt.Errorf("%s: %w", opLoginFailures, err)
+	}
+
+	var lastFailureAt int64
+
+	row := stmt.QueryRowContext(ctx, subject)
+	if err = row.Scan(&failures.Failures, &lastFailureAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return failures, nil
+		}
+
+		return models.LoginFailures{}, fmt.Errorf("%s: %w", opLoginFailures, err)
+	}
+
+	failures.LastFailureAt = time.Unix(lastFailureAt, 0)
+
+	return failures, nil
+}
+
+// ReserveLoginAttempt counts login attempt of the subject at given time as failed,
+// if failures of the subject are still the same as seen
+//
+// Counter of the subject without failures since windowStart starts over.
+// If another attempt has changed the failures since they were read,
+// returns storage.ErrLoginFailuresChanged and counts nothing
+func (s *Storage) ReserveLoginAttempt(
+	ctx context.Context,
+	seen models.LoginFailures,
+	at time.Time,
+	windowStart time.Time,
+) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO login_failures(subject, failures, last_failure_at) VALUES(?, 1, ?)
+		ON CONFLICT(subject) DO UPDATE SET
+			failures = CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END,
+			last_failure_at = excluded.last_failure_at
+		WHERE failures = ? AND last_failure_at = ?`,
+		seen.Subject, at.Unix(), windowStart.Unix(), seen.Failures, seen.LastFailureAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opReserveLoginAttempt, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", opReserveLoginAttempt, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", opReserveLoginAttempt, storage.ErrLoginFailuresChanged)
+	}
+
+	return nil
+}
+
+// ReleaseLoginAttempt takes back login attempt of the subject reserved by ReserveLoginAttempt
+func (s *Storage) ReleaseLoginAttempt(ctx context.Context, subject string) error {
+	if _, err := s.db.ExecContext(
+		ctx,
+		"UPDATE login_failures SET failures = failures - 1 WHERE subject = ? AND failures > 0",
+		subject,
+	); err != nil {
+		return fmt.Errorf("%s: %w", opReleaseLoginAttempt, err)
+	}
+
+	return nil
+}
+
+// ResetLoginFailures forgets failed logins of the subject
+func (s *Storage) ResetLoginFailures(ctx context.Context, subject string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM login_failures WHERE subject = ?", subject); err != nil {
+		return fmt.Errorf("%s: %w", opResetLoginFailures, err)
+	}
+
+	return nil
+}
+
+// DeleteStaleLoginFailures deletes counters of subjects without failures since given time
+//
+// Returns number of deleted counters
+func (s *Storage) DeleteStaleLoginFailures(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM login_failures WHERE last_failure_at < ?", before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opDeleteStaleFailures, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opDeleteStaleFailures, err)
+	}
+
+	return deleted, nil
+}
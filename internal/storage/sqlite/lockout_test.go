@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+func TestReserveLoginAttempt(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	windowStart := now.Add(-time.Hour)
+
+	seen, err := s.LoginFailures(ctx, "email:user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.ReserveLoginAttempt(ctx, seen, now, windowStart); err != nil {
+		t.Fatal(err)
+	}
+
+	// another attempt has read the same failures
+	if err = s.ReserveLoginAttempt(ctx, seen, now, windowStart); !errors.Is(err, storage.ErrLoginFailuresChanged) {
+		t.Fatalf("got %v, want %v", err, storage.ErrLoginFailuresChanged)
+	}
+
+	seen, err = s.LoginFailures(ctx, "email:user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen.Failures != 1 {
+		t.Fatalf("got %d failures, want 1", seen.Failures)
+	}
+
+	if err = s.ReserveLoginAttempt(ctx, seen, now, windowStart); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.ReleaseLoginAttempt(ctx, "email:user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	failures, err := s.LoginFailures(ctx, "email:user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures.Failures != 1 {
+		t.Fatalf("got %d failures after release, want 1", failures.Failures)
+	}
+
+	// counter starts over after the window without failures
+	later := now.Add(2 * time.Hour)
+	if err = s.ReserveLoginAttempt(ctx, failures, later, later.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	failures, err = s.LoginFailures(ctx, "email:user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures.Failures != 1 {
+		t.Fatalf("got %d failures after the window, want 1", failures.Failures)
+	}
+}
@@ -0,0 +1,256 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opSaveTOTP               = "storage.sqlite.SaveTOTP"
+	opTOTP                   = "storage.sqlite.TOTP"
+	opEnableTOTP             = "storage.sqlite.EnableTOTP"
+	opUseTOTPStep            = "storage.sqlite.UseTOTPStep"
+	opSaveMFAChallenge       = "storage.sqlite.SaveMFAChallenge"
+	opMFAChallenge           = "storage.sqlite.MFAChallenge"
+	opUseMFAAttempt          = "storage.sqlite.UseMFAChallengeAttempt"
+	opDeleteMFAChallenge     = "storage.sqlite.DeleteMFAChallenge"
+	opDeleteExpiredChallenge = "storage.sqlite.DeleteExpiredMFAChallenges"
+	opReplaceRecoveryCodes   = "storage.sqlite.ReplaceRecoveryCodes"
+	opUseRecoveryCode        = "storage.sqlite.UseRecoveryCode"
+	opCountRecoveryCodes     = "storage.sqlite.CountRecoveryCodes"
+)
+
+// SaveTOTP saves encrypted secret of the TOTP authenticator the user is enrolling
+//
+// Previous unconfirmed authenticator is replaced, new one stays disabled until EnableTOTP
+func (s *Storage) SaveTOTP(ctx context.Context, userID int64, secret []byte) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE users SET totp_secret = ?, totp_enabled = FALSE, totp_last_step = 0 WHERE id = ?",
+		secret, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opSaveTOTP, err)
+	}
+
+	return checkAffected(opSaveTOTP, res, storage.ErrUserNotFound)
+}
+
+// TOTP returns TOTP authenticator of the user
+//
+// If user hasn't enrolled any, returns storage.ErrTOTPNotFound
+func (s *Storage) TOTP(ctx context.Context, userID int64) (models.TOTP, error) {
+	totp := models.TOTP{UserID: userID}
+
+	stmt, err := s.db.Prepare("SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = ?")
+	if err != nil {
+		return models.TOTP{}, fmt.Errorf("%s: %w", opTOTP, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, userID)
+	if err = row.Scan(&totp.Secret, &totp.Enabled, &totp.LastStep); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TOTP{}, storage.ErrUserNotFound
+		}
+
+		return models.TOTP{}, fmt.Errorf("%s: %w", opTOTP, err)
+	}
+
+	if totp.Secret == nil {
+		return models.TOTP{}, storage.ErrTOTPNotFound
+	}
+
+	return totp, nil
+}
+
+// EnableTOTP enables enrolled TOTP authenticator confirmed with the code of given time step
+func (s *Storage) EnableTOTP(ctx context.Context, userID int64, step int64) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE users SET totp_enabled = TRUE, totp_last_step = ? WHERE id = ? AND totp_secret IS NOT NULL",
+		step, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opEnableTOTP, err)
+	}
+
+	return checkAffected(opEnableTOTP, res, storage.ErrTOTPNotFound)
+}
+
+// UseTOTPStep records that code of given time step was accepted
+//
+// If code of this or later step was already accepted, returns storage.ErrTOTPStepUsed
+func (s *Storage) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?",
+		step, userID, step,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opUseTOTPStep, err)
+	}
+
+	return checkAffected(opUseTOTPStep, res, storage.ErrTOTPStepUsed)
+}
+
+// SaveMFAChallenge saves hashed MFA challenge
+func (s *Storage) SaveMFAChallenge(ctx context.Context, challenge models.MFAChallenge) error {
+	stmt, err := s.db.Prepare("INSERT INTO mfa_challenges(id_hash, user_id, app_id, nonce, expires_at) VALUES(?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", opSaveMFAChallenge, err)
+	}
+
+	if _, err = stmt.ExecContext(
+		ctx,
+		challenge.IDHash, challenge.UserID, challenge.AppID, challenge.Nonce, challenge.ExpiresAt.Unix(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", opSaveMFAChallenge, err)
+	}
+
+	return nil
+}
+
+// MFAChallenge returns MFA challenge by its hash
+func (s *Storage) MFAChallenge(ctx context.Context, idHash string) (models.MFAChallenge, error) {
+	var (
+		challenge models.MFAChallenge
+		expiresAt int64
+	)
+
+	stmt, err := s.db.Prepare("SELECT id_hash, user_id, app_id, nonce, attempts, expires_at FROM mfa_challenges WHERE id_hash = ?")
+	if err != nil {
+		return models.MFAChallenge{}, fmt.Errorf("%s: %w", opMFAChallenge, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, idHash)
+	if err = row.Scan(
+		&challenge.IDHash, &challenge.UserID, &challenge.AppID, &challenge.Nonce, &challenge.Attempts, &expiresAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.MFAChallenge{}, storage.ErrMFAChallengeNotFound
+		}
+
+		return models.MFAChallenge{}, fmt.Errorf("%s: %w", opMFAChallenge, err)
+	}
+
+	challenge.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return challenge, nil
+}
+
+// UseMFAChallengeAttempt counts attempt to complete MFA challenge
+//
+// If challenge has no attempts left or doesn't exist, returns
+// storage.ErrMFAChallengeNotFound. Check and count are a single statement,
+// so concurrent attempts can't exceed maxAttempts
+func (s *Storage) UseMFAChallengeAttempt(ctx context.Context, idHash string, maxAttempts int) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id_hash = ? AND attempts < ?",
+		idHash, maxAttempts,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opUseMFAAttempt, err)
+	}
+
+	return checkAffected(opUseMFAAttempt, res, storage.ErrMFAChallengeNotFound)
+}
+
+// DeleteMFAChallenge deletes completed or exhausted MFA challenge
+//
+// If challenge was already deleted, returns storage.ErrMFAChallengeNotFound,
+// so a challenge can't be completed twice concurrently
+func (s *Storage) DeleteMFAChallenge(ctx context.Context, idHash string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM mfa_challenges WHERE id_hash = ?", idHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opDeleteMFAChallenge, err)
+	}
+
+	return checkAffected(opDeleteMFAChallenge, res, storage.ErrMFAChallengeNotFound)
+}
+
+// DeleteExpiredMFAChallenges deletes MFA challenges expired before given time
+//
+// Returns number of deleted challenges
+func (s *Storage) DeleteExpiredMFAChallenges(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM mfa_challenges WHERE expires_at < ?", before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opDeleteExpiredChallenge, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opDeleteExpiredChallenge, err)
+	}
+
+	return deleted, nil
+}
+
+// ReplaceRecoveryCodes replaces all recovery codes of the user with given hashed ones
+func (s *Storage) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes [][]byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opReplaceRecoveryCodes, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("%s: %w", opReplaceRecoveryCodes, err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO recovery_codes(user_id, code_hash) VALUES(?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", opReplaceRecoveryCodes, err)
+	}
+	defer stmt.Close()
+
+	for _, hash := range codeHashes {
+		if _, err = stmt.ExecContext(ctx, userID, hash); err != nil {
+			return fmt.Errorf("%s: %w", opReplaceRecoveryCodes, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", opReplaceRecoveryCodes, err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode deletes recovery code of the user with given hash
+//
+// If there is no such code, e.g. it was already used, returns storage.ErrRecoveryCodeNotFound,
+// so the same code can't be used twice concurrently
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		"DELETE FROM recovery_codes WHERE user_id = ? AND code_hash = ?",
+		userID, codeHash,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opUseRecoveryCode, err)
+	}
+
+	return checkAffected(opUseRecoveryCode, res, storage.ErrRecoveryCodeNotFound)
+}
+
+// CountRecoveryCodes returns number of unused recovery codes of the user
+func (s *Storage) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var count int
+
+	if err := s.db.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?",
+		userID,
+	).Scan(&count); err != nil {
+		return 0, fmt.Errorf("%s: %w", opCountRecoveryCodes, err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,81 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+func TestUseMFAChallengeAttempt(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	if err := s.SaveMFAChallenge(ctx, models.MFAChallenge{
+		IDHash:    "hash",
+		UserID:    1,
+		AppID:     1,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 3 {
+		if err := s.UseMFAChallengeAttempt(ctx, "hash", 3); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+
+	if err := s.UseMFAChallengeAttempt(ctx, "hash", 3); !errors.Is(err, storage.ErrMFAChallengeNotFound) {
+		t.Fatalf("attempt over the limit: got %v, want %v", err, storage.ErrMFAChallengeNotFound)
+	}
+
+	challenge, err := s.MFAChallenge(ctx, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge.Attempts != 3 {
+		t.Fatalf("got %d attempts, want 3", challenge.Attempts)
+	}
+
+	if err = s.UseMFAChallengeAttempt(ctx, "unknown", 3); !errors.Is(err, storage.ErrMFAChallengeNotFound) {
+		t.Fatalf("unknown challenge: got %v, want %v", err, storage.ErrMFAChallengeNotFound)
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	id, err := s.SaveUser(ctx, "user@example.com", "user@example.com", []byte("hash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.ReplaceRecoveryCodes(ctx, id, [][]byte{[]byte("first"), []byte("second")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.UseRecoveryCode(ctx, id+1, []byte("first")); !errors.Is(err, storage.ErrRecoveryCodeNotFound) {
+		t.Fatalf("code of another user: got %v, want %v", err, storage.ErrRecoveryCodeNotFound)
+	}
+
+	if err = s.UseRecoveryCode(ctx, id, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.UseRecoveryCode(ctx, id, []byte("first")); !errors.Is(err, storage.ErrRecoveryCodeNotFound) {
+		t.Fatalf("used code: got %v, want %v", err, storage.ErrRecoveryCodeNotFound)
+	}
+
+	count, err := s.CountRecoveryCodes(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("got %d remaining codes, want 1", count)
+	}
+}
@@ -0,0 +1,139 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opRedirectURIs            = "storage.sqlite.RedirectURIs"
+	opSaveAuthorizationCode   = "storage.sqlite.SaveAuthorizationCode"
+	opAuthorizationCode       = "storage.sqlite.AuthorizationCode"
+	opRedeemAuthorizationCode = "storage.sqlite.RedeemAuthorizationCode"
+	opDeleteExpiredCodes      = "storage.sqlite.DeleteExpiredAuthorizationCodes"
+)
+
+// RedirectURIs returns redirect URIs registered for the app
+func (s *Storage) RedirectURIs(ctx context.Context, appID int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT uri FROM redirect_uris WHERE app_id = ?", appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opRedirectURIs, err)
+	}
+	defer rows.Close()
+
+	var uris []string
+	for rows.Next() {
+		var uri string
+		if err = rows.Scan(&uri); err != nil {
+			return nil, fmt.Errorf("%s: %w", opRedirectURIs, err)
+		}
+		uris = append(uris, uri)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", opRedirectURIs, err)
+	}
+
+	return uris, nil
+}
+
+// SaveAuthorizationCode saves hashed authorization code
+func (s *Storage) SaveAuthorizationCode(ctx context.Context, code models.AuthorizationCode) error {
+	stmt, err := s.db.Prepare(`
+		INSERT INTO authorization_codes(code_hash, app_id, user_id, redirect_uri, code_challenge, scope, nonce, auth_time, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opSaveAuthorizationCode, err)
+	}
+
+	if _, err = stmt.ExecContext(
+		ctx,
+		code.CodeHash, code.AppID, code.UserID, code.RedirectURI, code.CodeChallenge,
+		code.Scope, code.Nonce, code.AuthTime.Unix(), code.ExpiresAt.Unix(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", opSaveAuthorizationCode, err)
+	}
+
+	return nil
+}
+
+// AuthorizationCode returns authorization code by its hash
+func (s *Storage) AuthorizationCode(ctx context.Context, codeHash string) (models.AuthorizationCode, error) {
+	var (
+		code                models.AuthorizationCode
+		authTime, expiresAt int64
+	)
+
+	stmt, err := s.db.Prepare(`
+		SELECT code_hash, app_id, user_id, redirect_uri, code_challenge, scope, nonce, auth_time, expires_at, used
+		FROM authorization_codes WHERE code_hash = ?`,
+	)
+	if err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", opAuthorizationCode, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, codeHash)
+	if err = row.Scan(
+		&code.CodeHash, &code.AppID, &code.UserID, &code.RedirectURI, &code.CodeChallenge,
+		&code.Scope, &code.Nonce, &authTime, &expiresAt, &code.Used,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.AuthorizationCode{}, storage.ErrCodeNotFound
+		}
+
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", opAuthorizationCode, err)
+	}
+
+	code.AuthTime = time.Unix(authTime, 0)
+	code.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return code, nil
+}
+
+// RedeemAuthorizationCode marks authorization code as used
+//
+// If code was already used, returns storage.ErrCodeAlreadyUsed
+func (s *Storage) RedeemAuthorizationCode(ctx context.Context, codeHash string) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE authorization_codes SET used = TRUE WHERE code_hash = ? AND used = FALSE",
+		codeHash,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opRedeemAuthorizationCode, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", opRedeemAuthorizationCode, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", opRedeemAuthorizationCode, storage.ErrCodeAlreadyUsed)
+	}
+
+	return nil
+}
+
+// DeleteExpiredAuthorizationCodes deletes authorization codes expired before given time
+//
+// Returns number of deleted codes
+func (s *Storage) DeleteExpiredAuthorizationCodes(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM authorization_codes WHERE expires_at < ?", before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opDeleteExpiredCodes, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opDeleteExpiredCodes, err)
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,222 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opSavePasskey              = "storage.sqlite.SavePasskey"
+	opPasskey                  = "storage.sqlite.Passkey"
+	opPasskeys                 = "storage.sqlite.Passkeys"
+	opUpdatePasskeySignCount   = "storage.sqlite.UpdatePasskeySignCount"
+	opSaveWebAuthnSession      = "storage.sqlite.SaveWebAuthnSession"
+	opWebAuthnSession          = "storage.sqlite.WebAuthnSession"
+	opDeleteWebAuthnSession    = "storage.sqlite.DeleteWebAuthnSession"
+	opDeleteExpiredWebAuthnSes = "storage.sqlite.DeleteExpiredWebAuthnSessions"
+)
+
+// SavePasskey saves registered passkey of the user
+//
+// If passkey with the same credential ID exists, returns storage.ErrPasskeyExists
+func (s *Storage) SavePasskey(ctx context.Context, passkey models.Passkey) error {
+	stmt, err := s.db.Prepare("INSERT INTO passkeys(id, user_id, public_key, sign_count, created_at) VALUES(?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", opSavePasskey, err)
+	}
+
+	if _, err = stmt.ExecContext(
+		ctx,
+		passkey.ID, passkey.UserID, passkey.PublicKey, passkey.SignCount, passkey.CreatedAt.Unix(),
+	); err != nil {
+		var sqliteErr sqlite3.Error
+
+		if errors.As(err, &sqliteErr) && (errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintPrimaryKey) ||
+			errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique)) {
+			return fmt.Errorf("%s: %w", opSavePasskey, storage.ErrPasskeyExists)
+		}
+
+		return fmt.Errorf("%s: %w", opSavePasskey, err)
+	}
+
+	return nil
+}
+
+// Passkey returns passkey by its credential ID
+func (s *Storage) Passkey(ctx context.Context, id []byte) (models.Passkey, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT id, user_id, public_key, sign_count, created_at, COALESCE(last_used_at, 0)
+		FROM passkeys WHERE id = ?`,
+	)
+	if err != nil {
+		return models.Passkey{}, fmt.Errorf("%s: %w", opPasskey, err)
+	}
+
+	passkey, err := scanPasskey(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Passkey{}, storage.ErrPasskeyNotFound
+		}
+
+		return models.Passkey{}, fmt.Errorf("%s: %w", opPasskey, err)
+	}
+
+	return passkey, nil
+}
+
+// Passkeys returns all passkeys of the user
+func (s *Storage) Passkeys(ctx context.Context, userID int64) ([]models.Passkey, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, public_key, sign_count, created_at, COALESCE(last_used_at, 0)
+		FROM passkeys WHERE user_id = ? ORDER BY created_at`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opPasskeys, err)
+	}
+	defer rows.Close()
+
+	var passkeys []models.Passkey
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", opPasskeys, err)
+		}
+		passkeys = append(passkeys, passkey)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", opPasskeys, err)
+	}
+
+	return passkeys, nil
+}
+
+// UpdatePasskeySignCount records use of the passkey with given signature counter
+//
+// Counter must be greater than the stored one unless the authenticator doesn't
+// count at all (both are zero), else returns storage.ErrPasskeySignCount:
+// the passkey may have been cloned
+func (s *Storage) UpdatePasskeySignCount(ctx context.Context, id []byte, signCount uint32, usedAt time.Time) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE passkeys SET sign_count = ?, last_used_at = ?
+		WHERE id = ? AND (sign_count < ? OR (sign_count = 0 AND ? = 0))`,
+		signCount, usedAt.Unix(), id, signCount, signCount,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opUpdatePasskeySignCount, err)
+	}
+
+	return checkAffected(opUpdatePasskeySignCount, res, storage.ErrPasskeySignCount)
+}
+
+// SaveWebAuthnSession saves pending WebAuthn ceremony
+func (s *Storage) SaveWebAuthnSession(ctx context.Context, session models.WebAuthnSession) error {
+	stmt, err := s.db.Prepare(`
+		INSERT INTO webauthn_sessions(challenge_hash, ceremony, user_id, app_id, nonce, mfa_challenge_hash, expires_at)
+		VALUES(?, ?, NULLIF(?, 0), NULLIF(?, 0), ?, ?, ?)`,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opSaveWebAuthnSession, err)
+	}
+
+	if _, err = stmt.ExecContext(
+		ctx,
+		session.ChallengeHash, session.Ceremony, session.UserID, session.AppID,
+		session.Nonce, session.MFAChallengeHash, session.ExpiresAt.Unix(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", opSaveWebAuthnSession, err)
+	}
+
+	return nil
+}
+
+// WebAuthnSession returns pending WebAuthn ceremony by hash of its challenge
+func (s *Storage) WebAuthnSession(ctx context.Context, challengeHash string) (models.WebAuthnSession, error) {
+	var (
+		session   models.WebAuthnSession
+		expiresAt int64
+	)
+
+	stmt, err := s.db.Prepare(`
+		SELECT challenge_hash, ceremony, COALESCE(user_id, 0), COALESCE(app_id, 0), nonce, mfa_challenge_hash, expires_at
+		FROM webauthn_sessions WHERE challenge_hash = ?`,
+	)
+	if err != nil {
+		return models.WebAuthnSession{}, fmt.Errorf("%s: %w", opWebAuthnSession, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, challengeHash)
+	if err = row.Scan(
+		&session.ChallengeHash, &session.Ceremony, &session.UserID, &session.AppID,
+		&session.Nonce, &session.MFAChallengeHash, &expiresAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebAuthnSession{}, storage.ErrWebAuthnSessionNotFound
+		}
+
+		return models.WebAuthnSession{}, fmt.Errorf("%s: %w", opWebAuthnSession, err)
+	}
+
+	session.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return session, nil
+}
+
+// DeleteWebAuthnSession deletes finished WebAuthn ceremony
+//
+// If session was already deleted, returns storage.ErrWebAuthnSessionNotFound,
+// so a challenge can't be answered twice concurrently
+func (s *Storage) DeleteWebAuthnSession(ctx context.Context, challengeHash string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM webauthn_sessions WHERE challenge_hash = ?", challengeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opDeleteWebAuthnSession, err)
+	}
+
+	return checkAffected(opDeleteWebAuthnSession, res, storage.ErrWebAuthnSessionNotFound)
+}
+
+// DeleteExpiredWebAuthnSessions deletes WebAuthn ceremonies expired before given time
+//
+// Returns number of deleted sessions
+func (s *Storage) DeleteExpiredWebAuthnSessions(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM webauthn_sessions WHERE expires_at < ?", before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opDeleteExpiredWebAuthnSes, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opDeleteExpiredWebAuthnSes, err)
+	}
+
+	return deleted, nil
+}
+
+func scanPasskey(row scanner) (models.Passkey, error) {
+	var (
+		passkey               models.Passkey
+		createdAt, lastUsedAt int64
+	)
+
+	if err := row.Scan(
+		&passkey.ID, &passkey.UserID, &passkey.PublicKey, &passkey.SignCount, &createdAt, &lastUsedAt,
+	); err != nil {
+		return models.Passkey{}, err
+	}
+
+	passkey.CreatedAt = time.Unix(createdAt, 0)
+	if lastUsedAt != 0 {
+		passkey.LastUsedAt = time.Unix(lastUsedAt, 0)
+	}
+
+	return passkey, nil
+}
@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opSavePasswordless       = "storage.sqlite.SavePasswordlessLogin"
+	opPasswordless           = "storage.sqlite.PasswordlessLogin"
+	opUsePasswordlessAttempt = "storage.sqlite.UsePasswordlessAttempt"
+	opDeletePasswordless     = "storage.sqlite.DeletePasswordlessLogin"
+)
+
+// SavePasswordlessLogin saves hashed passwordless login
+func (s *Storage) SavePasswordlessLogin(ctx context.Context, login models.PasswordlessLogin) error {
+	stmt, err := s.db.Prepare(
+		"INSERT INTO passwordless_logins(id_hash, user_id, app_id, nonce, code_hash, token_hash, expires_at) " +
+			"VALUES(?, ?, ?, ?, ?, ?, ?)",
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opSavePasswordless, err)
+	}
+
+	if _, err = stmt.ExecContext(
+		ctx,
+		login.IDHash, login.UserID, login.AppID, login.Nonce, login.CodeHash, login.TokenHash, login.ExpiresAt.Unix(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", opSavePasswordless, err)
+	}
+
+	return nil
+}
+
+// PasswordlessLogin returns passwordless login by hash of its id
+func (s *Storage) PasswordlessLogin(ctx context.Context, idHash string) (models.PasswordlessLogin, error) {
+	var (
+		login     models.PasswordlessLogin
+		expiresAt int64
+	)
+
+	stmt, err := s.db.Prepare(
+		"SELECT id_hash, user_id, app_id, nonce, code_hash, token_hash, attempts, expires_at " +
+			"FROM passwordless_logins WHERE id_hash = ?",
+	)
+	if err != nil {
+		return models.PasswordlessLogin{}, fmt.Errorf("%s: %w", opPasswordless, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, idHash)
+	if err = row.Scan(
+		&login.IDHash, &login.UserID, &login.AppID, &login.Nonce,
+		&login.CodeHash, &login.TokenHash, &login.Attempts, &expiresAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.PasswordlessLogin{}, storage.ErrPasswordlessNotFound
+		}
+
+		return models.PasswordlessLogin{}, fmt.Errorf("%s: %w", opPasswordless, err)
+	}
+
+	login.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return login, nil
+}
+
+// UsePasswordlessAttempt counts attempt to complete passwordless login
+//
+// If login has no attempts left or doesn't exist, returns
+// storage.ErrPasswordlessNotFound. Check and count are a single statement,
+// so concurrent attempts can't exceed maxAttempts
+func (s *Storage) UsePasswordlessAttempt(ctx context.Context, idHash string, maxAttempts int) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE passwordless_logins SET attempts = attempts + 1 WHERE id_hash = ? AND attempts < ?",
+		idHash, maxAttempts,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opUsePasswordlessAttempt, err)
+	}
+
+	return checkAffected(opUsePasswordlessAttempt, res, storage.ErrPasswordlessNotFound)
+}
+
+// DeletePasswordlessLogin deletes completed passwordless login
+//
+// If login was already deleted, returns storage.ErrPasswordlessNotFound,
+// so a login can't be completed twice concurrently
+func (s *Storage) DeletePasswordlessLogin(ctx context.Context, idHash string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM passwordless_logins WHERE id_hash = ?", idHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opDeletePasswordless, err)
+	}
+
+	return checkAffected(opDeletePasswordless, res, storage.ErrPasswordlessNotFound)
+}
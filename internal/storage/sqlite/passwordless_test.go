@@ -0,0 +1,45 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+func TestUsePasswordlessAttempt(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	if err := s.SavePasswordlessLogin(ctx, models.PasswordlessLogin{
+		IDHash:    "hash",
+		UserID:    1,
+		AppID:     1,
+		CodeHash:  "code",
+		TokenHash: "token",
+		ExpiresAt: time.Now().Add(time.Minute),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 3 {
+		if err := s.UsePasswordlessAttempt(ctx, "hash", 3); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+
+	if err := s.UsePasswordlessAttempt(ctx, "hash", 3); !errors.Is(err, storage.ErrPasswordlessNotFound) {
+		t.Fatalf("attempt over the limit: got %v, want %v", err, storage.ErrPasswordlessNotFound)
+	}
+
+	login, err := s.PasswordlessLogin(ctx, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.Attempts != 3 {
+		t.Fatalf("got %d attempts, want 3", login.Attempts)
+	}
+}
@@ -0,0 +1,430 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opSaveRole         = "storage.sqlite.SaveRole"
+	opRole             = "storage.sqlite.Role"
+	opRoles            = "storage.sqlite.Roles"
+	opDeleteRole       = "storage.sqlite.DeleteRole"
+	opSavePermission   = "storage.sqlite.SavePermission"
+	opPermission       = "storage.sqlite.Permission"
+	opPermissions      = "storage.sqlite.Permissions"
+	opDeletePermission = "storage.sqlite.DeletePermission"
+	opGrantPermission  = "storage.sqlite.GrantPermission"
+	opRevokePermission = "storage.sqlite.RevokePermission"
+	opAssignRole       = "storage.sqlite.AssignRole"
+	opUnassignRole     = "storage.sqlite.UnassignRole"
+	opUserRoles        = "storage.sqlite.UserRoles"
+	opHasPermission    = "storage.sqlite.HasPermission"
+	opUsersRoles       = "storage.sqlite.UsersRoles"
+)
+
+// SaveRole saves role of the app and returns its ID
+//
+// If the app has a role with the same name, returns storage.ErrRoleExists
+func (s *Storage) SaveRole(ctx context.Context, appID int, name string) (int64, error) {
+	id, err := s.insertNamed(ctx, "INSERT INTO roles(app_id, name) VALUES(?, ?)", appID, name)
+	if err != nil {
+		if errors.Is(err, errUnique) {
+			return 0, fmt.Errorf("%s: %w", opSaveRole, storage.ErrRoleExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", opSaveRole, err)
+	}
+
+	return id, nil
+}
+
+// Role returns role by ID without its permissions
+func (s *Storage) Role(ctx context.Context, roleID int64) (models.Role, error) {
+	role := models.Role{ID: roleID}
+
+	row := s.db.QueryRowContext(ctx, "SELECT app_id, name FROM roles WHERE id = ?", roleID)
+	if err := row.Scan(&role.AppID, &role.Name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Role{}, fmt.Errorf("%s: %w", opRole, storage.ErrRoleNotFound)
+		}
+
+		return models.Role{}, fmt.Errorf("%s: %w", opRole, err)
+	}
+
+	return role, nil
+}
+
+// Roles returns roles of the app with names of their permissions, ordered by name
+func (s *Storage) Roles(ctx context.Context, appID int) ([]models.Role, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.id, r.name, p.name
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		WHERE r.app_id = ?
+		ORDER BY r.name, p.name`,
+		appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opRoles, err)
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+
+	for rows.Next() {
+		var (
+			id         int64
+			name       string
+			permission sql.NullString
+		)
+
+		if err = rows.Scan(&id, &name, &permission); err != nil {
+			return nil, fmt.Errorf("%s: %w", opRoles, err)
+		}
+
+		if len(roles) == 0 || roles[len(roles)-1].ID != id {
+			roles = append(roles, models.Role{ID: id, AppID: appID, Name: name})
+		}
+
+		if permission.Valid {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, permission.String)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", opRoles, err)
+	}
+
+	return roles, nil
+}
+
+// DeleteRole deletes role, its grants and assignments to users
+func (s *Storage) DeleteRole(ctx context.Context, roleID int64) error {
+	err := s.deleteNamed(
+		ctx,
+		"DELETE FROM roles WHERE id = ?",
+		roleID,
+		"DELETE FROM role_permissions WHERE role_id = ?",
+		"DELETE FROM user_roles WHERE role_id = ?",
+	)
+	if err != nil {
+		if errors.Is(err, errNone) {
+			return fmt.Errorf("%s: %w", opDeleteRole, storage.ErrRoleNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", opDeleteRole, err)
+	}
+
+	return nil
+}
+
+// SavePermission saves permission of the app and returns its ID
+//
+// If the app has a permission with the same name, returns storage.ErrPermissionExists
+func (s *Storage) SavePermission(ctx context.Context, appID int, name string) (int64, error) {
+	id, err := s.insertNamed(ctx, "INSERT INTO permissions(app_id, name) VALUES(?, ?)", appID, name)
+	if err != nil {
+		if errors.Is(err, errUnique) {
+			return 0, fmt.Errorf("%s: %w", opSavePermission, storage.ErrPermissionExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", opSavePermission, err)
+	}
+
+	return id, nil
+}
+
+// Permission returns permission by ID
+func (s *Storage) Permission(ctx context.Context, permissionID int64) (models.Permission, error) {
+	permission := models.Permission{ID: permissionID}
+
+	row := s.db.QueryRowContext(ctx, "SELECT app_id, name FROM permissions WHERE id = ?", permissionID)
+	if err := row.Scan(&permission.AppID, &permission.Name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Permission{}, fmt.Errorf("%s: %w", opPermission, storage.ErrPermissionNotFound)
+		}
+
+		return models.Permission{}, fmt.Errorf("%s: %w", opPermission, err)
+	}
+
+	return permission, nil
+}
+
+// Permissions returns permissions of the app ordered by name
+func (s *Storage) Permissions(ctx context.Context, appID int) ([]models.Permission, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name FROM permissions WHERE app_id = ? ORDER BY name", appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opPermissions, err)
+	}
+	defer rows.Close()
+
+	var permissions []models.Permission
+
+	for rows.Next() {
+		permission := models.Permission{AppID: appID}
+		if err = rows.Scan(&permission.ID, &permission.Name); err != nil {
+			return nil, fmt.Errorf("%s: %w", opPermissions, err)
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", opPermissions, err)
+	}
+
+	return permissions, nil
+}
+
+// DeletePermission deletes permission and its grants to roles
+func (s *Storage) DeletePermission(ctx context.Context, permissionID int64) error {
+	err := s.deleteNamed(
+		ctx,
+		"DELETE FROM permissions WHERE id = ?",
+		permissionID,
+		"DELETE FROM role_permissions WHERE permission_id = ?",
+	)
+	if err != nil {
+		if errors.Is(err, errNone) {
+			return fmt.Errorf("%s: %w", opDeletePermission, storage.ErrPermissionNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", opDeletePermission, err)
+	}
+
+	return nil
+}
+
+// GrantPermission grants permission to the role, granting it again changes nothing
+func (s *Storage) GrantPermission(ctx context.Context, roleID int64, permissionID int64) error {
+	if _, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO role_permissions(role_id, permission_id) VALUES(?, ?) ON CONFLICT DO NOTHING",
+		roleID, permissionID,
+	); err != nil {
+		return fmt.Errorf("%s: %w", opGrantPermission, err)
+	}
+
+	return nil
+}
+
+// RevokePermission revokes permission from the role, if it's granted
+func (s *Storage) RevokePermission(ctx context.Context, roleID int64, permissionID int64) error {
+	if _, err := s.db.ExecContext(
+		ctx,
+		"DELETE FROM role_permissions WHERE role_id = ? AND permission_id = ?",
+		roleID, permissionID,
+	); err != nil {
+		return fmt.Errorf("%s: %w", opRevokePermission, err)
+	}
+
+	return nil
+}
+
+// AssignRole assigns role to the user, assigning it again changes nothing
+func (s *Storage) AssignRole(ctx context.Context, userID int64, roleID int64) error {
+	if _, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO user_roles(user_id, role_id) VALUES(?, ?) ON CONFLICT DO NOTHING",
+		userID, roleID,
+	); err != nil {
+		return fmt.Errorf("%s: %w", opAssignRole, err)
+	}
+
+	return nil
+}
+
+// UnassignRole takes role away from the user, if it's assigned
+func (s *Storage) UnassignRole(ctx context.Context, userID int64, roleID int64) error {
+	if _, err := s.db.ExecContext(
+		ctx,
+		"DELETE FROM user_roles WHERE user_id = ? AND role_id = ?",
+		userID, roleID,
+	); err != nil {
+		return fmt.Errorf("%s: %w", opUnassignRole, err)
+	}
+
+	return nil
+}
+
+// UserRoles returns roles of the user in the app without their permissions, ordered by name
+func (s *Storage) UserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.id, r.name
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = ? AND r.app_id = ?
+		ORDER BY r.name`,
+		userID, appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opUserRoles, err)
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+
+	for rows.Next() {
+		role := models.Role{AppID: appID}
+		if err = rows.Scan(&role.ID, &role.Name); err != nil {
+			return nil, fmt.Errorf("%s: %w", opUserRoles, err)
+		}
+
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", opUserRoles, err)
+	}
+
+	return roles, nil
+}
+
+// HasPermission reports whether any role of the user in the app grants the permission
+func (s *Storage) HasPermission(ctx context.Context, userID int64, appID int, permission string) (bool, error) {
+	var has bool
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM user_roles ur
+			JOIN roles r ON r.id = ur.role_id
+			JOIN role_permissions rp ON rp.role_id = r.id
+			JOIN permissions p ON p.id = rp.permission_id
+			WHERE ur.user_id = ? AND r.app_id = ? AND p.name = ?
+		)`,
+		userID, appID, permission,
+	)
+	if err := row.Scan(&has); err != nil {
+		return false, fmt.Errorf("%s: %w", opHasPermission, err)
+	}
+
+	return has, nil
+}
+
+// UsersRoles returns roles of every given user in the app with names of their
+// permissions, ordered by name, in a single query. Users without roles are omitted
+func (s *Storage) UsersRoles(ctx context.Context, users []models.AppUser) (map[models.AppUser][]models.Role, error) {
+	roles := make(map[models.AppUser][]models.Role, len(users))
+	if len(users) == 0 {
+		return roles, nil
+	}
+
+	values := make([]string, 0, len(users))
+	args := make([]any, 0, 2*len(users))
+	for _, user := range users {
+		values = append(values, "(?, ?)")
+		args = append(args, user.UserID, user.AppID)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		WITH wanted(user_id, app_id) AS (VALUES `+strings.Join(values, ", ")+`)
+		SELECT DISTINCT ur.user_id, r.app_id, r.id, r.name, p.name
+		FROM wanted w
+		JOIN user_roles ur ON ur.user_id = w.user_id
+		JOIN roles r ON r.id = ur.role_id AND r.app_id = w.app_id
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		ORDER BY ur.user_id, r.app_id, r.name, p.name`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opUsersRoles, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			user       models.AppUser
+			role       models.Role
+			permission sql.NullString
+		)
+
+		if err = rows.Scan(&user.UserID, &user.AppID, &role.ID, &role.Name, &permission); err != nil {
+			return nil, fmt.Errorf("%s: %w", opUsersRoles, err)
+		}
+
+		list := roles[user]
+		if len(list) == 0 || list[len(list)-1].ID != role.ID {
+			role.AppID = user.AppID
+			list = append(list, role)
+		}
+
+		if permission.Valid {
+			last := &list[len(list)-1]
+			last.Permissions = append(last.Permissions, permission.String)
+		}
+
+		roles[user] = list
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", opUsersRoles, err)
+	}
+
+	return roles, nil
+}
+
+var (
+	// errUnique is returned by insertNamed when the name is taken
+	errUnique = errors.New("unique constraint failed")
+	// errNone is returned by deleteNamed when there's nothing to delete
+	errNone = errors.New("no rows deleted")
+)
+
+// insertNamed inserts role or permission and returns its ID
+func (s *Storage) insertNamed(ctx context.Context, query string, appID int, name string) (int64, error) {
+	res, err := s.db.ExecContext(ctx, query, appID, name)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return 0, errUnique
+		}
+
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+// deleteNamed deletes role or permission by ID along with rows referencing it,
+// as foreign keys aren't enforced
+func (s *Storage) deleteNamed(ctx context.Context, query string, id int64, references ...string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, ref := range references {
+		if _, err = tx.ExecContext(ctx, ref, id); err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errNone
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,146 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate"
+	_ "github.com/golang-migrate/migrate/database/sqlite3"
+	_ "github.com/golang-migrate/migrate/source/file"
+	"github.com/nhassl3/sso/internal/domain/models"
+)
+
+// benchUsers is the number of users with checks in a single gateway request
+const benchUsers = 50
+
+// newTestStorage returns storage in a temporary database with all migrations applied
+func newTestStorage(tb testing.TB) *Storage {
+	tb.Helper()
+
+	path := filepath.Join(tb.TempDir(), "sso.db")
+
+	m, err := migrate.New("file://../../../migrations", "sqlite3://"+path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err = m.Up(); err != nil {
+		tb.Fatal(err)
+	}
+	_, _ = m.Close()
+
+	s, err := New(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = s.db.Close() })
+
+	return s
+}
+
+// seedRoles creates users, each assigned a role granting a few permissions,
+// and returns checks of a permission every role grants
+func seedRoles(tb testing.TB, s *Storage, users int) []models.PermissionCheck {
+	tb.Helper()
+
+	ctx := context.Background()
+
+	roleID, err := s.SaveRole(ctx, 1, "editor")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	for _, name := range []string{"articles:read", "articles:write", "comments:write"} {
+		permissionID, err := s.SavePermission(ctx, 1, name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err = s.GrantPermission(ctx, roleID, permissionID); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	checks := make([]models.PermissionCheck, 0, users)
+	for i := range users {
+		email := fmt.Sprintf("user%d@example.com", i)
+
+		userID, err := s.SaveUser(ctx, email, email, []byte("hash"))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err = s.AssignRole(ctx, userID, roleID); err != nil {
+			tb.Fatal(err)
+		}
+
+		checks = append(checks, models.PermissionCheck{
+			UserID:   userID,
+			AppID:    1,
+			Resource: "articles",
+			Action:   "write",
+		})
+	}
+
+	return checks
+}
+
+func TestUsersRoles(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	checks := seedRoles(t, s, 2)
+
+	users := []models.AppUser{
+		{UserID: checks[0].UserID, AppID: 1},
+		{UserID: checks[1].UserID, AppID: 1},
+		{UserID: checks[0].UserID, AppID: 2},
+	}
+
+	roles, err := s.UsersRoles(ctx, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(roles) != 2 {
+		t.Fatalf("got roles of %d users, want 2", len(roles))
+	}
+
+	for _, user := range users[:2] {
+		got := roles[user]
+		if len(got) != 1 || got[0].Name != "editor" || len(got[0].Permissions) != 3 {
+			t.Errorf("roles of %+v = %+v, want editor with 3 permissions", user, got)
+		}
+	}
+}
+
+// BenchmarkCheckPermissions compares a HasPermission query per check
+// to loading roles of every user with a single UsersRoles query
+func BenchmarkCheckPermissions(b *testing.B) {
+	s := newTestStorage(b)
+	ctx := context.Background()
+
+	checks := seedRoles(b, s, benchUsers)
+
+	b.Run("single", func(b *testing.B) {
+		for range b.N {
+			for _, check := range checks {
+				if _, err := s.HasPermission(ctx, check.UserID, check.AppID, "articles:write"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("batch", func(b *testing.B) {
+		users := make([]models.AppUser, 0, len(checks))
+		for _, check := range checks {
+			users = append(users, models.AppUser{UserID: check.UserID, AppID: check.AppID})
+		}
+
+		for range b.N {
+			if _, err := s.UsersRoles(ctx, users); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
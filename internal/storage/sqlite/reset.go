@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opSaveResetToken   = "storage.sqlite.SavePasswordResetToken"
+	opResetToken       = "storage.sqlite.PasswordResetToken"
+	opDeleteResetToken = "storage.sqlite.DeletePasswordResetToken"
+)
+
+// SavePasswordResetToken saves hashed password reset token
+func (s *Storage) SavePasswordResetToken(ctx context.Context, token models.PasswordResetToken) error {
+	stmt, err := s.db.Prepare("INSERT INTO password_reset_tokens(token_hash, user_id, expires_at) VALUES(?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", opSaveResetToken, err)
+	}
+
+	if _, err = stmt.ExecContext(ctx, token.TokenHash, token.UserID, token.ExpiresAt.Unix()); err != nil {
+		return fmt.Errorf("%s: %w", opSaveResetToken, err)
+	}
+
+	return nil
+}
+
+// PasswordResetToken returns password reset token by its hash
+func (s *Storage) PasswordResetToken(ctx context.Context, tokenHash string) (models.PasswordResetToken, error) {
+	var (
+		token     models.PasswordResetToken
+		expiresAt int64
+	)
+
+	stmt, err := s.db.Prepare("SELECT token_hash, user_id, expires_at FROM password_reset_tokens WHERE token_hash = ?")
+	if err != nil {
+		return models.PasswordResetToken{}, fmt.Errorf("%s: %w", opResetToken, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, tokenHash)
+	if err = row.Scan(&token.TokenHash, &token.UserID, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.PasswordResetToken{}, storage.ErrResetTokenNotFound
+		}
+
+		return models.PasswordResetToken{}, fmt.Errorf("%s: %w", opResetToken, err)
+	}
+
+	token.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return token, nil
+}
+
+// DeletePasswordResetToken deletes used password reset token
+//
+// If token was already deleted, returns storage.ErrResetTokenNotFound,
+// so the same token can't be used twice concurrently
+func (s *Storage) DeletePasswordResetToken(ctx context.Context, tokenHash string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM password_reset_tokens WHERE token_hash = ?", tokenHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opDeleteResetToken, err)
+	}
+
+	return checkAffected(opDeleteResetToken, res, storage.ErrResetTokenNotFound)
+}
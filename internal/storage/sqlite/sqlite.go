@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/mattn/go-sqlite3"
 	_ "github.com/mattn/go-sqlite3"
@@ -13,13 +14,24 @@ import (
 )
 
 const (
-	opNew      = "storage.sqlite.New"
-	opSaveUser = "storage.sqlite.SaveUser"
-	opUser     = "storage.sqlite.User"
-	opIsAdmin  = "storage.sqlite.IsAdmin"
-	opApp      = "storage.sqlite.App"
+	opNew         = "storage.sqlite.New"
+	opSaveUser    = "storage.sqlite.SaveUser"
+	opUpdatePass  = "storage.sqlite.UpdatePasswordHash"
+	opReplacePass = "storage.sqlite.ReplacePassword"
+	opUser        = "storage.sqlite.User"
+	opEmails      = "storage.sqlite.UserEmails"
+	opNormalize   = "storage.sqlite.NormalizeEmails"
+	opUnnormalize = "storage.sqlite.UnnormalizedEmails"
+	opUserByID    = "storage.sqlite.UserByID"
+	opIsAdmin     = "storage.sqlite.IsAdmin"
+	opApp         = "storage.sqlite.App"
 )
 
+// userColumns are scanned into models.User. Either an enabled TOTP authenticator
+// or a registered passkey is a second factor of the user
+const userColumns = "id, email, pass_hash, " +
+	"totp_enabled OR EXISTS(SELECT 1 FROM passkeys WHERE passkeys.user_id = users.id), email_verified"
+
 type Storage struct {
 	db *sql.DB
 }
@@ -35,15 +47,16 @@ func New(storagePath string) (*Storage, error) {
 
 // SaveUser save user in database with given credentials
 //
+// normalizedEmail is the canonical form of email, unique among users.
 // returns user ID if function successfully complete. Type: int64
 // else return error
-func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (int64, error) {
-	stmt, err := s.db.Prepare("INSERT INTO users(email, pass_hash) VALUES(?, ?)")
+func (s *Storage) SaveUser(ctx context.Context, email string, normalizedEmail string, passHash []byte) (int64, error) {
+	stmt, err := s.db.Prepare("INSERT INTO users(email, email_normalized, pass_hash) VALUES(?, ?, ?)")
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", opSaveUser, err)
 	}
 
-	res, err := stmt.ExecContext(ctx, email, passHash)
+	res, err := stmt.ExecContext(ctx, email, normalizedEmail, passHash)
 	if err != nil {
 		var sqliteErr sqlite3.Error
 
@@ -62,18 +75,81 @@ func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (
 	return id, nil
 }
 
-// User returns user by email
-func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
+// UpdatePasswordHash replaces password hash of the user if it's still the expected one
+//
+// Check and update are a single statement, so of concurrent changes from the same
+// password only one succeeds, others get storage.ErrPasswordHashMismatch
+func (s *Storage) UpdatePasswordHash(ctx context.Context, userID int64, expected []byte, passHash []byte) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE users SET pass_hash = ? WHERE id = ? AND pass_hash = ?",
+		passHash, userID, expected,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opUpdatePass, err)
+	}
+
+	return checkAffected(opUpdatePass, res, storage.ErrPasswordHashMismatch)
+}
+
+// ReplacePassword replaces password hash of the user like UpdatePasswordHash does,
+// revokes sessions of the user like RevokeUserSessions does and deletes password
+// reset tokens of the user, all in one transaction
+//
+// So the password never changes while sessions opened with the old one stay valid
+func (s *Storage) ReplacePassword(
+	ctx context.Context,
+	userID int64,
+	expected []byte,
+	passHash []byte,
+	revokeBefore time.Time,
+) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opReplacePass, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"UPDATE users SET pass_hash = ? WHERE id = ? AND pass_hash = ?",
+		passHash, userID, expected,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opReplacePass, err)
+	}
+
+	if err = checkAffected(opReplacePass, res, storage.ErrPasswordHashMismatch); err != nil {
+		return err
+	}
+
+	if err = revokeUserSessions(ctx, tx, userID, revokeBefore); err != nil {
+		return fmt.Errorf("%s: %w", opReplacePass, err)
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM password_reset_tokens WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("%s: %w", opReplacePass, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", opReplacePass, err)
+	}
+
+	return nil
+}
+
+// User returns user by canonical form of the email
+func (s *Storage) User(ctx context.Context, normalizedEmail string) (models.User, error) {
 	var user models.User
 
-	stmt, err := s.db.Prepare("SELECT id, email, pass_hash FROM users WHERE email = ?")
+	stmt, err := s.db.Prepare("SELECT " + userColumns + " FROM users WHERE email_normalized = ?")
 	if err != nil {
 		return models.User{}, fmt.Errorf("%s: %w", opUser, err)
 	}
 
-	row := stmt.QueryRowContext(ctx, email)
+	row := stmt.QueryRowContext(ctx, normalizedEmail)
 
-	if err = row.Scan(&user.ID, &user.Email, &user.PasswordHash); err != nil {
+	if err = row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.MFAEnabled, &user.EmailVerified); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.User{}, storage.ErrUserNotFound
 		}
@@ -84,6 +160,176 @@ func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 	return user, nil
 }
 
+// UserEmails returns emails of every user by user ID, as they were registered
+func (s *Storage) UserEmails(ctx context.Context) (map[int64]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, email FROM users")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opEmails, err)
+	}
+	defer rows.Close()
+
+	emails := make(map[int64]string)
+
+	for rows.Next() {
+		var (
+			id    int64
+			email string
+		)
+
+		if err = rows.Scan(&id, &email); err != nil {
+			return nil, fmt.Errorf("%s: %w", opEmails, err)
+		}
+
+		emails[id] = email
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", opEmails, err)
+	}
+
+	return emails, nil
+}
+
+// NormalizeEmails sets canonical form of the email of every user, as given by
+// normalize, reading emails and writing the forms in a single transaction.
+// Only users whose form changes are updated. storage.ErrUserExists is returned
+// if two users get the same form, errors of normalize are returned as is
+//
+// Returns number of updated users
+func (s *Storage) NormalizeEmails(ctx context.Context, normalize func(email string) (string, error)) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opNormalize, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	changed, err := changedNormalizedEmails(ctx, tx, normalize)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opNormalize, err)
+	}
+
+	// clear changed forms first, so swapped forms don't collide halfway through
+	for id := range changed {
+		if _, err = tx.ExecContext(ctx, "UPDATE users SET email_normalized = NULL WHERE id = ?", id); err != nil {
+			return 0, fmt.Errorf("%s: %w", opNormalize, err)
+		}
+	}
+
+	for id, email := range changed {
+		if _, err = tx.ExecContext(ctx, "UPDATE users SET email_normalized = ? WHERE id = ?", email, id); err != nil {
+			var sqliteErr sqlite3.Error
+
+			if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+				return 0, fmt.Errorf("%s: %w", opNormalize, storage.ErrUserExists)
+			}
+
+			return 0, fmt.Errorf("%s: %w", opNormalize, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", opNormalize, err)
+	}
+
+	return len(changed), nil
+}
+
+// UnnormalizedEmails returns number of users whose stored canonical form of the email
+// is missing or differs from the one given by normalize. Emails normalize fails on
+// are counted as well
+func (s *Storage) UnnormalizedEmails(ctx context.Context, normalize func(email string) (string, error)) (int, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT email, email_normalized FROM users")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", opUnnormalize, err)
+	}
+	defer rows.Close()
+
+	count := 0
+
+	for rows.Next() {
+		var (
+			email   string
+			current sql.NullString
+		)
+
+		if err = rows.Scan(&email, &current); err != nil {
+			return 0, fmt.Errorf("%s: %w", opUnnormalize, err)
+		}
+
+		normalized, err := normalize(email)
+		if err != nil || !current.Valid || current.String != normalized {
+			count++
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", opUnnormalize, err)
+	}
+
+	return count, nil
+}
+
+// changedNormalizedEmails returns new canonical forms of emails by user ID
+// of the users whose stored form differs from the one given by normalize
+func changedNormalizedEmails(
+	ctx context.Context,
+	tx *sql.Tx,
+	normalize func(email string) (string, error),
+) (map[int64]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id, email, email_normalized FROM users")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changed := make(map[int64]string)
+
+	for rows.Next() {
+		var (
+			id      int64
+			email   string
+			current sql.NullString
+		)
+
+		if err = rows.Scan(&id, &email, &current); err != nil {
+			return nil, err
+		}
+
+		normalized, err := normalize(email)
+		if err != nil {
+			return nil, fmt.Errorf("email of user %d: %w", id, err)
+		}
+
+		if !current.Valid || current.String != normalized {
+			changed[id] = normalized
+		}
+	}
+
+	return changed, rows.Err()
+}
+
+// UserByID returns user by id
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	var user models.User
+
+	stmt, err := s.db.Prepare("SELECT " + userColumns + " FROM users WHERE id = ?")
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", opUserByID, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, userID)
+
+	if err = row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.MFAEnabled, &user.EmailVerified); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, storage.ErrUserNotFound
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", opUserByID, err)
+	}
+
+	return user, nil
+}
+
 func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 	var isAdmin bool
 
@@ -92,8 +338,7 @@ func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 		return false, fmt.Errorf("%s: %w", opIsAdmin, err)
 	}
 
-	res, err := stmt.QueryContext(ctx, userID)
-	if err != nil {
+	if err := stmt.QueryRowContext(ctx, userID).Scan(&isAdmin); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return false, storage.ErrUserNotFound
 		}
@@ -101,25 +346,21 @@ func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 		return false, fmt.Errorf("%s: %w", opIsAdmin, err)
 	}
 
-	if err := res.Scan(&isAdmin); err != nil {
-		return false, fmt.Errorf("%s: %w", opIsAdmin, err)
-	}
-
 	return isAdmin, nil
 }
 
 func (s *Storage) App(ctx context.Context, appID int) (models.App, error) {
 	var app models.App
 
-	stmt, err := s.db.Prepare("SELECT id, name, secret FROM apps where id = ?")
+	stmt, err := s.db.Prepare("SELECT id, name, secret, require_verified_email FROM apps where id = ?")
 	if err != nil {
 		return models.App{}, fmt.Errorf("%s: %w", opApp, err)
 	}
 
 	row := stmt.QueryRowContext(ctx, appID)
-	if err = row.Scan(&app.ID, &app.Name, &app.Secret); err != nil {
+	if err = row.Scan(&app.ID, &app.Name, &app.Secret, &app.RequireVerifiedEmail); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.App{}, storage.ErrUserNotFound
+			return models.App{}, storage.ErrAppNotFound
 		}
 
 		return models.App{}, fmt.Errorf("%s: %w", opApp, err)
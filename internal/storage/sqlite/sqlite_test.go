@@ -0,0 +1,201 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+func TestUser_MFAEnabled(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	id, err := s.SaveUser(ctx, "user@example.com", "user@example.com", []byte("hash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := s.UserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.MFAEnabled {
+		t.Fatal("user without second factor has MFA enabled")
+	}
+
+	if err = s.SavePasskey(ctx, models.Passkey{
+		ID:        []byte("credential"),
+		UserID:    id,
+		PublicKey: []byte("key"),
+		CreatedAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err = s.User(ctx, "user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.MFAEnabled {
+		t.Fatal("user with a passkey has MFA disabled")
+	}
+}
+
+func TestReplacePassword(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	id, err := s.SaveUser(ctx, "user@example.com", "user@example.com", []byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuedAt := time.Now().Add(-time.Second)
+
+	if err = s.SaveRefreshToken(ctx, models.RefreshToken{
+		TokenHash: "refresh",
+		FamilyID:  "family",
+		UserID:    id,
+		AppID:     1,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.SavePasswordResetToken(ctx, models.PasswordResetToken{
+		TokenHash: "reset",
+		UserID:    id,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.ReplacePassword(ctx, id, []byte("other"), []byte("new"), time.Now())
+	if !errors.Is(err, storage.ErrPasswordHashMismatch) {
+		t.Fatalf("got %v, want ErrPasswordHashMismatch", err)
+	}
+
+	revoked, err := s.IsTokenRevoked(ctx, "jti", id, issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked {
+		t.Fatal("sessions are revoked without changing the password")
+	}
+
+	if err = s.ReplacePassword(ctx, id, []byte("old"), []byte("new"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := s.UserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(user.PasswordHash) != "new" {
+		t.Fatalf("got password hash %q, want %q", user.PasswordHash, "new")
+	}
+
+	revoked, err = s.IsTokenRevoked(ctx, "jti", id, issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Fatal("access token issued before the change isn't revoked")
+	}
+
+	refresh, err := s.RefreshToken(ctx, "refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !refresh.Revoked {
+		t.Fatal("refresh token isn't revoked")
+	}
+
+	if _, err = s.PasswordResetToken(ctx, "reset"); !errors.Is(err, storage.ErrResetTokenNotFound) {
+		t.Fatalf("got %v, want ErrResetTokenNotFound", err)
+	}
+}
+
+func TestNormalizeEmails(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	// forms of the first two users are swapped by the normalization
+	for _, u := range []struct{ email, normalized string }{
+		{"B@example.com", "a@example.com"},
+		{"A@example.com", "b@example.com"},
+		{"c@example.com", "c@example.com"},
+	} {
+		if _, err := s.SaveUser(ctx, u.email, u.normalized, []byte("hash")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lower := func(email string) (string, error) { return strings.ToLower(email), nil }
+
+	updated, err := s.NormalizeEmails(ctx, lower)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 2 {
+		t.Fatalf("got %d updated users, want 2", updated)
+	}
+
+	user, err := s.User(ctx, "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "A@example.com" {
+		t.Fatalf("got user %q by a@example.com", user.Email)
+	}
+
+	if updated, err = s.NormalizeEmails(ctx, lower); err != nil || updated != 0 {
+		t.Fatalf("got %d updated users and %v, want nothing updated", updated, err)
+	}
+
+	_, err = s.NormalizeEmails(ctx, func(string) (string, error) { return "same@example.com", nil })
+	if !errors.Is(err, storage.ErrUserExists) {
+		t.Fatalf("got %v, want ErrUserExists", err)
+	}
+
+	if _, err = s.User(ctx, "c@example.com"); err != nil {
+		t.Fatalf("forms aren't rolled back: %v", err)
+	}
+}
+
+func TestUnnormalizedEmails(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	for _, u := range []struct{ email, normalized string }{
+		{"A@example.com", "A@example.com"},
+		{"b@example.com", "b@example.com"},
+	} {
+		if _, err := s.SaveUser(ctx, u.email, u.normalized, []byte("hash")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lower := func(email string) (string, error) { return strings.ToLower(email), nil }
+
+	count, err := s.UnnormalizedEmails(ctx, lower)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("got %d unnormalized emails, want 1", count)
+	}
+
+	if _, err = s.NormalizeEmails(ctx, lower); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, err = s.UnnormalizedEmails(ctx, lower); err != nil || count != 0 {
+		t.Fatalf("got %d unnormalized emails and %v, want none", count, err)
+	}
+}
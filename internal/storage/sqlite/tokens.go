@@ -0,0 +1,232 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opSaveRefreshToken         = "storage.sqlite.SaveRefreshToken"
+	opRefreshToken             = "storage.sqlite.RefreshToken"
+	opRotateRefreshToken       = "storage.sqlite.RotateRefreshToken"
+	opRevokeRefreshTokenFamily = "storage.sqlite.RevokeRefreshTokenFamily"
+	opRevokeToken              = "storage.sqlite.RevokeToken"
+	opIsTokenRevoked           = "storage.sqlite.IsTokenRevoked"
+	opRevokeUserSessions       = "storage.sqlite.RevokeUserSessions"
+	opDeleteExpiredTokens      = "storage.sqlite.DeleteExpiredTokens"
+)
+
+// SaveRefreshToken saves hashed refresh token
+func (s *Storage) SaveRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	stmt, err := s.db.Prepare(
+		"INSERT INTO refresh_tokens(token_hash, family_id, user_id, app_id, expires_at) VALUES(?, ?, ?, ?, ?)",
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opSaveRefreshToken, err)
+	}
+
+	if _, err = stmt.ExecContext(
+		ctx, token.TokenHash, token.FamilyID, token.UserID, token.AppID, token.ExpiresAt.Unix(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", opSaveRefreshToken, err)
+	}
+
+	return nil
+}
+
+// RefreshToken returns refresh token by its hash
+func (s *Storage) RefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	var (
+		token     models.RefreshToken
+		expiresAt int64
+	)
+
+	stmt, err := s.db.Prepare(
+		"SELECT id, token_hash, family_id, user_id, app_id, expires_at, used, revoked FROM refresh_tokens WHERE token_hash = ?",
+	)
+	if err != nil {
+		return models.RefreshToken{}, fmt.Errorf("%s: %w", opRefreshToken, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, tokenHash)
+	if err = row.Scan(
+		&token.ID, &token.TokenHash, &token.FamilyID, &token.UserID, &token.AppID, &expiresAt, &token.Used, &token.Revoked,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.RefreshToken{}, storage.ErrRefreshTokenNotFound
+		}
+
+		return models.RefreshToken{}, fmt.Errorf("%s: %w", opRefreshToken, err)
+	}
+
+	token.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return token, nil
+}
+
+// RotateRefreshToken marks token with given hash as used and saves the next one in the same transaction
+//
+// If token was already used or revoked (e.g. concurrent refresh), returns storage.ErrRefreshTokenAlreadyUsed
+func (s *Storage) RotateRefreshToken(ctx context.Context, usedHash string, next models.RefreshToken) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opRotateRefreshToken, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"UPDATE refresh_tokens SET used = TRUE WHERE token_hash = ? AND used = FALSE AND revoked = FALSE",
+		usedHash,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opRotateRefreshToken, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", opRotateRefreshToken, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", opRotateRefreshToken, storage.ErrRefreshTokenAlreadyUsed)
+	}
+
+	if _, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO refresh_tokens(token_hash, family_id, user_id, app_id, expires_at) VALUES(?, ?, ?, ?, ?)",
+		next.TokenHash, next.FamilyID, next.UserID, next.AppID, next.ExpiresAt.Unix(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", opRotateRefreshToken, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", opRotateRefreshToken, err)
+	}
+
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes all refresh tokens issued in the same family
+func (s *Storage) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	stmt, err := s.db.Prepare("UPDATE refresh_tokens SET revoked = TRUE WHERE family_id = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", opRevokeRefreshTokenFamily, err)
+	}
+
+	if _, err = stmt.ExecContext(ctx, familyID); err != nil {
+		return fmt.Errorf("%s: %w", opRevokeRefreshTokenFamily, err)
+	}
+
+	return nil
+}
+
+// RevokeToken adds token id (jti) to the denylist until the token expires
+func (s *Storage) RevokeToken(ctx context.Context, jti string, userID int64, expiresAt time.Time) error {
+	stmt, err := s.db.Prepare("INSERT INTO revoked_tokens(jti, user_id, expires_at) VALUES(?, ?, ?) ON CONFLICT DO NOTHING")
+	if err != nil {
+		return fmt.Errorf("%s: %w", opRevokeToken, err)
+	}
+
+	if _, err = stmt.ExecContext(ctx, jti, userID, expiresAt.Unix()); err != nil {
+		return fmt.Errorf("%s: %w", opRevokeToken, err)
+	}
+
+	return nil
+}
+
+// IsTokenRevoked checks if token is in the denylist or was issued before
+// all sessions of its user were revoked
+//
+// Issue and revocation times are compared in milliseconds, so tokens issued
+// right after the revocation stay valid
+func (s *Storage) IsTokenRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	var revoked bool
+
+	stmt, err := s.db.Prepare(`
+		SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = ?)
+			OR EXISTS(SELECT 1 FROM session_revocations WHERE user_id = ? AND revoked_before > ?)`,
+	)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", opIsTokenRevoked, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, jti, userID, issuedAt.UnixMilli())
+	if err = row.Scan(&revoked); err != nil {
+		return false, fmt.Errorf("%s: %w", opIsTokenRevoked, err)
+	}
+
+	return revoked, nil
+}
+
+// RevokeUserSessions revokes all refresh tokens of the user and every access token issued before given time
+func (s *Storage) RevokeUserSessions(ctx context.Context, userID int64, before time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opRevokeUserSessions, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err = revokeUserSessions(ctx, tx, userID, before); err != nil {
+		return fmt.Errorf("%s: %w", opRevokeUserSessions, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", opRevokeUserSessions, err)
+	}
+
+	return nil
+}
+
+// revokeUserSessions revokes sessions of the user within the transaction
+func revokeUserSessions(ctx context.Context, tx *sql.Tx, userID int64, before time.Time) error {
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO session_revocations(user_id, revoked_before) VALUES(?, ?)
+			ON CONFLICT(user_id) DO UPDATE SET revoked_before = excluded.revoked_before`,
+		userID, before.UnixMilli(),
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredTokens removes denylist entries, refresh tokens, password reset
+// and email verification tokens, passwordless logins expired before given time
+//
+// Returns number of deleted rows
+func (s *Storage) DeleteExpiredTokens(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+
+	for _, query := range []string{
+		"DELETE FROM revoked_tokens WHERE expires_at < ?",
+		"DELETE FROM refresh_tokens WHERE expires_at < ?",
+		"DELETE FROM password_reset_tokens WHERE expires_at < ?",
+		"DELETE FROM email_verification_tokens WHERE expires_at < ?",
+		"DELETE FROM passwordless_logins WHERE expires_at < ?",
+	} {
+		res, err := s.db.ExecContext(ctx, query, before.Unix())
+		if err != nil {
+			return deleted, fmt.Errorf("%s: %w", opDeleteExpiredTokens, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return deleted, fmt.Errorf("%s: %w", opDeleteExpiredTokens, err)
+		}
+
+		deleted += n
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,129 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+)
+
+const (
+	opWriteTuples = "storage.sqlite.WriteTuples"
+	opSubjects    = "storage.sqlite.Subjects"
+	opObjectIDs   = "storage.sqlite.ObjectIDs"
+)
+
+// WriteTuples saves writes and deletes deletes in a single transaction
+//
+// Writing a tuple that already exists or deleting a missing one changes nothing
+func (s *Storage) WriteTuples(ctx context.Context, writes []models.RelationTuple, deletes []models.RelationTuple) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opWriteTuples, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, tuple := range deletes {
+		if _, err = tx.ExecContext(ctx, `
+			DELETE FROM relation_tuples
+			WHERE namespace = ? AND object_id = ? AND relation = ?
+				AND subject_namespace = ? AND subject_id = ? AND subject_relation = ?`,
+			tupleArgs(tuple)...,
+		); err != nil {
+			return fmt.Errorf("%s: %w", opWriteTuples, err)
+		}
+	}
+
+	for _, tuple := range writes {
+		if _, err = tx.ExecContext(ctx, `
+			INSERT INTO relation_tuples(namespace, object_id, relation, subject_namespace, subject_id, subject_relation)
+			VALUES(?, ?, ?, ?, ?, ?)
+			ON CONFLICT DO NOTHING`,
+			tupleArgs(tuple)...,
+		); err != nil {
+			return fmt.Errorf("%s: %w", opWriteTuples, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", opWriteTuples, err)
+	}
+
+	return nil
+}
+
+// Subjects returns subjects having the relation to object directly, ordered
+func (s *Storage) Subjects(ctx context.Context, object models.Object, relation string) ([]models.Subject, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT subject_namespace, subject_id, subject_relation
+		FROM relation_tuples
+		WHERE namespace = ? AND object_id = ? AND relation = ?
+		ORDER BY subject_namespace, subject_id, subject_relation`,
+		object.Namespace, object.ID, relation,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opSubjects, err)
+	}
+	defer rows.Close()
+
+	var subjects []models.Subject
+
+	for rows.Next() {
+		var subject models.Subject
+		if err = rows.Scan(&subject.Object.Namespace, &subject.Object.ID, &subject.Relation); err != nil {
+			return nil, fmt.Errorf("%s: %w", opSubjects, err)
+		}
+
+		subjects = append(subjects, subject)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", opSubjects, err)
+	}
+
+	return subjects, nil
+}
+
+// ObjectIDs returns at most limit IDs of objects of the namespace having any relation,
+// ordered and following after
+func (s *Storage) ObjectIDs(ctx context.Context, namespace string, after string, limit int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT object_id FROM relation_tuples
+		WHERE namespace = ? AND object_id > ?
+		ORDER BY object_id
+		LIMIT ?`,
+		namespace, after, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opObjectIDs, err)
+	}
+	defer rows.Close()
+
+	var ids []string
+
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("%s: %w", opObjectIDs, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", opObjectIDs, err)
+	}
+
+	return ids, nil
+}
+
+func tupleArgs(tuple models.RelationTuple) []any {
+	return []any{
+		tuple.Object.Namespace,
+		tuple.Object.ID,
+		tuple.Relation,
+		tuple.Subject.Object.Namespace,
+		tuple.Subject.Object.ID,
+		tuple.Subject.Relation,
+	}
+}
@@ -0,0 +1,72 @@
+package sqlite
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+)
+
+func TestTuples(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	readme := models.Object{Namespace: "document", ID: "readme"}
+	user := models.Subject{Object: models.Object{Namespace: "user", ID: "1"}}
+	eng := models.Subject{Object: models.Object{Namespace: "group", ID: "eng"}, Relation: "member"}
+
+	writes := []models.RelationTuple{
+		{Object: readme, Relation: "viewer", Subject: user},
+		{Object: readme, Relation: "viewer", Subject: eng},
+		{Object: readme, Relation: "viewer", Subject: eng},
+		{Object: models.Object{Namespace: "document", ID: "guide"}, Relation: "owner", Subject: user},
+	}
+	if err := s.WriteTuples(ctx, writes, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	subjects, err := s.Subjects(ctx, readme, "viewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []models.Subject{eng, user}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("subjects = %v, want %v", subjects, want)
+	}
+
+	ids, err := s.ObjectIDs(ctx, "document", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"guide", "readme"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("object IDs = %v, want %v", ids, want)
+	}
+
+	ids, err = s.ObjectIDs(ctx, "document", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"guide"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("first object IDs = %v, want %v", ids, want)
+	}
+
+	ids, err = s.ObjectIDs(ctx, "document", "guide", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"readme"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("object IDs after guide = %v, want %v", ids, want)
+	}
+
+	if err = s.WriteTuples(ctx, nil, writes[1:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	subjects, err = s.Subjects(ctx, readme, "viewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []models.Subject{user}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("subjects after delete = %v, want %v", subjects, want)
+	}
+}
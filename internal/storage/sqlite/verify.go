@@ -0,0 +1,93 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nhassl3/sso/internal/domain/models"
+	"github.com/nhassl3/sso/internal/storage"
+)
+
+const (
+	opSaveVerifyToken        = "storage.sqlite.SaveEmailVerificationToken"
+	opVerifyToken            = "storage.sqlite.EmailVerificationToken"
+	opDeleteVerifyToken      = "storage.sqlite.DeleteEmailVerificationToken"
+	opDeleteUserVerifyTokens = "storage.sqlite.DeleteUserEmailVerificationTokens"
+	opMarkEmailVerified      = "storage.sqlite.MarkEmailVerified"
+)
+
+// SaveEmailVerificationToken saves hashed email verification token
+func (s *Storage) SaveEmailVerificationToken(ctx context.Context, token models.EmailVerificationToken) error {
+	stmt, err := s.db.Prepare("INSERT INTO email_verification_tokens(token_hash, user_id, email, expires_at) VALUES(?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", opSaveVerifyToken, err)
+	}
+
+	if _, err = stmt.ExecContext(ctx, token.TokenHash, token.UserID, token.Email, token.ExpiresAt.Unix()); err != nil {
+		return fmt.Errorf("%s: %w", opSaveVerifyToken, err)
+	}
+
+	return nil
+}
+
+// EmailVerificationToken returns email verification token by its hash
+func (s *Storage) EmailVerificationToken(ctx context.Context, tokenHash string) (models.EmailVerificationToken, error) {
+	var (
+		token     models.EmailVerificationToken
+		expiresAt int64
+	)
+
+	stmt, err := s.db.Prepare("SELECT token_hash, user_id, email, expires_at FROM email_verification_tokens WHERE token_hash = ?")
+	if err != nil {
+		return models.EmailVerificationToken{}, fmt.Errorf("%s: %w", opVerifyToken, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, tokenHash)
+	if err = row.Scan(&token.TokenHash, &token.UserID, &token.Email, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.EmailVerificationToken{}, storage.ErrVerifyTokenNotFound
+		}
+
+		return models.EmailVerificationToken{}, fmt.Errorf("%s: %w", opVerifyToken, err)
+	}
+
+	token.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return token, nil
+}
+
+// DeleteEmailVerificationToken deletes used email verification token
+//
+// If token was already deleted, returns storage.ErrVerifyTokenNotFound
+func (s *Storage) DeleteEmailVerificationToken(ctx context.Context, tokenHash string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM email_verification_tokens WHERE token_hash = ?", tokenHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opDeleteVerifyToken, err)
+	}
+
+	return checkAffected(opDeleteVerifyToken, res, storage.ErrVerifyTokenNotFound)
+}
+
+// DeleteUserEmailVerificationTokens deletes all email verification tokens of the user
+func (s *Storage) DeleteUserEmailVerificationTokens(ctx context.Context, userID int64) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM email_verification_tokens WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("%s: %w", opDeleteUserVerifyTokens, err)
+	}
+
+	return nil
+}
+
+// MarkEmailVerified marks email of the user verified if it's still the given one
+//
+// If there is no such user or their email has changed, returns storage.ErrUserNotFound
+func (s *Storage) MarkEmailVerified(ctx context.Context, userID int64, email string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET email_verified = TRUE WHERE id = ? AND email = ?", userID, email)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opMarkEmailVerified, err)
+	}
+
+	return checkAffected(opMarkEmailVerified, res, storage.ErrUserNotFound)
+}
@@ -3,7 +3,31 @@ package storage
 import "errors"
 
 var (
-	ErrUserExists   = errors.New("user already exists")
-	ErrUserNotFound = errors.New("user not found")
-	ErrAppNotFound  = errors.New("app not found")
+	ErrUserExists              = errors.New("user already exists")
+	ErrUserNotFound            = errors.New("user not found")
+	ErrPasswordHashMismatch    = errors.New("password hash mismatch")
+	ErrAppNotFound             = errors.New("app not found")
+	ErrRefreshTokenNotFound    = errors.New("refresh token not found")
+	ErrRefreshTokenAlreadyUsed = errors.New("refresh token already used")
+	ErrKeyNotFound             = errors.New("signing key not found")
+	ErrResetTokenNotFound      = errors.New("password reset token not found")
+	ErrVerifyTokenNotFound     = errors.New("email verification token not found")
+	ErrPasswordlessNotFound    = errors.New("passwordless login not found")
+	ErrCodeNotFound            = errors.New("authorization code not found")
+	ErrCodeAlreadyUsed         = errors.New("authorization code already used")
+	ErrDeviceCodeNotFound      = errors.New("device code not found")
+	ErrDeviceCodeNotPending    = errors.New("device code is not pending")
+	ErrTOTPNotFound            = errors.New("totp authenticator not found")
+	ErrTOTPStepUsed            = errors.New("totp code already used")
+	ErrMFAChallengeNotFound    = errors.New("mfa challenge not found")
+	ErrRecoveryCodeNotFound    = errors.New("recovery code not found")
+	ErrPasskeyExists           = errors.New("passkey already exists")
+	ErrPasskeyNotFound         = errors.New("passkey not found")
+	ErrPasskeySignCount        = errors.New("passkey signature counter not increased")
+	ErrWebAuthnSessionNotFound = errors.New("webauthn session not found")
+	ErrRoleExists              = errors.New("role already exists")
+	ErrRoleNotFound            = errors.New("role not found")
+	ErrPermissionExists        = errors.New("permission already exists")
+	ErrPermissionNotFound      = errors.New("permission not found")
+	ErrLoginFailuresChanged    = errors.New("login failures changed")
 )
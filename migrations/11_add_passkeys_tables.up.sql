@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS passkeys
+(
+    id           BLOB PRIMARY KEY,
+    user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    public_key   BLOB    NOT NULL,
+    sign_count   INTEGER NOT NULL DEFAULT 0,
+    created_at   INTEGER NOT NULL,
+    last_used_at INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_passkeys_user_id ON passkeys (user_id);
+
+CREATE TABLE IF NOT EXISTS webauthn_sessions
+(
+    challenge_hash     TEXT PRIMARY KEY,
+    ceremony           TEXT    NOT NULL CHECK (ceremony IN ('registration', 'login')),
+    user_id            INTEGER REFERENCES users (id) ON DELETE CASCADE,
+    app_id             INTEGER REFERENCES apps (id) ON DELETE CASCADE,
+    nonce              TEXT    NOT NULL DEFAULT '',
+    mfa_challenge_hash TEXT    NOT NULL DEFAULT '',
+    expires_at         INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_webauthn_sessions_expires_at ON webauthn_sessions (expires_at);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS passwordless_logins
+(
+    id_hash    TEXT PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    app_id     INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    nonce      TEXT    NOT NULL DEFAULT '',
+    code_hash  TEXT    NOT NULL,
+    token_hash TEXT    NOT NULL,
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_passwordless_logins_expires_at ON passwordless_logins (expires_at);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS login_failures
+(
+    subject         TEXT PRIMARY KEY,
+    failures        INTEGER NOT NULL,
+    last_failure_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_login_failures_last_failure_at ON login_failures (last_failure_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_email_normalized;
+ALTER TABLE users DROP COLUMN email_normalized;
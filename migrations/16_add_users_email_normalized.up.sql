@@ -0,0 +1,12 @@
+-- SQL lowercases the domain only, run "go run ./cmd/emails" before the migration to
+-- report collisions and "go run ./cmd/emails --apply" after it to normalize fully.
+-- The service refuses to start until emails are normalized fully.
+-- Emails are split at the last '@', as quoted local part may contain it too
+ALTER TABLE users
+    ADD COLUMN email_normalized TEXT;
+
+UPDATE users
+SET email_normalized = rtrim(trim(email), replace(trim(email), '@', ''))
+    || lower(substr(trim(email), length(rtrim(trim(email), replace(trim(email), '@', ''))) + 1));
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_normalized ON users (email_normalized);
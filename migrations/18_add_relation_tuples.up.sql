@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS relation_tuples
+(
+    namespace         TEXT NOT NULL,
+    object_id         TEXT NOT NULL,
+    relation          TEXT NOT NULL,
+    subject_namespace TEXT NOT NULL,
+    subject_id        TEXT NOT NULL,
+    subject_relation  TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (namespace, object_id, relation, subject_namespace, subject_id, subject_relation)
+);
+CREATE INDEX IF NOT EXISTS idx_relation_tuples_subject
+    ON relation_tuples (subject_namespace, subject_id, subject_relation);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS signing_keys
+(
+    id           TEXT PRIMARY KEY,
+    app_id       INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    algorithm    TEXT    NOT NULL,
+    private_key  BLOB    NOT NULL, -- PKCS #8 PEM encrypted with signing encryption key
+    state        TEXT    NOT NULL CHECK (state IN ('pending', 'active', 'retiring')),
+    created_at   INTEGER NOT NULL,
+    activated_at INTEGER,
+    expires_at   INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_signing_keys_app ON signing_keys (app_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_signing_keys_active ON signing_keys (app_id) WHERE state = 'active';
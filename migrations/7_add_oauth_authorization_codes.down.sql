@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS authorization_codes;
+DROP TABLE IF EXISTS redirect_uris;
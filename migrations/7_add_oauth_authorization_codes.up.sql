@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS redirect_uris
+(
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    uri    TEXT    NOT NULL,
+    PRIMARY KEY (app_id, uri)
+);
+
+CREATE TABLE IF NOT EXISTS authorization_codes
+(
+    code_hash      TEXT PRIMARY KEY,
+    app_id         INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    user_id        INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri   TEXT    NOT NULL,
+    code_challenge TEXT    NOT NULL,
+    scope          TEXT    NOT NULL DEFAULT '',
+    nonce          TEXT    NOT NULL DEFAULT '',
+    auth_time      INTEGER NOT NULL,
+    expires_at     INTEGER NOT NULL,
+    used           BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS idx_authorization_codes_expires_at ON authorization_codes (expires_at);
+
+INSERT INTO redirect_uris (app_id, uri)
+VALUES (1, 'http://localhost:3000/callback')
+ON CONFLICT DO NOTHING;
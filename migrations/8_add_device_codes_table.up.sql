@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS device_codes
+(
+    device_code_hash TEXT PRIMARY KEY,
+    user_code        TEXT    NOT NULL UNIQUE,
+    app_id           INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    scope            TEXT    NOT NULL DEFAULT '',
+    status           TEXT    NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'denied', 'redeemed')),
+    user_id          INTEGER REFERENCES users (id) ON DELETE CASCADE,
+    auth_time        INTEGER,
+    poll_interval    INTEGER NOT NULL,
+    last_polled_at   INTEGER NOT NULL DEFAULT 0,
+    expires_at       INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_device_codes_expires_at ON device_codes (expires_at);